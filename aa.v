@@ -0,0 +1,178 @@
+module wasm96
+
+// Anti-aliased (Wu-style) lines and circles.
+//
+// Each pixel touched by the shape gets a coverage value. In .blend mode that
+// becomes the pixel's alpha, which suits 32-bit (XRGB8888) output; in .dither
+// mode coverage is turned into an ordered-dither pattern of fully opaque
+// pixels, which holds up better on RGB565 where blended edges band.
+
+// How partial coverage is drawn.
+pub enum AaMode {
+	blend
+	dither
+}
+
+struct AaPlotter {
+mut:
+	xs  []int
+	ys  []int
+	cov []f32
+}
+
+__global aa_plots AaPlotter
+
+fn (mut p AaPlotter) plot(x int, y int, c f32) {
+	if c <= 0 {
+		return
+	}
+	p.xs << x
+	p.ys << y
+	p.cov << if c > 1 { f32(1) } else { c }
+}
+
+fn (mut p AaPlotter) reset() {
+	p.xs.clear()
+	p.ys.clear()
+	p.cov.clear()
+}
+
+fn fpart(x f32) f32 {
+	return x - floorf(x)
+}
+
+fn (mut p AaPlotter) line(ax f32, ay f32, bx f32, by f32) {
+	mut x0, mut y0, mut x1, mut y1 := ax, ay, bx, by
+	steep := absf(y1 - y0) > absf(x1 - x0)
+	if steep {
+		x0, y0 = y0, x0
+		x1, y1 = y1, x1
+	}
+	if x0 > x1 {
+		x0, x1 = x1, x0
+		y0, y1 = y1, y0
+	}
+	dx := x1 - x0
+	gradient := if dx == 0 { f32(1) } else { (y1 - y0) / dx }
+	// First endpoint.
+	mut xend := floorf(x0 + 0.5)
+	mut yend := y0 + gradient * (xend - x0)
+	mut xgap := 1 - fpart(x0 + 0.5)
+	xpxl1 := int(xend)
+	p.plot_pair(xpxl1, yend, xgap, steep)
+	mut intery := yend + gradient
+	// Second endpoint.
+	xend = floorf(x1 + 0.5)
+	yend = y1 + gradient * (xend - x1)
+	xgap = fpart(x1 + 0.5)
+	xpxl2 := int(xend)
+	if xpxl2 != xpxl1 {
+		p.plot_pair(xpxl2, yend, xgap, steep)
+	}
+	for x in xpxl1 + 1 .. xpxl2 {
+		p.plot_pair(x, intery, 1, steep)
+		intery += gradient
+	}
+}
+
+// Plot the two pixels straddling y at column x.
+fn (mut p AaPlotter) plot_pair(x int, y f32, weight f32, steep bool) {
+	iy := int(floorf(y))
+	f := fpart(y)
+	if steep {
+		p.plot(iy, x, (1 - f) * weight)
+		p.plot(iy + 1, x, f * weight)
+	} else {
+		p.plot(x, iy, (1 - f) * weight)
+		p.plot(x, iy + 1, f * weight)
+	}
+}
+
+fn (mut p AaPlotter) circle(cx f32, cy f32, r f32) {
+	if r <= 0 {
+		return
+	}
+	// Walk one octant and mirror it; the other axis is covered by transposing.
+	limit := int(floorf(r * 0.70710678)) + 1
+	for i in 0 .. limit {
+		x := f32(i)
+		y := sqrtf(r * r - x * x)
+		iy := floorf(y)
+		f := y - iy
+		for sx in [f32(-1), 1] {
+			for sy in [f32(-1), 1] {
+				if sx < 0 && i == 0 {
+					continue
+				}
+				// Inner pixel gets 1 - f, the outer one f.
+				p.plot(int(floorf(cx + sx * x)), int(floorf(cy + sy * iy)), 1 - f)
+				p.plot(int(floorf(cx + sx * x)), int(floorf(cy + sy * (iy + 1))), f)
+				p.plot(int(floorf(cx + sy * iy)), int(floorf(cy + sx * x)), 1 - f)
+				p.plot(int(floorf(cx + sy * (iy + 1))), int(floorf(cy + sx * x)), f)
+			}
+		}
+	}
+}
+
+// Draw the collected plots on screen with the current color.
+fn (p &AaPlotter) draw(mode AaMode) {
+	saved := current_color
+	for i in 0 .. p.xs.len {
+		x := p.xs[i]
+		y := p.ys[i]
+		if mode == .dither {
+			if p.cov[i] * 16 > f32(dither_bayer4[(y & 3) * 4 + (x & 3)]) + 0.5 {
+				graphics_point(x, y)
+			}
+			continue
+		}
+		graphics_set_color(saved[0], saved[1], saved[2], u8(f32(saved[3]) * p.cov[i]))
+		graphics_point(x, y)
+	}
+	if mode == .blend {
+		graphics_set_color(saved[0], saved[1], saved[2], saved[3])
+	}
+}
+
+// Blend the collected plots into an image.
+fn (p &AaPlotter) draw_image(mut img Image, color Color, mode AaMode) {
+	for i in 0 .. p.xs.len {
+		x := p.xs[i]
+		y := p.ys[i]
+		if mode == .dither {
+			if p.cov[i] * 16 > f32(dither_bayer4[(y & 3) * 4 + (x & 3)]) + 0.5 {
+				img.blend(x, y, color)
+			}
+			continue
+		}
+		img.blend(x, y, Color{color.r, color.g, color.b, u8(f32(color.a) * p.cov[i])})
+	}
+}
+
+// Draw an anti-aliased line with the current color.
+pub fn graphics_line_aa(x0 f32, y0 f32, x1 f32, y1 f32, mode AaMode) {
+	aa_plots.reset()
+	aa_plots.line(x0, y0, x1, y1)
+	aa_plots.draw(mode)
+}
+
+// Draw an anti-aliased circle outline with the current color.
+pub fn graphics_circle_aa(cx f32, cy f32, r f32, mode AaMode) {
+	aa_plots.reset()
+	aa_plots.circle(cx, cy, r)
+	aa_plots.draw(mode)
+}
+
+// Draw an anti-aliased line into the image.
+pub fn (mut img Image) line_aa(x0 f32, y0 f32, x1 f32, y1 f32, color Color, mode AaMode) {
+	aa_plots.reset()
+	aa_plots.line(x0, y0, x1, y1)
+	aa_plots.draw_image(mut img, color, mode)
+}
+
+// Draw an anti-aliased circle outline into the image.
+pub fn (mut img Image) circle_aa(cx f32, cy f32, r f32, color Color, mode AaMode) {
+	aa_plots.reset()
+	aa_plots.circle(cx, cy, r)
+	aa_plots.draw_image(mut img, color, mode)
+}
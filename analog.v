@@ -0,0 +1,109 @@
+module wasm96
+
+// Analog sticks with deadzone and response shaping.
+//
+// The host reports each stick axis as libretro does, from -32768 to 32767.
+// The shaped accessors turn that into -1 to 1 through an AnalogConfig per
+// axis: a deadzone that ignores drift around the center, an optional
+// anti-deadzone that skips past a game's own dead range, a saturation point
+// so worn sticks still reach full deflection, and a response curve for finer
+// control near the center.
+
+// Analog sticks on a controller.
+pub enum AnalogStick as u32 {
+	left
+	right
+}
+
+// Axes of an analog stick.
+pub enum AnalogAxis as u32 {
+	x
+	y
+}
+
+// How deflection maps to output once past the deadzone.
+pub enum AnalogCurve {
+	linear
+	// Blend of linear and cubic by expo: gentler near the center.
+	exponential
+}
+
+// Shaping applied to one analog axis.
+pub struct AnalogConfig {
+pub mut:
+	// Fraction of the range around the center read as 0.
+	deadzone f32 = 0.15
+	// Smallest output magnitude once outside the deadzone.
+	anti_deadzone f32
+	// Fraction of the range at which output reaches 1.
+	saturation f32 = 1
+	curve      AnalogCurve = .linear
+	// Cubic share of the exponential curve, 0 to 1.
+	expo f32 = 0.5
+}
+
+const analog_ports = 4
+
+__global analog_configs []AnalogConfig
+
+fn analog_config_index(port u32, stick AnalogStick, axis AnalogAxis) int {
+	if analog_configs.len == 0 {
+		analog_configs = []AnalogConfig{len: analog_ports * 4}
+	}
+	if port >= analog_ports {
+		return -1
+	}
+	return int(port) * 4 + int(stick) * 2 + int(axis)
+}
+
+// Set the shaping for both axes of a stick on port (ports 0 to 3).
+pub fn input_set_analog_config(port u32, stick AnalogStick, cfg AnalogConfig) {
+	input_set_analog_axis_config(port, stick, .x, cfg)
+	input_set_analog_axis_config(port, stick, .y, cfg)
+}
+
+// Set the shaping for one axis.
+pub fn input_set_analog_axis_config(port u32, stick AnalogStick, axis AnalogAxis, cfg AnalogConfig) {
+	i := analog_config_index(port, stick, axis)
+	if i >= 0 {
+		analog_configs[i] = cfg
+	}
+}
+
+// Get the unshaped position of an axis, -32768 to 32767. 0 if the host has
+// no analog input.
+pub fn input_get_analog_raw(port u32, stick AnalogStick, axis AnalogAxis) int {
+	if !compat_require(.analog) {
+		return 0
+	}
+	return C.wasm96_input_get_analog(port, u32(stick), u32(axis))
+}
+
+// Get the shaped position of an axis, -1 to 1 (right and down positive).
+pub fn input_get_analog(port u32, stick AnalogStick, axis AnalogAxis) f32 {
+	raw := input_get_analog_raw(port, stick, axis)
+	i := analog_config_index(port, stick, axis)
+	cfg := if i >= 0 { analog_configs[i] } else { AnalogConfig{} }
+	return cfg.apply(f32(raw) / 32767)
+}
+
+// Get the shaped x and y of a stick.
+pub fn input_get_stick(port u32, stick AnalogStick) (f32, f32) {
+	return input_get_analog(port, stick, .x), input_get_analog(port, stick, .y)
+}
+
+// Shape a raw axis value in -1 to 1.
+pub fn (cfg &AnalogConfig) apply(v f32) f32 {
+	a := absf(v)
+	if a <= cfg.deadzone {
+		return 0
+	}
+	span := cfg.saturation - cfg.deadzone
+	mut t := if span > 0 { clampf((a - cfg.deadzone) / span, 0, 1) } else { f32(1) }
+	if cfg.curve == .exponential {
+		k := clampf(cfg.expo, 0, 1)
+		t = (1 - k) * t + k * t * t * t
+	}
+	t = cfg.anti_deadzone + (1 - cfg.anti_deadzone) * t
+	return if v < 0 { -t } else { t }
+}
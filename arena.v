@@ -0,0 +1,104 @@
+module wasm96
+
+// Per-frame bump allocator.
+
+// A bump allocator over a fixed buffer. Everything allocated from an arena
+// is released at once by reset, so per-frame temporaries never reach the GC.
+pub struct Arena {
+mut:
+	buf    []u8
+	offset int
+	peak   int
+}
+
+// Create an arena with size bytes of backing storage.
+pub fn new_arena(size int) Arena {
+	return Arena{
+		buf: []u8{len: size}
+	}
+}
+
+fn arena_align(size usize) int {
+	return if size % 8 == 0 {
+		8
+	} else if size % 4 == 0 {
+		4
+	} else if size % 2 == 0 {
+		2
+	} else {
+		1
+	}
+}
+
+fn (mut a Arena) bump(size int, align int) voidptr {
+	base := usize(a.buf.data)
+	start := (base + usize(a.offset) + usize(align - 1)) & ~usize(align - 1)
+	offset := int(start - base)
+	if offset + size > a.buf.len {
+		panic('arena: out of memory (${size} bytes requested, ${a.buf.len - a.offset} free)')
+	}
+	a.offset = offset + size
+	if a.offset > a.peak {
+		a.peak = a.offset
+	}
+	p := unsafe { voidptr(start) }
+	unsafe { vmemset(p, 0, size) }
+	return p
+}
+
+// Allocate a zeroed value of type T.
+pub fn (mut a Arena) alloc[T]() &T {
+	p := a.bump(int(sizeof(T)), arena_align(sizeof(T)))
+	return unsafe { &T(p) }
+}
+
+// Allocate a zeroed slice of n values of type T.
+// The slice cannot grow; appending to it panics.
+pub fn (mut a Arena) alloc_slice[T](n int) []T {
+	p := a.bump(int(sizeof(T)) * n, arena_align(sizeof(T)))
+	mut s := []T{}
+	unsafe {
+		s.data = p
+		s.len = n
+		s.cap = n
+	}
+	s.flags.set(.noslices | .nogrow | .nofree)
+	return s
+}
+
+// Release everything allocated from the arena.
+pub fn (mut a Arena) reset() {
+	a.offset = 0
+}
+
+// Get the number of bytes currently allocated.
+pub fn (a &Arena) used() int {
+	return a.offset
+}
+
+// Get the highest number of bytes allocated since the arena was created.
+pub fn (a &Arena) peak() int {
+	return a.peak
+}
+
+// Get the size of the backing buffer in bytes.
+pub fn (a &Arena) capacity() int {
+	return a.buf.len
+}
+
+__global frame_arena_state Arena
+
+// Allocate the shared per-frame arena with size bytes of storage.
+pub fn frame_arena_init(size int) {
+	frame_arena_state = new_arena(size)
+}
+
+// Get the shared per-frame arena.
+pub fn frame_arena() &Arena {
+	return &frame_arena_state
+}
+
+// Reset the shared per-frame arena. Call at the start of every frame.
+pub fn frame_arena_reset() {
+	frame_arena_state.reset()
+}
@@ -0,0 +1,411 @@
+module wasm96
+
+// Aseprite (.ase/.aseprite) loader.
+//
+// Visible layers are flattened with normal blending into one frame per
+// column of the atlas image. Tags become animations, slices keep their keys.
+// Tilemap layers and blend modes other than normal are not supported.
+
+const ase_magic = u16(0xa5e0)
+const ase_frame_magic = u16(0xf1fa)
+
+const ase_chunk_old_palette = u16(0x0004)
+const ase_chunk_layer = u16(0x2004)
+const ase_chunk_cel = u16(0x2005)
+const ase_chunk_tags = u16(0x2018)
+const ase_chunk_palette = u16(0x2019)
+const ase_chunk_slice = u16(0x2022)
+
+struct AseLayer {
+	name    string
+	visible bool
+	group   bool
+	level   int
+	opacity u8
+}
+
+struct AseCel {
+	layer   int
+	frame   int
+	x       int
+	y       int
+	opacity u8
+	image   Image
+}
+
+struct AseReader {
+	data []u8
+mut:
+	pos int
+}
+
+fn (mut r AseReader) need(n int) ! {
+	if r.pos + n > r.data.len {
+		return error('aseprite: unexpected end of data')
+	}
+}
+
+fn (mut r AseReader) read_u8() !u8 {
+	r.need(1)!
+	r.pos++
+	return r.data[r.pos - 1]
+}
+
+fn (mut r AseReader) read_u16() !u16 {
+	r.need(2)!
+	v := u16(r.data[r.pos]) | u16(r.data[r.pos + 1]) << 8
+	r.pos += 2
+	return v
+}
+
+fn (mut r AseReader) read_i16() !int {
+	return int(i16(r.read_u16()!))
+}
+
+fn (mut r AseReader) read_u32() !u32 {
+	r.need(4)!
+	v := u32(r.data[r.pos]) | u32(r.data[r.pos + 1]) << 8 | u32(r.data[r.pos + 2]) << 16 | u32(r.data[
+		r.pos + 3]) << 24
+	r.pos += 4
+	return v
+}
+
+fn (mut r AseReader) read_i32() !int {
+	return int(i32(r.read_u32()!))
+}
+
+fn (mut r AseReader) bytes(n int) ![]u8 {
+	r.need(n)!
+	r.pos += n
+	return r.data[r.pos - n..r.pos]
+}
+
+fn (mut r AseReader) read_str() !string {
+	n := int(r.read_u16()!)
+	return r.bytes(n)!.bytestr()
+}
+
+// Load an Aseprite file into an atlas, flattening all visible layers.
+pub fn aseprite_load(data []u8) !Atlas {
+	return aseprite_load_layers(data, [])
+}
+
+// Load an Aseprite file into an atlas, flattening only the named layers
+// (or every visible layer if names is empty). Useful for splitting a sprite
+// into parts drawn separately.
+pub fn aseprite_load_layers(data []u8, names []string) !Atlas {
+	mut r := AseReader{
+		data: data
+	}
+	r.need(128)!
+	r.pos = 4
+	if r.read_u16()! != ase_magic {
+		return error('aseprite: bad magic number')
+	}
+	frame_count := int(r.read_u16()!)
+	width := int(r.read_u16()!)
+	height := int(r.read_u16()!)
+	depth := int(r.read_u16()!)
+	flags := r.read_u32()!
+	if depth !in [8, 16, 32] {
+		return error('aseprite: unsupported color depth ${depth}')
+	}
+	r.pos = 28
+	transparent := r.read_u8()!
+	r.pos = 128
+	layer_opacity := flags & 1 != 0
+
+	mut palette := []Color{len: 256}
+	mut has_palette := false
+	mut layers := []AseLayer{}
+	mut cels := []AseCel{}
+	mut atlas := Atlas{
+		image: new_image(width * frame_count, height)
+	}
+	for frame in 0 .. frame_count {
+		frame_start := r.pos
+		frame_size := int(r.read_u32()!)
+		if r.read_u16()! != ase_frame_magic {
+			return error('aseprite: bad frame magic in frame ${frame}')
+		}
+		old_chunks := int(r.read_u16()!)
+		duration := int(r.read_u16()!)
+		r.pos += 2
+		new_chunks := int(r.read_u32()!)
+		chunks := if new_chunks != 0 { new_chunks } else { old_chunks }
+		atlas.frames << AtlasFrame{
+			name: 'frame ${frame}'
+			x: frame * width
+			y: 0
+			w: width
+			h: height
+			duration_ms: duration
+		}
+		for _ in 0 .. chunks {
+			chunk_start := r.pos
+			chunk_size := int(r.read_u32()!)
+			kind := r.read_u16()!
+			if chunk_size < 6 {
+				return error('aseprite: bad chunk size')
+			}
+			r.need(chunk_size - 6)!
+			chunk_end := chunk_start + chunk_size
+			match kind {
+				ase_chunk_old_palette {
+					if !has_palette {
+						ase_old_palette(mut r, mut palette)!
+					}
+				}
+				ase_chunk_palette {
+					ase_palette(mut r, mut palette)!
+					has_palette = true
+				}
+				ase_chunk_layer {
+					layer_flags := r.read_u16()!
+					layer_type := r.read_u16()!
+					level := int(r.read_u16()!)
+					r.pos += 6
+					opacity := r.read_u8()!
+					r.pos += 3
+					layers << AseLayer{
+						name: r.read_str()!
+						visible: layer_flags & 1 != 0
+						group: layer_type == 1
+						level: level
+						opacity: if layer_opacity { opacity } else { 255 }
+					}
+				}
+				ase_chunk_cel {
+					cel := ase_cel(mut r, frame, chunk_end, depth, cels)!
+					if cel.layer >= 0 {
+						cels << cel
+					}
+				}
+				ase_chunk_tags {
+					count := int(r.read_u16()!)
+					r.pos += 8
+					for _ in 0 .. count {
+						from := int(r.read_u16()!)
+						to := int(r.read_u16()!)
+						dir := r.read_u8()!
+						repeat := int(r.read_u16()!)
+						r.pos += 10
+						name := r.read_str()!
+						mut anim := Animation{
+							name: name
+							direction: match dir {
+								1 { AnimDirection.reverse }
+								2 { AnimDirection.ping_pong }
+								3 { AnimDirection.ping_pong_reverse }
+								else { AnimDirection.forward }
+							}
+							repeat: repeat
+						}
+						for i in from .. to + 1 {
+							anim.frames << i
+						}
+						atlas.animations[name] = anim
+					}
+				}
+				ase_chunk_slice {
+					ase_slice(mut r, mut atlas)!
+				}
+				else {}
+			}
+			r.pos = chunk_end
+		}
+		r.pos = frame_start + frame_size
+	}
+
+	// Work out which layers to draw; children of hidden groups are hidden.
+	mut draw := []bool{len: layers.len}
+	mut parents := []bool{len: 16, init: true}
+	for i, l in layers {
+		if l.level + 1 >= parents.len {
+			parents << []bool{len: l.level + 2 - parents.len, init: true}
+		}
+		shown := l.visible && parents[l.level]
+		parents[l.level + 1] = shown
+		draw[i] = shown && !l.group && (names.len == 0 || l.name in names)
+		atlas.layers << l.name
+	}
+	// Composite bottom layer first, whatever order the cels were stored in.
+	for li, l in layers {
+		if !draw[li] {
+			continue
+		}
+		for cel in cels {
+			if cel.layer != li {
+				continue
+			}
+			opacity := u32(cel.opacity) * u32(l.opacity) / 255
+			img := ase_to_rgba(cel.image, depth, palette, transparent, u8(opacity))
+			// Clip to the frame so cels don't spill into their neighbours.
+			x0 := max_int(0, -cel.x)
+			x1 := min_int(img.width, width - cel.x)
+			if x0 < x1 {
+				atlas.image.blit_region(img, x0, 0, x1 - x0, img.height, cel.frame * width +
+					cel.x + x0, cel.y)
+			}
+		}
+	}
+	return atlas
+}
+
+fn ase_old_palette(mut r AseReader, mut palette []Color) ! {
+	packets := int(r.read_u16()!)
+	mut index := 0
+	for _ in 0 .. packets {
+		index += int(r.read_u8()!)
+		mut count := int(r.read_u8()!)
+		if count == 0 {
+			count = 256
+		}
+		for _ in 0 .. count {
+			rgb := r.bytes(3)!
+			if index < palette.len {
+				palette[index] = Color{rgb[0], rgb[1], rgb[2], 255}
+			}
+			index++
+		}
+	}
+}
+
+fn ase_palette(mut r AseReader, mut palette []Color) ! {
+	r.pos += 4
+	first := int(r.read_u32()!)
+	last := int(r.read_u32()!)
+	r.pos += 8
+	for i in first .. last + 1 {
+		entry_flags := r.read_u16()!
+		c := r.bytes(4)!
+		if entry_flags & 1 != 0 {
+			r.read_str()!
+		}
+		if i < palette.len {
+			palette[i] = Color{c[0], c[1], c[2], c[3]}
+		}
+	}
+}
+
+// Read a cel. The image keeps the file's pixel format until flattening.
+// Cels that can't be drawn come back with a layer of -1.
+fn ase_cel(mut r AseReader, frame int, end int, depth int, cels []AseCel) !AseCel {
+	layer := int(r.read_u16()!)
+	x := r.read_i16()!
+	y := r.read_i16()!
+	opacity := r.read_u8()!
+	kind := r.read_u16()!
+	r.pos += 7
+	bpp := depth / 8
+	match kind {
+		0, 2 {
+			w := int(r.read_u16()!)
+			h := int(r.read_u16()!)
+			raw := if kind == 0 {
+				r.bytes(w * h * bpp)!
+			} else {
+				zlib_decompress(r.data[r.pos..end])!
+			}
+			if raw.len < w * h * bpp {
+				return error('aseprite: cel data too short')
+			}
+			return AseCel{
+				layer: layer
+				frame: frame
+				x: x
+				y: y
+				opacity: opacity
+				image: Image{
+					width: w
+					height: h
+					pixels: raw[..w * h * bpp]
+				}
+			}
+		}
+		1 {
+			// Linked cel: reuse the image of the same layer in another frame.
+			target := int(r.read_u16()!)
+			for c in cels {
+				if c.layer == layer && c.frame == target {
+					return AseCel{
+						...c
+						frame: frame
+						x: x
+						y: y
+						opacity: opacity
+					}
+				}
+			}
+			return AseCel{
+				layer: -1
+			}
+		}
+		else {
+			return AseCel{
+				layer: -1
+			}
+		}
+	}
+}
+
+// Convert cel pixels to RGBA, applying opacity.
+fn ase_to_rgba(src Image, depth int, palette []Color, transparent u8, opacity u8) Image {
+	mut out := new_image(src.width, src.height)
+	for i in 0 .. src.width * src.height {
+		mut c := Color{}
+		match depth {
+			32 {
+				c = Color{src.pixels[i * 4], src.pixels[i * 4 + 1], src.pixels[i * 4 + 2], src.pixels[
+					i * 4 + 3]}
+			}
+			16 {
+				v := src.pixels[i * 2]
+				c = Color{v, v, v, src.pixels[i * 2 + 1]}
+			}
+			else {
+				index := src.pixels[i]
+				c = if index == transparent { Color{
+					a: 0
+				} } else { palette[index] }
+			}
+		}
+		if opacity != 255 {
+			c.a = u8(u32(c.a) * u32(opacity) / 255)
+		}
+		out.pixels[i * 4] = c.r
+		out.pixels[i * 4 + 1] = c.g
+		out.pixels[i * 4 + 2] = c.b
+		out.pixels[i * 4 + 3] = c.a
+	}
+	return out
+}
+
+fn ase_slice(mut r AseReader, mut atlas Atlas) ! {
+	keys := int(r.read_u32()!)
+	slice_flags := r.read_u32()!
+	r.pos += 4
+	name := r.read_str()!
+	for _ in 0 .. keys {
+		mut s := AtlasSlice{
+			name: name
+			frame: int(r.read_u32()!)
+			x: r.read_i32()!
+			y: r.read_i32()!
+			w: int(r.read_u32()!)
+			h: int(r.read_u32()!)
+		}
+		if slice_flags & 1 != 0 {
+			s.center_x = r.read_i32()!
+			s.center_y = r.read_i32()!
+			s.center_w = int(r.read_u32()!)
+			s.center_h = int(r.read_u32()!)
+		}
+		if slice_flags & 2 != 0 {
+			s.has_pivot = true
+			s.pivot_x = r.read_i32()!
+			s.pivot_y = r.read_i32()!
+		}
+		atlas.slices << s
+	}
+}
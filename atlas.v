@@ -0,0 +1,200 @@
+module wasm96
+
+// Sprite atlases and frame animations.
+
+// A named rectangle in an atlas image.
+pub struct AtlasFrame {
+pub mut:
+	name        string
+	x           int
+	y           int
+	w           int
+	h           int
+	duration_ms int = 100
+}
+
+// A named region of a sprite (hitboxes, pivots, 9-patch borders).
+pub struct AtlasSlice {
+pub mut:
+	name  string
+	frame int
+	x     int
+	y     int
+	w     int
+	h     int
+	// 9-patch center, relative to the slice. Zero size when unset.
+	center_x int
+	center_y int
+	center_w int
+	center_h int
+	// Pivot, relative to the slice.
+	has_pivot bool
+	pivot_x   int
+	pivot_y   int
+}
+
+// How an animation steps through its frames.
+pub enum AnimDirection {
+	forward
+	reverse
+	ping_pong
+	ping_pong_reverse
+}
+
+// A sequence of atlas frames.
+pub struct Animation {
+pub mut:
+	name      string
+	frames    []int
+	direction AnimDirection
+	// Number of times to play; 0 loops forever.
+	repeat int
+}
+
+// An image with named frames, animations and slices.
+pub struct Atlas {
+pub mut:
+	image      Image
+	frames     []AtlasFrame
+	animations map[string]Animation
+	slices     []AtlasSlice
+	layers     []string
+}
+
+// Get the index of the frame named name.
+pub fn (a &Atlas) frame_index(name string) ?int {
+	for i, f in a.frames {
+		if f.name == name {
+			return i
+		}
+	}
+	return none
+}
+
+// Get the slice named name for a frame. Slices keep their last key until
+// the next one, so the closest earlier key is returned.
+pub fn (a &Atlas) slice(name string, frame int) ?AtlasSlice {
+	mut found := -1
+	for i, s in a.slices {
+		if s.name == name && s.frame <= frame && (found < 0 || s.frame >= a.slices[found].frame) {
+			found = i
+		}
+	}
+	if found < 0 {
+		return none
+	}
+	return a.slices[found]
+}
+
+// Draw a frame at (x, y).
+pub fn (a &Atlas) draw_frame(index int, x int, y int) {
+	if index < 0 || index >= a.frames.len {
+		return
+	}
+	f := a.frames[index]
+	a.image.draw_region(x, y, f.x, f.y, f.w, f.h)
+}
+
+// Plays an animation from an atlas.
+pub struct AnimationPlayer {
+pub mut:
+	anim     Animation
+	speed    f32 = 1.0
+	paused   bool
+	finished bool
+mut:
+	step    int
+	dir     int = 1
+	elapsed f32
+	plays   int
+}
+
+// Create a player for an animation of an atlas.
+pub fn (a &Atlas) player(name string) ?AnimationPlayer {
+	anim := a.animations[name] or { return none }
+	mut p := AnimationPlayer{}
+	p.play(anim)
+	return p
+}
+
+// Start an animation from its first frame.
+pub fn (mut p AnimationPlayer) play(anim Animation) {
+	p.anim = anim
+	p.finished = false
+	p.elapsed = 0
+	p.plays = 0
+	match anim.direction {
+		.forward, .ping_pong {
+			p.step = 0
+			p.dir = 1
+		}
+		.reverse, .ping_pong_reverse {
+			p.step = anim.frames.len - 1
+			p.dir = -1
+		}
+	}
+}
+
+// Get the atlas frame index to draw.
+pub fn (p &AnimationPlayer) frame() int {
+	if p.anim.frames.len == 0 {
+		return 0
+	}
+	return p.anim.frames[p.step]
+}
+
+// Advance by dt milliseconds using the frame durations of atlas.
+pub fn (mut p AnimationPlayer) update(atlas &Atlas, dt f32) {
+	n := p.anim.frames.len
+	if p.paused || p.finished || n == 0 {
+		return
+	}
+	p.elapsed += dt * p.speed
+	for {
+		d := atlas.frames[p.frame()].duration_ms
+		if d <= 0 || p.elapsed < f32(d) {
+			return
+		}
+		p.elapsed -= f32(d)
+		p.advance()
+		if p.finished {
+			return
+		}
+	}
+}
+
+fn (mut p AnimationPlayer) advance() {
+	n := p.anim.frames.len
+	next := p.step + p.dir
+	ping_pong := p.anim.direction in [.ping_pong, .ping_pong_reverse]
+	if next >= 0 && next < n {
+		p.step = next
+		return
+	}
+	if ping_pong {
+		p.dir = -p.dir
+		// A ping-pong cycle ends back where it started.
+		started_forward := p.anim.direction == .ping_pong
+		if (p.dir == 1) == started_forward && !p.end_cycle() {
+			return
+		}
+		if n > 1 {
+			p.step += p.dir
+		}
+		return
+	}
+	if !p.end_cycle() {
+		return
+	}
+	p.step = if p.dir == 1 { 0 } else { n - 1 }
+}
+
+// Count a completed play; returns false once the repeat count is used up.
+fn (mut p AnimationPlayer) end_cycle() bool {
+	p.plays++
+	if p.anim.repeat > 0 && p.plays >= p.anim.repeat {
+		p.finished = true
+		return false
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+module wasm96
+
+// Base64 decoding for embedded asset data.
+
+fn base64_value(c u8) int {
+	return match true {
+		c >= `A` && c <= `Z` { int(c - `A`) }
+		c >= `a` && c <= `z` { int(c - `a`) + 26 }
+		c >= `0` && c <= `9` { int(c - `0`) + 52 }
+		c == `+` || c == `-` { 62 }
+		c == `/` || c == `_` { 63 }
+		else { -1 }
+	}
+}
+
+// Decode standard or URL-safe base64. Whitespace is skipped and padding is
+// optional.
+pub fn base64_decode(s string) ![]u8 {
+	mut out := []u8{cap: s.len * 3 / 4}
+	mut acc := u32(0)
+	mut bits := 0
+	for i in 0 .. s.len {
+		c := s[i]
+		if c == `=` {
+			break
+		}
+		if c == ` ` || c == `\n` || c == `\r` || c == `\t` {
+			continue
+		}
+		v := base64_value(c)
+		if v < 0 {
+			return error('base64: invalid character at ${i}')
+		}
+		acc = acc << 6 | u32(v)
+		bits += 6
+		if bits >= 8 {
+			bits -= 8
+			out << u8(acc >> bits)
+		}
+	}
+	return out
+}
@@ -0,0 +1,140 @@
+module wasm96
+
+// Batched host-call command buffer.
+//
+// While a batch is open, the simple drawing calls (colors, points, lines,
+// rects, circles, triangles, curves and pills) are recorded into a buffer of
+// u32 words instead of calling the host, and the whole buffer is handed to
+// wasm96_batch_submit in one call. Calls that cannot be recorded (images,
+// text, 3D) flush the batch first so drawing order is preserved. Input and
+// other queries always call the host directly because their results are
+// needed immediately. Hosts without the batch feature get the commands
+// replayed one import at a time.
+//
+// Each command is an opcode word followed by its arguments in the order of
+// the matching graphics_* function. Signed coordinates are stored as their
+// two's complement bit pattern.
+
+// Opcodes of recorded batch commands.
+pub enum BatchOp as u32 {
+	set_color = 1
+	background = 2
+	point = 3
+	line = 4
+	rect = 5
+	rect_outline = 6
+	circle = 7
+	circle_outline = 8
+	triangle = 9
+	triangle_outline = 10
+	bezier_quadratic = 11
+	bezier_cubic = 12
+	pill = 13
+	pill_outline = 14
+}
+
+const batch_max_words = 4096
+
+struct Batch {
+mut:
+	active bool
+	words  []u32 = []u32{cap: batch_max_words}
+}
+
+__global batch Batch
+
+// Start recording drawing calls.
+pub fn batch_begin() {
+	batch.active = true
+}
+
+// Submit the recorded commands and stop recording.
+pub fn batch_end() {
+	batch_flush()
+	batch.active = false
+}
+
+// Returns true while drawing calls are being recorded.
+pub fn batch_active() bool {
+	return batch.active
+}
+
+// Submit the recorded commands now without closing the batch.
+pub fn batch_flush() {
+	if batch.words.len == 0 {
+		return
+	}
+	if compat_require(.batch) {
+		C.wasm96_batch_submit(&batch.words[0], usize(batch.words.len))
+	} else {
+		compat_batch_replay(batch.words)
+	}
+	batch.words.clear()
+}
+
+fn (mut b Batch) reserve(words int) {
+	if b.words.len + words > batch_max_words {
+		batch_flush()
+	}
+}
+
+fn (mut b Batch) push2(op BatchOp, a0 u32, a1 u32) {
+	b.reserve(3)
+	b.words << u32(op)
+	b.words << a0
+	b.words << a1
+}
+
+fn (mut b Batch) push3(op BatchOp, a0 u32, a1 u32, a2 u32) {
+	b.reserve(4)
+	b.words << u32(op)
+	b.words << a0
+	b.words << a1
+	b.words << a2
+}
+
+fn (mut b Batch) push4(op BatchOp, a0 u32, a1 u32, a2 u32, a3 u32) {
+	b.reserve(5)
+	b.words << u32(op)
+	b.words << a0
+	b.words << a1
+	b.words << a2
+	b.words << a3
+}
+
+fn (mut b Batch) push6(op BatchOp, a0 u32, a1 u32, a2 u32, a3 u32, a4 u32, a5 u32) {
+	b.reserve(7)
+	b.words << u32(op)
+	b.words << a0
+	b.words << a1
+	b.words << a2
+	b.words << a3
+	b.words << a4
+	b.words << a5
+}
+
+fn (mut b Batch) push7(op BatchOp, a0 u32, a1 u32, a2 u32, a3 u32, a4 u32, a5 u32, a6 u32) {
+	b.reserve(8)
+	b.words << u32(op)
+	b.words << a0
+	b.words << a1
+	b.words << a2
+	b.words << a3
+	b.words << a4
+	b.words << a5
+	b.words << a6
+}
+
+fn (mut b Batch) push9(op BatchOp, a0 u32, a1 u32, a2 u32, a3 u32, a4 u32, a5 u32, a6 u32, a7 u32, a8 u32) {
+	b.reserve(10)
+	b.words << u32(op)
+	b.words << a0
+	b.words << a1
+	b.words << a2
+	b.words << a3
+	b.words << a4
+	b.words << a5
+	b.words << a6
+	b.words << a7
+	b.words << a8
+}
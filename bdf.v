@@ -0,0 +1,262 @@
+module wasm96
+
+// Guest-side BDF bitmap fonts, with a subpixel text path.
+//
+// Host fonts draw straight to the screen; a BitmapFont draws into Surfaces,
+// and can render text on subpixels for RGB-striped displays:
+// each font dot becomes one red, green or blue stripe (a third of a pixel),
+// so fonts drawn at three times their intended width come out sharp at a
+// third of the size. A 1-2-3-2-1 filter across stripes keeps color fringes
+// down. This pays off most for small UI text at the low resolutions RGB565
+// modes run at.
+
+// One glyph's bitmap, one bit per dot, rows padded to whole bytes.
+pub struct BitmapGlyph {
+pub:
+	width   int
+	height  int
+	x_off   int
+	y_off   int
+	advance int
+	bits    []u8
+}
+
+// Returns true if dot (x, y) of the glyph is set.
+pub fn (g &BitmapGlyph) dot(x int, y int) bool {
+	stride := (g.width + 7) / 8
+	return g.bits[y * stride + x / 8] & (u8(0x80) >> u32(x % 8)) != 0
+}
+
+// A bitmap font parsed from BDF.
+pub struct BitmapFont {
+pub:
+	ascent  int
+	descent int
+mut:
+	glyphs []BitmapGlyph
+	index  map[u32]int
+}
+
+// Get the height of a line of text in dots.
+pub fn (f &BitmapFont) line_height() int {
+	return f.ascent + f.descent
+}
+
+// Get the glyph for a character, or none if the font lacks it.
+pub fn (f &BitmapFont) glyph(ch rune) ?&BitmapGlyph {
+	i := f.index[u32(ch)] or { return none }
+	return &f.glyphs[i]
+}
+
+// Parse a BDF font.
+pub fn bdf_parse(data []u8) !BitmapFont {
+	lines := data.bytestr().split_into_lines()
+	mut glyphs := []BitmapGlyph{}
+	mut index := map[u32]int{}
+	mut ascent := 0
+	mut descent := 0
+	mut bbox_h := 0
+	mut bbox_y := 0
+	mut i := 0
+	for i < lines.len {
+		fields := lines[i].fields()
+		i++
+		if fields.len == 0 {
+			continue
+		}
+		match fields[0] {
+			'FONTBOUNDINGBOX' {
+				if fields.len >= 5 {
+					bbox_h = fields[2].int()
+					bbox_y = fields[4].int()
+				}
+			}
+			'FONT_ASCENT' {
+				if fields.len >= 2 {
+					ascent = fields[1].int()
+				}
+			}
+			'FONT_DESCENT' {
+				if fields.len >= 2 {
+					descent = fields[1].int()
+				}
+			}
+			'STARTCHAR' {
+				mut code := -1
+				mut advance := 0
+				mut bbx := [0, 0, 0, 0]
+				mut bits := []u8{}
+				for i < lines.len {
+					cf := lines[i].fields()
+					i++
+					if cf.len == 0 {
+						continue
+					}
+					if cf[0] == 'ENDCHAR' {
+						break
+					}
+					match cf[0] {
+						'ENCODING' {
+							code = if cf.len >= 2 { cf[1].int() } else { -1 }
+						}
+						'DWIDTH' {
+							advance = if cf.len >= 2 { cf[1].int() } else { 0 }
+						}
+						'BBX' {
+							if cf.len < 5 {
+								return error('bdf: bad BBX')
+							}
+							bbx = [cf[1].int(), cf[2].int(), cf[3].int(), cf[4].int()]
+						}
+						'BITMAP' {
+							stride := (bbx[0] + 7) / 8
+							for _ in 0 .. bbx[1] {
+								if i >= lines.len {
+									return error('bdf: bitmap too short')
+								}
+								row := lines[i].trim_space()
+								i++
+								for b in 0 .. stride {
+									bits << if b * 2 + 2 <= row.len {
+										u8(('0x' + row[b * 2..b * 2 + 2]).u32())
+									} else {
+										u8(0)
+									}
+								}
+							}
+						}
+						else {}
+					}
+				}
+				if code < 0 || bits.len < ((bbx[0] + 7) / 8) * bbx[1] {
+					continue
+				}
+				index[u32(code)] = glyphs.len
+				glyphs << BitmapGlyph{
+					width: bbx[0]
+					height: bbx[1]
+					x_off: bbx[2]
+					y_off: bbx[3]
+					advance: advance
+					bits: bits
+				}
+			}
+			else {}
+		}
+	}
+	if glyphs.len == 0 {
+		return error('bdf: no glyphs')
+	}
+	if ascent == 0 && descent == 0 {
+		descent = -bbox_y
+		ascent = bbox_h + bbox_y
+	}
+	return BitmapFont{
+		ascent: ascent
+		descent: descent
+		glyphs: glyphs
+		index: index
+	}
+}
+
+// Get the width of text in dots (in stripes for the subpixel path).
+pub fn (f &BitmapFont) measure(text string) int {
+	mut w := 0
+	for ch in text.runes() {
+		g := f.glyph(ch) or { continue }
+		w += g.advance
+	}
+	return w
+}
+
+// Draw text onto s with its top-left at (x, y), in the surface's color.
+pub fn (f &BitmapFont) draw(mut s Surface, x int, y int, text string) {
+	mut pen := x
+	base := y + f.ascent
+	for ch in text.runes() {
+		g := f.glyph(ch) or { continue }
+		top := base - g.y_off - g.height
+		for gy in 0 .. g.height {
+			for gx in 0 .. g.width {
+				if g.dot(gx, gy) {
+					s.point(pen + g.x_off + gx, top + gy)
+				}
+			}
+		}
+		pen += g.advance
+	}
+}
+
+// Draw text onto s with its top-left at (x, y) using subpixel rendering:
+// every dot is one color stripe, so text is a third as wide as with draw.
+// Suits fonts drawn at triple width, on displays with RGB stripes.
+pub fn (f &BitmapFont) draw_subpixel(mut s Surface, x int, y int, text string) {
+	width := (f.measure(text) + 2) / 3 + 2
+	if width <= 2 {
+		return
+	}
+	// Coverage per stripe for one row, with room for the filter's spread.
+	mut cov := []u8{len: width * 3 + 4}
+	for row in 0 .. f.line_height() {
+		for k in 0 .. cov.len {
+			cov[k] = 0
+		}
+		mut any := false
+		// Two stripes of padding on the left for the filter.
+		mut pen := 2
+		for ch in text.runes() {
+			g := f.glyph(ch) or { continue }
+			gy := row - (f.ascent - g.y_off - g.height)
+			if gy >= 0 && gy < g.height {
+				for gx in 0 .. g.width {
+					k := pen + g.x_off + gx
+					if k >= 0 && k < cov.len && g.dot(gx, gy) {
+						cov[k] = 1
+						any = true
+					}
+				}
+			}
+			pen += g.advance
+		}
+		if any {
+			subpixel_row(mut s, x, y + row, cov)
+		}
+	}
+}
+
+// Blend a row of stripe coverage onto s at row py, starting at pixel px0.
+// cov[k + 2] is stripe k: red, green and blue of pixel px0 + k / 3.
+fn subpixel_row(mut s Surface, px0 int, py int, cov []u8) {
+	if py < s.clip.y || py >= s.clip.y + s.clip.h {
+		return
+	}
+	c := s.color
+	for p in 0 .. (cov.len - 4) / 3 {
+		px := px0 + p
+		if px < s.clip.x || px >= s.clip.x + s.clip.w {
+			continue
+		}
+		mut w := [3]int{}
+		mut lit := false
+		for ch in 0 .. 3 {
+			k := p * 3 + ch + 2
+			// 1-2-3-2-1 filter, 0 to 9, scaled to the color's alpha.
+			sum := int(cov[k - 2]) + 2 * int(cov[k - 1]) + 3 * int(cov[k]) + 2 * int(cov[k + 1]) +
+				int(cov[k + 2])
+			w[ch] = sum * int(c.a) / 9
+			if w[ch] > 0 {
+				lit = true
+			}
+		}
+		if !lit {
+			continue
+		}
+		i := (py * s.width + px) * 4
+		s.pixels[i] = u8(int(s.pixels[i]) + (int(c.r) - int(s.pixels[i])) * w[0] / 255)
+		s.pixels[i + 1] = u8(int(s.pixels[i + 1]) + (int(c.g) - int(s.pixels[i + 1])) * w[1] / 255)
+		s.pixels[i + 2] = u8(int(s.pixels[i + 2]) + (int(c.b) - int(s.pixels[i + 2])) * w[2] / 255)
+		if s.pixels[i + 3] < c.a {
+			s.pixels[i + 3] = c.a
+		}
+	}
+}
@@ -0,0 +1,364 @@
+module wasm96
+
+// Behavior trees.
+//
+// A BehaviorTree is built once and shared by every entity that uses it. The
+// per-entity part, a BtAgent, holds the tree's running state and a
+// blackboard of named values, and is taken from and returned to the tree's
+// pool, so spawning and despawning NPCs doesn't allocate once warmed up.
+//
+// Composites remember which child is running, so a sequence that returned
+// .running resumes at that child on the next tick instead of starting over.
+//
+//   mut bt := wasm96.BehaviorTree[Guard]{}
+//   root := bt.selector([
+//       bt.sequence([bt.condition(sees_player), bt.action(attack)]),
+//       bt.action(patrol),
+//   ])
+//   bt.set_root(root)
+//   mut agent := bt.acquire()
+//   bt.tick(mut agent, mut guard)
+
+// The result of ticking a node.
+pub enum BtStatus {
+	success
+	failure
+	running
+}
+
+enum BtKind {
+	action
+	condition
+	sequence
+	selector
+	parallel
+	inverter
+	succeeder
+	repeat
+	until_fail
+	wait
+	cooldown
+}
+
+// Named values an agent's nodes share.
+pub struct Blackboard {
+mut:
+	ints   map[string]int
+	floats map[string]f32
+}
+
+// Get an int value, or 0 if unset.
+pub fn (b &Blackboard) get_int(key string) int {
+	return b.ints[key] or { 0 }
+}
+
+// Set an int value.
+pub fn (mut b Blackboard) set_int(key string, value int) {
+	b.ints[key] = value
+}
+
+// Get a float value, or 0 if unset.
+pub fn (b &Blackboard) get_f32(key string) f32 {
+	return b.floats[key] or { 0 }
+}
+
+// Set a float value.
+pub fn (mut b Blackboard) set_f32(key string, value f32) {
+	b.floats[key] = value
+}
+
+// Get a flag, stored as an int; false if unset.
+pub fn (b &Blackboard) get_bool(key string) bool {
+	return b.get_int(key) != 0
+}
+
+// Set a flag.
+pub fn (mut b Blackboard) set_bool(key string, value bool) {
+	b.ints[key] = if value { 1 } else { 0 }
+}
+
+// Returns true if key has an int or float value.
+pub fn (b &Blackboard) has(key string) bool {
+	return key in b.ints || key in b.floats
+}
+
+// Remove every value.
+pub fn (mut b Blackboard) clear() {
+	b.ints.clear()
+	b.floats.clear()
+}
+
+// The per-entity state of a behavior tree.
+pub struct BtAgent {
+pub mut:
+	blackboard Blackboard
+mut:
+	state []int
+	ticks int
+}
+
+struct BtNode[T] {
+	kind      BtKind
+	children  []int
+	param     int
+	action    fn (mut ctx T, mut bb Blackboard) BtStatus = unsafe { nil }
+	condition fn (ctx &T, bb &Blackboard) bool         = unsafe { nil }
+}
+
+// A behavior tree over context type T.
+pub struct BehaviorTree[T] {
+mut:
+	nodes  []BtNode[T]
+	root   int = -1
+	agents Pool[BtAgent]
+}
+
+fn (mut t BehaviorTree[T]) node(n BtNode[T]) int {
+	t.nodes << n
+	return t.nodes.len - 1
+}
+
+// Add a leaf that runs f and returns its status.
+pub fn (mut t BehaviorTree[T]) action(f fn (mut ctx T, mut bb Blackboard) BtStatus) int {
+	return t.node(BtNode[T]{
+		kind: .action
+		action: f
+	})
+}
+
+// Add a leaf that succeeds if f returns true and fails otherwise.
+pub fn (mut t BehaviorTree[T]) condition(f fn (ctx &T, bb &Blackboard) bool) int {
+	return t.node(BtNode[T]{
+		kind: .condition
+		condition: f
+	})
+}
+
+// Add a node that runs children in order until one fails.
+pub fn (mut t BehaviorTree[T]) sequence(children []int) int {
+	return t.node(BtNode[T]{
+		kind: .sequence
+		children: children
+	})
+}
+
+// Add a node that runs children in order until one succeeds.
+pub fn (mut t BehaviorTree[T]) selector(children []int) int {
+	return t.node(BtNode[T]{
+		kind: .selector
+		children: children
+	})
+}
+
+// Add a node that ticks every child each tick, succeeding once need of them
+// succeed and failing once that can no longer happen.
+pub fn (mut t BehaviorTree[T]) parallel(children []int, need int) int {
+	return t.node(BtNode[T]{
+		kind: .parallel
+		children: children
+		param: need
+	})
+}
+
+// Add a node that swaps its child's success and failure.
+pub fn (mut t BehaviorTree[T]) invert(child int) int {
+	return t.node(BtNode[T]{
+		kind: .inverter
+		children: [child]
+	})
+}
+
+// Add a node that succeeds whenever its child finishes.
+pub fn (mut t BehaviorTree[T]) succeed(child int) int {
+	return t.node(BtNode[T]{
+		kind: .succeeder
+		children: [child]
+	})
+}
+
+// Add a node that runs its child times times (0 for forever), failing if
+// the child fails.
+pub fn (mut t BehaviorTree[T]) repeat(child int, times int) int {
+	return t.node(BtNode[T]{
+		kind: .repeat
+		children: [child]
+		param: times
+	})
+}
+
+// Add a node that reruns its child until it fails, then succeeds.
+pub fn (mut t BehaviorTree[T]) until_fail(child int) int {
+	return t.node(BtNode[T]{
+		kind: .until_fail
+		children: [child]
+	})
+}
+
+// Add a leaf that stays running for ticks ticks, then succeeds.
+pub fn (mut t BehaviorTree[T]) wait(ticks int) int {
+	return t.node(BtNode[T]{
+		kind: .wait
+		param: ticks
+	})
+}
+
+// Add a node that fails without running its child for ticks ticks after the
+// child last finished.
+pub fn (mut t BehaviorTree[T]) cooldown(child int, ticks int) int {
+	return t.node(BtNode[T]{
+		kind: .cooldown
+		children: [child]
+		param: ticks
+	})
+}
+
+// Set the node ticked first.
+pub fn (mut t BehaviorTree[T]) set_root(node int) {
+	t.root = node
+}
+
+// Take an agent with fresh state and an empty blackboard.
+pub fn (mut t BehaviorTree[T]) acquire() &BtAgent {
+	mut a := t.agents.get()
+	if a.state.len != t.nodes.len {
+		a.state = []int{len: t.nodes.len}
+	}
+	a.reset()
+	return a
+}
+
+// Return an agent to the pool.
+pub fn (mut t BehaviorTree[T]) release(mut a BtAgent) {
+	t.agents.put(mut a)
+}
+
+// Forget running state and blackboard values.
+pub fn (mut a BtAgent) reset() {
+	for i in 0 .. a.state.len {
+		a.state[i] = 0
+	}
+	a.ticks = 0
+	a.blackboard.clear()
+}
+
+// Tick the tree once for an agent.
+pub fn (t &BehaviorTree[T]) tick(mut a BtAgent, mut ctx T) BtStatus {
+	if t.root < 0 {
+		return .failure
+	}
+	if a.state.len != t.nodes.len {
+		a.state = []int{len: t.nodes.len}
+	}
+	a.ticks++
+	return t.run(t.root, mut a, mut ctx)
+}
+
+// Clear the running state of a node and everything under it. Cooldowns keep
+// their timers, as those track time rather than progress.
+fn (t &BehaviorTree[T]) reset_node(id int, mut a BtAgent) {
+	n := t.nodes[id]
+	if n.kind != .cooldown {
+		a.state[id] = 0
+	}
+	for c in n.children {
+		t.reset_node(c, mut a)
+	}
+}
+
+fn (t &BehaviorTree[T]) run(id int, mut a BtAgent, mut ctx T) BtStatus {
+	n := t.nodes[id]
+	match n.kind {
+		.action {
+			return n.action(mut ctx, mut a.blackboard)
+		}
+		.condition {
+			return if n.condition(&ctx, &a.blackboard) { .success } else { .failure }
+		}
+		.sequence, .selector {
+			// Sequences stop at the first failure, selectors at the first success.
+			stop := if n.kind == .sequence { BtStatus.failure } else { BtStatus.success }
+			for a.state[id] < n.children.len {
+				s := t.run(n.children[a.state[id]], mut a, mut ctx)
+				if s == .running {
+					return s
+				}
+				if s == stop {
+					a.state[id] = 0
+					return s
+				}
+				a.state[id]++
+			}
+			a.state[id] = 0
+			return if stop == .failure { .success } else { .failure }
+		}
+		.parallel {
+			mut ok := 0
+			mut failed := 0
+			for c in n.children {
+				match t.run(c, mut a, mut ctx) {
+					.success { ok++ }
+					.failure { failed++ }
+					.running {}
+				}
+			}
+			if ok < n.param && failed <= n.children.len - n.param {
+				return .running
+			}
+			// Children still running are abandoned; start them afresh next time.
+			for c in n.children {
+				t.reset_node(c, mut a)
+			}
+			return if ok >= n.param { .success } else { .failure }
+		}
+		.inverter {
+			return match t.run(n.children[0], mut a, mut ctx) {
+				.success { .failure }
+				.failure { .success }
+				.running { .running }
+			}
+		}
+		.succeeder {
+			s := t.run(n.children[0], mut a, mut ctx)
+			return if s == .running { s } else { .success }
+		}
+		.repeat {
+			s := t.run(n.children[0], mut a, mut ctx)
+			if s == .failure {
+				a.state[id] = 0
+				return s
+			}
+			if s == .success {
+				a.state[id]++
+				if n.param > 0 && a.state[id] >= n.param {
+					a.state[id] = 0
+					return .success
+				}
+			}
+			return .running
+		}
+		.until_fail {
+			s := t.run(n.children[0], mut a, mut ctx)
+			return if s == .failure { .success } else { .running }
+		}
+		.wait {
+			a.state[id]++
+			if a.state[id] >= n.param {
+				a.state[id] = 0
+				return .success
+			}
+			return .running
+		}
+		.cooldown {
+			// state holds the tick at which the child may run again.
+			if a.ticks < a.state[id] {
+				return .failure
+			}
+			s := t.run(n.children[0], mut a, mut ctx)
+			if s != .running {
+				a.state[id] = a.ticks + n.param
+			}
+			return s
+		}
+	}
+	return .failure
+}
@@ -0,0 +1,221 @@
+module wasm96
+
+// BMP decoder: 1, 4, 8, 16, 24 and 32-bit images, uncompressed, RLE4/RLE8
+// and bitfields.
+
+fn le_u16(b []u8, i int) u32 {
+	return u32(b[i]) | u32(b[i + 1]) << 8
+}
+
+fn le_u32(b []u8, i int) u32 {
+	return u32(b[i]) | u32(b[i + 1]) << 8 | u32(b[i + 2]) << 16 | u32(b[i + 3]) << 24
+}
+
+// Scale a masked channel to 8 bits.
+fn bmp_channel(px u32, mask u32) u8 {
+	if mask == 0 {
+		return 0
+	}
+	mut shift := 0
+	for (mask >> shift) & 1 == 0 {
+		shift++
+	}
+	max := mask >> shift
+	return u8(((px & mask) >> shift) * 255 / max)
+}
+
+// Decode a BMP file.
+pub fn bmp_decode(data []u8) !Image {
+	if data.len < 26 || data[0] != `B` || data[1] != `M` {
+		return error('bmp: bad header')
+	}
+	offset := int(le_u32(data, 10))
+	dib := int(le_u32(data, 14))
+	mut width := 0
+	mut height := 0
+	mut bpp := 0
+	mut compression := u32(0)
+	mut colors := 0
+	mut entry := 4
+	if dib == 12 {
+		// OS/2 core header.
+		width = int(le_u16(data, 18))
+		height = int(i16(le_u16(data, 20)))
+		bpp = int(le_u16(data, 24))
+		entry = 3
+	} else {
+		if dib < 40 || data.len < 14 + dib {
+			return error('bmp: unsupported header size ${dib}')
+		}
+		width = int(i32(le_u32(data, 18)))
+		height = int(i32(le_u32(data, 22)))
+		bpp = int(le_u16(data, 28))
+		compression = le_u32(data, 30)
+		colors = int(le_u32(data, 46))
+	}
+	top_down := height < 0
+	if top_down {
+		height = -height
+	}
+	if width <= 0 || height == 0 {
+		return error('bmp: bad size ${width}x${height}')
+	}
+	// Channel masks; BI_RGB 16-bit is 5-5-5.
+	mut masks := match bpp {
+		16 { [u32(0x7c00), 0x03e0, 0x001f, 0] }
+		else { [u32(0x00ff0000), 0x0000ff00, 0x000000ff, 0] }
+	}
+	if compression == 3 || compression == 6 {
+		if dib >= 52 {
+			masks = [le_u32(data, 54), le_u32(data, 58), le_u32(data, 62), 0]
+			if dib >= 56 {
+				masks[3] = le_u32(data, 66)
+			}
+		} else if data.len >= 14 + dib + 12 {
+			// Masks follow a 40-byte header.
+			p := 14 + dib
+			masks = [le_u32(data, p), le_u32(data, p + 4), le_u32(data, p + 8), 0]
+			if compression == 6 && data.len >= p + 16 {
+				masks[3] = le_u32(data, p + 12)
+			}
+		}
+	} else if dib >= 56 && bpp == 32 {
+		masks[3] = le_u32(data, 66)
+	}
+	mut palette := []Color{}
+	if bpp <= 8 {
+		count := if colors > 0 { colors } else { 1 << bpp }
+		mut p := 14 + dib
+		if compression == 3 && dib == 40 {
+			p += 12
+		}
+		for _ in 0 .. count {
+			if p + entry > data.len {
+				break
+			}
+			palette << Color{data[p + 2], data[p + 1], data[p], 255}
+			p += entry
+		}
+	}
+	if offset >= data.len {
+		return error('bmp: pixel data out of range')
+	}
+	mut img := new_image(width, height)
+	pixels := data[offset..]
+	match compression {
+		1, 2 {
+			bmp_rle(mut img, pixels, palette, compression == 2, top_down)
+		}
+		0, 3, 6 {
+			stride := ((width * bpp + 31) / 32) * 4
+			if pixels.len < stride * height {
+				return error('bmp: pixel data too short')
+			}
+			for y in 0 .. height {
+				row := if top_down { y } else { height - 1 - y }
+				base := row * stride
+				for x in 0 .. width {
+					c := match bpp {
+						1, 4, 8 {
+							bit := x * bpp
+							index := (pixels[base + bit / 8] >> (8 - bpp - bit % 8)) & u8((1 << bpp) - 1)
+							if index < palette.len { palette[index] } else { Color{} }
+						}
+						16, 32 {
+							px := if bpp == 16 {
+								le_u16(pixels, base + x * 2)
+							} else {
+								le_u32(pixels, base + x * 4)
+							}
+							Color{bmp_channel(px, masks[0]), bmp_channel(px, masks[1]), bmp_channel(px,
+								masks[2]), if masks[3] != 0 { bmp_channel(px, masks[3]) } else { 255 }}
+						}
+						24 {
+							i := base + x * 3
+							Color{pixels[i + 2], pixels[i + 1], pixels[i], 255}
+						}
+						else {
+							return error('bmp: unsupported bit depth ${bpp}')
+						}
+					}
+					img.set(x, y, c)
+				}
+			}
+		}
+		else {
+			return error('bmp: unsupported compression ${compression}')
+		}
+	}
+	return img
+}
+
+// Decode RLE8 or RLE4 data. Skipped pixels stay transparent.
+fn bmp_rle(mut img Image, src []u8, palette []Color, nibbles bool, top_down bool) {
+	mut x := 0
+	mut y := 0
+	mut i := 0
+	for i + 1 < src.len {
+		count := int(src[i])
+		value := src[i + 1]
+		i += 2
+		if count > 0 {
+			for n in 0 .. count {
+				index := if !nibbles {
+					value
+				} else if n % 2 == 0 {
+					value >> 4
+				} else {
+					value & 0x0f
+				}
+				bmp_put(mut img, x, y, index, palette, top_down)
+				x++
+			}
+			continue
+		}
+		match value {
+			0 {
+				x = 0
+				y++
+			}
+			1 {
+				return
+			}
+			2 {
+				if i + 1 >= src.len {
+					return
+				}
+				x += int(src[i])
+				y += int(src[i + 1])
+				i += 2
+			}
+			else {
+				n := int(value)
+				bytes := if nibbles { (n + 1) / 2 } else { n }
+				for k in 0 .. n {
+					b := if nibbles { i + k / 2 } else { i + k }
+					if b >= src.len {
+						return
+					}
+					index := if !nibbles {
+						src[b]
+					} else if k % 2 == 0 {
+						src[b] >> 4
+					} else {
+						src[b] & 0x0f
+					}
+					bmp_put(mut img, x, y, index, palette, top_down)
+					x++
+				}
+				// Absolute runs are padded to a word.
+				i += bytes + bytes % 2
+			}
+		}
+	}
+}
+
+fn bmp_put(mut img Image, x int, y int, index u8, palette []Color, top_down bool) {
+	row := if top_down { y } else { img.height - 1 - y }
+	if index < palette.len {
+		img.set(x, row, palette[index])
+	}
+}
@@ -0,0 +1,69 @@
+module wasm96
+
+fn bmp_test_put(mut b []u8, v u32, n int) {
+	for i in 0 .. n {
+		b << u8(v >> (i * 8))
+	}
+}
+
+// Build a BMP with a 40-byte header around pixels.
+fn bmp_test_file(width int, height int, bpp int, palette []Color, pixels []u8) []u8 {
+	offset := 54 + palette.len * 4
+	mut b := 'BM'.bytes()
+	bmp_test_put(mut b, u32(offset + pixels.len), 4)
+	bmp_test_put(mut b, 0, 4)
+	bmp_test_put(mut b, u32(offset), 4)
+	bmp_test_put(mut b, 40, 4)
+	bmp_test_put(mut b, u32(width), 4)
+	bmp_test_put(mut b, u32(height), 4)
+	bmp_test_put(mut b, 1, 2)
+	bmp_test_put(mut b, u32(bpp), 2)
+	bmp_test_put(mut b, 0, 4)
+	bmp_test_put(mut b, u32(pixels.len), 4)
+	bmp_test_put(mut b, 2835, 4)
+	bmp_test_put(mut b, 2835, 4)
+	bmp_test_put(mut b, u32(palette.len), 4)
+	bmp_test_put(mut b, 0, 4)
+	for c in palette {
+		b << [c.b, c.g, c.r, 0]
+	}
+	b << pixels
+	return b
+}
+
+fn test_bmp_decode_24bit() ! {
+	// Bottom-up rows of three BGR pixels padded to 12 bytes.
+	pixels := [
+		u8(0), 0, 255, 0, 255, 0, 255, 0, 0, 0, 0, 0,
+		255, 255, 255, 0, 0, 0, 10, 20, 30, 0, 0, 0,
+	]
+	img := bmp_decode(bmp_test_file(3, 2, 24, []Color{}, pixels))!
+	assert img.width == 3
+	assert img.height == 2
+	assert img.get(0, 1) == Color{255, 0, 0, 255}
+	assert img.get(1, 1) == Color{0, 255, 0, 255}
+	assert img.get(2, 1) == Color{0, 0, 255, 255}
+	assert img.get(0, 0) == Color{255, 255, 255, 255}
+	assert img.get(1, 0) == Color{0, 0, 0, 255}
+	assert img.get(2, 0) == Color{30, 20, 10, 255}
+}
+
+fn test_bmp_decode_8bit_top_down() ! {
+	palette := [Color{1, 2, 3, 255}, Color{200, 100, 50, 255}]
+	pixels := [u8(0), 1, 0, 0, 1, 1, 0, 0]
+	img := bmp_decode(bmp_test_file(2, -2, 8, palette, pixels))!
+	assert img.get(0, 0) == palette[0]
+	assert img.get(1, 0) == palette[1]
+	assert img.get(0, 1) == palette[1]
+	assert img.get(1, 1) == palette[1]
+}
+
+fn test_bmp_decode_errors() {
+	if _ := bmp_decode('PNG'.bytes()) {
+		assert false
+	}
+	data := bmp_test_file(3, 2, 24, []Color{}, []u8{len: 24})
+	if _ := bmp_decode(data[..data.len - 4]) {
+		assert false
+	}
+}
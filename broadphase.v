@@ -0,0 +1,441 @@
+module wasm96
+
+// Broad-phase collision: spatial hashing and quadtrees.
+//
+// Both structures track axis-aligned boxes by id and answer "what might
+// touch this area (or ray)?" without testing every pair. Ids are small
+// non-negative ints such as entity or array indices; they index internal
+// tables, so keep them dense. Results are written into a caller-owned
+// array, which is cleared first and can be reused every frame.
+
+// An axis-aligned rectangle.
+pub struct Rect {
+pub mut:
+	x int
+	y int
+	w int
+	h int
+}
+
+// Returns true if the rectangles share any area.
+pub fn (a Rect) overlaps(b Rect) bool {
+	return a.x < b.x + b.w && b.x < a.x + a.w && a.y < b.y + b.h && b.y < a.y + a.h
+}
+
+// Returns true if b lies entirely inside a.
+pub fn (a Rect) contains(b Rect) bool {
+	return b.x >= a.x && b.y >= a.y && b.x + b.w <= a.x + a.w && b.y + b.h <= a.y + a.h
+}
+
+// Returns true if the point (x, y) lies inside the rectangle.
+pub fn (r Rect) has_point(x int, y int) bool {
+	return x >= r.x && y >= r.y && x < r.x + r.w && y < r.y + r.h
+}
+
+// Returns true if the segment from (x0, y0) to (x1, y1) touches the rectangle.
+pub fn (r Rect) hits_segment(x0 f32, y0 f32, x1 f32, y1 f32) bool {
+	mut t0 := f32(0)
+	mut t1 := f32(1)
+	dx := x1 - x0
+	dy := y1 - y0
+	// Clip the segment against each pair of slabs (Liang-Barsky).
+	for axis in 0 .. 2 {
+		d := if axis == 0 { dx } else { dy }
+		p := if axis == 0 { x0 } else { y0 }
+		lo := f32(if axis == 0 { r.x } else { r.y })
+		hi := lo + f32(if axis == 0 { r.w } else { r.h })
+		if d == 0 {
+			if p < lo || p > hi {
+				return false
+			}
+			continue
+		}
+		mut ta := (lo - p) / d
+		mut tb := (hi - p) / d
+		if ta > tb {
+			ta, tb = tb, ta
+		}
+		if ta > t0 {
+			t0 = ta
+		}
+		if tb < t1 {
+			t1 = tb
+		}
+		if t0 > t1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Marks ids already reported by a query, without clearing between queries.
+struct QueryStamp {
+mut:
+	marks []u32
+	gen   u32
+}
+
+fn (mut s QueryStamp) begin() {
+	s.gen++
+	if s.gen == 0 {
+		for i in 0 .. s.marks.len {
+			s.marks[i] = 0
+		}
+		s.gen = 1
+	}
+}
+
+// Mark id, returning false if it was already marked in this query.
+fn (mut s QueryStamp) mark(id int) bool {
+	for s.marks.len <= id {
+		s.marks << 0
+	}
+	if s.marks[id] == s.gen {
+		return false
+	}
+	s.marks[id] = s.gen
+	return true
+}
+
+// A uniform grid of buckets over unbounded space. Best when objects are of
+// similar size, up to about one cell.
+pub struct SpatialHash {
+pub:
+	cell_size int
+mut:
+	cells map[u64][]int
+	rects []Rect
+	live  []bool
+	stamp QueryStamp
+}
+
+// Create a spatial hash with square cells of cell_size pixels.
+pub fn new_spatial_hash(cell_size int) SpatialHash {
+	return SpatialHash{
+		cell_size: max_int(1, cell_size)
+	}
+}
+
+fn hash_cell_key(cx int, cy int) u64 {
+	return (u64(u32(cx)) << 32) | u64(u32(cy))
+}
+
+// Add id with bounds r, or move it if it is already present.
+pub fn (mut h SpatialHash) insert(id int, r Rect) {
+	if id < h.live.len && h.live[id] {
+		h.remove(id)
+	}
+	for h.live.len <= id {
+		h.live << false
+		h.rects << Rect{}
+	}
+	h.live[id] = true
+	h.rects[id] = r
+	x0, y0, x1, y1 := h.cell_span(r)
+	for cy in y0 .. y1 + 1 {
+		for cx in x0 .. x1 + 1 {
+			key := hash_cell_key(cx, cy)
+			if key in h.cells {
+				h.cells[key] << id
+			} else {
+				h.cells[key] = [id]
+			}
+		}
+	}
+}
+
+// Move id to new bounds.
+pub fn (mut h SpatialHash) update(id int, r Rect) {
+	h.insert(id, r)
+}
+
+// Remove id.
+pub fn (mut h SpatialHash) remove(id int) {
+	if id >= h.live.len || !h.live[id] {
+		return
+	}
+	h.live[id] = false
+	x0, y0, x1, y1 := h.cell_span(h.rects[id])
+	for cy in y0 .. y1 + 1 {
+		for cx in x0 .. x1 + 1 {
+			key := hash_cell_key(cx, cy)
+			mut bucket := h.cells[key] or { continue }
+			i := bucket.index(id)
+			if i >= 0 {
+				bucket.delete(i)
+			}
+			if bucket.len == 0 {
+				h.cells.delete(key)
+			} else {
+				h.cells[key] = bucket
+			}
+		}
+	}
+}
+
+// Remove every id.
+pub fn (mut h SpatialHash) clear() {
+	h.cells.clear()
+	for i in 0 .. h.live.len {
+		h.live[i] = false
+	}
+}
+
+fn (h &SpatialHash) cell_span(r Rect) (int, int, int, int) {
+	return floor_div(r.x, h.cell_size), floor_div(r.y, h.cell_size), floor_div(r.x + max_int(r.w,
+		1) - 1, h.cell_size), floor_div(r.y + max_int(r.h, 1) - 1, h.cell_size)
+}
+
+// Find every id whose bounds overlap r.
+pub fn (mut h SpatialHash) query(r Rect, mut out []int) {
+	out.clear()
+	h.stamp.begin()
+	x0, y0, x1, y1 := h.cell_span(r)
+	for cy in y0 .. y1 + 1 {
+		for cx in x0 .. x1 + 1 {
+			bucket := h.cells[hash_cell_key(cx, cy)] or { continue }
+			for id in bucket {
+				if h.rects[id].overlaps(r) && h.stamp.mark(id) {
+					out << id
+				}
+			}
+		}
+	}
+}
+
+// Find every id whose bounds the segment from (x0, y0) to (x1, y1) touches,
+// walking only the cells along it.
+pub fn (mut h SpatialHash) query_ray(x0 f32, y0 f32, x1 f32, y1 f32, mut out []int) {
+	out.clear()
+	h.stamp.begin()
+	size := f32(h.cell_size)
+	mut cx := int(floorf(x0 / size))
+	mut cy := int(floorf(y0 / size))
+	end_x := int(floorf(x1 / size))
+	end_y := int(floorf(y1 / size))
+	dx := x1 - x0
+	dy := y1 - y0
+	step_x := if dx > 0 { 1 } else { -1 }
+	step_y := if dy > 0 { 1 } else { -1 }
+	// Distance along the ray (as a fraction) to the next cell edge on each
+	// axis, and between edges.
+	big := f32(1e30)
+	delta_x := if dx == 0 { big } else { absf(size / dx) }
+	delta_y := if dy == 0 { big } else { absf(size / dy) }
+	mut next_x := if dx == 0 {
+		big
+	} else if dx > 0 {
+		(f32(cx + 1) * size - x0) / dx
+	} else {
+		(f32(cx) * size - x0) / dx
+	}
+	mut next_y := if dy == 0 {
+		big
+	} else if dy > 0 {
+		(f32(cy + 1) * size - y0) / dy
+	} else {
+		(f32(cy) * size - y0) / dy
+	}
+	steps := iabs(end_x - cx) + iabs(end_y - cy)
+	for _ in 0 .. steps + 1 {
+		if bucket := h.cells[hash_cell_key(cx, cy)] {
+			for id in bucket {
+				if h.rects[id].hits_segment(x0, y0, x1, y1) && h.stamp.mark(id) {
+					out << id
+				}
+			}
+		}
+		if next_x < next_y {
+			next_x += delta_x
+			cx += step_x
+		} else {
+			next_y += delta_y
+			cy += step_y
+		}
+	}
+}
+
+struct QuadNode {
+mut:
+	bounds Rect
+	// Index of the first of four children, or -1 for a leaf.
+	first int = -1
+	depth int
+	items []int
+}
+
+// A quadtree over a fixed area. Each box is stored in the smallest node that
+// fully contains it; nodes split once they hold more than max_items. Suits
+// objects of widely varying size better than a spatial hash.
+pub struct Quadtree {
+pub:
+	max_items int
+	max_depth int
+mut:
+	nodes   []QuadNode
+	node_of []int
+	rects   []Rect
+	stack   []int
+}
+
+// Create a quadtree covering bounds.
+pub fn new_quadtree(bounds Rect, max_items int, max_depth int) Quadtree {
+	return Quadtree{
+		max_items: max_int(1, max_items)
+		max_depth: max_depth
+		nodes: [QuadNode{
+			bounds: bounds
+		}]
+	}
+}
+
+// Add id with bounds r, or move it if it is already present. Boxes outside
+// the tree's area are kept in the root.
+pub fn (mut q Quadtree) insert(id int, r Rect) {
+	q.remove(id)
+	for q.node_of.len <= id {
+		q.node_of << -1
+		q.rects << Rect{}
+	}
+	q.rects[id] = r
+	q.place(0, id)
+}
+
+// Move id to new bounds.
+pub fn (mut q Quadtree) update(id int, r Rect) {
+	q.insert(id, r)
+}
+
+fn (mut q Quadtree) place(start int, id int) {
+	r := q.rects[id]
+	mut n := start
+	for {
+		first := q.nodes[n].first
+		if first < 0 {
+			break
+		}
+		mut child := -1
+		for c in first .. first + 4 {
+			if q.nodes[c].bounds.contains(r) {
+				child = c
+				break
+			}
+		}
+		if child < 0 {
+			break
+		}
+		n = child
+	}
+	q.nodes[n].items << id
+	q.node_of[id] = n
+	if q.nodes[n].first < 0 && q.nodes[n].items.len > q.max_items && q.nodes[n].depth < q.max_depth {
+		q.split(n)
+	}
+}
+
+fn (mut q Quadtree) split(n int) {
+	b := q.nodes[n].bounds
+	hw := b.w / 2
+	hh := b.h / 2
+	if hw == 0 || hh == 0 {
+		return
+	}
+	depth := q.nodes[n].depth + 1
+	first := q.nodes.len
+	q.nodes << QuadNode{
+		bounds: Rect{b.x, b.y, hw, hh}
+		depth: depth
+	}
+	q.nodes << QuadNode{
+		bounds: Rect{b.x + hw, b.y, b.w - hw, hh}
+		depth: depth
+	}
+	q.nodes << QuadNode{
+		bounds: Rect{b.x, b.y + hh, hw, b.h - hh}
+		depth: depth
+	}
+	q.nodes << QuadNode{
+		bounds: Rect{b.x + hw, b.y + hh, b.w - hw, b.h - hh}
+		depth: depth
+	}
+	q.nodes[n].first = first
+	// Push items down into children that fully contain them.
+	items := q.nodes[n].items.clone()
+	q.nodes[n].items.clear()
+	for id in items {
+		q.place(n, id)
+	}
+}
+
+// Remove id.
+pub fn (mut q Quadtree) remove(id int) {
+	if id >= q.node_of.len || q.node_of[id] < 0 {
+		return
+	}
+	n := q.node_of[id]
+	i := q.nodes[n].items.index(id)
+	if i >= 0 {
+		q.nodes[n].items.delete(i)
+	}
+	q.node_of[id] = -1
+}
+
+// Remove every id and collapse the tree back to its root.
+pub fn (mut q Quadtree) clear() {
+	root := q.nodes[0].bounds
+	q.nodes = [QuadNode{
+		bounds: root
+	}]
+	for i in 0 .. q.node_of.len {
+		q.node_of[i] = -1
+	}
+}
+
+// Find every id whose bounds overlap r.
+pub fn (mut q Quadtree) query(r Rect, mut out []int) {
+	out.clear()
+	q.stack.clear()
+	q.stack << 0
+	for q.stack.len > 0 {
+		n := q.stack.pop()
+		node := q.nodes[n]
+		// The root also holds boxes outside its area, so always search it.
+		if n != 0 && !node.bounds.overlaps(r) {
+			continue
+		}
+		for id in node.items {
+			if q.rects[id].overlaps(r) {
+				out << id
+			}
+		}
+		if node.first >= 0 {
+			for c in node.first .. node.first + 4 {
+				q.stack << c
+			}
+		}
+	}
+}
+
+// Find every id whose bounds the segment from (x0, y0) to (x1, y1) touches.
+pub fn (mut q Quadtree) query_ray(x0 f32, y0 f32, x1 f32, y1 f32, mut out []int) {
+	out.clear()
+	q.stack.clear()
+	q.stack << 0
+	for q.stack.len > 0 {
+		n := q.stack.pop()
+		node := q.nodes[n]
+		if n != 0 && !node.bounds.hits_segment(x0, y0, x1, y1) {
+			continue
+		}
+		for id in node.items {
+			if q.rects[id].hits_segment(x0, y0, x1, y1) {
+				out << id
+			}
+		}
+		if node.first >= 0 {
+			for c in node.first .. node.first + 4 {
+				q.stack << c
+			}
+		}
+	}
+}
@@ -0,0 +1,365 @@
+module wasm96
+
+// Bullets for shoot-'em-ups.
+//
+// A BulletPool holds a fixed number of bullets in a SlotPool, so a bullet
+// keeps its index while it lives and spawning thousands a second never
+// allocates. Bullets share a small set of styles (look and hit radius) and
+// are drawn style by style, setting the color once per style. Collision is
+// batched: collide tests every bullet against the targets in a SpatialHash
+// and reports all hits at once.
+//
+// A BulletEmitter fires patterns into a pool: rings, spreads, aimed spreads
+// and waves. Give any pattern a spin to turn it each shot; a ring with spin
+// is a spiral.
+//
+//   mut pool := wasm96.new_bullet_pool(4096)
+//   small := pool.add_style(wasm96.BulletStyle{ color: red, radius: 2 })
+//   mut boss := wasm96.BulletEmitter{ pattern: .ring, count: 12, spin: 0.1, style: small }
+//   // each frame:
+//   boss.update(mut pool, player_x, player_y)
+//   pool.update()
+//   if pool.hit_test(player_x, player_y, 2, enemy_team) >= 0 { ... }
+//   pool.draw(cam_x, cam_y)
+
+// How a bullet style is drawn.
+pub enum BulletShape {
+	circle
+	square
+	image
+}
+
+// The look and hit radius shared by a group of bullets.
+pub struct BulletStyle {
+pub mut:
+	shape  BulletShape
+	color  Color = Color{255, 255, 255, 255}
+	radius int   = 2
+	// Drawn centered on the bullet for .image.
+	image Image
+}
+
+// One bullet.
+pub struct Bullet {
+pub mut:
+	x  f32
+	y  f32
+	vx f32
+	vy f32
+	// Acceleration per frame.
+	ax f32
+	ay f32
+	// Frames left to live; 0 lives until it leaves the pool's bounds.
+	life  int
+	style int
+	// Whose bullet it is, so enemies' bullets only hit the player and so on.
+	team int
+}
+
+// A bullet touching a target, reported by collide.
+pub struct BulletHit {
+pub:
+	bullet int
+	target int
+}
+
+// A pool of bullets.
+pub struct BulletPool {
+pub mut:
+	styles []BulletStyle
+	// Bullets leaving this area are removed; empty for the screen plus
+	// margin pixels on each side.
+	bounds Rect
+	margin int = 32
+mut:
+	slots SlotPool[Bullet]
+	found []int
+}
+
+// Create a pool with room for capacity bullets.
+pub fn new_bullet_pool(capacity int) BulletPool {
+	return BulletPool{
+		slots: new_slot_pool[Bullet](capacity)
+	}
+}
+
+// Add a style, returning its index for Bullet.style.
+pub fn (mut p BulletPool) add_style(s BulletStyle) int {
+	p.styles << s
+	return p.styles.len - 1
+}
+
+// Add a bullet, returning its slot, or -1 if the pool is full.
+pub fn (mut p BulletPool) spawn(b Bullet) int {
+	return p.slots.add(b)
+}
+
+// Fire a bullet from (x, y) at angle radians (0 is right, pi / 2 is down)
+// and speed pixels per frame, speeding up by accel each frame.
+pub fn (mut p BulletPool) fire(x f32, y f32, angle f32, speed f32, accel f32, style int, team int, life int) int {
+	c := cosf(angle)
+	s := sinf(angle)
+	return p.spawn(Bullet{
+		x: x
+		y: y
+		vx: c * speed
+		vy: s * speed
+		ax: c * accel
+		ay: s * accel
+		life: life
+		style: style
+		team: team
+	})
+}
+
+// Remove the bullet in slot i.
+pub fn (mut p BulletPool) kill(i int) {
+	p.slots.release(i)
+}
+
+// Returns true if slot i holds a live bullet.
+pub fn (p &BulletPool) is_alive(i int) bool {
+	return p.slots.is_alive(i)
+}
+
+// Get the bullet in slot i, to steer it or read its position.
+pub fn (mut p BulletPool) get(i int) &Bullet {
+	return p.slots.get(i)
+}
+
+// Get the number of live bullets.
+pub fn (p &BulletPool) len() int {
+	return p.slots.len()
+}
+
+// Get the most bullets the pool holds.
+pub fn (p &BulletPool) capacity() int {
+	return p.slots.capacity()
+}
+
+// Remove every bullet.
+pub fn (mut p BulletPool) clear() {
+	p.slots.clear()
+}
+
+// Remove every bullet of a team, e.g. when the player bombs or dies.
+pub fn (mut p BulletPool) clear_team(team int) {
+	for i in 0 .. p.slots.end() {
+		if p.slots.alive[i] && p.slots.items[i].team == team {
+			p.kill(i)
+		}
+	}
+}
+
+fn (p &BulletPool) area() Rect {
+	if p.bounds.w > 0 && p.bounds.h > 0 {
+		return p.bounds
+	}
+	return Rect{-p.margin, -p.margin, int(screen_width) + 2 * p.margin, int(screen_height) +
+		2 * p.margin}
+}
+
+// Move every bullet a frame and remove those that expired or left the
+// bounds.
+pub fn (mut p BulletPool) update() {
+	area := p.area()
+	for i in 0 .. p.slots.end() {
+		if !p.slots.alive[i] {
+			continue
+		}
+		mut b := &p.slots.items[i]
+		b.vx += b.ax
+		b.vy += b.ay
+		b.x += b.vx
+		b.y += b.vy
+		if b.life > 0 {
+			b.life--
+			if b.life == 0 {
+				p.kill(i)
+				continue
+			}
+		}
+		if !area.has_point(int(b.x), int(b.y)) {
+			p.kill(i)
+		}
+	}
+}
+
+fn (p &BulletPool) radius(b &Bullet) int {
+	return if b.style >= 0 && b.style < p.styles.len { p.styles[b.style].radius } else { 1 }
+}
+
+// Test every bullet of a team (-1 for any) against the targets in h, whose
+// ids are the caller's, and write each bullet/target pair that touches into
+// hits. Bullets are not removed; kill the ones that should stop.
+pub fn (mut p BulletPool) collide(mut h SpatialHash, team int, mut hits []BulletHit) {
+	hits.clear()
+	for i in 0 .. p.slots.end() {
+		if !p.slots.alive[i] {
+			continue
+		}
+		b := &p.slots.items[i]
+		if team >= 0 && b.team != team {
+			continue
+		}
+		r := p.radius(b)
+		h.query(Rect{int(b.x) - r, int(b.y) - r, 2 * r + 1, 2 * r + 1}, mut p.found)
+		for id in p.found {
+			hits << BulletHit{i, id}
+		}
+	}
+}
+
+// Find a bullet of a team (-1 for any) touching the circle at (x, y), e.g.
+// the player's small hitbox. Returns its slot, or -1 if none.
+pub fn (p &BulletPool) hit_test(x f32, y f32, radius f32, team int) int {
+	for i in 0 .. p.slots.end() {
+		if !p.slots.alive[i] {
+			continue
+		}
+		b := &p.slots.items[i]
+		if team >= 0 && b.team != team {
+			continue
+		}
+		dx := b.x - x
+		dy := b.y - y
+		reach := radius + f32(p.radius(b))
+		if dx * dx + dy * dy <= reach * reach {
+			return i
+		}
+	}
+	return -1
+}
+
+// Find a bullet of a team (-1 for any) inside r. Returns its slot, or -1.
+pub fn (p &BulletPool) hit_rect(r Rect, team int) int {
+	for i in 0 .. p.slots.end() {
+		if !p.slots.alive[i] || (team >= 0 && p.slots.items[i].team != team) {
+			continue
+		}
+		b := p.slots.items[i]
+		if r.has_point(int(b.x), int(b.y)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Draw every bullet offset by (-cam_x, -cam_y), one style at a time.
+pub fn (p &BulletPool) draw(cam_x int, cam_y int) {
+	for si, s in p.styles {
+		if s.shape != .image {
+			graphics_set_color_rgba(s.color)
+		}
+		r := s.radius
+		for i in 0 .. p.slots.end() {
+			if !p.slots.alive[i] || p.slots.items[i].style != si {
+				continue
+			}
+			x := int(p.slots.items[i].x) - cam_x
+			y := int(p.slots.items[i].y) - cam_y
+			match s.shape {
+				.circle { graphics_circle(x, y, u32(r)) }
+				.square { graphics_rect(x - r, y - r, u32(2 * r + 1), u32(2 * r + 1)) }
+				.image { s.image.draw(x - s.image.width / 2, y - s.image.height / 2) }
+			}
+		}
+	}
+}
+
+// Shapes of volley an emitter fires.
+pub enum BulletPattern {
+	// count bullets evenly around a circle.
+	ring
+	// count bullets across spread radians, centered on angle.
+	spread
+	// A spread centered on the target.
+	aimed
+	// A spread whose center sweeps back and forth across spread radians.
+	wave
+}
+
+// Fires a pattern of bullets into a pool at a fixed rate.
+pub struct BulletEmitter {
+pub mut:
+	x       f32
+	y       f32
+	pattern BulletPattern
+	// Bullets per shot.
+	count int = 1
+	// Arc in radians for .spread, .aimed and .wave.
+	spread f32 = pi / 4
+	// Direction in radians (0 is right, pi / 2 is down); .aimed ignores it.
+	angle f32 = pi / 2
+	// Radians the direction turns after each shot.
+	spin f32
+	// How fast a wave sweeps, in radians of its cycle per shot.
+	wave_speed f32 = 0.3
+	speed      f32 = 2
+	accel      f32
+	// Frames between shots.
+	interval int = 10
+	style    int
+	team     int
+	// Bullet life in frames; 0 lives until offscreen.
+	life   int
+	active bool = true
+mut:
+	timer int
+	shots int
+}
+
+// Fire when due and count down to the next shot. (tx, ty) is the target
+// aimed patterns point at.
+pub fn (mut e BulletEmitter) update(mut p BulletPool, tx f32, ty f32) {
+	if !e.active {
+		return
+	}
+	if e.timer <= 0 {
+		e.fire(mut p, tx, ty)
+		e.timer = max_int(1, e.interval)
+	}
+	e.timer--
+}
+
+// Fire one shot now.
+pub fn (mut e BulletEmitter) fire(mut p BulletPool, tx f32, ty f32) {
+	n := max_int(1, e.count)
+	mut center := e.angle
+	mut arc := e.spread
+	match e.pattern {
+		.ring {
+			arc = 2 * pi
+		}
+		.spread {}
+		.aimed {
+			center = atan2f(ty - e.y, tx - e.x)
+		}
+		.wave {
+			center = e.angle + sinf(f32(e.shots) * e.wave_speed) * e.spread / 2
+			arc = 0
+		}
+	}
+	for k in 0 .. n {
+		// A ring spaces bullets a full step apart so the last doesn't land on
+		// the first; a spread puts them at both ends of its arc.
+		a := if e.pattern == .ring {
+			center + arc * f32(k) / f32(n)
+		} else if n == 1 {
+			center
+		} else {
+			center - arc / 2 + arc * f32(k) / f32(n - 1)
+		}
+		if p.fire(e.x, e.y, a, e.speed, e.accel, e.style, e.team, e.life) < 0 {
+			break
+		}
+	}
+	e.angle += e.spin
+	e.shots++
+}
+
+// Reset the emitter to fire at once on its next update.
+pub fn (mut e BulletEmitter) reset() {
+	e.timer = 0
+	e.shots = 0
+}
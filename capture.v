@@ -0,0 +1,42 @@
+module wasm96
+
+// Screenshots.
+
+// Encoding used for saved screenshots.
+pub enum ScreenshotFormat {
+	png
+	qoi
+}
+
+// Capture the last presented frame. Returns none if the host can't read
+// back frames or no size has been set.
+pub fn screenshot() ?Image {
+	if screen_width == 0 || screen_height == 0 {
+		return none
+	}
+	mut img := new_image(int(screen_width), int(screen_height))
+	if !graphics_capture(mut img.pixels) {
+		return none
+	}
+	return img
+}
+
+// Encode an image in the given format.
+pub fn screenshot_encode(img &Image, format ScreenshotFormat) []u8 {
+	return match format {
+		.png { png_encode(img) }
+		.qoi { qoi_encode(img) }
+	}
+}
+
+// Capture the last frame and save it to storage under key.
+pub fn screenshot_save(key []u8, format ScreenshotFormat) bool {
+	img := screenshot() or { return false }
+	return storage_save(key, screenshot_encode(img, format))
+}
+
+// Capture the last frame and hand it to the host to save or share.
+pub fn screenshot_share(format ScreenshotFormat) bool {
+	img := screenshot() or { return false }
+	return system_screenshot(screenshot_encode(img, format))
+}
@@ -0,0 +1,171 @@
+module wasm96
+
+// A small image with a different color and alpha in every pixel.
+fn capture_test_image(width int, height int) Image {
+	mut img := new_image(width, height)
+	for y in 0 .. height {
+		for x in 0 .. width {
+			img.set(x, y, Color{u8(x * 50), u8(y * 100), u8((x + y) * 30), u8(255 - x * 40)})
+		}
+	}
+	return img
+}
+
+fn capture_test_u32(b []u8, i int) u32 {
+	return u32(b[i]) << 24 | u32(b[i + 1]) << 16 | u32(b[i + 2]) << 8 | u32(b[i + 3])
+}
+
+fn test_checksums() {
+	assert crc32('123456789'.bytes()) == 0xcbf43926
+	assert crc32([]u8{}) == 0
+	assert adler32('Wikipedia'.bytes()) == 0x11e60398
+	assert adler32([]u8{}) == 1
+	// Long enough to need the periodic reduction; check against reducing
+	// after every byte.
+	big := []u8{len: 100000, init: 0xff}
+	mut a, mut b := u32(1), u32(0)
+	for v in big {
+		a = (a + v) % 65521
+		b = (b + a) % 65521
+	}
+	assert adler32(big) == b << 16 | a
+}
+
+fn test_zlib_store_round_trip() ! {
+	mut data := []u8{len: 70000}
+	for i in 0 .. data.len {
+		data[i] = u8(i * 31 + i / 256)
+	}
+	assert zlib_decompress(zlib_store(data))! == data
+	assert zlib_decompress(zlib_store([]u8{}))! == []u8{}
+}
+
+fn test_png_encode() ! {
+	img := capture_test_image(5, 3)
+	data := png_encode(img)
+	assert data[..8] == png_signature
+	// IHDR: 5x3, 8-bit RGBA, no interlace.
+	assert data[8..29] == [u8(0), 0, 0, 13, `I`, `H`, `D`, `R`, 0, 0, 0, 5, 0, 0, 0, 3, 8,
+		6, 0, 0, 0]
+	// The IEND chunk is the same in every PNG.
+	assert data[data.len - 12..] == [u8(0), 0, 0, 0, `I`, `E`, `N`, `D`, 0xae, 0x42, 0x60, 0x82]
+	mut pos := 8
+	mut kinds := []string{}
+	mut idat := []u8{}
+	for pos < data.len {
+		n := int(capture_test_u32(data, pos))
+		kind := data[pos + 4..pos + 8].bytestr()
+		assert capture_test_u32(data, pos + 8 + n) == crc32(data[pos + 4..pos + 8 + n])
+		if kind == 'IDAT' {
+			idat << data[pos + 8..pos + 8 + n]
+		}
+		kinds << kind
+		pos += n + 12
+	}
+	assert pos == data.len
+	assert kinds == ['IHDR', 'IDAT', 'IEND']
+	// Each row is filter type 0 followed by the pixels as they are.
+	raw := zlib_decompress(idat)!
+	stride := img.width * 4
+	assert raw.len == (stride + 1) * img.height
+	for y in 0 .. img.height {
+		row := raw[y * (stride + 1)..(y + 1) * (stride + 1)]
+		assert row[0] == 0
+		assert row[1..] == img.pixels[y * stride..(y + 1) * stride]
+	}
+}
+
+// A minimal decoder, enough to check what qoi_encode writes.
+fn capture_test_qoi_decode(data []u8) !Image {
+	if data.len < 22 || data[..4].bytestr() != 'qoif' {
+		return error('qoi: bad header')
+	}
+	w := int(capture_test_u32(data, 4))
+	h := int(capture_test_u32(data, 8))
+	mut img := new_image(w, h)
+	mut index := [64][4]u8{}
+	mut px := [u8(0), 0, 0, 255]!
+	mut pos := 14
+	mut i := 0
+	for i < w * h {
+		b := data[pos]
+		pos++
+		mut run := 1
+		if b == 0xfe {
+			px[0], px[1], px[2] = data[pos], data[pos + 1], data[pos + 2]
+			pos += 3
+		} else if b == 0xff {
+			px[0], px[1], px[2], px[3] = data[pos], data[pos + 1], data[pos + 2], data[pos + 3]
+			pos += 4
+		} else if b >> 6 == 0 {
+			px = index[b]
+		} else if b >> 6 == 1 {
+			px[0] += ((b >> 4) & 3) - 2
+			px[1] += ((b >> 2) & 3) - 2
+			px[2] += (b & 3) - 2
+		} else if b >> 6 == 2 {
+			dg := (b & 0x3f) - 32
+			b2 := data[pos]
+			pos++
+			px[0] += dg + (b2 >> 4) - 8
+			px[1] += dg
+			px[2] += dg + (b2 & 0x0f) - 8
+		} else {
+			run = int(b & 0x3f) + 1
+		}
+		index[qoi_hash(px[0], px[1], px[2], px[3])] = px
+		for _ in 0 .. run {
+			img.pixels[i * 4] = px[0]
+			img.pixels[i * 4 + 1] = px[1]
+			img.pixels[i * 4 + 2] = px[2]
+			img.pixels[i * 4 + 3] = px[3]
+			i++
+		}
+	}
+	if data[pos..] != [u8(0), 0, 0, 0, 0, 0, 0, 1] {
+		return error('qoi: bad end marker')
+	}
+	return img
+}
+
+fn test_qoi_encoding() {
+	// One pixel for each op: run, diff, luma, index, RGBA, RGB, then a run
+	// to the end.
+	mut img := new_image(8, 1)
+	img.set(0, 0, Color{0, 0, 0, 255})
+	img.set(1, 0, Color{1, 255, 0, 255})
+	img.set(2, 0, Color{11, 8, 5, 255})
+	img.set(3, 0, Color{1, 255, 0, 255})
+	img.set(4, 0, Color{1, 255, 0, 128})
+	for x in 5 .. 8 {
+		img.set(x, 0, Color{200, 100, 50, 128})
+	}
+	mut want := 'qoif'.bytes()
+	want << [u8(0), 0, 0, 8, 0, 0, 0, 1, 4, 0]
+	want << [u8(0xc0), 0x76, 0xa9, 0x94, 0x33, 0xff, 1, 255, 0, 128, 0xfe, 200, 100, 50, 0xc1]
+	want << [u8(0), 0, 0, 0, 0, 0, 0, 1]
+	assert qoi_encode(img) == want
+}
+
+fn test_qoi_round_trip() ! {
+	img := capture_test_image(5, 3)
+	assert capture_test_qoi_decode(qoi_encode(img))!.pixels == img.pixels
+	// Runs, small and medium differences and index hits.
+	mut grad := new_image(16, 8)
+	for y in 0 .. 8 {
+		for x in 0 .. 16 {
+			c := if x < 4 || x == 15 {
+				Color{10, 10, 10, 255}
+			} else if x % 2 == 0 {
+				Color{u8(x * 3), u8(y * 2 + x), u8(100 + x), 255}
+			} else {
+				Color{u8(x * 3 + 20), u8(y * 2 + x + 25), u8(100 + x + 20), 128}
+			}
+			grad.set(x, y, c)
+		}
+	}
+	assert capture_test_qoi_decode(qoi_encode(grad))!.pixels == grad.pixels
+	// A run longer than one op holds.
+	flat := new_image(100, 2)
+	assert capture_test_qoi_decode(qoi_encode(flat))!.pixels == flat.pixels
+}
@@ -0,0 +1,341 @@
+module wasm96
+
+// Top-down car physics in fixed point.
+//
+// A Car moves with 16.16 fixed-point position and velocity (65536 = one
+// pixel) and a heading in 1/65536ths of a turn, using only integer math, so
+// a race replays identically from the same inputs on every host, for replays
+// and rollback netplay. Each frame the velocity is split into its forward
+// and sideways parts: throttle and brake act forwards, drag slows both, and
+// the sideways part is mostly cancelled by the tyres' grip. How much sideways
+// speed survives each frame is the drift; more drift and the car slides
+// through corners. A CarTrack gives each tile a surface, such as tarmac,
+// grass or ice, that scales grip, drag and top speed.
+//
+//   mut track := wasm96.new_car_track(map, 0, 'surface', walls)
+//   track.add_surface(wasm96.CarSurface{ name: 'grass', grip: wasm96.fx_from_f32(0.5),
+//       drag: wasm96.fx_from_f32(0.95), top_speed: wasm96.fx_from_f32(0.6) })
+//   mut car := wasm96.new_car(64, 64, wasm96.CarTuning{})
+//   // each frame:
+//   car.update(wasm96.car_input(0), track)
+//   p := car.pos()
+//   sheet.draw_frame(car.direction(16), p.x - cam_x, p.y - cam_y)
+
+// One in 16.16 fixed point.
+pub const fx_one = 65536
+
+// Convert a float to 16.16 fixed point, for setting up tuning values.
+pub fn fx_from_f32(x f32) int {
+	return int(x * 65536)
+}
+
+fn fx_mul(a int, b int) int {
+	return int((i64(a) * i64(b)) >> 16)
+}
+
+fn fx_div(a int, b int) int {
+	return int((i64(a) << 16) / i64(b))
+}
+
+// Sine over a quarter turn in 64 steps, 16.16.
+const car_sin_table = [0, 1608, 3216, 4821, 6424, 8022, 9616, 11204, 12785, 14359, 15924, 17479,
+	19024, 20557, 22078, 23586, 25080, 26558, 28020, 29466, 30893, 32303, 33692, 35062, 36410,
+	37736, 39040, 40320, 41576, 42806, 44011, 45190, 46341, 47464, 48559, 49624, 50660, 51665,
+	52639, 53581, 54491, 55368, 56212, 57022, 57798, 58538, 59244, 59914, 60547, 61145, 61705,
+	62228, 62714, 63162, 63572, 63944, 64277, 64571, 64827, 65043, 65220, 65358, 65457, 65516,
+	65536]
+
+// Get the sine of angle (1/65536ths of a turn) in 16.16.
+pub fn sin_fx(angle int) int {
+	a := angle & 0xffff
+	// 256 steps per turn, interpolating linearly between them.
+	step := a >> 8
+	frac := a & 0xff
+	quadrant := step >> 6
+	i := step & 63
+	mut lo := 0
+	mut hi := 0
+	if quadrant % 2 == 0 {
+		lo = car_sin_table[i]
+		hi = car_sin_table[i + 1]
+	} else {
+		lo = car_sin_table[64 - i]
+		hi = car_sin_table[63 - i]
+	}
+	v := lo + (((hi - lo) * frac) >> 8)
+	return if quadrant >= 2 { -v } else { v }
+}
+
+// Get the cosine of angle (1/65536ths of a turn) in 16.16.
+pub fn cos_fx(angle int) int {
+	return sin_fx(angle + 0x4000)
+}
+
+// How a tile surface changes the car's handling. Every field is a 16.16
+// multiplier on the car's own tuning; fx_one leaves it unchanged.
+pub struct CarSurface {
+pub mut:
+	name      string
+	grip      int = fx_one
+	drag      int = fx_one
+	top_speed int = fx_one
+}
+
+// Surfaces for every tile of a track, and the walls the car bounces off.
+pub struct CarTrack {
+pub mut:
+	width       int
+	height      int
+	tile_width  int
+	tile_height int
+	// Index into surfaces for each tile; 0 is the default surface.
+	cells    []u8
+	surfaces []CarSurface = [CarSurface{
+		name: 'road'
+	}]
+	walls TileCollision
+}
+
+// Build a track from a tile layer, where each tile's surface is named by
+// its tileset property (e.g. "surface" = "grass"). Tiles without the
+// property use surface 0. Add the named surfaces' handling with add_surface;
+// names not added act like surface 0.
+pub fn new_car_track(m &Tilemap, layer int, property string, walls TileCollision) CarTrack {
+	mut t := CarTrack{
+		width: m.width
+		height: m.height
+		tile_width: m.tile_width
+		tile_height: m.tile_height
+		cells: []u8{len: m.width * m.height}
+		walls: walls
+	}
+	mut names := []string{}
+	for i, tile in m.layers[layer].tiles {
+		if tile == 0 {
+			continue
+		}
+		name := m.tile_property(tile, property) or { continue }
+		mut k := names.index(name)
+		if k < 0 {
+			names << name
+			k = names.len - 1
+			t.surfaces << CarSurface{
+				name: name
+			}
+		}
+		t.cells[i] = u8(min_int(k + 1, 255))
+	}
+	return t
+}
+
+// Set the handling of the surface called s.name, adding it if no tile uses
+// it yet. Returns its index.
+pub fn (mut t CarTrack) add_surface(s CarSurface) int {
+	for i, existing in t.surfaces {
+		if existing.name == s.name {
+			t.surfaces[i] = s
+			return i
+		}
+	}
+	t.surfaces << s
+	return t.surfaces.len - 1
+}
+
+// Set the surface of tile (tx, ty).
+pub fn (mut t CarTrack) set_surface(tx int, ty int, surface int) {
+	if tx >= 0 && ty >= 0 && tx < t.width && ty < t.height {
+		t.cells[ty * t.width + tx] = u8(surface)
+	}
+}
+
+// Get the surface under pixel (x, y).
+pub fn (t &CarTrack) surface_at(x int, y int) CarSurface {
+	if t.tile_width <= 0 || t.tile_height <= 0 {
+		return t.surfaces[0]
+	}
+	tx := floor_div(x, t.tile_width)
+	ty := floor_div(y, t.tile_height)
+	if tx < 0 || ty < 0 || tx >= t.width || ty >= t.height {
+		return t.surfaces[0]
+	}
+	i := int(t.cells[ty * t.width + tx])
+	return if i < t.surfaces.len { t.surfaces[i] } else { t.surfaces[0] }
+}
+
+// Handling of a car. Speeds are 16.16 pixels per frame, fractions 16.16.
+pub struct CarTuning {
+pub mut:
+	accel         int = fx_from_f32(0.08)
+	brake         int = fx_from_f32(0.15)
+	max_speed     int = fx_from_f32(4)
+	reverse_speed int = fx_from_f32(1.5)
+	// Fraction of speed kept each frame while coasting.
+	drag int = fx_from_f32(0.985)
+	// Heading change per frame at full lock, in 1/65536ths of a turn.
+	steer int = 700
+	// Speed at which steering reaches full effect; slower cars turn less.
+	steer_speed int = fx_from_f32(1.5)
+	// Fraction of sideways speed kept each frame: 0 grips like rails,
+	// fx_one slides like ice.
+	drift int = fx_from_f32(0.2)
+	// Fraction of speed kept when bouncing off a wall.
+	bounce int = fx_from_f32(0.4)
+}
+
+// Controls for one frame.
+pub struct CarInput {
+pub mut:
+	throttle bool
+	brake    bool
+	// Steering from -256 (full left) to 256 (full right).
+	steer int
+}
+
+// Read car controls from a port: A accelerates, B brakes and reverses, and
+// the d-pad or left stick steers.
+pub fn car_input(port u32) CarInput {
+	mut steer := 0
+	if input_is_button_down(port, .left) {
+		steer -= 256
+	}
+	if input_is_button_down(port, .right) {
+		steer += 256
+	}
+	if steer == 0 {
+		steer = clamp_int(input_get_analog_raw(port, .left, .x) / 128, -256, 256)
+	}
+	return CarInput{
+		throttle: input_is_button_down(port, .a)
+		brake: input_is_button_down(port, .b)
+		steer: steer
+	}
+}
+
+// A car. (x, y) is its center.
+pub struct Car {
+pub mut:
+	tuning CarTuning
+	x      int
+	y      int
+	vx     int
+	vy     int
+	// 0 faces right, 0x4000 down.
+	heading int
+	// Size of the box tested against walls, in pixels.
+	w int = 8
+	h int = 8
+}
+
+// Create a car centered on pixel (x, y), facing right.
+pub fn new_car(x int, y int, tuning CarTuning) Car {
+	return Car{
+		tuning: tuning
+		x: x << 16
+		y: y << 16
+	}
+}
+
+// Get the car's center in pixels.
+pub fn (c &Car) pos() Point {
+	return Point{c.x >> 16, c.y >> 16}
+}
+
+// Get the speed along the heading in 16.16 pixels per frame; negative when
+// reversing.
+pub fn (c &Car) forward_speed() int {
+	return fx_mul(c.vx, cos_fx(c.heading)) + fx_mul(c.vy, sin_fx(c.heading))
+}
+
+// Get the sideways speed in 16.16 pixels per frame, e.g. to draw skid marks
+// or play a screech above some amount.
+pub fn (c &Car) slide_speed() int {
+	return fx_mul(c.vy, cos_fx(c.heading)) - fx_mul(c.vx, sin_fx(c.heading))
+}
+
+// Get the heading in radians, for drawing.
+pub fn (c &Car) angle() f32 {
+	return f32(c.heading & 0xffff) * 2 * pi / 65536
+}
+
+// Advance the car a frame.
+pub fn (mut c Car) update(input CarInput, track &CarTrack) {
+	t := c.tuning
+	p := c.pos()
+	s := track.surface_at(p.x, p.y)
+	mut fwd := c.forward_speed()
+	mut side := c.slide_speed()
+	// Drive.
+	accel := fx_mul(t.accel, s.grip)
+	if input.throttle {
+		fwd += accel
+	}
+	if input.brake {
+		fwd -= if fwd > 0 { fx_mul(t.brake, s.grip) } else { accel / 2 }
+	}
+	top := fx_mul(t.max_speed, s.top_speed)
+	fwd = clamp_int(fwd, -fx_mul(t.reverse_speed, s.top_speed), top)
+	// Drag, and the tyres cancelling sideways slide. Less grip keeps more.
+	fwd = fx_mul(fwd, fx_mul(t.drag, s.drag))
+	keep := t.drift + fx_mul(fx_one - t.drift, fx_one - clamp_int(s.grip, 0, fx_one))
+	side = fx_mul(side, keep)
+	// Steer in proportion to speed, reversed when reversing.
+	if input.steer != 0 && fwd != 0 {
+		amount := fx_div(min_int(iabs(fwd), t.steer_speed), t.steer_speed)
+		turn := fx_mul(t.steer * clamp_int(input.steer, -256, 256) / 256, amount)
+		c.heading = (c.heading + if fwd > 0 { turn } else { -turn }) & 0xffff
+	}
+	// Back to world space along the new heading.
+	cs := cos_fx(c.heading)
+	sn := sin_fx(c.heading)
+	c.vx = fx_mul(fwd, cs) - fx_mul(side, sn)
+	c.vy = fx_mul(fwd, sn) + fx_mul(side, cs)
+	c.move(track.walls)
+}
+
+fn (c &Car) hits(walls &TileCollision, x int, y int) bool {
+	if walls.width == 0 {
+		return false
+	}
+	return walls.overlaps((x >> 16) - c.w / 2, (y >> 16) - c.h / 2, c.w, c.h)
+}
+
+// Move one axis at a time, bouncing off walls.
+fn (mut c Car) move(walls &TileCollision) {
+	if c.hits(walls, c.x + c.vx, c.y) {
+		c.vx = -fx_mul(c.vx, c.tuning.bounce)
+	} else {
+		c.x += c.vx
+	}
+	if c.hits(walls, c.x, c.y + c.vy) {
+		c.vy = -fx_mul(c.vy, c.tuning.bounce)
+	} else {
+		c.y += c.vy
+	}
+}
+
+// Get which of steps evenly spaced directions the car faces, 0 being
+// right and counting clockwise, to pick a frame from a sheet of pre-rotated
+// sprites.
+pub fn (c &Car) direction(steps int) int {
+	n := max_int(1, steps)
+	// Round to the nearest direction.
+	return int(((i64(c.heading & 0xffff) * n + 0x8000) >> 16) % n)
+}
+
+// Save the car's motion.
+pub fn (mut c Car) save_state(mut w StateWriter) {
+	w.write_u32(u32(c.x))
+	w.write_u32(u32(c.y))
+	w.write_u32(u32(c.vx))
+	w.write_u32(u32(c.vy))
+	w.write_u32(u32(c.heading))
+}
+
+// Restore the car's motion.
+pub fn (mut c Car) load_state(mut r StateReader) ! {
+	c.x = int(r.read_u32()!)
+	c.y = int(r.read_u32()!)
+	c.vx = int(r.read_u32()!)
+	c.vy = int(r.read_u32()!)
+	c.heading = int(r.read_u32()!)
+}
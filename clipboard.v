@@ -0,0 +1,43 @@
+module wasm96
+
+// System clipboard access through the frontend, for level editors, password
+// systems and anything else exchanging text with the user's desktop.
+//
+// wasm96_system_clipboard_get copies the clipboard's text into the buffer
+// and returns its length, or -1 if it holds no text. Text longer than the
+// buffer isn't copied; its length is returned so the call can be retried.
+
+__global clipboard_buf []u8
+
+// Get the text on the system clipboard, or none if it holds no text or the
+// host has no clipboard.
+pub fn clipboard_get() ?string {
+	if !compat_require(.clipboard) {
+		return none
+	}
+	if clipboard_buf.len == 0 {
+		clipboard_buf = []u8{len: 256}
+	}
+	for {
+		n := C.wasm96_system_clipboard_get(&clipboard_buf[0], usize(clipboard_buf.len))
+		if n < 0 {
+			return none
+		}
+		if n > clipboard_buf.len {
+			clipboard_buf = []u8{len: n}
+			continue
+		}
+		return clipboard_buf[..n].bytestr()
+	}
+	return none
+}
+
+// Put text on the system clipboard. Returns false if the host has no
+// clipboard.
+pub fn clipboard_set(text string) bool {
+	if !compat_require(.clipboard) {
+		return false
+	}
+	ptr := if text.len > 0 { text.str } else { unsafe { nil } }
+	return record_status(C.wasm96_system_clipboard_set(ptr, usize(text.len)))
+}
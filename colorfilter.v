@@ -0,0 +1,163 @@
+module wasm96
+
+// Accessibility color filters.
+//
+// A ColorFilter remaps every pixel of the finished frame: a high-contrast
+// mode, or a simulation of protanopia, deuteranopia or tritanopia (to check
+// a game stays readable) which can instead daltonize (shift the colors those
+// players can't tell apart into ones they can). Work is done through lookup
+// tables built once: sRGB to linear light, a 3x3 matrix in fixed point
+// (Machado et al. 2009 for the simulations), and back to sRGB. sRGB is
+// approximated with gamma 2, close enough for these filters.
+//
+// The filter selected with accessibility_set_filter is applied as a
+// VirtualScreen is presented, so games drawing through one get it for free;
+// others can filter their own offscreen frame with accessibility_apply.
+
+// Full-frame color filters.
+pub enum ColorFilterMode {
+	none
+	high_contrast
+	protanopia
+	deuteranopia
+	tritanopia
+}
+
+const cf_lin_max = 4095
+
+// A color filter with its lookup tables.
+pub struct ColorFilter {
+pub:
+	mode ColorFilterMode
+	// Correct for the deficiency instead of simulating it.
+	daltonize bool
+mut:
+	matrix  [9]int
+	to_lin  []u16
+	to_srgb []u8
+	curve   []u8
+}
+
+__global color_filter ColorFilter
+
+// Create a filter. daltonize only affects the color vision modes.
+pub fn new_color_filter(mode ColorFilterMode, daltonize bool) ColorFilter {
+	mut f := ColorFilter{
+		mode: mode
+		daltonize: daltonize
+		to_lin: []u16{len: 256}
+		to_srgb: []u8{len: cf_lin_max + 1}
+		curve: []u8{len: 256}
+	}
+	for i in 0 .. 256 {
+		f.to_lin[i] = u16(i * i * cf_lin_max / (255 * 255))
+		// Stretch contrast around the middle and clip.
+		f.curve[i] = u8(clamp_int((i - 128) * 8 / 5 + 128, 0, 255))
+	}
+	for i in 0 .. cf_lin_max + 1 {
+		f.to_srgb[i] = u8(int(sqrtf(f32(i) / cf_lin_max) * 255 + 0.5))
+	}
+	sim := match mode {
+		.protanopia {
+			[f32(0.152286), 1.052583, -0.204868, 0.114503, 0.786281, 0.099216, -0.003882, -0.048116,
+				1.051998]
+		}
+		.deuteranopia {
+			[f32(0.367322), 0.860646, -0.227968, 0.280085, 0.672501, 0.047413, -0.011820, 0.042940,
+				0.968881]
+		}
+		.tritanopia {
+			[f32(1.255528), -0.076749, -0.178779, -0.078411, 0.930809, 0.147602, 0.004733, 0.691367,
+				0.303900]
+		}
+		else {
+			[f32(1), 0, 0, 0, 1, 0, 0, 0, 1]
+		}
+	}
+	mut m := sim.clone()
+	if daltonize {
+		// Daltonize: add the error the simulation loses (original minus
+		// simulated), redistributed into channels the viewer can see.
+		// D = I + E * (I - S).
+		err := [f32(0), 0, 0, 0.7, 1, 0, 0.7, 0, 1]
+		for r in 0 .. 3 {
+			for c in 0 .. 3 {
+				mut v := if r == c { f32(1) } else { f32(0) }
+				for k in 0 .. 3 {
+					id := if k == c { f32(1) } else { f32(0) }
+					v += err[r * 3 + k] * (id - sim[k * 3 + c])
+				}
+				m[r * 3 + c] = v
+			}
+		}
+	}
+	for i in 0 .. 9 {
+		half := if m[i] < 0 { f32(-0.5) } else { f32(0.5) }
+		f.matrix[i] = int(m[i] * 4096 + half)
+	}
+	return f
+}
+
+// Filter every pixel of img in place.
+pub fn (f &ColorFilter) apply_image(mut img Image) {
+	p := img.pixels
+	if f.mode == .none {
+		return
+	}
+	if f.mode == .high_contrast {
+		for i := 0; i < p.len; i += 4 {
+			img.pixels[i] = f.curve[p[i]]
+			img.pixels[i + 1] = f.curve[p[i + 1]]
+			img.pixels[i + 2] = f.curve[p[i + 2]]
+		}
+		return
+	}
+	m := f.matrix
+	for i := 0; i < p.len; i += 4 {
+		r := int(f.to_lin[p[i]])
+		g := int(f.to_lin[p[i + 1]])
+		b := int(f.to_lin[p[i + 2]])
+		img.pixels[i] = f.to_srgb[clamp_int((m[0] * r + m[1] * g + m[2] * b) >> 12, 0, cf_lin_max)]
+		img.pixels[i + 1] = f.to_srgb[clamp_int((m[3] * r + m[4] * g + m[5] * b) >> 12, 0,
+			cf_lin_max)]
+		img.pixels[i + 2] = f.to_srgb[clamp_int((m[6] * r + m[7] * g + m[8] * b) >> 12, 0,
+			cf_lin_max)]
+	}
+}
+
+// Filter a single color.
+pub fn (f &ColorFilter) apply_color(c Color) Color {
+	mut img := Image{
+		width: 1
+		height: 1
+		pixels: [c.r, c.g, c.b, c.a]
+	}
+	f.apply_image(mut img)
+	return Color{img.pixels[0], img.pixels[1], img.pixels[2], c.a}
+}
+
+// Select the filter accessibility_apply uses.
+pub fn accessibility_set_filter(mode ColorFilterMode, daltonize bool) {
+	if mode == color_filter.mode && daltonize == color_filter.daltonize && color_filter.to_lin.len > 0 {
+		return
+	}
+	color_filter = new_color_filter(mode, daltonize)
+}
+
+// Get the filter accessibility_apply uses.
+pub fn accessibility_filter() ColorFilterMode {
+	return color_filter.mode
+}
+
+// Returns true if a filter is selected.
+pub fn accessibility_active() bool {
+	return color_filter.mode != .none
+}
+
+// Filter a finished frame drawn offscreen, in place, before it goes on
+// screen. VirtualScreen.present does this itself.
+pub fn accessibility_apply(mut frame Image) {
+	if color_filter.mode != .none {
+		color_filter.apply_image(mut frame)
+	}
+}
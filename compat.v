@@ -0,0 +1,125 @@
+module wasm96
+
+// Graceful degradation for hosts that lack optional features.
+//
+// Every SDK call that depends on an optional feature goes through
+// compat_require, never system_has_feature directly. When the host does not
+// report the feature, the call falls back to an emulated path (or does
+// nothing) and the feature is recorded as degraded, so one guest binary keeps
+// running on older hosts.
+//
+// The guest still imports every host function it might call, and a wasm
+// module whose imports can't all be resolved fails to instantiate. Hosts
+// must therefore satisfy wasm96_* imports they don't implement with stubs
+// that return 0 (wasmtime's define_unknown_imports_as_traps works too, since
+// the SDK never reaches them). A host without wasm96_system_abi_version and
+// wasm96_system_features stubbed that way reports ABI 0 and no features, and
+// everything optional degrades.
+
+__global compat_degraded Feature
+
+// Get the set of features the guest has used that the host did not support
+// and that were emulated or ignored instead.
+pub fn system_degraded() Feature {
+	return compat_degraded
+}
+
+// Log the set of degraded features to the host console.
+pub fn system_log_degraded() {
+	if compat_degraded == unsafe { Feature(0) } {
+		system_log('wasm96: no features degraded'.bytes())
+		return
+	}
+	system_log('wasm96: degraded features: ${compat_degraded}'.bytes())
+}
+
+// Returns true if the host supports feature. Otherwise records it as degraded
+// (logging the first time) and returns false so the caller can fall back.
+fn compat_require(feature Feature) bool {
+	if system_has_feature(feature) {
+		return true
+	}
+	if !compat_degraded.has(feature) {
+		compat_degraded.set(feature)
+		system_log('wasm96: host lacks ${feature}, using fallback'.bytes())
+	}
+	return false
+}
+
+fn compat_word(words []u32, i int) int {
+	return int(words[i])
+}
+
+// Replay recorded batch commands through the individual host imports.
+fn compat_batch_replay(words []u32) {
+	mut i := 0
+	for i < words.len {
+		op := unsafe { BatchOp(words[i]) }
+		w := words[i + 1..]
+		match op {
+			.set_color {
+				C.wasm96_graphics_set_color(w[0], w[1], w[2], w[3])
+				i += 5
+			}
+			.background {
+				C.wasm96_graphics_background(w[0], w[1], w[2])
+				i += 4
+			}
+			.point {
+				C.wasm96_graphics_point(compat_word(w, 0), compat_word(w, 1))
+				i += 3
+			}
+			.line {
+				C.wasm96_graphics_line(compat_word(w, 0), compat_word(w, 1), compat_word(w, 2),
+					compat_word(w, 3))
+				i += 5
+			}
+			.rect {
+				C.wasm96_graphics_rect(compat_word(w, 0), compat_word(w, 1), w[2], w[3])
+				i += 5
+			}
+			.rect_outline {
+				C.wasm96_graphics_rect_outline(compat_word(w, 0), compat_word(w, 1), w[2], w[3])
+				i += 5
+			}
+			.circle {
+				C.wasm96_graphics_circle(compat_word(w, 0), compat_word(w, 1), w[2])
+				i += 4
+			}
+			.circle_outline {
+				C.wasm96_graphics_circle_outline(compat_word(w, 0), compat_word(w, 1), w[2])
+				i += 4
+			}
+			.triangle {
+				C.wasm96_graphics_triangle(compat_word(w, 0), compat_word(w, 1), compat_word(w, 2),
+					compat_word(w, 3), compat_word(w, 4), compat_word(w, 5))
+				i += 7
+			}
+			.triangle_outline {
+				C.wasm96_graphics_triangle_outline(compat_word(w, 0), compat_word(w, 1),
+					compat_word(w, 2), compat_word(w, 3), compat_word(w, 4), compat_word(w, 5))
+				i += 7
+			}
+			.bezier_quadratic {
+				C.wasm96_graphics_bezier_quadratic(compat_word(w, 0), compat_word(w, 1),
+					compat_word(w, 2), compat_word(w, 3), compat_word(w, 4), compat_word(w, 5),
+					w[6])
+				i += 8
+			}
+			.bezier_cubic {
+				C.wasm96_graphics_bezier_cubic(compat_word(w, 0), compat_word(w, 1), compat_word(w, 2),
+					compat_word(w, 3), compat_word(w, 4), compat_word(w, 5), compat_word(w, 6),
+					compat_word(w, 7), w[8])
+				i += 10
+			}
+			.pill {
+				C.wasm96_graphics_pill(compat_word(w, 0), compat_word(w, 1), w[2], w[3])
+				i += 5
+			}
+			.pill_outline {
+				C.wasm96_graphics_pill_outline(compat_word(w, 0), compat_word(w, 1), w[2], w[3])
+				i += 5
+			}
+		}
+	}
+}
@@ -0,0 +1,176 @@
+module wasm96
+
+// In-game debug console.
+
+// A console command handler. args holds the words after the command name.
+pub type ConsoleCommand = fn (args []string)
+
+struct Console {
+mut:
+	open        bool
+	slide       f32
+	toggle_key  u32 = u32(Key.backquote)
+	commands    map[string]ConsoleCommand
+	input       TextInput
+	history     []string
+	history_pos int
+	lines       []string
+	max_lines   int = 128
+}
+
+__global console Console
+
+// Register a command that can be run from the console.
+pub fn console_register(name string, handler ConsoleCommand) {
+	console.commands[name] = handler
+}
+
+// Remove a registered console command.
+pub fn console_unregister(name string) {
+	console.commands.delete(name)
+}
+
+// Set the key that opens and closes the console (backquote by default).
+pub fn console_set_toggle_key(key u32) {
+	console.toggle_key = key
+}
+
+// Returns true if the console is open and consuming keyboard input.
+pub fn console_is_open() bool {
+	return console.open
+}
+
+// Open or close the console.
+pub fn console_set_open(open bool) {
+	console.open = open
+}
+
+// Print a line to the console scrollback without logging it to the host.
+pub fn console_print(line string) {
+	console_echo(line)
+}
+
+fn console_echo(text string) {
+	for line in text.split_into_lines() {
+		console.lines << line
+	}
+	if console.lines.len > console.max_lines {
+		console.lines.delete_many(0, console.lines.len - console.max_lines)
+	}
+}
+
+// Run a command line as if it was typed into the console.
+pub fn console_exec(line string) {
+	words := line.fields()
+	if words.len == 0 {
+		return
+	}
+	console_echo('> ${line}')
+	name := words[0]
+	args := words[1..]
+	match name {
+		'help' {
+			mut names := console.commands.keys()
+			names.sort()
+			console_echo('help clear ' + names.join(' '))
+		}
+		'clear' {
+			console.lines.clear()
+		}
+		else {
+			if handler := console.commands[name] {
+				handler(args)
+			} else {
+				console_echo('unknown command: ${name}')
+			}
+		}
+	}
+}
+
+fn console_recall(step int) {
+	if console.history.len == 0 {
+		return
+	}
+	console.history_pos += step
+	if console.history_pos < 0 {
+		console.history_pos = 0
+	}
+	if console.history_pos >= console.history.len {
+		console.history_pos = console.history.len
+		console.input.clear()
+		return
+	}
+	console.input.set(console.history[console.history_pos])
+}
+
+// Poll the keyboard and feed key events to the console. Call once per frame;
+// read keyboard_events afterwards instead of calling keyboard_poll yourself.
+pub fn console_update() {
+	keyboard_poll()
+	for ev in keyboard_events() {
+		if ev.pressed && ev.key == console.toggle_key {
+			console.open = !console.open
+			continue
+		}
+		if !console.open || !ev.pressed {
+			continue
+		}
+		match ev.key {
+			u32(Key.up) {
+				console_recall(-1)
+			}
+			u32(Key.down) {
+				console_recall(1)
+			}
+			u32(Key.escape) {
+				console.open = false
+			}
+			else {
+				if console.input.handle(ev) {
+					line := console.input.str()
+					console.input.clear()
+					if line.len > 0 {
+						console.history << line
+					}
+					console.history_pos = console.history.len
+					console_exec(line)
+				}
+			}
+		}
+	}
+	target := if console.open { f32(1) } else { f32(0) }
+	console.slide += (target - console.slide) * 0.35
+	if console.slide < 0.01 && !console.open {
+		console.slide = 0
+	}
+}
+
+// Draw the console if it is open or sliding closed.
+pub fn console_draw() {
+	if console.slide <= 0 || !debug_font_ready() {
+		return
+	}
+	line_height := int(graphics_text_measure_key(debug_font_key, 'M'.bytes()).height)
+	if line_height <= 0 {
+		return
+	}
+	full := int(screen_height) / 2
+	height := int(f32(full) * console.slide)
+	top := height - full
+	saved := current_color
+	graphics_set_color(16, 16, 24, 220)
+	graphics_rect(0, top, screen_width, u32(full))
+	graphics_set_color(255, 255, 255, 255)
+	mut y := top + full - line_height - 2
+	prompt := '> ' + console.input.str()[..console.input.cursor] + '_' +
+		console.input.str()[console.input.cursor..]
+	graphics_text_key(2, y, debug_font_key, prompt.bytes())
+	graphics_set_color(180, 180, 180, 255)
+	for i := console.lines.len - 1; i >= 0 && y > top; i-- {
+		y -= line_height
+		if console.lines[i].len > 0 {
+			graphics_text_key(2, y, debug_font_key, console.lines[i].bytes())
+		}
+	}
+	graphics_set_color(saved[0], saved[1], saved[2], saved[3])
+}
@@ -0,0 +1,109 @@
+module wasm96
+
+// Frame-yielding coroutines.
+//
+// A coroutine is a function that is called once per tick of its scheduler.
+// Returning from the function yields until the next frame. Longer scripts are
+// written as a state machine over co.stage, moving on with next or waiting
+// with wait:
+//
+//   sched.start(fn (mut co wasm96.Coroutine) {
+//       match co.stage {
+//           0 { show_title(); co.wait(60); co.next() }
+//           1 { if fade_out() { co.next() } }
+//           else { co.finish() }
+//       }
+//   })
+
+// The body of a coroutine.
+pub type CoroutineFn = fn (mut co Coroutine)
+
+// A running coroutine.
+pub struct Coroutine {
+pub mut:
+	// The stage the body resumes at.
+	stage int
+mut:
+	body         CoroutineFn = unsafe { nil }
+	wait_frames  u64
+	stage_frames u64
+	finished     bool
+}
+
+// Resume at the next stage on the next frame.
+pub fn (mut co Coroutine) next() {
+	co.goto(co.stage + 1)
+}
+
+// Resume at stage on the next frame.
+pub fn (mut co Coroutine) goto(stage int) {
+	co.stage = stage
+	co.stage_frames = 0
+}
+
+// Do not resume for the next frames frames.
+pub fn (mut co Coroutine) wait(frames u64) {
+	co.wait_frames = frames
+}
+
+// Stop the coroutine. It is removed from its scheduler on the next tick.
+pub fn (mut co Coroutine) finish() {
+	co.finished = true
+}
+
+// Returns true once the coroutine has finished.
+pub fn (co &Coroutine) done() bool {
+	return co.finished
+}
+
+// Get how many times the body has run in the current stage, counting the
+// current run.
+pub fn (co &Coroutine) stage_frames() u64 {
+	return co.stage_frames
+}
+
+// Runs coroutines once per tick.
+pub struct Scheduler {
+mut:
+	coroutines []&Coroutine
+}
+
+// Start a coroutine. Its body first runs on the next tick.
+pub fn (mut s Scheduler) start(body CoroutineFn) &Coroutine {
+	co := &Coroutine{
+		body: body
+	}
+	s.coroutines << co
+	return co
+}
+
+// Run every coroutine that is not waiting. Call once per update.
+pub fn (mut s Scheduler) tick() {
+	// Coroutines started during the tick first run on the next one.
+	count := s.coroutines.len
+	for i in 0 .. count {
+		mut co := s.coroutines[i]
+		if co.finished {
+			continue
+		}
+		if co.wait_frames > 0 {
+			co.wait_frames--
+			continue
+		}
+		co.stage_frames++
+		co.body(mut co)
+	}
+	if s.coroutines.any(it.finished) {
+		s.coroutines = s.coroutines.filter(!it.finished)
+	}
+}
+
+// Stop every coroutine.
+pub fn (mut s Scheduler) stop_all() {
+	s.coroutines.clear()
+}
+
+// Get the number of coroutines that have not finished.
+pub fn (s &Scheduler) running() int {
+	return s.coroutines.len
+}
@@ -0,0 +1,140 @@
+module wasm96
+
+// Crash screen.
+//
+// V panics abort the module and cannot be intercepted, so the crash screen
+// works with errors instead: frame code that returns an error through
+// recover_to_screen stops running and the error is shown on screen from then
+// on, instead of the host tearing down a black screen. A crash report is also
+// written to the host log, and optionally to storage.
+
+struct CrashState {
+mut:
+	active   bool
+	message  string
+	code     int
+	frame    u64
+	save_key []u8
+}
+
+__global crash CrashState
+
+// Run frame, and if it returns an error, switch to the crash screen.
+// Once crashed, frame is no longer called and the crash screen is drawn
+// every time instead. Call from the exported draw function:
+//
+//   wasm96.recover_to_screen(fn () ! { game.frame()! })
+pub fn recover_to_screen(frame fn () !) {
+	if !crash.active {
+		frame() or { crash_enter(err) }
+	}
+	if crash.active {
+		crash_draw()
+	}
+}
+
+// Switch to the crash screen with a message.
+pub fn crash_screen(message string) {
+	crash_enter(error(message))
+}
+
+// Returns true once the crash screen is being shown.
+pub fn crash_active() bool {
+	return crash.active
+}
+
+fn crash_enter(err IError) {
+	batch.active = false
+	batch.words.clear()
+	crash.active = true
+	crash.message = err.msg()
+	crash.code = err.code()
+	crash_report(err)
+}
+
+// Also save crash reports to storage under key, so a frontend or the next
+// run of the guest can collect them. An empty key disables saving.
+pub fn crash_set_save_key(key []u8) {
+	crash.save_key = key.clone()
+}
+
+// Build the crash report written to the host log for err.
+pub fn crash_report_text(err IError) string {
+	mut lines := []string{}
+	lines << 'wasm96: guest crashed'
+	lines << 'error: ${err.msg()}'
+	if err.code() != 0 {
+		lines << 'code: ${err.code()}'
+	}
+	lines << 'sdk: ${sdk_version}'
+	lines << 'abi: guest ${abi_version}, host ${system_abi_version()}'
+	lines << 'features: ${system_host_features()}'
+	lines << 'degraded: ${system_degraded()}'
+	lines << 'uptime_ms: ${C.wasm96_system_millis()}'
+	lines << 'heap_bytes: ${gc_memory_use()}'
+	return lines.join('\n')
+}
+
+fn crash_report(err IError) {
+	report := crash_report_text(err)
+	for line in report.split_into_lines() {
+		system_log(line.bytes())
+	}
+	if crash.save_key.len > 0 {
+		storage_save(crash.save_key, report.bytes())
+	}
+}
+
+fn crash_wrap(text string, max_chars int) []string {
+	mut lines := []string{}
+	for paragraph in text.split_into_lines() {
+		mut line := ''
+		for word in paragraph.fields() {
+			if line.len > 0 && line.len + 1 + word.len > max_chars {
+				lines << line
+				line = ''
+			}
+			line = if line.len == 0 { word } else { line + ' ' + word }
+		}
+		lines << line
+	}
+	return lines
+}
+
+fn crash_draw() {
+	crash.frame++
+	graphics_background(96, 0, 0)
+	if !debug_font_ready() {
+		return
+	}
+	size := graphics_text_measure_key(debug_font_key, 'M'.bytes())
+	if size.width == 0 || size.height == 0 {
+		return
+	}
+	margin := int(size.width) * 2
+	max_chars := (int(screen_width) - margin * 2) / int(size.width)
+	mut y := margin
+	// Blink the title so a frozen host is distinguishable from a crashed guest.
+	if (crash.frame / 30) % 2 == 0 {
+		graphics_set_color(255, 255, 255, 255)
+		graphics_text_key(margin, y, debug_font_key, 'GUEST CRASHED'.bytes())
+	}
+	y += int(size.height) * 2
+	graphics_set_color(255, 220, 220, 255)
+	if crash.code != 0 {
+		graphics_text_key(margin, y, debug_font_key, 'error code ${crash.code}'.bytes())
+		y += int(size.height) * 2
+	}
+	for line in crash_wrap(crash.message, if max_chars > 8 { max_chars } else { 8 }) {
+		if y > int(screen_height) - margin {
+			break
+		}
+		if line.len > 0 {
+			graphics_text_key(margin, y, debug_font_key, line.bytes())
+		}
+		y += int(size.height)
+	}
+	y += int(size.height)
+	graphics_set_color(200, 160, 160, 255)
+	graphics_text_key(margin, y, debug_font_key, 'wasm96 sdk ${sdk_version}'.bytes())
+}
@@ -0,0 +1,124 @@
+module wasm96
+
+// Gamepad-driven mouse cursor.
+//
+// A VirtualCursor moves with the d-pad (speeding up the longer it is held)
+// or the left analog stick, and maps joypad buttons to mouse clicks. Real
+// mouse input is merged in: moving the mouse snaps the cursor to it and its
+// buttons click too, so point-and-click games work on a TV with a pad and
+// on a desktop alike.
+
+// A mouse cursor driven by a joypad and the real mouse.
+pub struct VirtualCursor {
+pub mut:
+	port u32
+	x    f32
+	y    f32
+	// D-pad speed in pixels per frame: starting speed, gain per frame held,
+	// and top speed (also the analog stick's top speed).
+	speed     f32 = 1
+	accel     f32 = 0.2
+	max_speed f32 = 6
+	// Joypad buttons acting as the left and right mouse buttons.
+	click       Button = .a
+	right_click Button = .b
+	// Drawn with its top-left at the cursor; a plain arrow when unset.
+	sprite &Image = unsafe { nil }
+	color  Color  = Color{255, 255, 255, 255}
+mut:
+	held    int
+	mouse_x int = -1
+	mouse_y int = -1
+	buttons u32
+	prev    u32
+}
+
+// Create a cursor at (x, y) driven by port's joypad.
+pub fn new_virtual_cursor(x int, y int, port u32) VirtualCursor {
+	return VirtualCursor{
+		port: port
+		x: f32(x)
+		y: f32(y)
+	}
+}
+
+// Move the cursor and read its buttons. Call once per frame.
+pub fn (mut vc VirtualCursor) update() {
+	mx := input_get_mouse_x()
+	my := input_get_mouse_y()
+	if vc.mouse_x >= 0 && (mx != vc.mouse_x || my != vc.mouse_y) {
+		vc.x = f32(mx)
+		vc.y = f32(my)
+	}
+	vc.mouse_x = mx
+	vc.mouse_y = my
+	mut dx := f32(0)
+	mut dy := f32(0)
+	if input_is_button_down(vc.port, .left) {
+		dx -= 1
+	}
+	if input_is_button_down(vc.port, .right) {
+		dx += 1
+	}
+	if input_is_button_down(vc.port, .up) {
+		dy -= 1
+	}
+	if input_is_button_down(vc.port, .down) {
+		dy += 1
+	}
+	if dx != 0 || dy != 0 {
+		v := minf(vc.speed + vc.accel * f32(vc.held), vc.max_speed)
+		vc.x += dx * v
+		vc.y += dy * v
+		vc.held++
+	} else {
+		vc.held = 0
+	}
+	sx, sy := input_get_stick(vc.port, .left)
+	vc.x += sx * vc.max_speed
+	vc.y += sy * vc.max_speed
+	vc.x = clampf(vc.x, 0, f32(int(screen_width) - 1))
+	vc.y = clampf(vc.y, 0, f32(int(screen_height) - 1))
+	vc.prev = vc.buttons
+	vc.buttons = 0
+	if input_is_button_down(vc.port, vc.click) || input_is_mouse_down(0) {
+		vc.buttons |= 1
+	}
+	if input_is_button_down(vc.port, vc.right_click) || input_is_mouse_down(1) {
+		vc.buttons |= 2
+	}
+	if input_is_mouse_down(2) {
+		vc.buttons |= 4
+	}
+}
+
+// Get the cursor position in pixels.
+pub fn (vc &VirtualCursor) position() (int, int) {
+	return int(vc.x), int(vc.y)
+}
+
+// Returns true if mouse button btn (0 left, 1 right, 2 middle) is held.
+pub fn (vc &VirtualCursor) down(btn u32) bool {
+	return btn < 3 && vc.buttons & (u32(1) << btn) != 0
+}
+
+// Returns true if mouse button btn went down this frame.
+pub fn (vc &VirtualCursor) pressed(btn u32) bool {
+	return btn < 3 && vc.buttons & ~vc.prev & (u32(1) << btn) != 0
+}
+
+// Returns true if mouse button btn was let go this frame.
+pub fn (vc &VirtualCursor) released(btn u32) bool {
+	return btn < 3 && vc.prev & ~vc.buttons & (u32(1) << btn) != 0
+}
+
+// Draw the cursor.
+pub fn (vc &VirtualCursor) draw() {
+	x, y := vc.position()
+	if vc.sprite != unsafe { nil } {
+		vc.sprite.draw(x, y)
+		return
+	}
+	graphics_set_color_rgba(vc.color)
+	graphics_triangle(x, y, x, y + 10, x + 7, y + 7)
+}
@@ -0,0 +1,159 @@
+module wasm96
+
+// Day/night cycle.
+//
+// A DayNight runs a clock through a day of a set number of frames and
+// blends between keyframes at given hours to give the ambient color and
+// light level for any moment. Feed the ambient color to a LightMap, so
+// lights show up at night, or grade the whole frame with a ColorGrade:
+//
+//   mut sky := wasm96.new_day_night(60 * 60 * 8) // an 8 minute day
+//   // each frame:
+//   sky.update()
+//   sky.apply_light_map(mut lights)
+//   ...
+//   vscreen.grade = *sky.grade()
+//   vscreen.present()
+
+// The sky at one hour of the day.
+pub struct DayNightKey {
+pub:
+	// Hour of the day, 0 to 24.
+	hour    f32
+	ambient Color
+	// Overall light, 0 (dark) to 1 (noon).
+	light f32
+}
+
+// A day/night clock.
+pub struct DayNight {
+pub mut:
+	// Frames in a whole day.
+	day_frames u64 = 60 * 60 * 10
+	// Sky keyframes in order of hour; the last blends into the first across
+	// midnight.
+	keys []DayNightKey = [
+		DayNightKey{0, Color{30, 36, 80, 255}, 0.2},
+		DayNightKey{5, Color{40, 44, 90, 255}, 0.25},
+		DayNightKey{7, Color{240, 170, 130, 255}, 0.7},
+		DayNightKey{12, Color{255, 255, 255, 255}, 1},
+		DayNightKey{17, Color{255, 235, 200, 255}, 0.9},
+		DayNightKey{19, Color{220, 120, 110, 255}, 0.55},
+		DayNightKey{21, Color{50, 50, 110, 255}, 0.25},
+	]
+	// Clock speed; 0 stops time.
+	speed u64 = 1
+mut:
+	now   u64
+	cache ColorGrade
+}
+
+// Create a cycle with day_frames frames to a day, starting at 8 in the
+// morning.
+pub fn new_day_night(day_frames u64) DayNight {
+	mut dn := DayNight{
+		day_frames: day_frames
+	}
+	dn.set_hour(8)
+	return dn
+}
+
+// Advance the clock a frame.
+pub fn (mut dn DayNight) update() {
+	if dn.day_frames > 0 {
+		dn.now = (dn.now + dn.speed) % dn.day_frames
+	}
+}
+
+// Get the hour of the day, 0 to 24.
+pub fn (dn &DayNight) hour() f32 {
+	if dn.day_frames == 0 {
+		return 0
+	}
+	return f32(dn.now) * 24 / f32(dn.day_frames)
+}
+
+// Set the clock to an hour of the day.
+pub fn (mut dn DayNight) set_hour(hour f32) {
+	if dn.day_frames == 0 {
+		return
+	}
+	h := hour - 24 * floorf(hour / 24)
+	dn.now = u64(h * f32(dn.day_frames) / 24) % dn.day_frames
+}
+
+// Get the keyframes either side of the current hour and how far between
+// them it is.
+fn (dn &DayNight) span() (DayNightKey, DayNightKey, f32) {
+	if dn.keys.len == 0 {
+		k := DayNightKey{0, Color{255, 255, 255, 255}, 1}
+		return k, k, 0
+	}
+	h := dn.hour()
+	mut i := dn.keys.len - 1
+	for j, k in dn.keys {
+		if k.hour <= h {
+			i = j
+		}
+	}
+	a := dn.keys[i]
+	b := dn.keys[(i + 1) % dn.keys.len]
+	// Measure forwards, wrapping across midnight.
+	mut length := b.hour - a.hour
+	if length <= 0 {
+		length += 24
+	}
+	mut into := h - a.hour
+	if into < 0 {
+		into += 24
+	}
+	return a, b, clampf(into / length, 0, 1)
+}
+
+// Get the ambient color now.
+pub fn (dn &DayNight) ambient() Color {
+	a, b, t := dn.span()
+	return color_lerp(a.ambient, b.ambient, t)
+}
+
+// Get the light level now, 0 to 1.
+pub fn (dn &DayNight) light() f32 {
+	a, b, t := dn.span()
+	return lerpf(a.light, b.light, t)
+}
+
+// Returns true when it is dark enough for lights to matter.
+pub fn (dn &DayNight) is_night() bool {
+	return dn.light() < 0.4
+}
+
+// Set a light map's ambient color to the sky's, so unlit areas darken at
+// night.
+pub fn (dn &DayNight) apply_light_map(mut lm LightMap) {
+	c := dn.ambient()
+	l := dn.light()
+	lm.ambient = Color{u8(f32(c.r) * l), u8(f32(c.g) * l), u8(f32(c.b) * l), 255}
+}
+
+// Get a color grade for the current moment. The tables are rebuilt only
+// when the sky has changed.
+pub fn (mut dn DayNight) grade() &ColorGrade {
+	c := dn.ambient()
+	l := dn.light()
+	// Desaturate a little in the dark, as eyes do.
+	sat := clampf(0.5 + l / 2, 0, 1)
+	if dn.cache.r.len == 0 || dn.cache.tint != c || dn.cache.brightness != l {
+		dn.cache = new_color_grade(c, l, sat)
+	}
+	return &dn.cache
+}
+
+// Save the clock.
+pub fn (mut dn DayNight) save_state(mut w StateWriter) {
+	w.write_u64(dn.now)
+}
+
+// Restore the clock.
+pub fn (mut dn DayNight) load_state(mut r StateReader) ! {
+	dn.now = r.read_u64()!
+}
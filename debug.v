@@ -0,0 +1,181 @@
+module wasm96
+
+// Debug stats HUD.
+
+const debug_font_key = 'wasm96.debug'.bytes()
+const debug_font_size = u32(8)
+const debug_frame_window = 32
+
+// Screen corner the stats HUD is anchored to.
+pub enum StatsCorner {
+	top_left
+	top_right
+	bottom_left
+	bottom_right
+}
+
+// A snapshot of the values shown by the stats HUD.
+pub struct FrameStats {
+pub:
+	fps          f32
+	frame_ms     f32
+	audio_queued u32
+	heap_bytes   usize
+}
+
+struct DebugHud {
+mut:
+	enabled      bool = true
+	corner       StatsCorner
+	toggle_key   u32
+	key_was_down bool
+	last_ms      u64
+	deltas       [debug_frame_window]u32
+	delta_index  int
+	delta_count  int
+	line_buf     []u8 = []u8{cap: 32}
+	line_args    []FmtArg = []FmtArg{len: 1}
+}
+
+__global (
+	debug_hud        DebugHud
+	debug_font_valid bool
+)
+
+// Register the built-in font used by debug overlays on first use.
+fn debug_font_ready() bool {
+	if !debug_font_valid {
+		debug_font_valid = graphics_font_register_spleen(debug_font_key, debug_font_size)
+	}
+	return debug_font_valid
+}
+
+// Enable or disable the stats HUD.
+pub fn debug_stats_set_enabled(enabled bool) {
+	debug_hud.enabled = enabled
+}
+
+// Toggle the stats HUD on or off.
+pub fn debug_stats_toggle() {
+	debug_hud.enabled = !debug_hud.enabled
+}
+
+// Returns true if the stats HUD is currently shown.
+pub fn debug_stats_enabled() bool {
+	return debug_hud.enabled
+}
+
+// Set the corner the stats HUD is drawn in.
+pub fn debug_stats_set_corner(corner StatsCorner) {
+	debug_hud.corner = corner
+}
+
+// Set a keyboard key that toggles the stats HUD when pressed.
+// 0 disables the toggle key.
+pub fn debug_stats_set_toggle_key(key u32) {
+	debug_hud.toggle_key = key
+}
+
+// Get the stats measured by the last call to debug_draw_stats.
+pub fn debug_frame_stats() FrameStats {
+	mut total := u64(0)
+	for i in 0 .. debug_hud.delta_count {
+		total += debug_hud.deltas[i]
+	}
+	mut frame_ms := f32(0)
+	mut fps := f32(0)
+	if debug_hud.delta_count > 0 && total > 0 {
+		frame_ms = f32(total) / f32(debug_hud.delta_count)
+		fps = 1000.0 / frame_ms
+	}
+	return FrameStats{
+		fps: fps
+		frame_ms: frame_ms
+		audio_queued: audio_queued_frames()
+		heap_bytes: gc_memory_use()
+	}
+}
+
+fn (mut hud DebugHud) tick() {
+	now := C.wasm96_system_millis()
+	if hud.last_ms != 0 {
+		hud.deltas[hud.delta_index] = u32(now - hud.last_ms)
+		hud.delta_index = (hud.delta_index + 1) % debug_frame_window
+		if hud.delta_count < debug_frame_window {
+			hud.delta_count++
+		}
+	}
+	hud.last_ms = now
+	if hud.toggle_key != 0 {
+		down := input_is_key_down(hud.toggle_key)
+		if down && !hud.key_was_down {
+			hud.enabled = !hud.enabled
+		}
+		hud.key_was_down = down
+	}
+}
+
+const debug_stats_lines = 4
+
+fn debug_stats_line(mut buf []u8, mut args []FmtArg, line int, stats FrameStats) {
+	buf.clear()
+	args[0] = match line {
+		0 { fmt_f(stats.fps) }
+		1 { fmt_f(stats.frame_ms) }
+		2 { fmt_u(stats.audio_queued) }
+		else { fmt_u(stats.heap_bytes / 1024) }
+	}
+	format := match line {
+		0 { 'FPS  %.1f' }
+		1 { 'MS   %.1f' }
+		2 { 'AUD  %u' }
+		else { 'HEAP %uK' }
+	}
+	fmt_sprintf(mut buf, format, args)
+}
+
+// Measure frame timing and draw FPS, frame time, audio queue depth and heap
+// usage in a corner of the screen. Call once per frame, after drawing the scene.
+pub fn debug_draw_stats() {
+	debug_hud.tick()
+	if !debug_hud.enabled {
+		return
+	}
+	if !debug_font_ready() {
+		return
+	}
+	stats := debug_frame_stats()
+	mut width := u32(0)
+	mut line_height := u32(0)
+	for i in 0 .. debug_stats_lines {
+		debug_stats_line(mut debug_hud.line_buf, mut debug_hud.line_args, i, stats)
+		size := graphics_text_measure_key(debug_font_key, debug_hud.line_buf)
+		if size.width > width {
+			width = size.width
+		}
+		if size.height > line_height {
+			line_height = size.height
+		}
+	}
+	pad := u32(2)
+	box_w := width + pad * 2
+	box_h := line_height * u32(debug_stats_lines) + pad * 2
+	mut x := 0
+	mut y := 0
+	if debug_hud.corner == .top_right || debug_hud.corner == .bottom_right {
+		x = int(screen_width) - int(box_w)
+	}
+	if debug_hud.corner == .bottom_left || debug_hud.corner == .bottom_right {
+		y = int(screen_height) - int(box_h)
+	}
+	saved := current_color
+	graphics_set_color(0, 0, 0, 160)
+	graphics_rect(x, y, box_w, box_h)
+	graphics_set_color(255, 255, 255, 255)
+	for i in 0 .. debug_stats_lines {
+		debug_stats_line(mut debug_hud.line_buf, mut debug_hud.line_args, i, stats)
+		graphics_text_key(x + int(pad), y + int(pad) + i * int(line_height), debug_font_key,
+			debug_hud.line_buf)
+	}
+	graphics_set_color(saved[0], saved[1], saved[2], saved[3])
+}
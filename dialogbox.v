@@ -0,0 +1,149 @@
+module wasm96
+
+// RPG-style dialog box.
+//
+// A DialogBox shows one line of rich text at a time along the bottom of the
+// safe area, revealed by a Typewriter, with an optional speaker name and a
+// menu of choices under the text. A reveals the rest of the line, then
+// confirms; the d-pad moves through choices.
+
+// A dialog box.
+pub struct DialogBox {
+pub mut:
+	// Port that advances the dialog.
+	port        u32
+	font_key    []u8
+	text_color  Color = Color{255, 255, 255, 255}
+	name_color  Color = Color{240, 220, 70, 255}
+	box_color   Color = Color{20, 20, 40, 230}
+	text_speed  int   = 2
+	// Smallest box height in lines, so it doesn't jump around.
+	min_lines int = 2
+mut:
+	speaker string
+	line    Typewriter
+	choices []string
+	cursor  int
+	showing bool
+	prev    u32
+}
+
+// Show a line of rich text, with the speaker's name if not empty.
+pub fn (mut b DialogBox) say(speaker string, text string) {
+	mut rt := rich_parse(text, b.text_color)
+	rt.font_key = b.font_key
+	b.speaker = speaker
+	b.line = new_typewriter(rt, b.text_speed)
+	b.choices.clear()
+	b.cursor = 0
+	b.showing = true
+}
+
+// Offer choices under the current line.
+pub fn (mut b DialogBox) ask(choices []string) {
+	b.choices = choices.clone()
+	b.cursor = 0
+	b.showing = true
+}
+
+// Hide the box.
+pub fn (mut b DialogBox) close() {
+	b.showing = false
+	b.choices.clear()
+}
+
+// Returns true while the box is shown.
+pub fn (b &DialogBox) is_open() bool {
+	return b.showing
+}
+
+// Returns true while the line is still being revealed.
+pub fn (b &DialogBox) typing() bool {
+	return b.showing && !b.line.done()
+}
+
+// Get the highlighted choice.
+pub fn (b &DialogBox) choice() int {
+	return b.cursor
+}
+
+// Handle input and reveal text for a frame. Returns true on the frame the
+// player confirms the line (or the highlighted choice).
+pub fn (mut b DialogBox) update() bool {
+	mut now := u32(0)
+	for btn in [Button.up, .down, .a] {
+		if input_is_button_down(b.port, btn) {
+			now |= vk_bit(btn)
+		}
+	}
+	pressed := now & ~b.prev
+	b.prev = now
+	if !b.showing {
+		return false
+	}
+	b.line.update()
+	if !b.line.done() {
+		if pressed & vk_bit(.a) != 0 {
+			b.line.skip()
+		}
+		return false
+	}
+	if b.choices.len > 0 {
+		if pressed & vk_bit(.up) != 0 {
+			b.cursor = (b.cursor + b.choices.len - 1) % b.choices.len
+		}
+		if pressed & vk_bit(.down) != 0 {
+			b.cursor = (b.cursor + 1) % b.choices.len
+		}
+	}
+	return pressed & vk_bit(.a) != 0
+}
+
+fn (b &DialogBox) font() []u8 {
+	return if b.font_key.len > 0 { b.font_key } else { debug_font_key }
+}
+
+// Draw the box if it is shown.
+pub fn (mut b DialogBox) draw() {
+	if !b.showing || (b.font_key.len == 0 && !debug_font_ready()) {
+		return
+	}
+	font := b.font()
+	line_h := int(graphics_text_measure_key(font, 'M'.bytes()).height) + 2
+	_, th := b.line.text.size()
+	h := max_int(th, b.min_lines * line_h) + b.choices.len * line_h + 8
+	safe := video_safe_rect()
+	box := Rect{safe.x + 4, safe.y + safe.h - h - 4, max_int(0, safe.w - 8), h}
+	graphics_set_color_rgba(b.box_color)
+	graphics_rect(box.x, box.y, u32(box.w), u32(box.h))
+	graphics_set_color_rgba(b.text_color)
+	graphics_rect_outline(box.x, box.y, u32(box.w), u32(box.h))
+	if b.speaker.len > 0 {
+		size := graphics_text_measure_key(font, b.speaker.bytes())
+		tab := Rect{box.x + 4, box.y - line_h - 2, int(size.width) + 8, line_h + 2}
+		graphics_set_color_rgba(b.box_color)
+		graphics_rect(tab.x, tab.y, u32(tab.w), u32(tab.h))
+		graphics_set_color_rgba(b.name_color)
+		graphics_text_key(tab.x + 4, tab.y + 2, font, b.speaker.bytes())
+	}
+	b.line.draw(box.x + 4, box.y + 4)
+	if !b.line.done() {
+		return
+	}
+	if b.choices.len == 0 {
+		if blink(30) {
+			graphics_set_color_rgba(b.text_color)
+			graphics_rect(box.x + box.w - 8, box.y + box.h - 6, 4, 2)
+		}
+		return
+	}
+	mut y := box.y + 4 + max_int(th, b.min_lines * line_h)
+	for i, c in b.choices {
+		graphics_set_color_rgba(if i == b.cursor { b.name_color } else { b.text_color })
+		if i == b.cursor {
+			graphics_text_key(box.x + 6, y, font, '>'.bytes())
+		}
+		graphics_text_key(box.x + 16, y, font, c.bytes())
+		y += line_h
+	}
+}
@@ -0,0 +1,595 @@
+module wasm96
+
+// Dialogue scripts.
+//
+// Dialogue is written in a small line-based language, compiled to a compact
+// binary (at build time or on load) and run by a Dialogue, which feeds a
+// DialogBox and hands commands it doesn't know back to the game:
+//
+//   # Comments start with a hash.
+//   @start
+//   Guard: Halt! Who goes there?
+//   * A friend. -> friend
+//   * Nobody. -> rude
+//   * ?has_pass Show the pass. -> friend
+//   @friend
+//   ?met_guard>0 -> inside
+//   Guard: {wave}Welcome{/wave}, friend.
+//   !set met_guard
+//   @inside
+//   !open_gate
+//   !end
+//   @rude
+//   Guard: {shake}Begone!{/shake}
+//   !add rudeness 1
+//   -> start
+//
+// Lines are `Speaker: text` (the speaker is one word) or plain narration,
+// in rich text markup. `*` lines are choices offered under the line before
+// them, jumping to a label or, without one, carrying on after the choices;
+// `* ?condition text` only offers the choice if the condition (written
+// without spaces) holds. `-> label` jumps, and `?condition -> label` jumps
+// if the condition holds. Conditions test an integer game flag: `flag`,
+// `!flag`, or `flag` with ==, !=, <, >, <= or >= and a number.
+// `!set flag [n]`, `!add flag n` and `!clear flag` change flags, `!end`
+// stops, and any other `!name args` is a command for the game.
+
+const dialogue_magic = u32(0x44363957) // 'W96D'
+
+const dialogue_version = u32(1)
+
+const dialogue_none = u16(0xffff)
+
+// Instruction opcodes.
+enum DialogueOp as u8 {
+	end
+	line
+	choice
+	menu
+	jump
+	branch
+	set
+	add
+	command
+}
+
+const dialogue_cmp_ops = ['==', '!=', '<=', '>=', '<', '>']
+
+// Instructions update runs before giving up for the frame, so a script that
+// jumps in a loop without showing a line can't hang the game.
+const dialogue_step_limit = 10000
+
+// A compiled flag test.
+struct DialogueCond {
+	flag  u16
+	op    u8
+	value int
+}
+
+// A loaded dialogue script.
+pub struct DialogueScript {
+mut:
+	strings []string
+	conds   []DialogueCond
+	labels  map[string]int
+	code    []u8
+}
+
+// A command from a script for the game to carry out.
+pub struct DialogueCommand {
+pub:
+	name string
+	args []string
+}
+
+// Builds a compiled script.
+struct DialogueCompiler {
+mut:
+	strings []string
+	index   map[string]int
+	conds   []DialogueCond
+	labels  map[string]int
+	code    StateWriter
+	// Jump targets to fill in once every label is known: code offset and
+	// label name.
+	fixups []DialogueFixup
+	// Choice targets that carry on after their menu.
+	open_choices []int
+}
+
+struct DialogueFixup {
+	at    int
+	label string
+	line  int
+}
+
+fn (mut c DialogueCompiler) intern(s string) u16 {
+	if i := c.index[s] {
+		return u16(i)
+	}
+	c.index[s] = c.strings.len
+	c.strings << s
+	return u16(c.strings.len - 1)
+}
+
+fn (mut c DialogueCompiler) cond(src string, line int) !u16 {
+	s := src.trim_space()
+	if s.len == 0 {
+		return error('dialogue: line ${line}: empty condition')
+	}
+	if s[0] == `!` {
+		c.conds << DialogueCond{c.intern(s[1..].trim_space()), 1, 0}
+		return u16(c.conds.len - 1)
+	}
+	for op_i, op in dialogue_cmp_ops {
+		at := s.index(op) or { continue }
+		name := s[..at].trim_space()
+		value := s[at + op.len..].trim_space()
+		if name.len == 0 || value.len == 0 {
+			return error('dialogue: line ${line}: bad condition `${s}`')
+		}
+		c.conds << DialogueCond{c.intern(name), u8(op_i + 2), value.int()}
+		return u16(c.conds.len - 1)
+	}
+	c.conds << DialogueCond{c.intern(s), 0, 0}
+	return u16(c.conds.len - 1)
+}
+
+// Emit a jump target to patch later.
+fn (mut c DialogueCompiler) target(label string, line int) {
+	c.fixups << DialogueFixup{c.code.data.len, label, line}
+	c.code.write_u32(0)
+}
+
+// Close a run of choices with a menu instruction.
+fn (mut c DialogueCompiler) close_menu() {
+	c.code.write_u8(u8(DialogueOp.menu))
+	after := u32(c.code.data.len)
+	for at in c.open_choices {
+		for k in 0 .. 4 {
+			c.code.data[at + k] = u8(after >> (k * 8))
+		}
+	}
+	c.open_choices.clear()
+}
+
+// Split `text -> label` into its parts.
+fn dialogue_arrow(s string) (string, string) {
+	at := s.last_index('->') or { return s.trim_space(), '' }
+	return s[..at].trim_space(), s[at + 2..].trim_space()
+}
+
+// Compile script source to its binary form.
+pub fn dialogue_compile(src string) ![]u8 {
+	mut c := DialogueCompiler{}
+	mut in_menu := false
+	for n, raw in src.split_into_lines() {
+		line := n + 1
+		s := raw.trim_space()
+		if s.len == 0 || s[0] == `#` {
+			continue
+		}
+		if in_menu && s[0] != `*` {
+			c.close_menu()
+			in_menu = false
+		}
+		match s[0] {
+			`@` {
+				name := s[1..].trim_space()
+				if name in c.labels {
+					return error('dialogue: line ${line}: duplicate label ${name}')
+				}
+				c.labels[name] = c.code.data.len
+			}
+			`*` {
+				mut body := s[1..].trim_space()
+				mut cond := dialogue_none
+				if body.starts_with('?') {
+					end := glyph_find(body, ` `, 0)
+					if end < 0 {
+						return error('dialogue: line ${line}: choice has no text')
+					}
+					cond = c.cond(body[1..end], line)!
+					body = body[end + 1..]
+				}
+				text, label := dialogue_arrow(body)
+				c.code.write_u8(u8(DialogueOp.choice))
+				c.code.write_u16(c.intern(text))
+				c.code.write_u16(cond)
+				if label.len > 0 {
+					c.target(label, line)
+				} else {
+					c.open_choices << c.code.data.len
+					c.code.write_u32(0)
+				}
+				in_menu = true
+			}
+			`?` {
+				cond_src, label := dialogue_arrow(s[1..])
+				if label.len == 0 {
+					return error('dialogue: line ${line}: condition without -> label')
+				}
+				c.code.write_u8(u8(DialogueOp.branch))
+				c.code.write_u16(c.cond(cond_src, line)!)
+				c.target(label, line)
+			}
+			`!` {
+				words := s[1..].fields()
+				if words.len == 0 {
+					return error('dialogue: line ${line}: empty command')
+				}
+				match words[0] {
+					'end' {
+						c.code.write_u8(u8(DialogueOp.end))
+					}
+					'set', 'add', 'clear' {
+						if words.len < 2 {
+							return error('dialogue: line ${line}: ${words[0]} needs a flag')
+						}
+						value := if words.len > 2 {
+							words[2].int()
+						} else if words[0] == 'set' {
+							1
+						} else {
+							0
+						}
+						c.code.write_u8(u8(if words[0] == 'add' { DialogueOp.add } else { DialogueOp.set }))
+						c.code.write_u16(c.intern(words[1]))
+						c.code.write_i32(value)
+					}
+					else {
+						c.code.write_u8(u8(DialogueOp.command))
+						c.code.write_u16(c.intern(words[0]))
+						c.code.write_u16(c.intern(words[1..].join(' ')))
+					}
+				}
+			}
+			else {
+				if s.starts_with('->') {
+					c.code.write_u8(u8(DialogueOp.jump))
+					c.target(s[2..].trim_space(), line)
+					continue
+				}
+				mut speaker := ''
+				mut text := s
+				if colon := s.index(':') {
+					who := s[..colon]
+					if colon > 0 && !who.contains(' ') && !who.contains('{') {
+						speaker = who
+						text = s[colon + 1..].trim_space()
+					}
+				}
+				c.code.write_u8(u8(DialogueOp.line))
+				c.code.write_u16(c.intern(speaker))
+				c.code.write_u16(c.intern(text))
+			}
+		}
+	}
+	if in_menu {
+		c.close_menu()
+	}
+	c.code.write_u8(u8(DialogueOp.end))
+	for f in c.fixups {
+		at := c.labels[f.label] or {
+			return error('dialogue: line ${f.line}: no label ${f.label}')
+		}
+		for k in 0 .. 4 {
+			c.code.data[f.at + k] = u8(u32(at) >> (k * 8))
+		}
+	}
+	for name, _ in c.labels {
+		c.intern(name)
+	}
+	if c.strings.len >= int(dialogue_none) || c.conds.len >= int(dialogue_none) {
+		return error('dialogue: script too large')
+	}
+	mut w := StateWriter{}
+	w.write_u32(dialogue_magic)
+	w.write_u32(dialogue_version)
+	w.write_u32(u32(c.strings.len))
+	for s in c.strings {
+		w.write_string(s)
+	}
+	w.write_u32(u32(c.conds.len))
+	for cd in c.conds {
+		w.write_u16(cd.flag)
+		w.write_u8(cd.op)
+		w.write_i32(cd.value)
+	}
+	w.write_u32(u32(c.labels.len))
+	for name, at in c.labels {
+		w.write_u16(c.intern(name))
+		w.write_u32(u32(at))
+	}
+	w.write_bytes(c.code.data)
+	return w.data
+}
+
+// Load a script compiled by dialogue_compile.
+pub fn dialogue_load(data []u8) !DialogueScript {
+	mut r := new_state_reader(data)
+	if r.read_u32()! != dialogue_magic {
+		return error('dialogue: not a compiled script')
+	}
+	if r.read_u32()! != dialogue_version {
+		return error('dialogue: unsupported version')
+	}
+	mut script := DialogueScript{}
+	strings := int(r.read_u32()!)
+	for _ in 0 .. strings {
+		script.strings << r.read_string()!
+	}
+	conds := int(r.read_u32()!)
+	for _ in 0 .. conds {
+		flag := r.read_u16()!
+		op := r.read_u8()!
+		value := r.read_i32()!
+		if int(flag) >= script.strings.len {
+			return error('dialogue: bad condition')
+		}
+		script.conds << DialogueCond{flag, op, value}
+	}
+	labels := int(r.read_u32()!)
+	for _ in 0 .. labels {
+		name := r.read_u16()!
+		at := r.read_u32()!
+		if int(name) >= script.strings.len {
+			return error('dialogue: bad label')
+		}
+		script.labels[script.strings[name]] = int(at)
+	}
+	script.code = r.read_bytes()!
+	script.verify()!
+	return script
+}
+
+// Get the size of an instruction's operands.
+fn dialogue_operand_size(op DialogueOp) int {
+	return match op {
+		.end, .menu { 0 }
+		.line, .jump, .command { 4 }
+		.branch, .set, .add { 6 }
+		.choice { 8 }
+	}
+}
+
+// Check every instruction, operand and jump target, so running the script
+// can't read out of range.
+fn (s &DialogueScript) verify() ! {
+	for c in s.conds {
+		if c.op > 7 {
+			return error('dialogue: bad condition')
+		}
+	}
+	mut starts := []bool{len: s.code.len}
+	mut targets := []int{}
+	mut pc := 0
+	for pc < s.code.len {
+		raw := s.code[pc]
+		if raw > u8(DialogueOp.command) {
+			return error('dialogue: bad opcode ${raw} at ${pc}')
+		}
+		op := unsafe { DialogueOp(raw) }
+		starts[pc] = true
+		at := pc + 1
+		pc = at + dialogue_operand_size(op)
+		if pc > s.code.len {
+			return error('dialogue: truncated instruction at ${at - 1}')
+		}
+		mut strs := []int{}
+		mut cond := dialogue_none
+		match op {
+			.line, .command {
+				strs << int(le_u16(s.code, at))
+				strs << int(le_u16(s.code, at + 2))
+			}
+			.choice {
+				strs << int(le_u16(s.code, at))
+				cond = u16(le_u16(s.code, at + 2))
+				targets << int(le_u32(s.code, at + 4))
+			}
+			.jump {
+				targets << int(le_u32(s.code, at))
+			}
+			.branch {
+				cond = u16(le_u16(s.code, at))
+				targets << int(le_u32(s.code, at + 2))
+			}
+			.set, .add {
+				strs << int(le_u16(s.code, at))
+			}
+			.end, .menu {}
+		}
+		for i in strs {
+			if i >= s.strings.len {
+				return error('dialogue: bad string at ${at - 1}')
+			}
+		}
+		if cond != dialogue_none && int(cond) >= s.conds.len {
+			return error('dialogue: bad condition at ${at - 1}')
+		}
+	}
+	for _, at in s.labels {
+		targets << at
+	}
+	for t in targets {
+		if t < 0 || t >= s.code.len || !starts[t] {
+			return error('dialogue: bad jump target ${t}')
+		}
+	}
+}
+
+// Compile and load script source in one go.
+pub fn dialogue_parse(src string) !DialogueScript {
+	return dialogue_load(dialogue_compile(src)!)!
+}
+
+// Runs a dialogue script against a set of game flags.
+pub struct Dialogue {
+pub mut:
+	// Game flags scripts test and change. Missing flags read as 0.
+	flags map[string]int
+mut:
+	script   DialogueScript
+	pc       int
+	waiting  bool
+	// Choices collected so far and where each one leads.
+	choices  []string
+	targets  []int
+	finished bool = true
+}
+
+// Create a runner for a loaded script.
+pub fn new_dialogue(script DialogueScript) Dialogue {
+	return Dialogue{
+		script: script
+	}
+}
+
+// Start running from a label.
+pub fn (mut d Dialogue) start(label string) ! {
+	at := d.script.labels[label] or { return error('dialogue: no label ${label}') }
+	d.pc = at
+	d.waiting = false
+	d.finished = false
+	d.choices.clear()
+	d.targets.clear()
+}
+
+// Returns true while the script is running.
+pub fn (d &Dialogue) running() bool {
+	return !d.finished
+}
+
+// Stop the script.
+pub fn (mut d Dialogue) stop(mut box DialogBox) {
+	d.finished = true
+	d.waiting = false
+	box.close()
+}
+
+// Get a game flag.
+pub fn (d &Dialogue) flag(name string) int {
+	return d.flags[name] or { 0 }
+}
+
+fn (d &Dialogue) test(cond u16) bool {
+	if cond == dialogue_none || int(cond) >= d.script.conds.len {
+		return true
+	}
+	c := d.script.conds[cond]
+	v := d.flag(d.script.strings[c.flag])
+	return match c.op {
+		0 { v != 0 }
+		1 { v == 0 }
+		2 { v == c.value }
+		3 { v != c.value }
+		4 { v <= c.value }
+		5 { v >= c.value }
+		6 { v < c.value }
+		else { v > c.value }
+	}
+}
+
+fn (mut d Dialogue) u16_at() u16 {
+	v := u16(le_u16(d.script.code, d.pc))
+	d.pc += 2
+	return v
+}
+
+fn (mut d Dialogue) u32_at() u32 {
+	v := le_u32(d.script.code, d.pc)
+	d.pc += 4
+	return v
+}
+
+// Run the script for a frame, showing lines and choices in box and waiting
+// for the player. Returns a command when the script reaches one the game
+// must carry out; the script carries on with the next update. A script that
+// runs dialogue_step_limit instructions without stopping also carries on
+// next update. Call once per frame while running, and draw box as usual.
+pub fn (mut d Dialogue) update(mut box DialogBox) ?DialogueCommand {
+	if d.finished {
+		return none
+	}
+	if d.waiting {
+		if !box.update() {
+			return none
+		}
+		d.waiting = false
+		if d.targets.len > 0 {
+			d.pc = d.targets[box.choice()]
+			d.choices.clear()
+			d.targets.clear()
+		}
+	}
+	for _ in 0 .. dialogue_step_limit {
+		if d.pc < 0 || d.pc >= d.script.code.len {
+			d.stop(mut box)
+			return none
+		}
+		raw := d.script.code[d.pc]
+		d.pc++
+		if raw > u8(DialogueOp.command) {
+			d.stop(mut box)
+			return none
+		}
+		op := unsafe { DialogueOp(raw) }
+		match op {
+			.line {
+				speaker := d.script.strings[d.u16_at()]
+				text := d.script.strings[d.u16_at()]
+				box.say(speaker, text)
+				// A line followed by choices asks them straight away.
+				if d.pc >= d.script.code.len || d.script.code[d.pc] != u8(DialogueOp.choice) {
+					d.waiting = true
+					return none
+				}
+			}
+			.choice {
+				text := d.script.strings[d.u16_at()]
+				cond := d.u16_at()
+				target := int(d.u32_at())
+				if d.test(cond) {
+					d.choices << text
+					d.targets << target
+				}
+			}
+			.menu {
+				if d.choices.len > 0 {
+					box.ask(d.choices)
+					d.waiting = true
+					return none
+				}
+			}
+			.jump {
+				d.pc = int(d.u32_at())
+			}
+			.branch {
+				cond := d.u16_at()
+				target := int(d.u32_at())
+				if d.test(cond) {
+					d.pc = target
+				}
+			}
+			.set, .add {
+				name := d.script.strings[d.u16_at()]
+				value := int(d.u32_at())
+				d.flags[name] = if op == .add { d.flag(name) + value } else { value }
+			}
+			.command {
+				name := d.script.strings[d.u16_at()]
+				args := d.script.strings[d.u16_at()]
+				return DialogueCommand{
+					name: name
+					args: args.fields()
+				}
+			}
+			.end {
+				d.stop(mut box)
+				return none
+			}
+		}
+	}
+	return none
+}
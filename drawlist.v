@@ -0,0 +1,176 @@
+module wasm96
+
+// Depth-sorted draw lists.
+//
+// Instead of drawing immediately, submit sprites and primitives to a
+// DrawList with a sort key, then flush it once per frame: commands run in
+// key order (and submission order for equal keys). Build keys with
+// draw_key(layer, y) so layers stack (world below UI) and, within a layer,
+// things further down the screen draw in front, as top-down scenes need.
+//
+// Images are kept by reference until the flush, so they must stay alive
+// and unchanged until then.
+
+// A function drawing custom content for a draw list; id is whatever was
+// submitted with it.
+pub type DrawListFn = fn (id int)
+
+enum DrawCmdKind {
+	image
+	image_region
+	rect
+	rect_outline
+	line
+	circle
+	circle_outline
+	triangle
+	custom
+}
+
+struct DrawCmd {
+	key    i64
+	seq    int
+	kind   DrawCmdKind
+	color  Color
+	img    &Image     = unsafe { nil }
+	custom DrawListFn = unsafe { nil }
+	args   [6]int
+}
+
+// Draw commands waiting to be sorted and run.
+pub struct DrawList {
+mut:
+	cmds []DrawCmd
+}
+
+// Build a sort key from a layer and a y position; layers take precedence.
+pub fn draw_key(layer int, y int) i64 {
+	return (i64(layer) << 32) + i64(y)
+}
+
+fn (mut dl DrawList) push(key i64, kind DrawCmdKind, color Color, args [6]int) {
+	dl.cmds << DrawCmd{
+		key: key
+		seq: dl.cmds.len
+		kind: kind
+		color: color
+		args: args
+	}
+}
+
+// Queue an image at (x, y).
+pub fn (mut dl DrawList) image(key i64, img &Image, x int, y int) {
+	dl.cmds << DrawCmd{
+		key: key
+		seq: dl.cmds.len
+		kind: .image
+		img: img
+		args: [x, y, 0, 0, 0, 0]!
+	}
+}
+
+// Queue a w x h region at (sx, sy) of an image, drawn at (x, y).
+pub fn (mut dl DrawList) image_region(key i64, img &Image, x int, y int, sx int, sy int, w int, h int) {
+	dl.cmds << DrawCmd{
+		key: key
+		seq: dl.cmds.len
+		kind: .image_region
+		img: img
+		args: [x, y, sx, sy, w, h]!
+	}
+}
+
+// Queue a filled rectangle.
+pub fn (mut dl DrawList) rect(key i64, x int, y int, w int, h int, color Color) {
+	dl.push(key, .rect, color, [x, y, w, h, 0, 0]!)
+}
+
+// Queue a rectangle outline.
+pub fn (mut dl DrawList) rect_outline(key i64, x int, y int, w int, h int, color Color) {
+	dl.push(key, .rect_outline, color, [x, y, w, h, 0, 0]!)
+}
+
+// Queue a line.
+pub fn (mut dl DrawList) line(key i64, x1 int, y1 int, x2 int, y2 int, color Color) {
+	dl.push(key, .line, color, [x1, y1, x2, y2, 0, 0]!)
+}
+
+// Queue a filled circle.
+pub fn (mut dl DrawList) circle(key i64, x int, y int, r int, color Color) {
+	dl.push(key, .circle, color, [x, y, r, 0, 0, 0]!)
+}
+
+// Queue a circle outline.
+pub fn (mut dl DrawList) circle_outline(key i64, x int, y int, r int, color Color) {
+	dl.push(key, .circle_outline, color, [x, y, r, 0, 0, 0]!)
+}
+
+// Queue a filled triangle.
+pub fn (mut dl DrawList) triangle(key i64, x1 int, y1 int, x2 int, y2 int, x3 int, y3 int, color Color) {
+	dl.push(key, .triangle, color, [x1, y1, x2, y2, x3, y3]!)
+}
+
+// Queue a call to f(id), for anything the list can't draw itself.
+pub fn (mut dl DrawList) custom(key i64, f DrawListFn, id int) {
+	dl.cmds << DrawCmd{
+		key: key
+		seq: dl.cmds.len
+		kind: .custom
+		custom: f
+		args: [id, 0, 0, 0, 0, 0]!
+	}
+}
+
+// Get the number of queued commands.
+pub fn (dl &DrawList) len() int {
+	return dl.cmds.len
+}
+
+// Drop every queued command without drawing.
+pub fn (mut dl DrawList) clear() {
+	dl.cmds.clear()
+}
+
+// Sort the queued commands, run them and empty the list.
+pub fn (mut dl DrawList) flush() {
+	dl.cmds.sort(a.key < b.key || (a.key == b.key && a.seq < b.seq))
+	for c in dl.cmds {
+		a := c.args
+		match c.kind {
+			.image {
+				c.img.draw(a[0], a[1])
+			}
+			.image_region {
+				c.img.draw_region(a[0], a[1], a[2], a[3], a[4], a[5])
+			}
+			.rect {
+				graphics_set_color_rgba(c.color)
+				graphics_rect(a[0], a[1], u32(a[2]), u32(a[3]))
+			}
+			.rect_outline {
+				graphics_set_color_rgba(c.color)
+				graphics_rect_outline(a[0], a[1], u32(a[2]), u32(a[3]))
+			}
+			.line {
+				graphics_set_color_rgba(c.color)
+				graphics_line(a[0], a[1], a[2], a[3])
+			}
+			.circle {
+				graphics_set_color_rgba(c.color)
+				graphics_circle(a[0], a[1], u32(a[2]))
+			}
+			.circle_outline {
+				graphics_set_color_rgba(c.color)
+				graphics_circle_outline(a[0], a[1], u32(a[2]))
+			}
+			.triangle {
+				graphics_set_color_rgba(c.color)
+				graphics_triangle(a[0], a[1], a[2], a[3], a[4], a[5])
+			}
+			.custom {
+				c.custom(a[0])
+			}
+		}
+	}
+	dl.cmds.clear()
+}
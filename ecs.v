@@ -0,0 +1,188 @@
+module wasm96
+
+// Minimal entity component system.
+//
+// Components live in dense arrays (one Store per component type) indexed
+// through a sparse table, so iterating a component touches contiguous memory.
+// Entities are handles with a generation counter, so a stale handle to a
+// despawned entity never aliases a new one.
+
+// An entity handle.
+pub struct Entity {
+pub:
+	index      u32
+	generation u32
+}
+
+// A handle that never refers to a live entity.
+pub const no_entity = Entity{
+	index: max_u32
+}
+
+// Something that stores per-entity data and must drop it on despawn.
+pub interface ComponentStorage {
+mut:
+	remove(e Entity)
+}
+
+// Allocates entities and tracks which are alive.
+pub struct World {
+mut:
+	generations []u32
+	free        []u32
+	live        int
+	stores      []ComponentStorage
+}
+
+// Register a component store so despawn removes the entity's component.
+pub fn (mut w World) register(mut store ComponentStorage) {
+	w.stores << store
+}
+
+// Create an entity.
+pub fn (mut w World) spawn() Entity {
+	w.live++
+	if w.free.len > 0 {
+		index := w.free.pop()
+		return Entity{
+			index: index
+			generation: w.generations[index]
+		}
+	}
+	w.generations << 0
+	return Entity{
+		index: u32(w.generations.len - 1)
+	}
+}
+
+// Destroy an entity and remove its components from every registered store.
+pub fn (mut w World) despawn(e Entity) {
+	if !w.alive(e) {
+		return
+	}
+	for mut store in w.stores {
+		store.remove(e)
+	}
+	w.generations[e.index]++
+	w.free << e.index
+	w.live--
+}
+
+// Returns true if e refers to a live entity.
+pub fn (w &World) alive(e Entity) bool {
+	return e.index < u32(w.generations.len) && w.generations[e.index] == e.generation
+}
+
+// Get the number of live entities.
+pub fn (w &World) len() int {
+	return w.live
+}
+
+// Dense storage for components of type T.
+pub struct Store[T] {
+mut:
+	sparse   []int
+	dense    []T
+	entities []Entity
+}
+
+fn (s &Store[T]) slot(e Entity) int {
+	if e.index >= u32(s.sparse.len) {
+		return -1
+	}
+	i := s.sparse[e.index]
+	if i < 0 || s.entities[i] != e {
+		return -1
+	}
+	return i
+}
+
+// Set the component of e, adding it if e has none.
+pub fn (mut s Store[T]) set(e Entity, value T) {
+	i := s.slot(e)
+	if i >= 0 {
+		s.dense[i] = value
+		return
+	}
+	for u32(s.sparse.len) <= e.index {
+		s.sparse << -1
+	}
+	s.sparse[e.index] = s.dense.len
+	s.dense << value
+	s.entities << e
+}
+
+// Get the component of e. The reference is valid until the store changes size.
+pub fn (mut s Store[T]) get(e Entity) ?&T {
+	i := s.slot(e)
+	if i < 0 {
+		return none
+	}
+	return unsafe { &s.dense[i] }
+}
+
+// Returns true if e has a component in this store.
+pub fn (s &Store[T]) has(e Entity) bool {
+	return s.slot(e) >= 0
+}
+
+// Remove the component of e, if any.
+pub fn (mut s Store[T]) remove(e Entity) {
+	i := s.slot(e)
+	if i < 0 {
+		return
+	}
+	last := s.dense.len - 1
+	if i != last {
+		s.dense[i] = s.dense[last]
+		s.entities[i] = s.entities[last]
+		s.sparse[s.entities[i].index] = i
+	}
+	s.dense.delete_last()
+	s.entities.delete_last()
+	s.sparse[e.index] = -1
+}
+
+// Get the number of components in the store.
+pub fn (s &Store[T]) len() int {
+	return s.dense.len
+}
+
+// Get the entity owning the i-th component.
+pub fn (s &Store[T]) entity_at(i int) Entity {
+	return s.entities[i]
+}
+
+// Get the i-th component.
+pub fn (mut s Store[T]) at(i int) &T {
+	return unsafe { &s.dense[i] }
+}
+
+// Call f for every component. f must not add or remove components.
+pub fn (mut s Store[T]) each(f fn (e Entity, mut c T)) {
+	for i in 0 .. s.dense.len {
+		f(s.entities[i], mut s.dense[i])
+	}
+}
+
+// Call f for every entity that has a component in both a and b.
+// Iterates the smaller store.
+pub fn each2[A, B](mut a Store[A], mut b Store[B], f fn (e Entity, mut ca A, mut cb B)) {
+	if a.len() <= b.len() {
+		for i in 0 .. a.dense.len {
+			e := a.entities[i]
+			j := b.slot(e)
+			if j >= 0 {
+				f(e, mut a.dense[i], mut b.dense[j])
+			}
+		}
+	} else {
+		for j in 0 .. b.dense.len {
+			e := b.entities[j]
+			i := a.slot(e)
+			if i >= 0 {
+				f(e, mut a.dense[i], mut b.dense[j])
+			}
+		}
+	}
+}
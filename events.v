@@ -0,0 +1,115 @@
+module wasm96
+
+// Typed event bus.
+//
+// Each event type gets its own channel, so handlers receive the concrete type
+// without reflection:
+//
+//   struct PlayerDied { player int }
+//   mut died := wasm96.EventChannel[PlayerDied]{}
+//   died.subscribe(fn (e PlayerDied) { ... })
+//   died.publish(PlayerDied{ player: 1 })
+//   died.dispatch()
+
+struct EventSub[T] {
+	id      int
+	handler fn (T) = unsafe { nil }
+}
+
+// A publish/subscribe channel for events of type T.
+pub struct EventChannel[T] {
+mut:
+	subs    []EventSub[T]
+	queue   []T
+	pending []T
+	next_id int
+}
+
+// Subscribe handler to the channel. Returns an id for unsubscribe.
+pub fn (mut c EventChannel[T]) subscribe(handler fn (T)) int {
+	c.next_id++
+	c.subs << EventSub[T]{
+		id: c.next_id
+		handler: handler
+	}
+	return c.next_id
+}
+
+// Remove the subscription with the given id.
+pub fn (mut c EventChannel[T]) unsubscribe(id int) {
+	for i, sub in c.subs {
+		if sub.id == id {
+			c.subs.delete(i)
+			return
+		}
+	}
+}
+
+// Queue an event for the next dispatch.
+pub fn (mut c EventChannel[T]) publish(event T) {
+	c.queue << event
+}
+
+// Deliver an event to every subscriber immediately.
+pub fn (mut c EventChannel[T]) emit(event T) {
+	for sub in c.subs {
+		sub.handler(event)
+	}
+}
+
+// Deliver the queued events in publish order. Events published by handlers
+// during dispatch are delivered by the next dispatch.
+pub fn (mut c EventChannel[T]) dispatch() {
+	if c.queue.len == 0 {
+		return
+	}
+	c.pending, c.queue = c.queue, c.pending
+	for event in c.pending {
+		c.emit(event)
+	}
+	c.pending.clear()
+}
+
+// Get the number of queued events.
+pub fn (c &EventChannel[T]) queued() int {
+	return c.queue.len
+}
+
+// Anything that delivers queued events, such as an EventChannel.
+pub interface EventDispatcher {
+mut:
+	dispatch()
+}
+
+struct EventBusEntry {
+	order int
+mut:
+	channel EventDispatcher
+}
+
+// Dispatches a set of channels in a fixed order once per frame, so for
+// example input events are always handled before gameplay events.
+pub struct EventBus {
+mut:
+	entries []EventBusEntry
+}
+
+// Add a channel. Channels dispatch in ascending order; channels with the same
+// order dispatch in the order they were added.
+pub fn (mut b EventBus) add(mut channel EventDispatcher, order int) {
+	mut i := b.entries.len
+	for i > 0 && b.entries[i - 1].order > order {
+		i--
+	}
+	b.entries.insert(i, EventBusEntry{
+		order: order
+		channel: channel
+	})
+}
+
+// Dispatch every channel. Call once per update.
+pub fn (mut b EventBus) dispatch() {
+	for mut entry in b.entries {
+		entry.channel.dispatch()
+	}
+}
@@ -0,0 +1,79 @@
+module wasm96
+
+// ABI capability negotiation.
+
+// Version of this SDK.
+pub const sdk_version = '0.1.4'
+
+// Oldest host ABI version this SDK works with.
+pub const abi_version = u32(1)
+
+// Optional host features, reported as a bitmask by wasm96_system_features.
+@[flag]
+pub enum Feature as u64 {
+	batch
+	analog
+	storage
+	rumble
+	trace
+	capture
+	async_present
+	frame_skip
+	video_mode
+	geometry
+	timing
+	audio_pitch
+	messages
+	clipboard
+	midi
+	camera
+	sensors
+	led
+	multi_mouse
+	lightgun
+	input_snapshot
+	hotplug
+	key_modifiers
+}
+
+struct HostInfo {
+mut:
+	queried  bool
+	abi      u32
+	features Feature
+}
+
+__global host_info HostInfo
+
+fn host_query() {
+	if host_info.queried {
+		return
+	}
+	host_info.abi = C.wasm96_system_abi_version()
+	host_info.features = unsafe { Feature(C.wasm96_system_features()) }
+	host_info.queried = true
+}
+
+// Get the ABI version implemented by the host.
+pub fn system_abi_version() u32 {
+	host_query()
+	return host_info.abi
+}
+
+// Returns true if the host implements at least the ABI this SDK targets.
+pub fn system_compatible() bool {
+	return system_abi_version() >= abi_version
+}
+
+// Get the set of optional features the host supports.
+pub fn system_host_features() Feature {
+	host_query()
+	return host_info.features
+}
+
+// Returns true if the host supports feature. Use this to adapt the game,
+// e.g. hide a camera menu; SDK calls check for themselves and fall back.
+pub fn system_has_feature(feature Feature) bool {
+	host_query()
+	return host_info.features.has(feature)
+}
@@ -0,0 +1,219 @@
+module wasm96
+
+// Flow fields: one shortest-path search from the goals that every agent on
+// the grid can follow.
+//
+// build runs Dijkstra outward from the goals and records, for every cell,
+// its distance and the neighbor to step to. When cells change, update only
+// resets the cells whose route went through them and repairs the field from
+// their surroundings, which is far cheaper than a full rebuild for the odd
+// tower placed or wall knocked down.
+
+const flow_unreached = max_i32
+
+// Distances to a set of goal cells and the direction to move from each cell.
+pub struct FlowField {
+pub mut:
+	// Allow diagonal steps (never squeezing past solid corners).
+	diagonal bool
+pub:
+	width  int
+	height int
+mut:
+	goals  []Point
+	dist   []int
+	next   []int
+	mark   []u32
+	gen    u32
+	stack  []int
+	starts []int
+	reset  []int
+	open   IntHeap
+}
+
+// Create an empty flow field for grids of the given size.
+pub fn new_flow_field(width int, height int, diagonal bool) FlowField {
+	n := width * height
+	return FlowField{
+		diagonal: diagonal
+		width: width
+		height: height
+		dist: []int{len: n, init: flow_unreached}
+		next: []int{len: n, init: -1}
+		mark: []u32{len: n}
+	}
+}
+
+// Compute the field towards goals from scratch. weights gives the cost of
+// entering each cell (row-major, 0 counts as 1), as for Pathfinder; pass an
+// empty array for a uniform grid.
+pub fn (mut f FlowField) build(grid &TileCollision, weights []u8, goals []Point) {
+	f.goals = goals.clone()
+	for i in 0 .. f.dist.len {
+		f.dist[i] = flow_unreached
+		f.next[i] = -1
+	}
+	f.open.clear()
+	f.seed_goals(grid, -1)
+	f.relax(grid, weights)
+}
+
+// Repair the field after the given cells changed solidity or weight.
+pub fn (mut f FlowField) update(grid &TileCollision, weights []u8, changed []Point) {
+	f.gen++
+	if f.gen == 0 {
+		for i in 0 .. f.mark.len {
+			f.mark[i] = 0
+		}
+		f.gen = 1
+	}
+	f.open.clear()
+	// Reset every cell whose route passes through a changed cell, or steps
+	// diagonally past one, as a solid corner now blocks that step.
+	f.starts.clear()
+	for c in changed {
+		if c.x < 0 || c.y < 0 || c.x >= f.width || c.y >= f.height {
+			continue
+		}
+		f.starts << c.y * f.width + c.x
+		if !f.diagonal {
+			continue
+		}
+		for sx in [-1, 1] {
+			for sy in [-1, 1] {
+				ax := c.x + sx
+				by := c.y + sy
+				if ax < 0 || ax >= f.width || by < 0 || by >= f.height {
+					continue
+				}
+				a := c.y * f.width + ax
+				b := by * f.width + c.x
+				if f.next[a] == b {
+					f.starts << a
+				}
+				if f.next[b] == a {
+					f.starts << b
+				}
+			}
+		}
+	}
+	f.reset.clear()
+	for start in f.starts {
+		if f.mark[start] == f.gen {
+			continue
+		}
+		f.mark[start] = f.gen
+		f.stack << start
+		for f.stack.len > 0 {
+			cell := f.stack.pop()
+			f.reset << cell
+			f.dist[cell] = flow_unreached
+			f.next[cell] = -1
+			x := cell % f.width
+			y := cell / f.width
+			for d in 0 .. 8 {
+				nx := x + path_dx[d]
+				ny := y + path_dy[d]
+				if nx < 0 || ny < 0 || nx >= f.width || ny >= f.height {
+					continue
+				}
+				n := ny * f.width + nx
+				if f.mark[n] != f.gen && f.next[n] == cell {
+					f.mark[n] = f.gen
+					f.stack << n
+				}
+			}
+		}
+	}
+	// Restart the search from the intact cells bordering the reset area.
+	for cell in f.reset {
+		x := cell % f.width
+		y := cell / f.width
+		for d in 0 .. 8 {
+			nx := x + path_dx[d]
+			ny := y + path_dy[d]
+			if nx < 0 || ny < 0 || nx >= f.width || ny >= f.height {
+				continue
+			}
+			n := ny * f.width + nx
+			if f.mark[n] != f.gen && f.dist[n] != flow_unreached {
+				f.open.push(f.dist[n], n)
+			}
+		}
+	}
+	f.seed_goals(grid, i64(f.gen))
+	f.relax(grid, weights)
+}
+
+// Queue the goals; with only_mark >= 0, only those in the reset area.
+fn (mut f FlowField) seed_goals(grid &TileCollision, only_mark i64) {
+	for g in f.goals {
+		if g.x < 0 || g.y < 0 || g.x >= f.width || g.y >= f.height || grid.is_solid(g.x, g.y) {
+			continue
+		}
+		i := g.y * f.width + g.x
+		if only_mark >= 0 && i64(f.mark[i]) != only_mark {
+			continue
+		}
+		f.dist[i] = 0
+		f.next[i] = -1
+		f.open.push(0, i)
+	}
+}
+
+fn (mut f FlowField) relax(grid &TileCollision, weights []u8) {
+	for f.open.keys.len > 0 {
+		d0, cell := f.open.pop()
+		if d0 != f.dist[cell] {
+			continue
+		}
+		x := cell % f.width
+		y := cell / f.width
+		dirs := if f.diagonal { 8 } else { 4 }
+		for d in 0 .. dirs {
+			nx := x + path_dx[d]
+			ny := y + path_dy[d]
+			if nx < 0 || ny < 0 || nx >= f.width || ny >= f.height || grid.is_solid(nx, ny) {
+				continue
+			}
+			diag := d >= 4
+			if diag && (grid.is_solid(nx, y) || grid.is_solid(x, ny)) {
+				continue
+			}
+			n := ny * f.width + nx
+			// The search runs from the goals, so stepping from n to cell
+			// enters cell.
+			w := if weights.len > cell && weights[cell] > 0 { int(weights[cell]) } else { 1 }
+			step := if diag { path_diag } else { path_step }
+			nd := d0 + w * step
+			if nd < f.dist[n] {
+				f.dist[n] = nd
+				f.next[n] = cell
+				f.open.push(nd, n)
+			}
+		}
+	}
+}
+
+// Get the distance from cell (x, y) to the nearest goal, in units of 10 per
+// orthogonal step, or -1 if no goal can be reached.
+pub fn (f &FlowField) distance(x int, y int) int {
+	if x < 0 || y < 0 || x >= f.width || y >= f.height {
+		return -1
+	}
+	d := f.dist[y * f.width + x]
+	return if d == flow_unreached { -1 } else { d }
+}
+
+// Get the step (-1, 0 or 1 on each axis) to move from cell (x, y) towards
+// the nearest goal. Returns (0, 0) on a goal or where no goal is reachable.
+pub fn (f &FlowField) direction(x int, y int) (int, int) {
+	if x < 0 || y < 0 || x >= f.width || y >= f.height {
+		return 0, 0
+	}
+	n := f.next[y * f.width + x]
+	if n < 0 {
+		return 0, 0
+	}
+	return n % f.width - x, n / f.width - y
+}
@@ -0,0 +1,336 @@
+module wasm96
+
+// Zero-allocation number and string formatting.
+//
+// The fmt_append_* helpers append to a caller-owned buffer with <<, so as long
+// as the buffer was created with enough capacity (e.g. []u8{cap: 64}) and is
+// cleared between uses, formatting never allocates.
+
+// Append the decimal representation of n.
+pub fn fmt_append_int(mut buf []u8, n i64) {
+	if n < 0 {
+		buf << `-`
+		// Negate through u64 so i64 min does not overflow.
+		fmt_append_uint(mut buf, u64(0) - u64(n))
+		return
+	}
+	fmt_append_uint(mut buf, u64(n))
+}
+
+// Append the decimal representation of n.
+pub fn fmt_append_uint(mut buf []u8, n u64) {
+	fmt_append_uint_padded(mut buf, n, 0, ` `)
+}
+
+fn fmt_append_uint_padded(mut buf []u8, n u64, width int, pad u8) {
+	mut digits := [20]u8{}
+	mut count := 0
+	mut v := n
+	for {
+		digits[count] = u8(v % 10) + `0`
+		count++
+		v /= 10
+		if v == 0 {
+			break
+		}
+	}
+	for _ in count .. width {
+		buf << pad
+	}
+	for i := count - 1; i >= 0; i-- {
+		buf << digits[i]
+	}
+}
+
+// Append n in lower-case hexadecimal, zero-padded to at least width digits.
+pub fn fmt_append_hex(mut buf []u8, n u64, width int) {
+	fmt_append_hex_padded(mut buf, n, width, `0`)
+}
+
+fn fmt_append_hex_padded(mut buf []u8, n u64, width int, pad u8) {
+	hex_digits := '0123456789abcdef'
+	mut digits := [16]u8{}
+	mut count := 0
+	mut v := n
+	for {
+		digits[count] = hex_digits[int(v & 0xf)]
+		count++
+		v >>= 4
+		if v == 0 {
+			break
+		}
+	}
+	for _ in count .. width {
+		buf << pad
+	}
+	for i := count - 1; i >= 0; i-- {
+		buf << digits[i]
+	}
+}
+
+// Append n padded to width, with the sign ahead of zero padding and after
+// space padding.
+fn fmt_append_int_padded(mut buf []u8, n i64, width int, pad u8) {
+	if n >= 0 {
+		fmt_append_uint_padded(mut buf, u64(n), width, pad)
+		return
+	}
+	mag := u64(0) - u64(n)
+	if pad == ` ` {
+		mut count := 1
+		for v := mag / 10; v != 0; v /= 10 {
+			count++
+		}
+		for _ in count + 1 .. width {
+			buf << ` `
+		}
+		buf << `-`
+		fmt_append_uint(mut buf, mag)
+		return
+	}
+	buf << `-`
+	fmt_append_uint_padded(mut buf, mag, width - 1, pad)
+}
+
+// Append f with a fixed number of decimals (0 to 9).
+pub fn fmt_append_float(mut buf []u8, f f64, decimals int) {
+	if f != f {
+		fmt_append_str(mut buf, 'nan')
+		return
+	}
+	mut v := f
+	if v < 0 {
+		buf << `-`
+		v = -v
+	}
+	if v > 1.8e19 {
+		fmt_append_str(mut buf, 'inf')
+		return
+	}
+	d := if decimals < 0 {
+		0
+	} else if decimals > 9 {
+		9
+	} else {
+		decimals
+	}
+	mut scale := u64(1)
+	for _ in 0 .. d {
+		scale *= 10
+	}
+	// Scaling must stay within u64, as converting a larger float traps on
+	// wasm. Digits that don't fit are past f64's precision anyway, so they
+	// print as zeros.
+	mut kept := d
+	for kept > 0 && v * f64(scale) >= 1.8e19 {
+		kept--
+		scale /= 10
+	}
+	scaled := u64(v * f64(scale) + 0.5)
+	fmt_append_uint(mut buf, scaled / scale)
+	if d > 0 {
+		buf << `.`
+		if kept > 0 {
+			fmt_append_uint_padded(mut buf, scaled % scale, kept, `0`)
+		}
+		for _ in kept .. d {
+			buf << `0`
+		}
+	}
+}
+
+// Append the bytes of s.
+pub fn fmt_append_str(mut buf []u8, s string) {
+	for i in 0 .. s.len {
+		buf << s[i]
+	}
+}
+
+// Write n into buf from the start and return the number of bytes written.
+// buf must be large enough (20 bytes always is).
+pub fn fmt_itoa(mut buf []u8, n i64) int {
+	buf.clear()
+	fmt_append_int(mut buf, n)
+	return buf.len
+}
+
+// Write f into buf from the start and return the number of bytes written.
+pub fn fmt_ftoa(mut buf []u8, f f64, decimals int) int {
+	buf.clear()
+	fmt_append_float(mut buf, f, decimals)
+	return buf.len
+}
+
+enum FmtKind {
+	signed
+	unsigned
+	float
+	text
+}
+
+// A sprintf argument. Build with fmt_i, fmt_u, fmt_f or fmt_s.
+pub struct FmtArg {
+	kind FmtKind
+	i    i64
+	u    u64
+	f    f64
+	s    string
+}
+
+// A signed integer argument for fmt_sprintf.
+pub fn fmt_i(n i64) FmtArg {
+	return FmtArg{
+		kind: .signed
+		i: n
+	}
+}
+
+// An unsigned integer argument for fmt_sprintf.
+pub fn fmt_u(n u64) FmtArg {
+	return FmtArg{
+		kind: .unsigned
+		u: n
+	}
+}
+
+// A float argument for fmt_sprintf.
+pub fn fmt_f(f f64) FmtArg {
+	return FmtArg{
+		kind: .float
+		f: f
+	}
+}
+
+// A string argument for fmt_sprintf.
+pub fn fmt_s(s string) FmtArg {
+	return FmtArg{
+		kind: .text
+		s: s
+	}
+}
+
+fn (a FmtArg) as_u64() u64 {
+	return match a.kind {
+		.signed { u64(a.i) }
+		.unsigned { a.u }
+		.float { fmt_f64_to_u64(a.f) }
+		.text { 0 }
+	}
+}
+
+// Convert f to an integer, saturating out-of-range values and giving 0 for
+// NaN, as a plain conversion traps on wasm.
+fn fmt_f64_to_i64(f f64) i64 {
+	if f != f {
+		return 0
+	}
+	if f >= 9.223372036854775807e18 {
+		return max_i64
+	}
+	if f <= -9.223372036854775808e18 {
+		return min_i64
+	}
+	return i64(f)
+}
+
+// Convert f to an unsigned integer like fmt_f64_to_i64. Negative values wrap
+// the way a negative signed argument does.
+fn fmt_f64_to_u64(f f64) u64 {
+	if f < 0 {
+		return u64(fmt_f64_to_i64(f))
+	}
+	if f != f {
+		return 0
+	}
+	if f >= 1.8446744073709552e19 {
+		return max_u64
+	}
+	return u64(f)
+}
+
+// Append a formatted string to buf. Supports %d, %u, %x, %f, %s, %c and %%,
+// with an optional zero flag and width for integers (%04d, %8x) and a
+// precision for floats (%.2f, default 2). Missing arguments format as nothing.
+// args is caller-owned; fill a reused slice each time to avoid allocating.
+//
+//   mut args := []wasm96.FmtArg{len: 1}
+//   args[0] = wasm96.fmt_i(score)
+//   wasm96.fmt_sprintf(mut buf, 'SCORE %06d', args)
+pub fn fmt_sprintf(mut buf []u8, format string, args []FmtArg) {
+	mut next := 0
+	mut i := 0
+	for i < format.len {
+		c := format[i]
+		i++
+		if c != `%` || i >= format.len {
+			buf << c
+			continue
+		}
+		mut pad := u8(` `)
+		if format[i] == `0` {
+			pad = `0`
+			i++
+		}
+		mut width := 0
+		for i < format.len && format[i] >= `0` && format[i] <= `9` {
+			width = width * 10 + int(format[i] - `0`)
+			i++
+		}
+		mut precision := 2
+		if i < format.len && format[i] == `.` {
+			i++
+			precision = 0
+			for i < format.len && format[i] >= `0` && format[i] <= `9` {
+				precision = precision * 10 + int(format[i] - `0`)
+				i++
+			}
+		}
+		if i >= format.len {
+			break
+		}
+		verb := format[i]
+		i++
+		if verb == `%` {
+			buf << `%`
+			continue
+		}
+		if next >= args.len {
+			continue
+		}
+		arg := args[next]
+		next++
+		match verb {
+			`d`, `i` {
+				mut n := arg.i
+				if arg.kind == .unsigned {
+					n = i64(arg.u)
+				} else if arg.kind == .float {
+					n = fmt_f64_to_i64(arg.f)
+				}
+				fmt_append_int_padded(mut buf, n, width, pad)
+			}
+			`u` {
+				fmt_append_uint_padded(mut buf, arg.as_u64(), width, pad)
+			}
+			`x` {
+				fmt_append_hex_padded(mut buf, arg.as_u64(), width, pad)
+			}
+			`f` {
+				f := match arg.kind {
+					.signed { f64(arg.i) }
+					.unsigned { f64(arg.u) }
+					.float { arg.f }
+					.text { f64(0) }
+				}
+				fmt_append_float(mut buf, f, precision)
+			}
+			`c` {
+				buf << u8(arg.as_u64())
+			}
+			`s` {
+				fmt_append_str(mut buf, arg.s)
+			}
+			else {}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+module wasm96
+
+// Hierarchical finite state machines.
+//
+// States are identified by ints, usually an enum cast with int(). Each has
+// optional enter, exit and update hooks that receive the machine's context
+// (an entity, the game, ...). A state may have a parent: while it is active
+// its ancestors are active too, their updates run first, and transitions
+// declared on an ancestor apply to all of its descendants.
+//
+//   mut m := wasm96.StateMachine[Enemy]{}
+//   m.add(wasm96.FsmState[Enemy]{ id: int(AI.patrol), on_update: patrol })
+//   m.add(wasm96.FsmState[Enemy]{ id: int(AI.chase), on_update: chase })
+//   m.add_transition(int(AI.patrol), int(AI.chase), sees_player)
+//   m.start(mut enemy, int(AI.patrol))
+
+// A state and its hooks.
+pub struct FsmState[T] {
+pub mut:
+	id int
+	// Enclosing state, or -1 at the top level.
+	parent int = -1
+	// Child entered when a transition targets this state, or -1.
+	initial   int = -1
+	on_enter  fn (mut ctx T) = unsafe { nil }
+	on_exit   fn (mut ctx T) = unsafe { nil }
+	on_update fn (mut ctx T) = unsafe { nil }
+}
+
+// A move from one state (or any of its descendants) to another, taken
+// automatically on update or when event is sent, if guard allows it.
+pub struct FsmTransition[T] {
+pub mut:
+	from int
+	to   int
+	// Event that triggers the transition, or -1 to check it on every update.
+	event int = -1
+	guard fn (ctx &T) bool = unsafe { nil }
+}
+
+// A hierarchical state machine over context type T.
+pub struct StateMachine[T] {
+mut:
+	states      []FsmState[T]
+	defined     []bool
+	transitions []FsmTransition[T]
+	current     int = -1
+	previous    int = -1
+	frames      u64
+}
+
+// Add a state, replacing any earlier one with the same id.
+pub fn (mut m StateMachine[T]) add(state FsmState[T]) {
+	for m.states.len <= state.id {
+		m.states << FsmState[T]{}
+		m.defined << false
+	}
+	m.states[state.id] = state
+	m.defined[state.id] = true
+}
+
+// Add a transition checked on every update. guard may be nil to always take
+// it.
+pub fn (mut m StateMachine[T]) add_transition(from int, to int, guard fn (ctx &T) bool) {
+	m.transitions << FsmTransition[T]{
+		from: from
+		to: to
+		guard: guard
+	}
+}
+
+// Add a transition taken when event is sent. guard may be nil.
+pub fn (mut m StateMachine[T]) on_event(from int, event int, to int, guard fn (ctx &T) bool) {
+	m.transitions << FsmTransition[T]{
+		from: from
+		to: to
+		event: event
+		guard: guard
+	}
+}
+
+// Enter the initial state.
+pub fn (mut m StateMachine[T]) start(mut ctx T, id int) {
+	m.current = -1
+	m.change(mut ctx, id)
+}
+
+// Get the active (innermost) state, or -1 before start.
+pub fn (m &StateMachine[T]) state() int {
+	return m.current
+}
+
+// Get the state active before the last change, or -1.
+pub fn (m &StateMachine[T]) previous_state() int {
+	return m.previous
+}
+
+// Get the number of updates since the last change.
+pub fn (m &StateMachine[T]) frames_in_state() u64 {
+	return m.frames
+}
+
+// Returns true if id is the active state or one of its ancestors.
+pub fn (m &StateMachine[T]) in_state(id int) bool {
+	mut s := m.current
+	for s >= 0 {
+		if s == id {
+			return true
+		}
+		s = m.parent_of(s)
+	}
+	return false
+}
+
+fn (m &StateMachine[T]) parent_of(id int) int {
+	return if id >= 0 && id < m.states.len { m.states[id].parent } else { -1 }
+}
+
+fn (m &StateMachine[T]) depth(id int) int {
+	mut d := 0
+	mut s := id
+	for s >= 0 {
+		d++
+		s = m.parent_of(s)
+	}
+	return d
+}
+
+// Take the first allowed automatic transition, then run the update hooks of
+// the active state and its ancestors, outermost first.
+pub fn (mut m StateMachine[T]) update(mut ctx T) {
+	if m.current < 0 {
+		return
+	}
+	m.fire(mut ctx, -1)
+	m.frames++
+	m.update_from(mut ctx, m.current)
+}
+
+fn (mut m StateMachine[T]) update_from(mut ctx T, id int) {
+	if id < 0 {
+		return
+	}
+	m.update_from(mut ctx, m.parent_of(id))
+	if m.states[id].on_update != unsafe { nil } {
+		m.states[id].on_update(mut ctx)
+	}
+}
+
+// Send an event. Returns true if it caused a transition.
+pub fn (mut m StateMachine[T]) send(mut ctx T, event int) bool {
+	return m.fire(mut ctx, event)
+}
+
+fn (mut m StateMachine[T]) fire(mut ctx T, event int) bool {
+	for t in m.transitions {
+		if t.event != event || !m.in_state(t.from) {
+			continue
+		}
+		if t.guard != unsafe { nil } && !t.guard(&ctx) {
+			continue
+		}
+		m.change(mut ctx, t.to)
+		return true
+	}
+	return false
+}
+
+// Switch to state id, exiting states up to the common ancestor and entering
+// those below it, then descending through initial children.
+pub fn (mut m StateMachine[T]) change(mut ctx T, id int) {
+	if id < 0 || id >= m.states.len || !m.defined[id] {
+		return
+	}
+	mut target := id
+	for m.states[target].initial >= 0 {
+		target = m.states[target].initial
+	}
+	// Walk both chains up to their lowest common ancestor.
+	mut a := m.current
+	mut b := target
+	mut da := m.depth(a)
+	mut db := m.depth(b)
+	for da > db {
+		m.exit_state(mut ctx, a)
+		a = m.parent_of(a)
+		da--
+	}
+	mut entering := []int{}
+	for db > da {
+		entering << b
+		b = m.parent_of(b)
+		db--
+	}
+	for a != b {
+		m.exit_state(mut ctx, a)
+		a = m.parent_of(a)
+		entering << b
+		b = m.parent_of(b)
+	}
+	// Re-entering the same state exits and enters it again.
+	if entering.len == 0 && target == m.current && target >= 0 {
+		m.exit_state(mut ctx, target)
+		entering << target
+	}
+	m.previous = m.current
+	m.current = target
+	m.frames = 0
+	for i := entering.len - 1; i >= 0; i-- {
+		s := entering[i]
+		if m.states[s].on_enter != unsafe { nil } {
+			m.states[s].on_enter(mut ctx)
+		}
+	}
+}
+
+fn (mut m StateMachine[T]) exit_state(mut ctx T, id int) {
+	if m.states[id].on_exit != unsafe { nil } {
+		m.states[id].on_exit(mut ctx)
+	}
+}
@@ -0,0 +1,460 @@
+module wasm96
+
+// Animated GIF decoding, playback and encoding in guest memory.
+//
+// Unlike graphics_gif_register, frames are decoded into Images, so they can be
+// blitted into other images, recolored or stepped manually.
+
+// One fully composited frame of a GIF.
+pub struct GifFrame {
+pub mut:
+	image    Image
+	delay_ms int
+}
+
+// A decoded GIF.
+pub struct GifAnimation {
+pub mut:
+	width  int
+	height int
+	frames []GifFrame
+	// Number of times to play; 0 loops forever.
+	loop_count int = 1
+}
+
+// Delays shorter than this are shown at 100 ms, as browsers do.
+const gif_min_delay_ms = 20
+
+struct GifReader {
+	data []u8
+mut:
+	pos int
+}
+
+fn (mut r GifReader) read_byte() !u8 {
+	if r.pos >= r.data.len {
+		return error('gif: unexpected end of data')
+	}
+	r.pos++
+	return r.data[r.pos - 1]
+}
+
+fn (mut r GifReader) read_word() !int {
+	lo := r.read_byte()!
+	hi := r.read_byte()!
+	return int(lo) | int(hi) << 8
+}
+
+fn (mut r GifReader) palette(size int) ![]Color {
+	if r.pos + size * 3 > r.data.len {
+		return error('gif: unexpected end of data')
+	}
+	mut pal := []Color{len: size}
+	for i in 0 .. size {
+		p := r.pos + i * 3
+		pal[i] = Color{r.data[p], r.data[p + 1], r.data[p + 2], 255}
+	}
+	r.pos += size * 3
+	return pal
+}
+
+// Read a chain of data sub-blocks.
+fn (mut r GifReader) sub_blocks() ![]u8 {
+	mut out := []u8{}
+	for {
+		n := int(r.read_byte()!)
+		if n == 0 {
+			return out
+		}
+		if r.pos + n > r.data.len {
+			return error('gif: unexpected end of data')
+		}
+		out << r.data[r.pos..r.pos + n]
+		r.pos += n
+	}
+	return out
+}
+
+// Decode a GIF into composited frames.
+pub fn gif_decode(data []u8) !GifAnimation {
+	if data.len < 13 || data[..6].bytestr() !in ['GIF87a', 'GIF89a'] {
+		return error('gif: bad header')
+	}
+	mut r := GifReader{
+		data: data
+		pos: 6
+	}
+	mut anim := GifAnimation{
+		width: r.read_word()!
+		height: r.read_word()!
+	}
+	flags := r.read_byte()!
+	r.pos += 2
+	mut global := []Color{}
+	if flags & 0x80 != 0 {
+		global = r.palette(2 << (flags & 7))!
+	}
+	mut canvas := new_image(anim.width, anim.height)
+	mut delay := 0
+	mut transparent := -1
+	mut disposal := 0
+	for {
+		match r.read_byte()! {
+			0x21 {
+				label := r.read_byte()!
+				block := r.sub_blocks()!
+				if label == 0xf9 && block.len >= 4 {
+					disposal = (block[0] >> 2) & 7
+					delay = (int(block[1]) | int(block[2]) << 8) * 10
+					transparent = if block[0] & 1 != 0 { int(block[3]) } else { -1 }
+				} else if label == 0xff && block.len >= 14 && block[..11].bytestr() in ['NETSCAPE2.0', 'ANIMEXTS1.0']
+					&& block[11] == 1 {
+					// The stored count is extra repeats; 0 means forever.
+					repeats := int(block[12]) | int(block[13]) << 8
+					anim.loop_count = if repeats == 0 { 0 } else { repeats + 1 }
+				}
+			}
+			0x2c {
+				left := r.read_word()!
+				top := r.read_word()!
+				w := r.read_word()!
+				h := r.read_word()!
+				desc := r.read_byte()!
+				palette := if desc & 0x80 != 0 { r.palette(2 << (desc & 7))! } else { global }
+				min_size := int(r.read_byte()!)
+				if min_size < 2 || min_size > 11 {
+					return error('gif: bad LZW code size ${min_size}')
+				}
+				indices := gif_lzw(r.sub_blocks()!, min_size, w * h)!
+				saved := if disposal == 3 { canvas.sub_image(0, 0, canvas.width, canvas.height) } else { Image{} }
+				rows := gif_rows(h, desc & 0x40 != 0)
+				for i, index in indices {
+					if int(index) == transparent || int(index) >= palette.len {
+						continue
+					}
+					canvas.set(left + i % w, top + rows[i / w], palette[index])
+				}
+				anim.frames << GifFrame{
+					image: canvas.sub_image(0, 0, canvas.width, canvas.height)
+					delay_ms: if delay < gif_min_delay_ms { 100 } else { delay }
+				}
+				match disposal {
+					2 { canvas.fill_rect(left, top, w, h, Color{ a: 0 }) }
+					3 { canvas = saved }
+					else {}
+				}
+				delay = 0
+				transparent = -1
+				disposal = 0
+			}
+			0x3b {
+				break
+			}
+			else {
+				return error('gif: unknown block at ${r.pos - 1}')
+			}
+		}
+	}
+	if anim.frames.len == 0 {
+		return error('gif: no frames')
+	}
+	return anim
+}
+
+// Map stored row order to image rows for (non-)interlaced images.
+fn gif_rows(h int, interlaced bool) []int {
+	mut rows := []int{cap: h}
+	if !interlaced {
+		for y in 0 .. h {
+			rows << y
+		}
+		return rows
+	}
+	for pass in [[0, 8], [4, 8], [2, 4], [1, 2]] {
+		for y := pass[0]; y < h; y += pass[1] {
+			rows << y
+		}
+	}
+	return rows
+}
+
+// Decode GIF-flavoured LZW into count color indices.
+fn gif_lzw(data []u8, min_size int, count int) ![]u8 {
+	clear := 1 << min_size
+	eoi := clear + 1
+	mut size := min_size + 1
+	mut next := clear + 2
+	mut prefix := []u16{len: 4096}
+	mut suffix := []u8{len: 4096}
+	mut stack := []u8{len: 4097}
+	mut out := []u8{cap: count}
+	mut prev := -1
+	mut first := u8(0)
+	mut bitbuf := u32(0)
+	mut bitcnt := 0
+	mut pos := 0
+	for out.len < count {
+		for bitcnt < size && pos < data.len {
+			bitbuf |= u32(data[pos]) << bitcnt
+			pos++
+			bitcnt += 8
+		}
+		if bitcnt < size {
+			break
+		}
+		code := int(bitbuf & ((u32(1) << size) - 1))
+		bitbuf >>= size
+		bitcnt -= size
+		if code == clear {
+			size = min_size + 1
+			next = clear + 2
+			prev = -1
+			continue
+		}
+		if code == eoi {
+			break
+		}
+		if prev < 0 {
+			if code >= clear {
+				return error('gif: bad LZW code')
+			}
+			first = u8(code)
+			out << first
+			prev = code
+			continue
+		}
+		if code > next {
+			return error('gif: bad LZW code')
+		}
+		mut sp := 0
+		mut c := code
+		if code == next {
+			stack[sp] = first
+			sp++
+			c = prev
+		}
+		for c >= clear {
+			stack[sp] = suffix[c]
+			sp++
+			c = int(prefix[c])
+		}
+		stack[sp] = u8(c)
+		sp++
+		first = u8(c)
+		for sp > 0 && out.len < count {
+			sp--
+			out << stack[sp]
+		}
+		if next < 4096 {
+			prefix[next] = u16(prev)
+			suffix[next] = first
+			next++
+			if next == 1 << size && size < 12 {
+				size++
+			}
+		}
+		prev = code
+	}
+	// Short streams leave the remaining pixels at index 0.
+	for out.len < count {
+		out << 0
+	}
+	return out
+}
+
+// Plays a decoded GIF on its own schedule.
+pub struct GifPlayer {
+pub mut:
+	anim   GifAnimation
+	speed  f32 = 1.0
+	paused bool
+mut:
+	index   int
+	elapsed f32
+	plays   int
+	done    bool
+}
+
+// Create a player for a decoded GIF.
+pub fn gif_player(anim GifAnimation) GifPlayer {
+	return GifPlayer{
+		anim: anim
+	}
+}
+
+// Advance by dt milliseconds.
+pub fn (mut p GifPlayer) update(dt f32) {
+	if p.paused || p.done || p.anim.frames.len == 0 {
+		return
+	}
+	p.elapsed += dt * p.speed
+	for p.elapsed >= f32(p.anim.frames[p.index].delay_ms) {
+		p.elapsed -= f32(p.anim.frames[p.index].delay_ms)
+		if p.index + 1 < p.anim.frames.len {
+			p.index++
+			continue
+		}
+		p.plays++
+		if p.anim.loop_count > 0 && p.plays >= p.anim.loop_count {
+			p.done = true
+			return
+		}
+		p.index = 0
+	}
+}
+
+// Restart from the first frame.
+pub fn (mut p GifPlayer) rewind() {
+	p.index = 0
+	p.elapsed = 0
+	p.plays = 0
+	p.done = false
+}
+
+// Returns true once a non-looping GIF has played through.
+pub fn (p &GifPlayer) finished() bool {
+	return p.done
+}
+
+// Get the current frame index.
+pub fn (p &GifPlayer) frame() int {
+	return p.index
+}
+
+// Get the current frame image.
+pub fn (p &GifPlayer) image() &Image {
+	return unsafe { &p.anim.frames[p.index].image }
+}
+
+// Draw the current frame at (x, y).
+pub fn (p &GifPlayer) draw(x int, y int) {
+	if p.anim.frames.len == 0 {
+		return
+	}
+	p.anim.frames[p.index].image.draw(x, y)
+}
+
+// Encode indexed frames (one palette index per pixel) as a looping GIF.
+// palette may hold up to 256 colors.
+pub fn gif_encode(width int, height int, palette []Color, frames [][]u8, delay_ms int) []u8 {
+	mut out := []u8{}
+	out << 'GIF89a'.bytes()
+	gif_put_word(mut out, width)
+	gif_put_word(mut out, height)
+	// Global color table of 256 entries.
+	out << [u8(0xf7), 0, 0]
+	for i in 0 .. 256 {
+		c := if i < palette.len { palette[i] } else { Color{} }
+		out << [c.r, c.g, c.b]
+	}
+	// Loop forever.
+	out << [u8(0x21), 0xff, 11]
+	out << 'NETSCAPE2.0'.bytes()
+	out << [u8(3), 1, 0, 0, 0]
+	delay := (delay_ms + 5) / 10
+	for frame in frames {
+		out << [u8(0x21), 0xf9, 4, 0x04]
+		gif_put_word(mut out, delay)
+		out << [u8(0), 0]
+		out << 0x2c
+		gif_put_word(mut out, 0)
+		gif_put_word(mut out, 0)
+		gif_put_word(mut out, width)
+		gif_put_word(mut out, height)
+		out << 0
+		out << 8
+		data := gif_lzw_encode(frame, 8)
+		for pos := 0; pos < data.len; pos += 255 {
+			n := min_int(255, data.len - pos)
+			out << u8(n)
+			out << data[pos..pos + n]
+		}
+		out << 0
+	}
+	out << 0x3b
+	return out
+}
+
+fn gif_put_word(mut out []u8, v int) {
+	out << u8(v)
+	out << u8(v >> 8)
+}
+
+struct GifBitWriter {
+mut:
+	out    []u8
+	bitbuf u32
+	bitcnt int
+}
+
+fn (mut w GifBitWriter) put(code int, size int) {
+	w.bitbuf |= u32(code) << w.bitcnt
+	w.bitcnt += size
+	for w.bitcnt >= 8 {
+		w.out << u8(w.bitbuf)
+		w.bitbuf >>= 8
+		w.bitcnt -= 8
+	}
+}
+
+fn (mut w GifBitWriter) flush() {
+	if w.bitcnt > 0 {
+		w.out << u8(w.bitbuf)
+	}
+	w.bitbuf = 0
+	w.bitcnt = 0
+}
+
+// Encode color indices with GIF-flavoured LZW. The dictionary is a trie of
+// first-child/next-sibling links and is reset when full.
+fn gif_lzw_encode(indices []u8, min_size int) []u8 {
+	clear := 1 << min_size
+	eoi := clear + 1
+	mut w := GifBitWriter{}
+	mut size := min_size + 1
+	mut next := clear + 2
+	mut child := []u16{len: 4096}
+	mut sibling := []u16{len: 4096}
+	mut suffix := []u8{len: 4096}
+	w.put(clear, size)
+	if indices.len == 0 {
+		w.put(eoi, size)
+		w.flush()
+		return w.out
+	}
+	mut cur := int(indices[0])
+	for i in 1 .. indices.len {
+		k := indices[i]
+		mut c := int(child[cur])
+		for c != 0 && suffix[c] != k {
+			c = int(sibling[c])
+		}
+		if c != 0 {
+			cur = c
+			continue
+		}
+		w.put(cur, size)
+		if next < 4096 {
+			suffix[next] = k
+			sibling[next] = child[cur]
+			child[cur] = u16(next)
+			next++
+			// The decoder adds its entries one code later, so widen one late.
+			if next > 1 << size && size < 12 {
+				size++
+			}
+		} else {
+			w.put(clear, size)
+			for j in 0 .. 4096 {
+				child[j] = 0
+			}
+			size = min_size + 1
+			next = clear + 2
+		}
+		cur = int(k)
+	}
+	w.put(cur, size)
+	w.put(eoi, size)
+	w.flush()
+	return w.out
+}
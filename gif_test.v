@@ -0,0 +1,64 @@
+module wasm96
+
+const gif_test_palette = [Color{0, 0, 0, 255}, Color{255, 0, 0, 255}, Color{0, 255, 0, 255},
+	Color{0, 0, 255, 255}]
+
+fn gif_test_frame(w int, h int, seed int) []u8 {
+	mut out := []u8{len: w * h}
+	for i in 0 .. out.len {
+		out[i] = u8((i * 7 + (i / w) * 13 + seed + (i * i) % 5) % 4)
+	}
+	return out
+}
+
+fn test_gif_round_trip() ! {
+	w, h := 64, 48
+	frames := [gif_test_frame(w, h, 0), gif_test_frame(w, h, 1), []u8{len: w * h}]
+	data := gif_encode(w, h, gif_test_palette, frames, 100)
+	anim := gif_decode(data)!
+	assert anim.width == w
+	assert anim.height == h
+	assert anim.loop_count == 0
+	assert anim.frames.len == frames.len
+	for f, frame in frames {
+		assert anim.frames[f].delay_ms == 100
+		img := anim.frames[f].image
+		for i, index in frame {
+			assert img.get(i % w, i / w) == gif_test_palette[index]
+		}
+	}
+}
+
+fn test_gif_lzw_round_trip() ! {
+	// Enough distinct strings to fill the code table and force a reset.
+	mut data := []u8{len: 20000}
+	for i in 0 .. data.len {
+		data[i] = u8((i * 131 + i / 7) % 256)
+	}
+	assert gif_lzw(gif_lzw_encode(data, 8), 8, data.len)! == data
+	flat := []u8{len: 5000}
+	assert gif_lzw(gif_lzw_encode(flat, 8), 8, flat.len)! == flat
+}
+
+fn test_gif_encode_header() {
+	frames := [gif_test_frame(16, 8, 0), gif_test_frame(16, 8, 3)]
+	data := gif_encode(16, 8, gif_test_palette, frames, 50)
+	// Signature, 16x8, 256-entry global color table.
+	assert data[..13] == [u8(`G`), `I`, `F`, `8`, `9`, `a`, 16, 0, 8, 0, 0xf7, 0, 0]
+	assert data[13..25] == [u8(0), 0, 0, 255, 0, 0, 0, 255, 0, 0, 0, 255]
+	assert data[data.len - 1] == 0x3b
+	assert gif_encode(16, 8, gif_test_palette, frames, 50) == data
+}
+
+fn test_gif_decode_errors() {
+	if _ := gif_decode('GIF89a'.bytes()) {
+		assert false
+	}
+	if _ := gif_decode('PNG'.bytes()) {
+		assert false
+	}
+	data := gif_encode(4, 4, gif_test_palette, [[]u8{len: 16}], 100)
+	if _ := gif_decode(data[..data.len - 10]) {
+		assert false
+	}
+}
@@ -0,0 +1,302 @@
+module wasm96
+
+// Controller button icons and prompt markup.
+//
+// Glyphs draws small icons for joypad buttons, mouse buttons and keyboard
+// keys out of primitives, sized to the text font, so prompts need no image
+// assets. draw_prompt renders text with icons inlined by name in braces:
+//
+//   glyphs.draw_prompt(8, 8, 'Press {A} to jump, {L1}/{R1} to switch')
+//
+// Button names are the Button enum's (A, B, X, Y, UP, DOWN, LEFT, RIGHT,
+// L1 to R3, START, SELECT), plus DPAD, LMB, RMB and MMB for the mouse, and
+// KEY:<label> for a keyboard key cap. Unknown names are drawn as text.
+
+// What a prompt icon shows.
+pub enum GlyphKind {
+	button
+	dpad
+	mouse
+	key
+}
+
+// A resolved prompt icon.
+pub struct Glyph {
+pub:
+	kind   GlyphKind
+	button Button
+	mouse  u32
+	label  string
+}
+
+// Icon set and prompt renderer.
+pub struct Glyphs {
+pub mut:
+	// Font for labels and prompt text; the built-in debug font when empty.
+	font_key   []u8
+	text_color Color = Color{255, 255, 255, 255}
+	icon_color Color = Color{70, 70, 90, 255}
+	// Face button colors, in A, B, X, Y order.
+	face_colors [4]Color = [Color{200, 60, 60, 255}, Color{220, 190, 40, 255},
+		Color{60, 110, 210, 255}, Color{60, 170, 80, 255}]!
+	// Gap around icons in pixels.
+	gap int = 2
+}
+
+// Button names by value, taken from the Button enum so they can't drift.
+const glyph_button_names = glyph_list_buttons()
+
+fn glyph_list_buttons() []string {
+	mut names := []string{cap: int(Button.r3) + 1}
+	for i in 0 .. int(Button.r3) + 1 {
+		names << unsafe { Button(i) }.str().to_upper()
+	}
+	return names
+}
+
+// Look up an icon by its markup name (case-insensitive).
+pub fn glyph_named(name string) ?Glyph {
+	upper := name.to_upper()
+	if upper.starts_with('KEY:') {
+		return Glyph{
+			kind: .key
+			label: name[4..]
+		}
+	}
+	match upper {
+		'DPAD' {
+			return Glyph{
+				kind: .dpad
+			}
+		}
+		'LMB' {
+			return Glyph{
+				kind: .mouse
+				mouse: 0
+			}
+		}
+		'RMB' {
+			return Glyph{
+				kind: .mouse
+				mouse: 1
+			}
+		}
+		'MMB' {
+			return Glyph{
+				kind: .mouse
+				mouse: 2
+			}
+		}
+		else {}
+	}
+	for i, n in glyph_button_names {
+		if n == upper {
+			return Glyph{
+				kind: .button
+				button: unsafe { Button(i) }
+				label: n
+			}
+		}
+	}
+	return none
+}
+
+fn (g &Glyphs) font() []u8 {
+	return if g.font_key.len > 0 { g.font_key } else { debug_font_key }
+}
+
+fn (g &Glyphs) has_font() bool {
+	return g.font_key.len > 0 || debug_font_ready()
+}
+
+// Get the icon height, matching a line of text.
+pub fn (g &Glyphs) size() int {
+	if !g.has_font() {
+		return 8
+	}
+	return max_int(8, int(graphics_text_measure_key(g.font(), 'M'.bytes()).height))
+}
+
+fn (g &Glyphs) text_width(s string) int {
+	if s.len == 0 || !g.has_font() {
+		return 0
+	}
+	return int(graphics_text_measure_key(g.font(), s.bytes()).width)
+}
+
+fn (g &Glyphs) text(x int, y int, s string, c Color) {
+	if s.len == 0 || !g.has_font() {
+		return
+	}
+	graphics_set_color_rgba(c)
+	graphics_text_key(x, y, g.font(), s.bytes())
+}
+
+// Get the width of an icon in pixels.
+pub fn (g &Glyphs) width(gl Glyph) int {
+	h := g.size()
+	return match gl.kind {
+		.button {
+			match gl.button {
+				.a, .b, .x, .y, .up, .down, .left, .right { h }
+				else { max_int(h, g.text_width(gl.label) + 6) }
+			}
+		}
+		.dpad {
+			h
+		}
+		.mouse {
+			h * 3 / 4
+		}
+		.key {
+			max_int(h, g.text_width(gl.label) + 6)
+		}
+	}
+}
+
+// Draw an icon with its top-left at (x, y). Returns its width.
+pub fn (g &Glyphs) draw(x int, y int, gl Glyph) int {
+	h := g.size()
+	w := g.width(gl)
+	match gl.kind {
+		.button {
+			match gl.button {
+				.a, .b, .x, .y {
+					idx := match gl.button {
+						.a { 0 }
+						.b { 1 }
+						.x { 2 }
+						else { 3 }
+					}
+					r := h / 2
+					graphics_set_color_rgba(g.face_colors[idx])
+					graphics_circle(x + r, y + r, u32(r))
+					tw := g.text_width(gl.label)
+					g.text(x + (w - tw) / 2, y, gl.label, g.text_color)
+				}
+				.up, .down, .left, .right {
+					g.draw_dpad(x, y, h, gl.button)
+				}
+				else {
+					// Shoulders, triggers, sticks and Start/Select as labeled pills.
+					graphics_set_color_rgba(g.icon_color)
+					graphics_rect(x + 2, y, u32(w - 4), u32(h))
+					graphics_circle(x + 2, y + h / 2, u32(h / 2))
+					graphics_circle(x + w - 3, y + h / 2, u32(h / 2))
+					g.text(x + 3, y, gl.label, g.text_color)
+				}
+			}
+		}
+		.dpad {
+			g.draw_dpad(x, y, h, none)
+		}
+		.mouse {
+			graphics_set_color_rgba(g.icon_color)
+			graphics_rect(x, y + h / 3, u32(w), u32(h - h / 3))
+			half := w / 2
+			graphics_rect(x, y, u32(half - 1), u32(h / 3 - 1))
+			graphics_rect(x + half + 1, y, u32(w - half - 1), u32(h / 3 - 1))
+			graphics_set_color_rgba(g.text_color)
+			match gl.mouse {
+				0 { graphics_rect(x, y, u32(half - 1), u32(h / 3 - 1)) }
+				1 { graphics_rect(x + half + 1, y, u32(w - half - 1), u32(h / 3 - 1)) }
+				else { graphics_rect(x + half - 1, y + 1, 2, u32(h / 3)) }
+			}
+		}
+		.key {
+			graphics_set_color_rgba(g.text_color)
+			graphics_rect_outline(x, y, u32(w), u32(h))
+			graphics_set_color_rgba(g.icon_color)
+			graphics_rect(x + 1, y + 1, u32(w - 2), u32(h - 2))
+			tw := g.text_width(gl.label)
+			g.text(x + (w - tw) / 2, y, gl.label, g.text_color)
+		}
+	}
+	return w
+}
+
+// Draw a d-pad cross, with one arm lit if dir is set.
+fn (g &Glyphs) draw_dpad(x int, y int, h int, dir ?Button) {
+	t := max_int(2, h / 3)
+	o := (h - t) / 2
+	graphics_set_color_rgba(g.icon_color)
+	graphics_rect(x + o, y, u32(t), u32(h))
+	graphics_rect(x, y + o, u32(h), u32(t))
+	d := dir or { return }
+	graphics_set_color_rgba(g.text_color)
+	match d {
+		.up { graphics_rect(x + o, y, u32(t), u32(o)) }
+		.down { graphics_rect(x + o, y + o + t, u32(t), u32(h - o - t)) }
+		.left { graphics_rect(x, y + o, u32(o), u32(t)) }
+		else { graphics_rect(x + o + t, y + o, u32(h - o - t), u32(t)) }
+	}
+}
+
+// Draw the icon for a joypad button. Returns its width.
+pub fn (g &Glyphs) draw_button(x int, y int, btn Button) int {
+	return g.draw(x, y, Glyph{
+		kind: .button
+		button: btn
+		label: glyph_button_names[int(btn)]
+	})
+}
+
+fn glyph_find(s string, c u8, from int) int {
+	for i in from .. s.len {
+		if s[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// Lay out prompt markup, drawing it if draw is set. Returns the width.
+fn (g &Glyphs) layout_prompt(x int, y int, text string, draw bool) int {
+	mut pen := x
+	mut i := 0
+	for i < text.len {
+		open := glyph_find(text, `{`, i)
+		end := if open < 0 { text.len } else { open }
+		run := text[i..end]
+		if draw {
+			g.text(pen, y, run, g.text_color)
+		}
+		pen += g.text_width(run)
+		if open < 0 {
+			break
+		}
+		close := glyph_find(text, `}`, open)
+		if close < 0 {
+			rest := text[open..]
+			if draw {
+				g.text(pen, y, rest, g.text_color)
+			}
+			pen += g.text_width(rest)
+			break
+		}
+		name := text[open + 1..close]
+		if gl := glyph_named(name) {
+			pen += g.gap
+			pen += if draw { g.draw(pen, y, gl) } else { g.width(gl) }
+			pen += g.gap
+		} else {
+			raw := text[open..close + 1]
+			if draw {
+				g.text(pen, y, raw, g.text_color)
+			}
+			pen += g.text_width(raw)
+		}
+		i = close + 1
+	}
+	return pen - x
+}
+
+// Draw prompt text with {NAME} icons inlined. Returns its width.
+pub fn (g &Glyphs) draw_prompt(x int, y int, text string) int {
+	return g.layout_prompt(x, y, text, true)
+}
+
+// Get the width draw_prompt would use.
+pub fn (g &Glyphs) measure_prompt(text string) int {
+	return g.layout_prompt(0, 0, text, false)
+}
@@ -0,0 +1,83 @@
+module wasm96
+
+// Color grading.
+//
+// A ColorGrade remaps each channel through a 256-entry lookup table, so a
+// grade costs three table reads per pixel however it was built. Tables are
+// built from a tint (a multiply, like colored light), a brightness and a
+// saturation, which covers time-of-day moods, flashes and fades. Set one as
+// a VirtualScreen's grade to color the whole frame as it is presented, or
+// grade any offscreen image with apply_image.
+
+// Per-channel lookup tables.
+pub struct ColorGrade {
+pub:
+	tint       Color = Color{255, 255, 255, 255}
+	brightness f32   = 1
+	saturation f32   = 1
+mut:
+	r []u8
+	g []u8
+	b []u8
+}
+
+// Build a grade: channels are multiplied by tint and by brightness, and
+// pulled towards gray for saturation below 1 (0 is grayscale).
+pub fn new_color_grade(tint Color, brightness f32, saturation f32) ColorGrade {
+	mut cg := ColorGrade{
+		tint: tint
+		brightness: brightness
+		saturation: clampf(saturation, 0, 1)
+		r: []u8{len: 256}
+		g: []u8{len: 256}
+		b: []u8{len: 256}
+	}
+	for i in 0 .. 256 {
+		v := f32(i) * brightness
+		cg.r[i] = u8(clampf(v * f32(tint.r) / 255, 0, 255))
+		cg.g[i] = u8(clampf(v * f32(tint.g) / 255, 0, 255))
+		cg.b[i] = u8(clampf(v * f32(tint.b) / 255, 0, 255))
+	}
+	return cg
+}
+
+// Returns true if the grade leaves colors as they are.
+pub fn (cg &ColorGrade) identity() bool {
+	return cg.r.len == 0 || (cg.tint.r == 255 && cg.tint.g == 255 && cg.tint.b == 255
+		&& cg.brightness == 1 && cg.saturation >= 1)
+}
+
+// Grade every pixel of img in place.
+pub fn (cg &ColorGrade) apply_image(mut img Image) {
+	if cg.identity() {
+		return
+	}
+	p := img.pixels
+	sat := int(cg.saturation * 256)
+	for i := 0; i < p.len; i += 4 {
+		mut r := int(cg.r[p[i]])
+		mut g := int(cg.g[p[i + 1]])
+		mut b := int(cg.b[p[i + 2]])
+		if sat < 256 {
+			// Rec. 601 luma in 8.8 fixed point.
+			y := (77 * r + 150 * g + 29 * b) >> 8
+			r = y + (((r - y) * sat) >> 8)
+			g = y + (((g - y) * sat) >> 8)
+			b = y + (((b - y) * sat) >> 8)
+		}
+		img.pixels[i] = u8(r)
+		img.pixels[i + 1] = u8(g)
+		img.pixels[i + 2] = u8(b)
+	}
+}
+
+// Grade a single color.
+pub fn (cg &ColorGrade) apply_color(c Color) Color {
+	mut img := Image{
+		width: 1
+		height: 1
+		pixels: [c.r, c.g, c.b, c.a]
+	}
+	cg.apply_image(mut img)
+	return Color{img.pixels[0], img.pixels[1], img.pixels[2], c.a}
+}
@@ -0,0 +1,203 @@
+module wasm96
+
+// Gradient and pattern fills.
+//
+// Fills are rendered in guest memory, into an Image or (for the graphics_*
+// helpers) into a scratch image drawn with graphics_image. With dithering on,
+// colors are ordered-dithered to RGB565 steps so smooth ramps don't band on
+// 16-bit displays.
+
+// A color at a position (0 to 1) along a gradient.
+pub struct GradientStop {
+pub:
+	pos   f32
+	color Color
+}
+
+// Shape of a gradient.
+pub enum GradientKind {
+	linear
+	radial
+}
+
+// A linear or radial gradient. Coordinates are relative to the filled area.
+pub struct Gradient {
+pub mut:
+	kind GradientKind
+	// Linear: from (x0, y0) to (x1, y1). Radial: center (x0, y0), radius r.
+	x0     f32
+	y0     f32
+	x1     f32
+	y1     f32
+	r      f32
+	stops  []GradientStop
+	dither bool = true
+}
+
+// Make a linear gradient from (x0, y0) to (x1, y1).
+pub fn linear_gradient(x0 f32, y0 f32, x1 f32, y1 f32, stops []GradientStop) Gradient {
+	return Gradient{
+		kind: .linear
+		x0: x0
+		y0: y0
+		x1: x1
+		y1: y1
+		stops: stops
+	}
+}
+
+// Make a radial gradient centred on (cx, cy).
+pub fn radial_gradient(cx f32, cy f32, r f32, stops []GradientStop) Gradient {
+	return Gradient{
+		kind: .radial
+		x0: cx
+		y0: cy
+		r: r
+		stops: stops
+	}
+}
+
+// Get the color at position t along the gradient.
+pub fn (g &Gradient) color_at(t f32) Color {
+	if g.stops.len == 0 {
+		return Color{
+			a: 0
+		}
+	}
+	if t <= g.stops[0].pos {
+		return g.stops[0].color
+	}
+	for i in 1 .. g.stops.len {
+		b := g.stops[i]
+		if t <= b.pos {
+			a := g.stops[i - 1]
+			span := b.pos - a.pos
+			f := if span > 0 { (t - a.pos) / span } else { f32(1) }
+			return color_lerp(a.color, b.color, f)
+		}
+	}
+	return g.stops[g.stops.len - 1].color
+}
+
+// Interpolate between two colors.
+pub fn color_lerp(a Color, b Color, t f32) Color {
+	return Color{u8(lerpf(f32(a.r), f32(b.r), t)), u8(lerpf(f32(a.g), f32(b.g), t)), u8(lerpf(f32(a.b),
+		f32(b.b), t)), u8(lerpf(f32(a.a), f32(b.a), t))}
+}
+
+// Get the gradient position of point (x, y).
+fn (g &Gradient) position(x f32, y f32) f32 {
+	match g.kind {
+		.linear {
+			dx := g.x1 - g.x0
+			dy := g.y1 - g.y0
+			len2 := dx * dx + dy * dy
+			if len2 == 0 {
+				return 0
+			}
+			return ((x - g.x0) * dx + (y - g.y0) * dy) / len2
+		}
+		.radial {
+			if g.r <= 0 {
+				return 0
+			}
+			dx := x - g.x0
+			dy := y - g.y0
+			return sqrtf(dx * dx + dy * dy) / g.r
+		}
+	}
+}
+
+// The 4x4 Bayer matrix, thresholds 0-15, shared by every ordered dither.
+const dither_bayer4 = [0, 8, 2, 10, 12, 4, 14, 6, 3, 11, 1, 9, 15, 7, 13, 5]
+
+// Dither a channel to a 5 or 6-bit step, returning the 8-bit result.
+fn dither_channel(v u8, bits int, threshold int) u8 {
+	step := 1 << (8 - bits)
+	// Spread the 4x4 threshold over one quantization step.
+	q := clamp_int(int(v) + threshold * step / 16, 0, 255) >> (8 - bits)
+	return u8((q << (8 - bits)) | (q >> (2 * bits - 8)))
+}
+
+// Ordered-dither a color to RGB565 precision at pixel (x, y).
+pub fn dither_rgb565(c Color, x int, y int) Color {
+	t := dither_bayer4[(y & 3) * 4 + (x & 3)]
+	return Color{dither_channel(c.r, 5, t), dither_channel(c.g, 6, t), dither_channel(c.b,
+		5, t), c.a}
+}
+
+fn clamp_int(v int, lo int, hi int) int {
+	return if v < lo {
+		lo
+	} else if v > hi {
+		hi
+	} else {
+		v
+	}
+}
+
+// Fill a rectangle of the image with a gradient, blending over what's there.
+// Gradient coordinates are relative to (x, y).
+pub fn (mut img Image) fill_gradient(x int, y int, w int, h int, g &Gradient) {
+	for py in max_int(y, 0) .. min_int(y + h, img.height) {
+		for px in max_int(x, 0) .. min_int(x + w, img.width) {
+			mut c := g.color_at(g.position(f32(px - x) + 0.5, f32(py - y) + 0.5))
+			if g.dither {
+				c = dither_rgb565(c, px, py)
+			}
+			img.blend(px, py, c)
+		}
+	}
+}
+
+// Fill a rectangle of the image by tiling pattern, blending over what's
+// there. (ox, oy) shifts the pattern, e.g. to scroll it.
+pub fn (mut img Image) fill_pattern(x int, y int, w int, h int, pattern &Image, ox int, oy int) {
+	if pattern.width <= 0 || pattern.height <= 0 {
+		return
+	}
+	for py in max_int(y, 0) .. min_int(y + h, img.height) {
+		sy := floor_mod(py - y + oy, pattern.height)
+		for px in max_int(x, 0) .. min_int(x + w, img.width) {
+			img.blend(px, py, pattern.get(floor_mod(px - x + ox, pattern.width), sy))
+		}
+	}
+}
+
+fn floor_mod(a int, b int) int {
+	m := a % b
+	return if m < 0 { m + b } else { m }
+}
+
+__global fill_scratch Image
+
+fn fill_scratch_image(w int, h int) &Image {
+	if fill_scratch.width != w || fill_scratch.height != h {
+		fill_scratch = new_image(w, h)
+	} else {
+		fill_scratch.fill(Color{
+			a: 0
+		})
+	}
+	return &fill_scratch
+}
+
+// Draw a rectangle filled with a gradient on screen.
+pub fn graphics_gradient_rect(x int, y int, w u32, h u32, g &Gradient) {
+	if w == 0 || h == 0 {
+		return
+	}
+	mut img := fill_scratch_image(int(w), int(h))
+	img.fill_gradient(0, 0, int(w), int(h), g)
+	img.draw(x, y)
+}
+
+// Draw a rectangle tiled with pattern on screen.
+pub fn graphics_pattern_rect(x int, y int, w u32, h u32, pattern &Image, ox int, oy int) {
+	if w == 0 || h == 0 {
+		return
+	}
+	mut img := fill_scratch_image(int(w), int(h))
+	img.fill_pattern(0, 0, int(w), int(h), pattern, ox, oy)
+	img.draw(x, y)
+}
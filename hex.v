@@ -0,0 +1,211 @@
+module wasm96
+
+// Hex grids in axial coordinates, plus hexagonal tilemaps.
+//
+// Axial coordinates (q, r) make neighbor, distance and line math simple;
+// offset coordinates (col, row) are what rectangular storage such as tile
+// layers use. See https://www.redblobgames.com/grids/hexagons/.
+
+// A hex cell in axial coordinates.
+pub struct Hex {
+pub mut:
+	q int
+	r int
+}
+
+// How offset coordinates stagger: which rows (r) or columns (q) are shoved.
+pub enum HexOffset {
+	odd_r
+	even_r
+	odd_q
+	even_q
+}
+
+const hex_dirs = [Hex{1, 0}, Hex{1, -1}, Hex{0, -1}, Hex{-1, 0}, Hex{-1, 1}, Hex{0, 1}]
+
+pub fn (a Hex) + (b Hex) Hex {
+	return Hex{a.q + b.q, a.r + b.r}
+}
+
+pub fn (a Hex) - (b Hex) Hex {
+	return Hex{a.q - b.q, a.r - b.r}
+}
+
+// Get the third cube coordinate.
+pub fn (h Hex) s() int {
+	return -h.q - h.r
+}
+
+// Get the neighbor in direction dir (0 to 5, counter-clockwise from east).
+pub fn (h Hex) neighbor(dir int) Hex {
+	return h + hex_dirs[floor_mod(dir, 6)]
+}
+
+// Get all six neighbors.
+pub fn (h Hex) neighbors() []Hex {
+	return hex_dirs.map(h + it)
+}
+
+// Get the number of steps between two hexes.
+pub fn (a Hex) distance(b Hex) int {
+	d := a - b
+	return (iabs(d.q) + iabs(d.r) + iabs(d.s())) / 2
+}
+
+fn iabs(v int) int {
+	return if v < 0 { -v } else { v }
+}
+
+// Round fractional axial coordinates to the nearest hex.
+pub fn hex_round(q f32, r f32) Hex {
+	s := -q - r
+	mut rq := floorf(q + 0.5)
+	mut rr := floorf(r + 0.5)
+	rs := floorf(s + 0.5)
+	dq := absf(rq - q)
+	dr := absf(rr - r)
+	ds := absf(rs - s)
+	if dq > dr && dq > ds {
+		rq = -rr - rs
+	} else if dr > ds {
+		rr = -rq - rs
+	}
+	return Hex{int(rq), int(rr)}
+}
+
+// Get the hexes on a straight line from a to b, inclusive.
+pub fn hex_line(a Hex, b Hex) []Hex {
+	n := a.distance(b)
+	mut out := []Hex{cap: n + 1}
+	for i in 0 .. n + 1 {
+		t := if n == 0 { f32(0) } else { f32(i) / f32(n) }
+		// Nudge off exact edges so ties round consistently.
+		out << hex_round(lerpf(f32(a.q) + 1e-6, f32(b.q) + 1e-6, t), lerpf(f32(a.r) + 1e-6,
+			f32(b.r) + 1e-6, t))
+	}
+	return out
+}
+
+// Get every hex within radius steps of center.
+pub fn hex_range(center Hex, radius int) []Hex {
+	mut out := []Hex{}
+	for q in -radius .. radius + 1 {
+		for r in max_int(-radius, -q - radius) .. min_int(radius, -q + radius) + 1 {
+			out << center + Hex{q, r}
+		}
+	}
+	return out
+}
+
+// Get the hexes exactly radius steps from center.
+pub fn hex_ring(center Hex, radius int) []Hex {
+	if radius <= 0 {
+		return [center]
+	}
+	mut out := []Hex{cap: 6 * radius}
+	mut h := center + Hex{hex_dirs[4].q * radius, hex_dirs[4].r * radius}
+	for dir in 0 .. 6 {
+		for _ in 0 .. radius {
+			out << h
+			h = h.neighbor(dir)
+		}
+	}
+	return out
+}
+
+// Convert a hex to offset coordinates (col, row).
+pub fn (h Hex) to_offset(kind HexOffset) (int, int) {
+	return match kind {
+		.odd_r { h.q + (h.r - (h.r & 1)) / 2, h.r }
+		.even_r { h.q + (h.r + (h.r & 1)) / 2, h.r }
+		.odd_q { h.q, h.r + (h.q - (h.q & 1)) / 2 }
+		.even_q { h.q, h.r + (h.q + (h.q & 1)) / 2 }
+	}
+}
+
+// Convert offset coordinates (col, row) to a hex.
+pub fn hex_from_offset(col int, row int, kind HexOffset) Hex {
+	return match kind {
+		.odd_r { Hex{col - (row - (row & 1)) / 2, row} }
+		.even_r { Hex{col - (row + (row & 1)) / 2, row} }
+		.odd_q { Hex{col, row - (col - (col & 1)) / 2} }
+		.even_q { Hex{col, row - (col + (col & 1)) / 2} }
+	}
+}
+
+const sqrt3 = f32(1.7320508)
+
+// Maps regular hexes to pixels. size is the center-to-corner distance.
+pub struct HexLayout {
+pub mut:
+	pointy   bool = true
+	size_x   f32
+	size_y   f32
+	origin_x f32
+	origin_y f32
+}
+
+// Get the pixel center of a hex.
+pub fn (l &HexLayout) to_pixel(h Hex) (f32, f32) {
+	q := f32(h.q)
+	r := f32(h.r)
+	if l.pointy {
+		return l.origin_x + l.size_x * (sqrt3 * q + sqrt3 / 2 * r), l.origin_y + l.size_y * 1.5 * r
+	}
+	return l.origin_x + l.size_x * 1.5 * q, l.origin_y + l.size_y * (sqrt3 / 2 * q + sqrt3 * r)
+}
+
+// Get the hex containing a pixel.
+pub fn (l &HexLayout) from_pixel(x f32, y f32) Hex {
+	px := (x - l.origin_x) / l.size_x
+	py := (y - l.origin_y) / l.size_y
+	if l.pointy {
+		return hex_round(sqrt3 / 3 * px - py / 3, 2 * py / 3)
+	}
+	return hex_round(2 * px / 3, -px / 3 + sqrt3 / 3 * py)
+}
+
+// Get the offset layout of a hexagonal tilemap.
+pub fn (m &Tilemap) hex_offset() HexOffset {
+	return if m.stagger_x {
+		if m.stagger_odd { HexOffset.odd_q } else { HexOffset.even_q }
+	} else {
+		if m.stagger_odd { HexOffset.odd_r } else { HexOffset.even_r }
+	}
+}
+
+// Get the top-left of the bounding box of cell (tx, ty) on a hexagonal map,
+// in map pixels, using Tiled's layout.
+pub fn (m &Tilemap) hex_cell_pixel(tx int, ty int) (int, int) {
+	if m.stagger_x {
+		shoved := (tx & 1 == 1) == m.stagger_odd
+		y := ty * m.tile_height + if shoved { m.tile_height / 2 } else { 0 }
+		return tx * (m.tile_width + m.hex_side) / 2, y
+	}
+	shoved := (ty & 1 == 1) == m.stagger_odd
+	x := tx * m.tile_width + if shoved { m.tile_width / 2 } else { 0 }
+	return x, ty * (m.tile_height + m.hex_side) / 2
+}
+
+// Draw the visible part of a hexagonal tile layer, top to bottom.
+pub fn (m &Tilemap) draw_hex_layer(layer int, cam_x int, cam_y int, draw TileDrawFn) {
+	l := m.layers[layer]
+	if !l.visible || m.tile_width <= 0 || m.tile_height <= 0 {
+		return
+	}
+	step_x := if m.stagger_x { max_int(1, (m.tile_width + m.hex_side) / 2) } else { m.tile_width }
+	step_y := if m.stagger_x { m.tile_height } else { max_int(1, (m.tile_height + m.hex_side) / 2) }
+	x0 := max_int(0, floor_div(cam_x, step_x) - 1)
+	y0 := max_int(0, floor_div(cam_y, step_y) - 1)
+	x1 := min_int(l.width - 1, floor_div(cam_x + int(screen_width), step_x) + 1)
+	y1 := min_int(l.height - 1, floor_div(cam_y + int(screen_height), step_y) + 1)
+	for ty in y0 .. y1 + 1 {
+		for tx in x0 .. x1 + 1 {
+			tile := l.get(tx, ty)
+			if tile != 0 {
+				px, py := m.hex_cell_pixel(tx, ty)
+				draw(tile, px - cam_x, py - cam_y)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+module wasm96
+
+// Controller connect and disconnect notifications.
+//
+// Call input_poll_connections once per frame; it compares every port's
+// connection with the last frame and tells the registered listeners about
+// changes, so a game can pause on "controller disconnected". Hosts without
+// the hotplug feature can't tell, so every port reads as connected and no
+// change is ever reported.
+
+// A function told that port was connected or disconnected.
+pub type ConnectionFn = fn (port u32, connected bool)
+
+// Number of ports watched for connection changes.
+pub const hotplug_ports = 4
+
+struct HotplugState {
+mut:
+	polled    bool
+	connected [hotplug_ports]bool
+	listeners []ConnectionFn
+}
+
+__global hotplug HotplugState
+
+// Returns true if a controller is plugged into port.
+pub fn input_port_connected(port u32) bool {
+	if !compat_require(.hotplug) {
+		return true
+	}
+	return C.wasm96_input_port_connected(port) != 0
+}
+
+// Register f to be called when a port's connection changes.
+pub fn input_on_connection_change(f ConnectionFn) {
+	hotplug.listeners << f
+}
+
+// Check every port and report changes since the last call. The first call
+// only records the initial state.
+pub fn input_poll_connections() {
+	for p in 0 .. hotplug_ports {
+		now := input_port_connected(u32(p))
+		if hotplug.polled && now != hotplug.connected[p] {
+			for f in hotplug.listeners {
+				f(u32(p), now)
+			}
+		}
+		hotplug.connected[p] = now
+	}
+	hotplug.polled = true
+}
+
+// Get the number of ports with a controller, as of the last poll.
+pub fn input_connected_count() int {
+	mut n := 0
+	for c in hotplug.connected {
+		if c {
+			n++
+		}
+	}
+	return n
+}
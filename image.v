@@ -0,0 +1,226 @@
+module wasm96
+
+// RGBA images in guest memory.
+
+// An RGBA color.
+pub struct Color {
+pub mut:
+	r u8
+	g u8
+	b u8
+	a u8 = 255
+}
+
+// Make an opaque color.
+pub fn rgb(r u8, g u8, b u8) Color {
+	return Color{r, g, b, 255}
+}
+
+// Make a color with alpha.
+pub fn rgba(r u8, g u8, b u8, a u8) Color {
+	return Color{r, g, b, a}
+}
+
+// Make an opaque color from 0xRRGGBB.
+pub fn hex_color(rgb u32) Color {
+	return Color{u8(rgb >> 16), u8(rgb >> 8), u8(rgb), 255}
+}
+
+// Set the current drawing color.
+pub fn graphics_set_color_rgba(c Color) {
+	graphics_set_color(c.r, c.g, c.b, c.a)
+}
+
+// An image stored as RGBA bytes (4 per pixel, rows top to bottom), the
+// format taken by graphics_image.
+pub struct Image {
+pub mut:
+	width  int
+	height int
+	pixels []u8
+}
+
+// Create a transparent image.
+pub fn new_image(width int, height int) Image {
+	return Image{
+		width: width
+		height: height
+		pixels: []u8{len: width * height * 4}
+	}
+}
+
+// Returns true if (x, y) is inside the image.
+pub fn (img &Image) contains(x int, y int) bool {
+	return x >= 0 && y >= 0 && x < img.width && y < img.height
+}
+
+// Get the pixel at (x, y). Pixels outside the image are transparent.
+pub fn (img &Image) get(x int, y int) Color {
+	if !img.contains(x, y) {
+		return Color{
+			a: 0
+		}
+	}
+	i := (y * img.width + x) * 4
+	return Color{img.pixels[i], img.pixels[i + 1], img.pixels[i + 2], img.pixels[i + 3]}
+}
+
+// Set the pixel at (x, y). Does nothing outside the image.
+pub fn (mut img Image) set(x int, y int, c Color) {
+	if !img.contains(x, y) {
+		return
+	}
+	i := (y * img.width + x) * 4
+	img.pixels[i] = c.r
+	img.pixels[i + 1] = c.g
+	img.pixels[i + 2] = c.b
+	img.pixels[i + 3] = c.a
+}
+
+// Alpha-blend c over the pixel at (x, y).
+pub fn (mut img Image) blend(x int, y int, c Color) {
+	if !img.contains(x, y) || c.a == 0 {
+		return
+	}
+	if c.a == 255 {
+		img.set(x, y, c)
+		return
+	}
+	i := (y * img.width + x) * 4
+	a := u32(c.a)
+	for ch, v in [c.r, c.g, c.b]! {
+		t := u32(v) * a + u32(img.pixels[i + ch]) * (255 - a) + 128
+		img.pixels[i + ch] = u8((t + (t >> 8)) >> 8)
+	}
+	t := a * 255 + u32(img.pixels[i + 3]) * (255 - a) + 128
+	img.pixels[i + 3] = u8((t + (t >> 8)) >> 8)
+}
+
+// Fill the whole image with one color.
+pub fn (mut img Image) fill(c Color) {
+	pixels_fill(mut img.pixels, c.r, c.g, c.b, c.a)
+}
+
+// Fill a rectangle, clipped to the image.
+pub fn (mut img Image) fill_rect(x int, y int, w int, h int, c Color) {
+	x0 := max_int(x, 0)
+	y0 := max_int(y, 0)
+	x1 := min_int(x + w, img.width)
+	y1 := min_int(y + h, img.height)
+	if x0 >= x1 || y0 >= y1 {
+		return
+	}
+	for py in y0 .. y1 {
+		start := (py * img.width + x0) * 4
+		mut row := img.pixels[start..(py * img.width + x1) * 4]
+		pixels_fill(mut row, c.r, c.g, c.b, c.a)
+	}
+}
+
+// Copy a rectangle out of the image. Parts outside the image are transparent.
+pub fn (img &Image) sub_image(x int, y int, w int, h int) Image {
+	mut out := new_image(w, h)
+	out.copy_from(img, x, y, w, h, 0, 0)
+	return out
+}
+
+// Copy (without blending) a w x h rectangle at (sx, sy) in src to (dx, dy),
+// clipped to both images.
+pub fn (mut img Image) copy_from(src &Image, sx int, sy int, w int, h int, dx int, dy int) {
+	for row in 0 .. h {
+		y := sy + row
+		ty := dy + row
+		if y < 0 || y >= src.height || ty < 0 || ty >= img.height {
+			continue
+		}
+		x0 := max_int(max_int(0, -sx), -dx)
+		x1 := min_int(min_int(w, src.width - sx), img.width - dx)
+		if x0 >= x1 {
+			continue
+		}
+		s := (y * src.width + sx + x0) * 4
+		d := (ty * img.width + dx + x0) * 4
+		n := (x1 - x0) * 4
+		for i in 0 .. n {
+			img.pixels[d + i] = src.pixels[s + i]
+		}
+	}
+}
+
+// Alpha-blend all of src onto the image at (dx, dy).
+pub fn (mut img Image) blit(src &Image, dx int, dy int) {
+	img.blit_region(src, 0, 0, src.width, src.height, dx, dy)
+}
+
+// Alpha-blend a w x h rectangle at (sx, sy) in src onto the image at (dx, dy).
+pub fn (mut img Image) blit_region(src &Image, sx int, sy int, w int, h int, dx int, dy int) {
+	for row in 0 .. h {
+		y := sy + row
+		ty := dy + row
+		if y < 0 || y >= src.height || ty < 0 || ty >= img.height {
+			continue
+		}
+		x0 := max_int(max_int(0, -sx), -dx)
+		x1 := min_int(min_int(w, src.width - sx), img.width - dx)
+		if x0 >= x1 {
+			continue
+		}
+		s := (y * src.width + sx + x0) * 4
+		d := (ty * img.width + dx + x0) * 4
+		n := (x1 - x0) * 4
+		mut dst_row := img.pixels[d..d + n]
+		pixels_blend(mut dst_row, src.pixels[s..s + n])
+	}
+}
+
+// Draw the image on screen at (x, y).
+pub fn (img &Image) draw(x int, y int) {
+	if img.pixels.len == 0 {
+		return
+	}
+	graphics_image(x, y, u32(img.width), u32(img.height), img.pixels)
+}
+
+__global region_scratch []u8
+
+// Draw a w x h region at (sx, sy) of the image on screen at (x, y). Runs
+// per sprite, so it doesn't allocate: full-width regions go straight from
+// the image and others are copied through a reused buffer.
+pub fn (img &Image) draw_region(x int, y int, sx int, sy int, w int, h int) {
+	// Clip to the image; parts outside it would be transparent anyway.
+	x0 := max_int(0, -sx)
+	y0 := max_int(0, -sy)
+	x1 := min_int(w, img.width - sx)
+	y1 := min_int(h, img.height - sy)
+	cw := x1 - x0
+	ch := y1 - y0
+	if cw <= 0 || ch <= 0 {
+		return
+	}
+	top := sy + y0
+	if cw == img.width {
+		graphics_image(x + x0, y + y0, u32(cw), u32(ch),
+			img.pixels[top * cw * 4..(top + ch) * cw * 4])
+		return
+	}
+	n := cw * ch * 4
+	if region_scratch.len < n {
+		region_scratch = []u8{len: n}
+	}
+	row := cw * 4
+	for r in 0 .. ch {
+		s := ((top + r) * img.width + sx + x0) * 4
+		for i in 0 .. row {
+			region_scratch[r * row + i] = img.pixels[s + i]
+		}
+	}
+	graphics_image(x + x0, y + y0, u32(cw), u32(ch), region_scratch[..n])
+}
+
+fn min_int(a int, b int) int {
+	return if a < b { a } else { b }
+}
+
+fn max_int(a int, b int) int {
+	return if a > b { a } else { b }
+}
@@ -0,0 +1,263 @@
+module wasm96
+
+// DEFLATE decompression (RFC 1951), with zlib and gzip wrappers.
+
+const inflate_length_base = [u16(3), 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43,
+	51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258]
+const inflate_length_extra = [u8(0), 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4,
+	4, 4, 4, 5, 5, 5, 5, 0]
+const inflate_dist_base = [u16(1), 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257,
+	385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577]
+const inflate_dist_extra = [u8(0), 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9,
+	10, 10, 11, 11, 12, 12, 13, 13]
+const inflate_code_order = [16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15]
+
+struct Huffman {
+mut:
+	counts  []u16
+	symbols []u16
+}
+
+fn huffman_build(lengths []u8) Huffman {
+	mut h := Huffman{
+		counts: []u16{len: 16}
+		symbols: []u16{len: lengths.len}
+	}
+	for l in lengths {
+		h.counts[l]++
+	}
+	mut offsets := []u16{len: 16}
+	for i in 1 .. 15 {
+		offsets[i + 1] = offsets[i] + h.counts[i]
+	}
+	for sym, l in lengths {
+		if l != 0 {
+			h.symbols[offsets[l]] = u16(sym)
+			offsets[l]++
+		}
+	}
+	return h
+}
+
+struct Inflater {
+	src []u8
+mut:
+	pos    int
+	bitbuf u32
+	bitcnt int
+	out    []u8
+}
+
+fn (mut s Inflater) bits(need int) !int {
+	mut val := s.bitbuf
+	for s.bitcnt < need {
+		if s.pos >= s.src.len {
+			return error('inflate: unexpected end of data')
+		}
+		val |= u32(s.src[s.pos]) << s.bitcnt
+		s.pos++
+		s.bitcnt += 8
+	}
+	s.bitbuf = val >> need
+	s.bitcnt -= need
+	return int(val & ((u32(1) << need) - 1))
+}
+
+fn (mut s Inflater) decode(h &Huffman) !int {
+	mut code := 0
+	mut first := 0
+	mut index := 0
+	for l in 1 .. 16 {
+		code |= s.bits(1)!
+		count := int(h.counts[l])
+		if code - count < first {
+			return int(h.symbols[index + code - first])
+		}
+		index += count
+		first += count
+		first <<= 1
+		code <<= 1
+	}
+	return error('inflate: invalid code')
+}
+
+fn (mut s Inflater) stored() ! {
+	s.bitbuf = 0
+	s.bitcnt = 0
+	if s.pos + 4 > s.src.len {
+		return error('inflate: unexpected end of data')
+	}
+	len := int(s.src[s.pos]) | int(s.src[s.pos + 1]) << 8
+	nlen := int(s.src[s.pos + 2]) | int(s.src[s.pos + 3]) << 8
+	if len != (~nlen & 0xffff) {
+		return error('inflate: corrupt stored block')
+	}
+	s.pos += 4
+	if s.pos + len > s.src.len {
+		return error('inflate: unexpected end of data')
+	}
+	s.out << s.src[s.pos..s.pos + len]
+	s.pos += len
+}
+
+fn (mut s Inflater) codes(lencode &Huffman, distcode &Huffman) ! {
+	for {
+		mut sym := s.decode(lencode)!
+		if sym < 256 {
+			s.out << u8(sym)
+			continue
+		}
+		if sym == 256 {
+			return
+		}
+		sym -= 257
+		if sym >= 29 {
+			return error('inflate: invalid length symbol')
+		}
+		len := int(inflate_length_base[sym]) + s.bits(int(inflate_length_extra[sym]))!
+		dsym := s.decode(distcode)!
+		if dsym >= 30 {
+			return error('inflate: invalid distance symbol')
+		}
+		dist := int(inflate_dist_base[dsym]) + s.bits(int(inflate_dist_extra[dsym]))!
+		if dist > s.out.len {
+			return error('inflate: distance too far back')
+		}
+		start := s.out.len - dist
+		for i in 0 .. len {
+			s.out << s.out[start + i]
+		}
+	}
+}
+
+fn (mut s Inflater) fixed() ! {
+	mut lengths := []u8{len: 288}
+	for i in 0 .. 288 {
+		lengths[i] = if i < 144 {
+			8
+		} else if i < 256 {
+			9
+		} else if i < 280 {
+			7
+		} else {
+			8
+		}
+	}
+	lencode := huffman_build(lengths)
+	distcode := huffman_build([]u8{len: 30, init: 5})
+	s.codes(&lencode, &distcode)!
+}
+
+fn (mut s Inflater) dynamic() ! {
+	nlen := s.bits(5)! + 257
+	ndist := s.bits(5)! + 1
+	ncode := s.bits(4)! + 4
+	if nlen > 286 || ndist > 30 {
+		return error('inflate: bad code counts')
+	}
+	mut lengths := []u8{len: 19}
+	for i in 0 .. ncode {
+		lengths[inflate_code_order[i]] = u8(s.bits(3)!)
+	}
+	lencode := huffman_build(lengths)
+	mut all := []u8{len: nlen + ndist}
+	mut index := 0
+	for index < nlen + ndist {
+		sym := s.decode(&lencode)!
+		if sym < 16 {
+			all[index] = u8(sym)
+			index++
+			continue
+		}
+		mut value := u8(0)
+		mut repeat := 0
+		if sym == 16 {
+			if index == 0 {
+				return error('inflate: repeat with no previous length')
+			}
+			value = all[index - 1]
+			repeat = 3 + s.bits(2)!
+		} else if sym == 17 {
+			repeat = 3 + s.bits(3)!
+		} else {
+			repeat = 11 + s.bits(7)!
+		}
+		if index + repeat > nlen + ndist {
+			return error('inflate: too many lengths')
+		}
+		for _ in 0 .. repeat {
+			all[index] = value
+			index++
+		}
+	}
+	if all[256] == 0 {
+		return error('inflate: missing end-of-block code')
+	}
+	litcode := huffman_build(all[..nlen])
+	distcode := huffman_build(all[nlen..])
+	s.codes(&litcode, &distcode)!
+}
+
+// Decompress a raw DEFLATE stream.
+pub fn inflate(data []u8) ![]u8 {
+	mut s := Inflater{
+		src: data
+		out: []u8{cap: data.len * 4}
+	}
+	for {
+		last := s.bits(1)!
+		kind := s.bits(2)!
+		match kind {
+			0 { s.stored()! }
+			1 { s.fixed()! }
+			2 { s.dynamic()! }
+			else { return error('inflate: invalid block type') }
+		}
+		if last == 1 {
+			break
+		}
+	}
+	return s.out
+}
+
+// Decompress a zlib stream (RFC 1950).
+pub fn zlib_decompress(data []u8) ![]u8 {
+	if data.len < 2 || data[0] & 0x0f != 8 || (u16(data[0]) << 8 | u16(data[1])) % 31 != 0 {
+		return error('zlib: bad header')
+	}
+	if data[1] & 0x20 != 0 {
+		return error('zlib: preset dictionaries are not supported')
+	}
+	return inflate(data[2..])
+}
+
+// Decompress a gzip stream (RFC 1952). Only the first member is read.
+pub fn gzip_decompress(data []u8) ![]u8 {
+	if data.len < 18 || data[0] != 0x1f || data[1] != 0x8b || data[2] != 8 {
+		return error('gzip: bad header')
+	}
+	flags := data[3]
+	mut pos := 10
+	if flags & 0x04 != 0 {
+		pos += 2 + (int(data[pos]) | int(data[pos + 1]) << 8)
+	}
+	if flags & 0x08 != 0 {
+		for pos < data.len && data[pos] != 0 {
+			pos++
+		}
+		pos++
+	}
+	if flags & 0x10 != 0 {
+		for pos < data.len && data[pos] != 0 {
+			pos++
+		}
+		pos++
+	}
+	if flags & 0x02 != 0 {
+		pos += 2
+	}
+	if pos >= data.len {
+		return error('gzip: truncated header')
+	}
+	return inflate(data[pos..])
+}
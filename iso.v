@@ -0,0 +1,116 @@
+module wasm96
+
+// Isometric (diamond) tilemap projection.
+//
+// Map pixel space follows Tiled: tile (0, 0) has its top corner at
+// x = height * tile_width / 2, y = 0, the map's x axis runs down-right and
+// its y axis down-left.
+
+// An object to draw between isometric tiles, positioned in tile coordinates.
+pub struct IsoObject {
+pub mut:
+	id int
+	x  f32
+	y  f32
+}
+
+// A function that draws an object at a screen position.
+pub type IsoObjectDrawFn = fn (id int, x int, y int)
+
+// Convert tile coordinates to map pixels. For isometric maps this is the
+// top corner of the tile's diamond; for hexagonal maps the top-left of the
+// cell's bounding box.
+pub fn (m &Tilemap) tile_to_pixel(tx f32, ty f32) (f32, f32) {
+	if m.orientation == .orthogonal {
+		return tx * f32(m.tile_width), ty * f32(m.tile_height)
+	}
+	if m.orientation == .hexagonal {
+		px, py := m.hex_cell_pixel(int(floorf(tx)), int(floorf(ty)))
+		return f32(px), f32(py)
+	}
+	hw := f32(m.tile_width) / 2
+	hh := f32(m.tile_height) / 2
+	return (tx - ty) * hw + f32(m.height) * hw, (tx + ty) * hh
+}
+
+// Convert map pixels to (fractional) tile coordinates. Hexagonal maps use
+// their bounding-box grid; use HexLayout for exact hex picking.
+pub fn (m &Tilemap) pixel_to_tile(px f32, py f32) (f32, f32) {
+	if m.orientation != .isometric {
+		return px / f32(m.tile_width), py / f32(m.tile_height)
+	}
+	hw := f32(max_int(1, m.tile_width)) / 2
+	hh := f32(max_int(1, m.tile_height)) / 2
+	sx := (px - f32(m.height) * hw) / hw
+	sy := py / hh
+	return (sy + sx) / 2, (sy - sx) / 2
+}
+
+// Convert a screen position with the camera at (cam_x, cam_y) to the tile
+// under it.
+pub fn (m &Tilemap) screen_to_tile(x int, y int, cam_x int, cam_y int) (int, int) {
+	tx, ty := m.pixel_to_tile(f32(x + cam_x), f32(y + cam_y))
+	return int(floorf(tx)), int(floorf(ty))
+}
+
+// Get the tile position of a Tiled object on an isometric map. Tiled stores
+// both axes of isometric objects in units of tile_height.
+pub fn (m &Tilemap) iso_object_tile(obj &MapObject) (f32, f32) {
+	return obj.x / f32(m.tile_height), obj.y / f32(m.tile_height)
+}
+
+// Draw an isometric tile layer back to front, interleaving objects so each
+// one is drawn after the tiles it stands on and before those in front of it.
+// draw gets the top-left of each tile's bounding box; draw_obj gets the
+// screen position of each object's tile-space position.
+pub fn (m &Tilemap) draw_iso_layer(layer int, cam_x int, cam_y int, draw TileDrawFn, objects []IsoObject, draw_obj IsoObjectDrawFn) {
+	l := m.layers[layer]
+	if m.tile_width <= 0 || m.tile_height <= 0 {
+		return
+	}
+	// Halves are at least a pixel, so 1-pixel tiles don't divide by zero.
+	hw := max_int(1, m.tile_width / 2)
+	hh := max_int(1, m.tile_height / 2)
+	origin := m.height * hw
+	// Sort objects by depth (x + y) so they can be merged with tile rows.
+	mut order := []int{len: objects.len, init: index}
+	for i in 1 .. order.len {
+		mut j := i
+		for j > 0 && iso_depth(objects[order[j - 1]]) > iso_depth(objects[order[j]]) {
+			order[j - 1], order[j] = order[j], order[j - 1]
+			j--
+		}
+	}
+	mut next_obj := 0
+	// Draw extra rows below the screen so tall tiles reaching up are kept.
+	d_min := max_int(0, cam_y / hh - 1)
+	d_max := min_int(m.width + m.height - 2, (cam_y + int(screen_height)) / hh + 4)
+	for next_obj < order.len && iso_depth(objects[order[next_obj]]) < f32(d_min) {
+		next_obj++
+	}
+	for d in d_min .. d_max + 1 {
+		if l.visible {
+			// Columns with a screen x inside the view, from x = (2tx - d) * hw + origin.
+			lo := floor_div((cam_x - m.tile_width - origin) / hw + d, 2)
+			hi := floor_div((cam_x + int(screen_width) - origin) / hw + d, 2) + 1
+			for tx in max_int(lo, max_int(0, d - (m.height - 1))) .. min_int(hi, min_int(d,
+				m.width - 1)) + 1 {
+				ty := d - tx
+				tile := l.get(tx, ty)
+				if tile != 0 {
+					draw(tile, (tx - ty) * hw + origin - hw - cam_x, d * hh - cam_y)
+				}
+			}
+		}
+		for next_obj < order.len && iso_depth(objects[order[next_obj]]) < f32(d + 1) {
+			o := objects[order[next_obj]]
+			px, py := m.tile_to_pixel(o.x, o.y)
+			draw_obj(o.id, int(px) - cam_x, int(py) - cam_y)
+			next_obj++
+		}
+	}
+}
+
+fn iso_depth(o IsoObject) f32 {
+	return o.x + o.y
+}
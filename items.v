@@ -0,0 +1,469 @@
+module wasm96
+
+// Item definitions, inventories and an inventory grid.
+//
+// Items are defined once in a global registry and referred to by id (ids
+// start at 1; 0 is no item). An Inventory is a fixed number of slots, each
+// holding a stack of one item up to the item's max_stack. Inventories are
+// Stateful, writing items by name so saves survive items being added or
+// reordered, and can go straight to storage with save and load.
+//
+//   potion := wasm96.item_define(wasm96.ItemDef{ name: 'potion', max_stack: 9 })
+//   mut bag := wasm96.new_inventory(16)
+//   bag.add(potion, 3)
+//   wasm96.savestate_register('bag', &bag)
+
+// What an item is.
+pub struct ItemDef {
+pub mut:
+	// Unique name, used in saves.
+	name string
+	// Shown to the player; name if empty.
+	label     string
+	max_stack int = 1
+	// Index into the game's icon atlas.
+	icon int
+	// Fallback icon color for the grid when there's no icon drawer.
+	color      Color = Color{180, 180, 200, 255}
+	properties map[string]string
+}
+
+// Some number of one item.
+pub struct ItemStack {
+pub mut:
+	item  int
+	count int
+}
+
+// Returns true if the stack holds nothing.
+pub fn (s ItemStack) empty() bool {
+	return s.item == 0 || s.count <= 0
+}
+
+__global (
+	item_defs  []ItemDef
+	item_names map[string]int
+)
+
+// Define an item, or replace the one with the same name. Returns its id.
+pub fn item_define(def ItemDef) int {
+	if id := item_names[def.name] {
+		item_defs[id - 1] = def
+		return id
+	}
+	item_defs << def
+	item_names[def.name] = item_defs.len
+	return item_defs.len
+}
+
+// Get an item's definition.
+pub fn item_def(id int) ?ItemDef {
+	if id < 1 || id > item_defs.len {
+		return none
+	}
+	return item_defs[id - 1]
+}
+
+// Get an item's id by name.
+pub fn item_find(name string) ?int {
+	id := item_names[name] or { return none }
+	return id
+}
+
+// Get how many of an item fit in one slot.
+pub fn item_max_stack(id int) int {
+	def := item_def(id) or { return 0 }
+	return max_int(1, def.max_stack)
+}
+
+// Get an item property, or none if the item or property isn't defined.
+pub fn item_property(id int, name string) ?string {
+	def := item_def(id) or { return none }
+	return def.properties[name] or { return none }
+}
+
+// A fixed number of item slots.
+pub struct Inventory {
+mut:
+	slots []ItemStack
+}
+
+// Create an inventory with slots empty slots.
+pub fn new_inventory(slots int) Inventory {
+	return Inventory{
+		slots: []ItemStack{len: slots}
+	}
+}
+
+// Get the number of slots.
+pub fn (inv &Inventory) len() int {
+	return inv.slots.len
+}
+
+// Get the stack in a slot.
+pub fn (inv &Inventory) get(slot int) ItemStack {
+	if slot < 0 || slot >= inv.slots.len {
+		return ItemStack{}
+	}
+	return inv.slots[slot]
+}
+
+// Replace the stack in a slot.
+pub fn (mut inv Inventory) set(slot int, stack ItemStack) {
+	if slot < 0 || slot >= inv.slots.len {
+		return
+	}
+	inv.slots[slot] = if stack.empty() { ItemStack{} } else { stack }
+}
+
+// Empty every slot.
+pub fn (mut inv Inventory) clear() {
+	for i in 0 .. inv.slots.len {
+		inv.slots[i] = ItemStack{}
+	}
+}
+
+// Get how many of an item the inventory holds.
+pub fn (inv &Inventory) count(item int) int {
+	mut n := 0
+	for s in inv.slots {
+		if s.item == item {
+			n += s.count
+		}
+	}
+	return n
+}
+
+// Returns true if the inventory holds at least count of an item.
+pub fn (inv &Inventory) has(item int, count int) bool {
+	return inv.count(item) >= count
+}
+
+// Add count of an item, topping up existing stacks first. Returns how many
+// didn't fit.
+pub fn (mut inv Inventory) add(item int, count int) int {
+	limit := item_max_stack(item)
+	if limit == 0 {
+		return count
+	}
+	mut left := count
+	for i in 0 .. inv.slots.len {
+		if left == 0 {
+			break
+		}
+		if inv.slots[i].item == item && inv.slots[i].count < limit {
+			n := min_int(left, limit - inv.slots[i].count)
+			inv.slots[i].count += n
+			left -= n
+		}
+	}
+	for i in 0 .. inv.slots.len {
+		if left == 0 {
+			break
+		}
+		if inv.slots[i].empty() {
+			n := min_int(left, limit)
+			inv.slots[i] = ItemStack{item, n}
+			left -= n
+		}
+	}
+	return left
+}
+
+// Remove up to count of an item, from the last stacks first. Returns how
+// many were removed.
+pub fn (mut inv Inventory) remove(item int, count int) int {
+	mut left := count
+	for i := inv.slots.len - 1; i >= 0 && left > 0; i-- {
+		if inv.slots[i].item != item {
+			continue
+		}
+		n := min_int(left, inv.slots[i].count)
+		inv.slots[i].count -= n
+		left -= n
+		if inv.slots[i].count == 0 {
+			inv.slots[i] = ItemStack{}
+		}
+	}
+	return count - left
+}
+
+// Move the stack in from onto to: merge if they hold the same item,
+// otherwise swap them.
+pub fn (mut inv Inventory) move(from int, to int) {
+	if from == to || from < 0 || to < 0 || from >= inv.slots.len || to >= inv.slots.len {
+		return
+	}
+	a := inv.slots[from]
+	b := inv.slots[to]
+	if !a.empty() && a.item == b.item {
+		n := min_int(a.count, item_max_stack(a.item) - b.count)
+		inv.slots[to].count += n
+		inv.set(from, ItemStack{a.item, a.count - n})
+		return
+	}
+	inv.slots[from] = b
+	inv.slots[to] = a
+}
+
+// Merge partial stacks and move everything to the front, ordered by item id.
+pub fn (mut inv Inventory) sort() {
+	mut ids := []int{}
+	for s in inv.slots {
+		if !s.empty() && s.item !in ids {
+			ids << s.item
+		}
+	}
+	ids.sort()
+	mut totals := []int{len: ids.len}
+	for i, id in ids {
+		totals[i] = inv.count(id)
+	}
+	inv.clear()
+	for i, id in ids {
+		inv.add(id, totals[i])
+	}
+}
+
+// Write the inventory, with items by name.
+pub fn (mut inv Inventory) save_state(mut w StateWriter) {
+	w.write_u32(u32(inv.slots.len))
+	for s in inv.slots {
+		def := item_def(s.item) or {
+			w.write_string('')
+			continue
+		}
+		w.write_string(def.name)
+		w.write_u32(u32(s.count))
+	}
+}
+
+// Read an inventory written by save_state. The inventory keeps its size:
+// saved slots past the end, and items no longer defined, are dropped.
+pub fn (mut inv Inventory) load_state(mut r StateReader) ! {
+	n := int(r.read_u32()!)
+	mut slots := []ItemStack{len: inv.slots.len}
+	for i in 0 .. n {
+		name := r.read_string()!
+		if name.len == 0 {
+			continue
+		}
+		count := int(r.read_u32()!)
+		if i >= slots.len {
+			continue
+		}
+		if id := item_find(name) {
+			slots[i] = ItemStack{id, clamp_int(count, 0, item_max_stack(id))}
+		}
+	}
+	inv.slots = slots
+}
+
+// Save the inventory to storage under key.
+pub fn (mut inv Inventory) save(key string) bool {
+	mut w := StateWriter{}
+	inv.save_state(mut w)
+	return storage_save(key.bytes(), w.data)
+}
+
+// Load the inventory from storage under key.
+pub fn (mut inv Inventory) load(key string) ! {
+	data := storage_load(key.bytes()) or { return error('items: nothing saved as ${key}') }
+	mut r := new_state_reader(data)
+	inv.load_state(mut r)!
+}
+
+// Draws an item icon with its top-left at (x, y), size pixels square.
+pub type ItemIconFn = fn (item int, x int, y int, size int)
+
+// A grid view of an inventory, driven by a joypad or mouse: move the cursor
+// with the d-pad, press A to pick up a stack and A again to drop, merge or
+// swap it, and B to pick up half a stack.
+pub struct InventoryGrid {
+pub mut:
+	x    int
+	y    int
+	cols int = 4
+	// Slot size and gap in pixels.
+	slot int = 20
+	gap  int = 2
+	port u32
+	// Draws item icons; a colored square when nil.
+	draw_icon  ItemIconFn = unsafe { nil }
+	font_key   []u8
+	slot_color Color = Color{40, 40, 60, 255}
+	sel_color  Color = Color{230, 200, 80, 255}
+	text_color Color = Color{255, 255, 255, 255}
+mut:
+	cursor    int
+	carry     ItemStack
+	held_from int = -1
+	prev      u32
+	mouse_was bool
+}
+
+// Create a grid at (x, y) with cols columns.
+pub fn new_inventory_grid(x int, y int, cols int) InventoryGrid {
+	return InventoryGrid{
+		x: x
+		y: y
+		cols: cols
+	}
+}
+
+// Get the selected slot.
+pub fn (g &InventoryGrid) selected() int {
+	return g.cursor
+}
+
+// Get the stack being carried, if any.
+pub fn (g &InventoryGrid) held() ItemStack {
+	return g.carry
+}
+
+// Get the screen rectangle of a slot.
+pub fn (g &InventoryGrid) slot_rect(slot int) Rect {
+	c := max_int(1, g.cols)
+	return Rect{g.x + (slot % c) * (g.slot + g.gap), g.y + (slot / c) * (g.slot + g.gap), g.slot, g.slot}
+}
+
+// Get the grid's size in pixels for inv.
+pub fn (g &InventoryGrid) size(inv &Inventory) (int, int) {
+	c := max_int(1, g.cols)
+	rows := (inv.len() + c - 1) / c
+	return c * (g.slot + g.gap) - g.gap, rows * (g.slot + g.gap) - g.gap
+}
+
+// Handle input for a frame. Returns true on frames the inventory changed.
+pub fn (mut g InventoryGrid) update(mut inv Inventory) bool {
+	if inv.len() == 0 {
+		return false
+	}
+	mut now := u32(0)
+	for btn in [Button.up, .down, .left, .right, .a, .b] {
+		if input_is_button_down(g.port, btn) {
+			now |= vk_bit(btn)
+		}
+	}
+	pressed := now & ~g.prev
+	g.prev = now
+	c := max_int(1, g.cols)
+	if pressed & vk_bit(.left) != 0 && g.cursor % c > 0 {
+		g.cursor--
+	}
+	if pressed & vk_bit(.right) != 0 && g.cursor % c < c - 1 && g.cursor + 1 < inv.len() {
+		g.cursor++
+	}
+	if pressed & vk_bit(.up) != 0 && g.cursor >= c {
+		g.cursor -= c
+	}
+	if pressed & vk_bit(.down) != 0 && g.cursor + c < inv.len() {
+		g.cursor += c
+	}
+	mut changed := false
+	if pressed & vk_bit(.a) != 0 {
+		changed = g.activate(mut inv, false)
+	}
+	if pressed & vk_bit(.b) != 0 {
+		changed = g.activate(mut inv, true) || changed
+	}
+	mouse := input_is_mouse_down(0)
+	if mouse && !g.mouse_was {
+		mx := input_get_mouse_x()
+		my := input_get_mouse_y()
+		for i in 0 .. inv.len() {
+			if g.slot_rect(i).has_point(mx, my) {
+				g.cursor = i
+				changed = g.activate(mut inv, false) || changed
+			}
+		}
+	}
+	g.mouse_was = mouse
+	return changed
+}
+
+// Pick up from or drop onto the selected slot.
+fn (mut g InventoryGrid) activate(mut inv Inventory, half bool) bool {
+	here := inv.get(g.cursor)
+	if g.carry.empty() {
+		if here.empty() {
+			return false
+		}
+		n := if half { (here.count + 1) / 2 } else { here.count }
+		g.carry = ItemStack{here.item, n}
+		g.held_from = g.cursor
+		inv.set(g.cursor, ItemStack{here.item, here.count - n})
+		return true
+	}
+	if here.empty() {
+		inv.set(g.cursor, g.carry)
+		g.carry = ItemStack{}
+	} else if here.item == g.carry.item {
+		n := min_int(g.carry.count, item_max_stack(here.item) - here.count)
+		inv.set(g.cursor, ItemStack{here.item, here.count + n})
+		g.carry = ItemStack{here.item, g.carry.count - n}
+		if g.carry.count == 0 {
+			g.carry = ItemStack{}
+		}
+	} else {
+		inv.set(g.cursor, g.carry)
+		g.carry = here
+		g.held_from = g.cursor
+	}
+	return true
+}
+
+// Put a carried stack back, e.g. when the menu closes. Anything that no
+// longer fits where it came from goes to the first free space. Returns how
+// many didn't fit anywhere; those stay carried, so the game can drop them
+// in the world or keep the menu open.
+pub fn (mut g InventoryGrid) cancel(mut inv Inventory) int {
+	if g.carry.empty() {
+		return 0
+	}
+	if g.held_from >= 0 && g.held_from < inv.len() && inv.get(g.held_from).empty() {
+		inv.set(g.held_from, g.carry)
+		g.carry = ItemStack{}
+		return 0
+	}
+	left := inv.add(g.carry.item, g.carry.count)
+	g.carry = if left > 0 { ItemStack{g.carry.item, left} } else { ItemStack{} }
+	return left
+}
+
+fn (g &InventoryGrid) draw_stack(s ItemStack, r Rect) {
+	if s.empty() {
+		return
+	}
+	if g.draw_icon != unsafe { nil } {
+		g.draw_icon(s.item, r.x + 2, r.y + 2, r.w - 4)
+	} else {
+		def := item_def(s.item) or { return }
+		graphics_set_color_rgba(def.color)
+		graphics_rect(r.x + 3, r.y + 3, u32(max_int(0, r.w - 6)), u32(max_int(0, r.h - 6)))
+	}
+	if s.count > 1 && (g.font_key.len > 0 || debug_font_ready()) {
+		font := if g.font_key.len > 0 { g.font_key } else { debug_font_key }
+		label := s.count.str()
+		size := graphics_text_measure_key(font, label.bytes())
+		graphics_set_color_rgba(g.text_color)
+		graphics_text_key(r.x + r.w - int(size.width) - 1, r.y + r.h - int(size.height), font,
+			label.bytes())
+	}
+}
+
+// Draw the grid, with any carried stack over the cursor.
+pub fn (g &InventoryGrid) draw(inv &Inventory) {
+	for i in 0 .. inv.len() {
+		r := g.slot_rect(i)
+		graphics_set_color_rgba(g.slot_color)
+		graphics_rect(r.x, r.y, u32(r.w), u32(r.h))
+		g.draw_stack(inv.get(i), r)
+	}
+	cur := g.slot_rect(g.cursor)
+	graphics_set_color_rgba(g.sel_color)
+	graphics_rect_outline(cur.x - 1, cur.y - 1, u32(cur.w + 2), u32(cur.h + 2))
+	if !g.carry.empty() {
+		g.draw_stack(g.carry, Rect{cur.x + cur.w / 3, cur.y - cur.h / 3, cur.w, cur.h})
+	}
+}
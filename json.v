@@ -0,0 +1,364 @@
+module wasm96
+
+// Minimal JSON reader for asset formats.
+
+enum JsonKind {
+	null
+	boolean
+	number
+	text
+	array
+	object
+}
+
+struct JsonValue {
+	kind JsonKind
+mut:
+	num     f64
+	boolean bool
+	text    string
+	items   []JsonValue
+	fields  map[string]JsonValue
+	keys    []string
+}
+
+fn (v &JsonValue) get(key string) ?JsonValue {
+	if v.kind != .object {
+		return none
+	}
+	return v.fields[key] or { return none }
+}
+
+fn (v &JsonValue) has(key string) bool {
+	f := v.get(key) or { return false }
+	return f.kind != .null
+}
+
+fn (v &JsonValue) get_int(key string, default int) int {
+	f := v.get(key) or { return default }
+	return if f.kind == .number { int(f.num) } else { default }
+}
+
+fn (v &JsonValue) get_f32(key string, default f32) f32 {
+	f := v.get(key) or { return default }
+	return if f.kind == .number { f32(f.num) } else { default }
+}
+
+fn (v &JsonValue) get_bool(key string, default bool) bool {
+	f := v.get(key) or { return default }
+	return if f.kind == .boolean { f.boolean } else { default }
+}
+
+fn (v &JsonValue) get_str(key string) string {
+	f := v.get(key) or { return '' }
+	return if f.kind == .text { f.text } else { '' }
+}
+
+fn (v &JsonValue) get_arr(key string) []JsonValue {
+	f := v.get(key) or { return [] }
+	return f.items
+}
+
+// Render a value as text: strings as-is, whole numbers without a fraction,
+// null as '' and arrays and objects as compact JSON.
+fn (v &JsonValue) to_text() string {
+	return match v.kind {
+		.text { v.text }
+		.null { '' }
+		else { v.encode() }
+	}
+}
+
+fn (v &JsonValue) encode() string {
+	return match v.kind {
+		.null {
+			'null'
+		}
+		.boolean {
+			if v.boolean { 'true' } else { 'false' }
+		}
+		.number {
+			if v.num == f64(i64(v.num)) { i64(v.num).str() } else { v.num.str() }
+		}
+		.text {
+			'"' + v.text.replace_each(['\\', '\\\\', '"', '\\"', '\n', '\\n']) + '"'
+		}
+		.array {
+			'[' + v.items.map(it.encode()).join(',') + ']'
+		}
+		.object {
+			mut parts := []string{cap: v.keys.len}
+			for k in v.keys {
+				f := v.fields[k] or { continue }
+				parts << JsonValue{
+					kind: .text
+					text: k
+				}.encode() + ':' + f.encode()
+			}
+			'{' + parts.join(',') + '}'
+		}
+	}
+}
+
+struct JsonParser {
+	src string
+mut:
+	pos   int
+	depth int
+}
+
+const json_max_depth = 128
+
+fn json_parse(src string) !JsonValue {
+	mut p := JsonParser{
+		src: src
+	}
+	v := p.value()!
+	p.skip_space()
+	if p.pos != p.src.len {
+		return error('json: trailing data at ${p.pos}')
+	}
+	return v
+}
+
+fn (mut p JsonParser) skip_space() {
+	for p.pos < p.src.len && p.src[p.pos] in [` `, `\t`, `\n`, `\r`] {
+		p.pos++
+	}
+}
+
+fn (mut p JsonParser) literal(word string) ! {
+	if p.pos + word.len > p.src.len || p.src[p.pos..p.pos + word.len] != word {
+		return error('json: unexpected token at ${p.pos}')
+	}
+	p.pos += word.len
+}
+
+fn (mut p JsonParser) value() !JsonValue {
+	p.skip_space()
+	if p.pos >= p.src.len {
+		return error('json: unexpected end of data')
+	}
+	match p.src[p.pos] {
+		`{` {
+			return p.object()
+		}
+		`[` {
+			return p.array()
+		}
+		`"` {
+			return JsonValue{
+				kind: .text
+				text: p.read_string()!
+			}
+		}
+		`t` {
+			p.literal('true')!
+			return JsonValue{
+				kind: .boolean
+				boolean: true
+			}
+		}
+		`f` {
+			p.literal('false')!
+			return JsonValue{
+				kind: .boolean
+			}
+		}
+		`n` {
+			p.literal('null')!
+			return JsonValue{
+				kind: .null
+			}
+		}
+		else {
+			return p.number()
+		}
+	}
+}
+
+fn (mut p JsonParser) enter() ! {
+	p.depth++
+	if p.depth > json_max_depth {
+		return error('json: nesting too deep')
+	}
+	p.pos++
+}
+
+fn (mut p JsonParser) object() !JsonValue {
+	p.enter()!
+	mut v := JsonValue{
+		kind: .object
+	}
+	p.skip_space()
+	if p.pos < p.src.len && p.src[p.pos] == `}` {
+		p.pos++
+		p.depth--
+		return v
+	}
+	for {
+		p.skip_space()
+		if p.pos >= p.src.len || p.src[p.pos] != `"` {
+			return error('json: expected key at ${p.pos}')
+		}
+		key := p.read_string()!
+		p.skip_space()
+		if p.pos >= p.src.len || p.src[p.pos] != `:` {
+			return error('json: expected : at ${p.pos}')
+		}
+		p.pos++
+		if key !in v.fields {
+			v.keys << key
+		}
+		v.fields[key] = p.value()!
+		p.skip_space()
+		if p.pos >= p.src.len {
+			return error('json: unterminated object')
+		}
+		c := p.src[p.pos]
+		p.pos++
+		if c == `}` {
+			break
+		}
+		if c != `,` {
+			return error('json: expected , or } at ${p.pos - 1}')
+		}
+	}
+	p.depth--
+	return v
+}
+
+fn (mut p JsonParser) array() !JsonValue {
+	p.enter()!
+	mut v := JsonValue{
+		kind: .array
+	}
+	p.skip_space()
+	if p.pos < p.src.len && p.src[p.pos] == `]` {
+		p.pos++
+		p.depth--
+		return v
+	}
+	for {
+		v.items << p.value()!
+		p.skip_space()
+		if p.pos >= p.src.len {
+			return error('json: unterminated array')
+		}
+		c := p.src[p.pos]
+		p.pos++
+		if c == `]` {
+			break
+		}
+		if c != `,` {
+			return error('json: expected , or ] at ${p.pos - 1}')
+		}
+	}
+	p.depth--
+	return v
+}
+
+fn (mut p JsonParser) number() !JsonValue {
+	start := p.pos
+	for p.pos < p.src.len && p.src[p.pos] in [`-`, `+`, `.`, `e`, `E`, `0`, `1`, `2`, `3`, `4`,
+		`5`, `6`, `7`, `8`, `9`] {
+		p.pos++
+	}
+	if p.pos == start {
+		return error('json: unexpected character at ${p.pos}')
+	}
+	return JsonValue{
+		kind: .number
+		num: p.src[start..p.pos].f64()
+	}
+}
+
+fn (mut p JsonParser) hex4() !u32 {
+	if p.pos + 4 > p.src.len {
+		return error('json: bad \\u escape')
+	}
+	mut v := u32(0)
+	for c in p.src[p.pos..p.pos + 4].bytes() {
+		v <<= 4
+		v |= match c {
+			`0`...`9` { u32(c - `0`) }
+			`a`...`f` { u32(c - `a` + 10) }
+			`A`...`F` { u32(c - `A` + 10) }
+			else { return error('json: bad \\u escape') }
+		}
+	}
+	p.pos += 4
+	return v
+}
+
+fn (mut p JsonParser) read_string() !string {
+	p.pos++
+	mut out := []u8{}
+	for {
+		if p.pos >= p.src.len {
+			return error('json: unterminated string')
+		}
+		c := p.src[p.pos]
+		p.pos++
+		if c == `"` {
+			break
+		}
+		if c != `\\` {
+			out << c
+			continue
+		}
+		if p.pos >= p.src.len {
+			return error('json: unterminated string')
+		}
+		e := p.src[p.pos]
+		p.pos++
+		match e {
+			`n` {
+				out << `\n`
+			}
+			`t` {
+				out << `\t`
+			}
+			`r` {
+				out << `\r`
+			}
+			`b` {
+				out << 8
+			}
+			`f` {
+				out << 12
+			}
+			`u` {
+				mut cp := p.hex4()!
+				if cp >= 0xd800 && cp < 0xdc00 && p.src[p.pos..].starts_with('\\u') {
+					p.pos += 2
+					lo := p.hex4()!
+					cp = 0x10000 + ((cp - 0xd800) << 10) + (lo - 0xdc00)
+				}
+				json_append_utf8(mut out, cp)
+			}
+			else {
+				out << e
+			}
+		}
+	}
+	return out.bytestr()
+}
+
+fn json_append_utf8(mut out []u8, cp u32) {
+	if cp < 0x80 {
+		out << u8(cp)
+	} else if cp < 0x800 {
+		out << u8(0xc0 | (cp >> 6))
+		out << u8(0x80 | (cp & 0x3f))
+	} else if cp < 0x10000 {
+		out << u8(0xe0 | (cp >> 12))
+		out << u8(0x80 | ((cp >> 6) & 0x3f))
+		out << u8(0x80 | (cp & 0x3f))
+	} else {
+		out << u8(0xf0 | (cp >> 18))
+		out << u8(0x80 | ((cp >> 12) & 0x3f))
+		out << u8(0x80 | ((cp >> 6) & 0x3f))
+		out << u8(0x80 | (cp & 0x3f))
+	}
+}
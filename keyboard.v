@@ -0,0 +1,232 @@
+module wasm96
+
+// Keyboard key codes, matching libretro's RETROK values.
+pub enum Key as u32 {
+	backspace = 8
+	tab = 9
+	enter = 13
+	escape = 27
+	space = 32
+	quote = 39
+	comma = 44
+	minus = 45
+	period = 46
+	slash = 47
+	num0 = 48
+	num1 = 49
+	num2 = 50
+	num3 = 51
+	num4 = 52
+	num5 = 53
+	num6 = 54
+	num7 = 55
+	num8 = 56
+	num9 = 57
+	semicolon = 59
+	equals = 61
+	left_bracket = 91
+	backslash = 92
+	right_bracket = 93
+	backquote = 96
+	a = 97
+	b = 98
+	c = 99
+	d = 100
+	e = 101
+	f = 102
+	g = 103
+	h = 104
+	i = 105
+	j = 106
+	k = 107
+	l = 108
+	m = 109
+	n = 110
+	o = 111
+	p = 112
+	q = 113
+	r = 114
+	s = 115
+	t = 116
+	u = 117
+	v = 118
+	w = 119
+	x = 120
+	y = 121
+	z = 122
+	delete = 127
+	up = 273
+	down = 274
+	right = 275
+	left = 276
+	home = 278
+	end = 279
+	page_up = 280
+	page_down = 281
+	f1 = 282
+	f2 = 283
+	f3 = 284
+	f4 = 285
+	f5 = 286
+	f6 = 287
+	f7 = 288
+	f8 = 289
+	f9 = 290
+	f10 = 291
+	f11 = 292
+	f12 = 293
+	rshift = 303
+	lshift = 304
+	rctrl = 305
+	lctrl = 306
+	ralt = 307
+	lalt = 308
+	rmeta = 309
+	lmeta = 310
+}
+
+// Keyboard modifier state, matching libretro's RETROKMOD bits.
+@[flag]
+pub enum KeyMod as u32 {
+	shift
+	ctrl
+	alt
+	meta
+	num_lock
+	caps_lock
+	scroll_lock
+}
+
+// A key press or release, with the character it produces (0 if none).
+pub struct KeyEvent {
+pub:
+	key     u32
+	pressed bool
+	ch      u8
+	// Modifiers held when the event was polled.
+	mods KeyMod
+}
+
+fn keyboard_shifted(c u8) u8 {
+	return match c {
+		`1` { u8(`!`) }
+		`2` { `@` }
+		`3` { `#` }
+		`4` { `$` }
+		`5` { `%` }
+		`6` { `^` }
+		`7` { `&` }
+		`8` { `*` }
+		`9` { `(` }
+		`0` { `)` }
+		`-` { `_` }
+		`=` { `+` }
+		`[` { `{` }
+		`]` { `}` }
+		`\\` { `|` }
+		`;` { `:` }
+		`'` { `"` }
+		`,` { `<` }
+		`.` { `>` }
+		`/` { `?` }
+		`\`` { `~` }
+		else { c }
+	}
+}
+
+struct KeyboardState {
+mut:
+	keys   []u32
+	down   []bool
+	events []KeyEvent
+}
+
+__global keyboard KeyboardState
+
+fn keyboard_polled_keys() []u32 {
+	mut keys := []u32{}
+	for k in 32 .. 127 {
+		// RETROK has no codes for upper-case letters.
+		if k >= `A` && k <= `Z` {
+			continue
+		}
+		keys << u32(k)
+	}
+	for k in [Key.backspace, .tab, .enter, .escape, .delete, .up, .down, .right, .left, .home,
+		.end, .page_up, .page_down, .f1, .f2, .f3, .f4, .f5, .f6, .f7, .f8, .f9, .f10, .f11,
+		.f12] {
+		keys << u32(k)
+	}
+	return keys
+}
+
+fn keyboard_pair_down(a Key, b Key) bool {
+	return input_is_key_down(u32(a)) || input_is_key_down(u32(b))
+}
+
+// Get the modifier keys held and lock keys toggled on. Hosts without
+// modifier reporting only give shift, ctrl, alt and meta, read from the
+// keys themselves.
+pub fn key_modifiers() KeyMod {
+	if compat_require(.key_modifiers) {
+		return unsafe { KeyMod(C.wasm96_input_key_modifiers()) }
+	}
+	mut mods := unsafe { KeyMod(0) }
+	if keyboard_pair_down(.lshift, .rshift) {
+		mods.set(.shift)
+	}
+	if keyboard_pair_down(.lctrl, .rctrl) {
+		mods.set(.ctrl)
+	}
+	if keyboard_pair_down(.lalt, .ralt) {
+		mods.set(.alt)
+	}
+	if keyboard_pair_down(.lmeta, .rmeta) {
+		mods.set(.meta)
+	}
+	return mods
+}
+
+fn keyboard_char(key u32, mods KeyMod) u8 {
+	if key < 32 || key > 126 {
+		return 0
+	}
+	c := u8(key)
+	if c >= `a` && c <= `z` {
+		// Caps lock inverts shift for letters only.
+		return if mods.has(.shift) != mods.has(.caps_lock) { c - 32 } else { c }
+	}
+	if !mods.has(.shift) {
+		return c
+	}
+	return keyboard_shifted(c)
+}
+
+// Poll the keyboard and queue an event for every key that changed state
+// since the last poll. Call once per frame before reading keyboard_events.
+pub fn keyboard_poll() {
+	if keyboard.keys.len == 0 {
+		keyboard.keys = keyboard_polled_keys()
+		keyboard.down = []bool{len: keyboard.keys.len}
+	}
+	keyboard.events.clear()
+	mods := key_modifiers()
+	for i, key in keyboard.keys {
+		down := input_is_key_down(key)
+		if down == keyboard.down[i] {
+			continue
+		}
+		keyboard.down[i] = down
+		keyboard.events << KeyEvent{
+			key: key
+			pressed: down
+			ch: if down { keyboard_char(key, mods) } else { 0 }
+			mods: mods
+		}
+	}
+}
+
+// Get the key events queued by the last keyboard_poll.
+pub fn keyboard_events() []KeyEvent {
+	return keyboard.events
+}
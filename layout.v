@@ -0,0 +1,117 @@
+module wasm96
+
+// Anchored HUD layout.
+//
+// A Layout places rectangles relative to a container (normally the screen's
+// safe area, see video_safe_rect) by anchor point, with offsets in pixels
+// and as a percentage of the container, so HUD elements stay put in their
+// corner or edge when the resolution, aspect or rotation changes. Elements
+// are placed on demand, so there is nothing to rebuild after a mode change.
+
+// Points of a rectangle that elements can be anchored to.
+pub enum Anchor {
+	top_left
+	top
+	top_right
+	left
+	center
+	right
+	bottom_left
+	bottom
+	bottom_right
+}
+
+// Where and how big an element should be.
+pub struct LayoutItem {
+pub mut:
+	// Point of the container the element is pinned to.
+	anchor Anchor = .top_left
+	// Point of the element placed on the anchor; defaults to the anchor,
+	// so a top_right item sits inside the top-right corner.
+	pivot ?Anchor
+	// Offset from the anchor in pixels, and in percent of the container.
+	x     int
+	y     int
+	x_pct int
+	y_pct int
+	// Size in pixels, plus percent of the container.
+	w     int
+	h     int
+	w_pct int
+	h_pct int
+}
+
+// Places items inside a container rectangle.
+pub struct Layout {
+pub mut:
+	// Use the safe area of the current screen instead of bounds.
+	use_safe_area bool = true
+	bounds        Rect
+	// Extra margin inside the container on every edge.
+	margin int
+}
+
+// Create a layout over the screen's safe area.
+pub fn new_layout(margin int) Layout {
+	return Layout{
+		margin: margin
+	}
+}
+
+// Create a layout over a fixed rectangle, such as a panel or a
+// VirtualScreen's logical size.
+pub fn new_layout_in(bounds Rect, margin int) Layout {
+	return Layout{
+		use_safe_area: false
+		bounds: bounds
+		margin: margin
+	}
+}
+
+// Get the container after margins.
+pub fn (l &Layout) container() Rect {
+	r := if l.use_safe_area { video_safe_rect() } else { l.bounds }
+	return Rect{r.x + l.margin, r.y + l.margin, max_int(0, r.w - 2 * l.margin), max_int(0,
+		r.h - 2 * l.margin)}
+}
+
+// Get how far across (0, 1 or 2 halves) an anchor lies on each axis.
+fn anchor_halves(a Anchor) (int, int) {
+	i := int(a)
+	return i % 3, i / 3
+}
+
+// Place item in the container.
+pub fn (l &Layout) place(item LayoutItem) Rect {
+	c := l.container()
+	return layout_place(c, item)
+}
+
+// Place item inside another rectangle, e.g. one returned by place, to nest
+// elements.
+pub fn layout_place(c Rect, item LayoutItem) Rect {
+	w := item.w + c.w * item.w_pct / 100
+	h := item.h + c.h * item.h_pct / 100
+	ax, ay := anchor_halves(item.anchor)
+	px, py := anchor_halves(item.pivot or { item.anchor })
+	// Offsets point inwards from edge anchors, so positive x moves a right
+	// anchored item left, away from the edge.
+	sx := if ax == 2 { -1 } else { 1 }
+	sy := if ay == 2 { -1 } else { 1 }
+	ox := item.x + c.w * item.x_pct / 100
+	oy := item.y + c.h * item.y_pct / 100
+	x := c.x + c.w * ax / 2 - w * px / 2 + sx * ox
+	y := c.y + c.h * ay / 2 - h * py / 2 + sy * oy
+	return Rect{x, y, w, h}
+}
+
+// Place a w x h element at anchor, inset by (x, y) pixels.
+pub fn (l &Layout) at(anchor Anchor, w int, h int, x int, y int) Rect {
+	return l.place(LayoutItem{
+		anchor: anchor
+		x: x
+		y: y
+		w: w
+		h: h
+	})
+}
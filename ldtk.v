@@ -0,0 +1,333 @@
+module wasm96
+
+// LDtk project importer.
+//
+// Each level becomes a Tilemap: Tiles and auto-layers become tile layers using
+// the same global ids as Tiled (tilesets are numbered in definition order),
+// IntGrid layers become hidden tile layers holding their int values, and
+// entity layers become object layers. Layers should share one grid size.
+
+// Resolves the path of an external level file to its contents.
+pub type LdtkResolveFn = fn (path string) !string
+
+// Called for every entity when spawning a level.
+pub type LdtkSpawnFn = fn (level &LdtkLevel, entity &MapObject)
+
+// An enum defined in the project.
+pub struct LdtkEnum {
+pub mut:
+	identifier string
+	values     []string
+}
+
+// A level of an LDtk project.
+pub struct LdtkLevel {
+pub mut:
+	identifier string
+	iid        string
+	world_x    int
+	world_y    int
+	px_width   int
+	px_height  int
+	fields     map[string]string
+	tilemap    Tilemap
+}
+
+// A loaded LDtk project.
+pub struct LdtkProject {
+pub mut:
+	levels   []LdtkLevel
+	tilesets []Tileset
+	enums    []LdtkEnum
+}
+
+// Get the level named identifier.
+pub fn (p &LdtkProject) level(identifier string) ?&LdtkLevel {
+	for i in 0 .. p.levels.len {
+		if p.levels[i].identifier == identifier {
+			return unsafe { &p.levels[i] }
+		}
+	}
+	return none
+}
+
+// Get the enum named identifier.
+pub fn (p &LdtkProject) enum_values(identifier string) []string {
+	for e in p.enums {
+		if e.identifier == identifier {
+			return e.values
+		}
+	}
+	return []
+}
+
+// Load an LDtk project. Projects saved with separate level files are an error;
+// use ldtk_load_with to resolve them.
+pub fn ldtk_load(data string) !LdtkProject {
+	return ldtk_load_with(data, fn (path string) !string {
+		return error('ldtk: external level ${path} needs a resolver')
+	})
+}
+
+// Load an LDtk project, calling resolve to read external level files.
+pub fn ldtk_load_with(data string, resolve LdtkResolveFn) !LdtkProject {
+	root := json_parse(data)!
+	defs := root.get('defs') or { return error('ldtk: missing defs') }
+	mut proj := LdtkProject{}
+	mut tileset_uids := map[int]int{}
+	mut next_gid := u32(1)
+	for def in defs.get_arr('tilesets') {
+		ts := ldtk_tileset(def, next_gid)
+		next_gid += u32(ts.tile_count)
+		tileset_uids[def.get_int('uid', 0)] = proj.tilesets.len
+		proj.tilesets << ts
+	}
+	for def in defs.get_arr('enums') {
+		mut e := LdtkEnum{
+			identifier: def.get_str('identifier')
+		}
+		for v in def.get_arr('values') {
+			e.values << v.get_str('id')
+		}
+		proj.enums << e
+	}
+	grid := root.get_int('defaultGridSize', 16)
+	for node in root.get_arr('levels') {
+		mut level_node := node
+		if !node.has('layerInstances') {
+			path := node.get_str('externalRelPath')
+			if path.len == 0 {
+				return error('ldtk: level ${node.get_str('identifier')} has no layers')
+			}
+			level_node = json_parse(resolve(path)!)!
+		}
+		proj.levels << ldtk_level(level_node, grid, proj.tilesets, tileset_uids)!
+	}
+	return proj
+}
+
+fn ldtk_tileset(def JsonValue, first_gid u32) Tileset {
+	grid := def.get_int('tileGridSize', 16)
+	spacing := def.get_int('spacing', 0)
+	padding := def.get_int('padding', 0)
+	columns := (def.get_int('pxWid', 0) - 2 * padding + spacing) / (grid + spacing)
+	rows := (def.get_int('pxHei', 0) - 2 * padding + spacing) / (grid + spacing)
+	mut ts := Tileset{
+		name: def.get_str('identifier')
+		first_gid: first_gid
+		tile_width: grid
+		tile_height: grid
+		tile_count: columns * rows
+		columns: columns
+		spacing: spacing
+		margin: padding
+		image: def.get_str('relPath')
+	}
+	for cd in def.get_arr('customData') {
+		id := cd.get_int('tileId', 0)
+		mut props := ts.tile_properties[id] or { map[string]string{} }
+		props['data'] = cd.get_str('data')
+		ts.tile_properties[id] = props.clone()
+	}
+	// Enum tags become "true" properties, so collision_from_property works
+	// with them directly.
+	for tag in def.get_arr('enumTags') {
+		value := tag.get_str('enumValueId')
+		for id_node in tag.get_arr('tileIds') {
+			id := int(id_node.num)
+			mut props := ts.tile_properties[id] or { map[string]string{} }
+			props[value] = 'true'
+			ts.tile_properties[id] = props.clone()
+		}
+	}
+	return ts
+}
+
+fn ldtk_fields(list []JsonValue) map[string]string {
+	mut fields := map[string]string{}
+	for f in list {
+		value := f.get('__value') or { continue }
+		fields[f.get_str('__identifier')] = value.to_text()
+	}
+	return fields
+}
+
+fn ldtk_level(node JsonValue, grid int, tilesets []Tileset, tileset_uids map[int]int) !LdtkLevel {
+	mut level := LdtkLevel{
+		identifier: node.get_str('identifier')
+		iid: node.get_str('iid')
+		world_x: node.get_int('worldX', 0)
+		world_y: node.get_int('worldY', 0)
+		px_width: node.get_int('pxWid', 0)
+		px_height: node.get_int('pxHei', 0)
+		fields: ldtk_fields(node.get_arr('fieldInstances'))
+	}
+	level.tilemap = Tilemap{
+		width: level.px_width / grid
+		height: level.px_height / grid
+		tile_width: grid
+		tile_height: grid
+		tilesets: tilesets
+		properties: level.fields.clone()
+	}
+	// LDtk lists layers top first; tilemaps draw bottom first.
+	layers := node.get_arr('layerInstances')
+	mut ids := map[string]int{}
+	for i := layers.len - 1; i >= 0; i-- {
+		l := layers[i]
+		name := l.get_str('__identifier')
+		visible := l.get_bool('visible', true)
+		match l.get_str('__type') {
+			'IntGrid' {
+				mut values := TileLayer{
+					name: name
+					width: l.get_int('__cWid', 0)
+					height: l.get_int('__cHei', 0)
+					visible: false
+					properties: {
+						'ldtk_type': 'IntGrid'
+					}
+				}
+				for v in l.get_arr('intGridCsv') {
+					values.tiles << u32(v.num)
+				}
+				if values.tiles.len != values.width * values.height {
+					return error('ldtk: layer ${name} has ${values.tiles.len} cells, expected ${values.width * values.height}')
+				}
+				auto := l.get_arr('autoLayerTiles')
+				if auto.len > 0 {
+					level.tilemap.layers << ldtk_tile_layer(l, name + '_tiles', visible, auto,
+						tilesets, tileset_uids)
+				}
+				level.tilemap.layers << values
+			}
+			'Tiles' {
+				level.tilemap.layers << ldtk_tile_layer(l, name, visible, l.get_arr('gridTiles'),
+					tilesets, tileset_uids)
+			}
+			'AutoLayer' {
+				level.tilemap.layers << ldtk_tile_layer(l, name, visible, l.get_arr('autoLayerTiles'),
+					tilesets, tileset_uids)
+			}
+			'Entities' {
+				level.tilemap.object_layers << ldtk_entity_layer(l, name, visible, mut ids)
+			}
+			else {}
+		}
+	}
+	return level
+}
+
+fn ldtk_tile_layer(l JsonValue, name string, visible bool, tiles []JsonValue, tilesets []Tileset, tileset_uids map[int]int) TileLayer {
+	cell := l.get_int('__gridSize', 16)
+	mut layer := TileLayer{
+		name: name
+		width: l.get_int('__cWid', 0)
+		height: l.get_int('__cHei', 0)
+		visible: visible
+		properties: {
+			'ldtk_type': l.get_str('__type')
+		}
+	}
+	layer.tiles = []u32{len: layer.width * layer.height}
+	uid := l.get_int('__tilesetDefUid', -1)
+	first_gid := if index := tileset_uids[uid] { tilesets[index].first_gid } else { u32(1) }
+	for t in tiles {
+		px := t.get_arr('px')
+		if px.len != 2 {
+			continue
+		}
+		mut gid := first_gid + u32(t.get_int('t', 0))
+		flip := t.get_int('f', 0)
+		if flip & 1 != 0 {
+			gid |= tile_flip_h
+		}
+		if flip & 2 != 0 {
+			gid |= tile_flip_v
+		}
+		// Stacked tiles keep the topmost one.
+		layer.set(int(px[0].num) / cell, int(px[1].num) / cell, gid)
+	}
+	return layer
+}
+
+// ids numbers entity instances from 1 by iid, so every object in the level
+// gets its own id.
+fn ldtk_entity_layer(l JsonValue, name string, visible bool, mut ids map[string]int) ObjectLayer {
+	mut layer := ObjectLayer{
+		name: name
+		visible: visible
+	}
+	offset_x := l.get_f32('__pxTotalOffsetX', 0)
+	offset_y := l.get_f32('__pxTotalOffsetY', 0)
+	for e in l.get_arr('entityInstances') {
+		px := e.get_arr('px')
+		pivot := e.get_arr('__pivot')
+		w := e.get_f32('width', 0)
+		h := e.get_f32('height', 0)
+		mut x := offset_x
+		mut y := offset_y
+		if px.len == 2 {
+			x += f32(px[0].num)
+			y += f32(px[1].num)
+		}
+		// Store the top-left corner like Tiled rectangles.
+		if pivot.len == 2 {
+			x -= f32(pivot[0].num) * w
+			y -= f32(pivot[1].num) * h
+		}
+		mut props := ldtk_fields(e.get_arr('fieldInstances'))
+		iid := e.get_str('iid')
+		id := ids[iid] or { ids.len + 1 }
+		ids[iid] = id
+		props['iid'] = iid
+		props['tags'] = e.get_arr('__tags').map(it.text).join(',')
+		identifier := e.get_str('__identifier')
+		layer.objects << MapObject{
+			id: id
+			name: identifier
+			kind: identifier
+			x: x
+			y: y
+			width: w
+			height: h
+			properties: props
+		}
+	}
+	return layer
+}
+
+// Dispatches level entities to spawn functions by identifier.
+pub struct LdtkSpawner {
+mut:
+	handlers map[string]LdtkSpawnFn
+	fallback LdtkSpawnFn = unsafe { nil }
+}
+
+// Call f for entities with the given identifier.
+pub fn (mut s LdtkSpawner) on(identifier string, f LdtkSpawnFn) {
+	s.handlers[identifier] = f
+}
+
+// Call f for entities with no handler of their own.
+pub fn (mut s LdtkSpawner) on_other(f LdtkSpawnFn) {
+	s.fallback = f
+}
+
+// Spawn every entity of a level. Returns the number of entities handled.
+pub fn (s &LdtkSpawner) spawn(level &LdtkLevel) int {
+	mut count := 0
+	for layer in level.tilemap.object_layers {
+		for i in 0 .. layer.objects.len {
+			obj := unsafe { &layer.objects[i] }
+			if f := s.handlers[obj.kind] {
+				f(level, obj)
+				count++
+			} else if s.fallback != unsafe { nil } {
+				s.fallback(level, obj)
+				count++
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,42 @@
+module wasm96
+
+// Frontend LEDs, over libretro's LED interface: player indicators, power or
+// drive lights on devices that have them. States are cached so setting an
+// LED every frame only reaches the host when it changes.
+
+__global led_states []bool
+
+// Get the number of LEDs the frontend exposes (0 if none).
+pub fn led_count() int {
+	if !compat_require(.led) {
+		return 0
+	}
+	return int(C.wasm96_system_led_count())
+}
+
+// Turn LED index on or off. Returns false if there is no such LED.
+pub fn led_set(index int, on bool) bool {
+	if index < 0 || !compat_require(.led) {
+		return false
+	}
+	if led_states.len == 0 {
+		led_states = []bool{len: led_count()}
+	}
+	if index >= led_states.len {
+		return false
+	}
+	if led_states[index] == on {
+		return true
+	}
+	if !record_status(C.wasm96_system_led_set(u32(index), if on { 1 } else { 0 })) {
+		return false
+	}
+	led_states[index] = on
+	return true
+}
+
+// Blink LED index, on for the first half of every period frames (see
+// blink). Call every frame while it should blink, e.g. at low health.
+pub fn led_blink(index int, period u64) {
+	led_set(index, blink(period))
+}
@@ -0,0 +1,200 @@
+module wasm96
+
+// 2D lighting with tile shadows.
+//
+// Lights are rendered into an offscreen light map: each light casts rays
+// against a tile collision grid to build its visibility polygon, which is
+// filled with the light's color fading out towards its radius. The light map
+// starts at the ambient color, and apply_to multiplies it onto the scene, so
+// anything outside every light takes the ambient tint.
+
+// A point light, or a cone light if spread is above 0.
+pub struct Light {
+pub mut:
+	// Position in world pixels.
+	x      f32
+	y      f32
+	radius f32
+	color  Color = Color{255, 255, 255, 255}
+	// Brightness multiplier; above 1 saturates towards white sooner.
+	intensity f32 = 1
+	// Cone direction and half-width in radians.
+	angle  f32
+	spread f32
+	// Rays cast for the visibility polygon; 0 picks a count from the radius.
+	rays int
+}
+
+// An offscreen light map the size of the screen.
+pub struct LightMap {
+pub mut:
+	ambient Color = Color{24, 24, 40, 255}
+	lights  []Light
+	image   Image
+mut:
+	poly []Point
+}
+
+__global light_screen Image
+
+// Create a light map of the given size, normally the screen's.
+pub fn new_light_map(width int, height int, ambient Color) LightMap {
+	return LightMap{
+		ambient: ambient
+		image: new_image(width, height)
+	}
+}
+
+// Get the distance along a ray from (x, y) in direction (dx, dy) (a unit
+// vector) to the first solid cell, up to max_dist.
+pub fn (c &TileCollision) raycast(x f32, y f32, dx f32, dy f32, max_dist f32) f32 {
+	if c.tile_width <= 0 || c.tile_height <= 0 {
+		return max_dist
+	}
+	tw := f32(c.tile_width)
+	th := f32(c.tile_height)
+	mut cx := int(floorf(x / tw))
+	mut cy := int(floorf(y / th))
+	if c.is_solid(cx, cy) {
+		return 0
+	}
+	big := f32(1e30)
+	step_x := if dx > 0 { 1 } else { -1 }
+	step_y := if dy > 0 { 1 } else { -1 }
+	delta_x := if dx == 0 { big } else { absf(tw / dx) }
+	delta_y := if dy == 0 { big } else { absf(th / dy) }
+	mut next_x := if dx > 0 {
+		(f32(cx + 1) * tw - x) / dx
+	} else if dx < 0 {
+		(f32(cx) * tw - x) / dx
+	} else {
+		big
+	}
+	mut next_y := if dy > 0 {
+		(f32(cy + 1) * th - y) / dy
+	} else if dy < 0 {
+		(f32(cy) * th - y) / dy
+	} else {
+		big
+	}
+	for {
+		mut t := f32(0)
+		if next_x < next_y {
+			t = next_x
+			next_x += delta_x
+			cx += step_x
+		} else {
+			t = next_y
+			next_y += delta_y
+			cy += step_y
+		}
+		if t >= max_dist {
+			return max_dist
+		}
+		if c.is_solid(cx, cy) {
+			return t
+		}
+	}
+	return max_dist
+}
+
+// Render every light into the light map, with the camera at (cam_x, cam_y).
+pub fn (mut lm LightMap) render(occluders &TileCollision, cam_x int, cam_y int) {
+	lm.image.fill(lm.ambient)
+	for l in lm.lights {
+		lm.render_light(l, occluders, cam_x, cam_y)
+	}
+}
+
+fn (mut lm LightMap) render_light(l Light, occluders &TileCollision, cam_x int, cam_y int) {
+	if l.radius <= 0 {
+		return
+	}
+	cone := l.spread > 0 && l.spread < pi
+	arc := if cone { 2 * l.spread } else { 2 * pi }
+	mut rays := l.rays
+	if rays <= 0 {
+		rays = clamp_int(int(l.radius * arc / 4), 16, 360)
+	}
+	sx := l.x - f32(cam_x)
+	sy := l.y - f32(cam_y)
+	lm.poly.clear()
+	if cone {
+		lm.poly << round_point(sx, sy)
+	}
+	start := if cone { l.angle - l.spread } else { f32(0) }
+	// A full circle doesn't repeat its first ray; a cone includes both edges.
+	count := if cone { rays + 1 } else { rays }
+	for i in 0 .. count {
+		a := start + arc * f32(i) / f32(rays)
+		dx := cosf(a)
+		dy := sinf(a)
+		d := occluders.raycast(l.x, l.y, dx, dy, l.radius)
+		lm.poly << round_point(sx + dx * d, sy + dy * d)
+	}
+	poly_raster.rasterize(lm.poly, 0, 0, lm.image.width, lm.image.height)
+	s := poly_raster.spans
+	r2 := l.radius * l.radius
+	k := clampf(l.intensity, 0, 16) * 256
+	cr := u32(l.color.r)
+	cg := u32(l.color.g)
+	cb := u32(l.color.b)
+	for i := 0; i < s.len; i += 3 {
+		y := s[i]
+		py := f32(y) + 0.5 - sy
+		for x in s[i + 1] .. s[i + 2] {
+			px := f32(x) + 0.5 - sx
+			d2 := px * px + py * py
+			if d2 >= r2 {
+				continue
+			}
+			// Smooth falloff without a square root: (1 - d^2 / r^2)^2.
+			f := 1 - d2 / r2
+			w := u32(f * f * k)
+			j := (y * lm.image.width + x) * 4
+			lm.image.pixels[j] = light_add(lm.image.pixels[j], cr, w)
+			lm.image.pixels[j + 1] = light_add(lm.image.pixels[j + 1], cg, w)
+			lm.image.pixels[j + 2] = light_add(lm.image.pixels[j + 2], cb, w)
+		}
+	}
+}
+
+fn light_add(v u8, c u32, w u32) u8 {
+	t := u32(v) + ((c * w) >> 8)
+	return if t > 255 { 255 } else { u8(t) }
+}
+
+// Multiply the light map onto scene, normally the offscreen image the game
+// draws into (such as a VirtualScreen's surface), keeping the lights'
+// colors. scene must be the light map's size.
+pub fn (lm &LightMap) apply_to(mut scene Image) {
+	if scene.width != lm.image.width || scene.height != lm.image.height {
+		return
+	}
+	for i := 0; i < scene.pixels.len; i += 4 {
+		for ch in 0 .. 3 {
+			t := u32(scene.pixels[i + ch]) * u32(lm.image.pixels[i + ch]) + 128
+			scene.pixels[i + ch] = u8((t + (t >> 8)) >> 8)
+		}
+	}
+}
+
+// Darken what has been drawn on screen this frame with an overlay that is
+// clear where lit. The screen can't be read back in time to multiply, so
+// the lights' colors are lost; use apply_to on an offscreen scene for
+// colored light.
+pub fn (lm &LightMap) apply() {
+	if light_screen.width != lm.image.width || light_screen.height != lm.image.height {
+		light_screen = new_image(lm.image.width, lm.image.height)
+	}
+	p := lm.image.pixels
+	for i := 0; i < p.len; i += 4 {
+		lum := if p[i] > p[i + 1] { p[i] } else { p[i + 1] }
+		brightest := if p[i + 2] > lum { p[i + 2] } else { lum }
+		light_screen.pixels[i] = 0
+		light_screen.pixels[i + 1] = 0
+		light_screen.pixels[i + 2] = 0
+		light_screen.pixels[i + 3] = 255 - brightest
+	}
+	light_screen.draw(0, 0)
+}
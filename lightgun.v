@@ -0,0 +1,180 @@
+module wasm96
+
+// Lightgun input.
+//
+// The host reports where a lightgun points as libretro does: -32767 to 32767
+// across each axis of the visible picture, plus a state word with the
+// buttons and whether the gun points off screen (to reload, classically).
+// A Lightgun converts that into framebuffer pixels, tracks button edges,
+// can draw a crosshair, and applies a two-point calibration for guns that
+// read off-target. Without host lightgun support, port's mouse stands in.
+
+// Lightgun state bits.
+pub enum LightgunButton as u32 {
+	offscreen = 1
+	trigger = 2
+	reload = 4
+	aux_a = 8
+	aux_b = 16
+	start = 32
+}
+
+// A lightgun on one port.
+pub struct Lightgun {
+pub mut:
+	port u32
+	// Sprite drawn centered on the aim point; a plain cross when unset.
+	crosshair       &Image = unsafe { nil }
+	crosshair_color Color  = Color{255, 255, 255, 255}
+	// Calibration mapping raw pixels to corrected pixels per axis.
+	scale_x  f32 = 1
+	scale_y  f32 = 1
+	offset_x f32
+	offset_y f32
+mut:
+	x           int
+	y           int
+	state       u32
+	prev        u32
+	cal_step    int = -1
+	cal_targets [2]Point
+	cal_raw     [2]Point
+}
+
+// Create a lightgun reader for port.
+pub fn new_lightgun(port u32) Lightgun {
+	return Lightgun{
+		port: port
+	}
+}
+
+// Read the gun's position and buttons. Call once per frame. While
+// calibrating, a trigger pull records the shot at the current target.
+pub fn (mut g Lightgun) poll() {
+	g.prev = g.state
+	mut rx := 0
+	mut ry := 0
+	if compat_require(.lightgun) {
+		w := int(screen_width)
+		h := int(screen_height)
+		rx = (C.wasm96_input_lightgun_x(g.port) + 32767) * w / 65535
+		ry = (C.wasm96_input_lightgun_y(g.port) + 32767) * h / 65535
+		g.state = C.wasm96_input_lightgun_state(g.port)
+	} else {
+		rx = input_get_port_mouse_x(g.port)
+		ry = input_get_port_mouse_y(g.port)
+		g.state = 0
+		if input_is_port_mouse_down(g.port, 0) {
+			g.state |= u32(LightgunButton.trigger)
+		}
+		if input_is_port_mouse_down(g.port, 1) {
+			g.state |= u32(LightgunButton.reload)
+		}
+	}
+	if g.cal_step >= 0 {
+		g.x = rx
+		g.y = ry
+		if g.pressed(.trigger) && !g.offscreen() {
+			g.cal_raw[g.cal_step] = Point{rx, ry}
+			g.cal_step++
+			if g.cal_step == 2 {
+				g.finish_calibration()
+			}
+		}
+		return
+	}
+	g.x = int(f32(rx) * g.scale_x + g.offset_x)
+	g.y = int(f32(ry) * g.scale_y + g.offset_y)
+}
+
+// Get the aim point in framebuffer pixels.
+pub fn (g &Lightgun) position() (int, int) {
+	return g.x, g.y
+}
+
+// Returns true if the gun points off the screen.
+pub fn (g &Lightgun) offscreen() bool {
+	return g.state & u32(LightgunButton.offscreen) != 0
+}
+
+// Returns true if button is held.
+pub fn (g &Lightgun) down(button LightgunButton) bool {
+	return g.state & u32(button) != 0
+}
+
+// Returns true if button went down this frame.
+pub fn (g &Lightgun) pressed(button LightgunButton) bool {
+	return g.state & u32(button) != 0 && g.prev & u32(button) == 0
+}
+
+// Returns true if the trigger was pulled this frame while pointing at the
+// screen: a shot.
+pub fn (g &Lightgun) fired() bool {
+	return g.pressed(.trigger) && !g.offscreen() && g.cal_step < 0
+}
+
+// Returns true if the trigger was pulled off screen or reload was pressed,
+// the usual ways to reload.
+pub fn (g &Lightgun) reloaded() bool {
+	return (g.pressed(.trigger) && g.offscreen()) || g.pressed(.reload)
+}
+
+// Draw the crosshair at the aim point, unless off screen.
+pub fn (g &Lightgun) draw_crosshair() {
+	if g.offscreen() {
+		return
+	}
+	if g.crosshair != unsafe { nil } {
+		g.crosshair.draw(g.x - g.crosshair.width / 2, g.y - g.crosshair.height / 2)
+		return
+	}
+	graphics_set_color_rgba(g.crosshair_color)
+	graphics_line(g.x - 6, g.y, g.x - 2, g.y)
+	graphics_line(g.x + 2, g.y, g.x + 6, g.y)
+	graphics_line(g.x, g.y - 6, g.x, g.y - 2)
+	graphics_line(g.x, g.y + 2, g.x, g.y + 6)
+}
+
+// Start calibrating: the player shoots at a then at b (screen pixels, best
+// near opposite corners). Positions are uncorrected until both are done.
+pub fn (mut g Lightgun) start_calibration(a Point, b Point) {
+	g.cal_targets = [a, b]!
+	g.cal_step = 0
+}
+
+// Returns true while waiting for calibration shots.
+pub fn (g &Lightgun) calibrating() bool {
+	return g.cal_step >= 0
+}
+
+// Get the point the player should shoot next, or none when not calibrating.
+pub fn (g &Lightgun) calibration_target() ?Point {
+	if g.cal_step < 0 {
+		return none
+	}
+	return g.cal_targets[g.cal_step]
+}
+
+// Forget any calibration.
+pub fn (mut g Lightgun) reset_calibration() {
+	g.scale_x = 1
+	g.scale_y = 1
+	g.offset_x = 0
+	g.offset_y = 0
+	g.cal_step = -1
+}
+
+fn (mut g Lightgun) finish_calibration() {
+	g.cal_step = -1
+	t := g.cal_targets
+	r := g.cal_raw
+	// Two shots too close together on an axis can't calibrate it.
+	if iabs(r[1].x - r[0].x) >= 8 && t[1].x != t[0].x {
+		g.scale_x = f32(t[1].x - t[0].x) / f32(r[1].x - r[0].x)
+		g.offset_x = f32(t[0].x) - f32(r[0].x) * g.scale_x
+	}
+	if iabs(r[1].y - r[0].y) >= 8 && t[1].y != t[0].y {
+		g.scale_y = f32(t[1].y - t[0].y) / f32(r[1].y - r[0].y)
+		g.offset_y = f32(t[0].y) - f32(r[0].y) * g.scale_y
+	}
+}
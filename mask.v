@@ -0,0 +1,259 @@
+module wasm96
+
+// Pixel-perfect collision masks.
+//
+// A CollisionMask is one bit per pixel of a sprite, packed 64 to a word
+// along each row, so testing two masks for overlap ANDs 64 pixels at a time
+// instead of comparing pixels one by one. Build masks once from sprite
+// alpha or a color key, make flipped or rotated copies up front for each
+// way a sprite is drawn, and test them at their screen positions. Check
+// bounding boxes first; masks are for when boxes are too coarse.
+//
+//   ship := wasm96.collision_mask_from_image(ship_img, 128)
+//   rock := wasm96.collision_mask_from_image(rock_img, 128)
+//   if ship.overlaps(px, py, rock, rx, ry) { ... }
+
+// One bit per pixel, set where a sprite is solid.
+pub struct CollisionMask {
+pub:
+	width  int
+	height int
+mut:
+	// Words per row.
+	stride int
+	// Bit i of a row's word k is pixel k * 64 + i.
+	bits []u64
+}
+
+// Create an empty mask.
+pub fn new_collision_mask(width int, height int) CollisionMask {
+	w := max_int(0, width)
+	h := max_int(0, height)
+	stride := (w + 63) / 64
+	return CollisionMask{
+		width: w
+		height: h
+		stride: stride
+		bits: []u64{len: stride * h}
+	}
+}
+
+// Build a mask of the pixels whose alpha is at least threshold.
+pub fn collision_mask_from_image(img &Image, threshold u8) CollisionMask {
+	mut m := new_collision_mask(img.width, img.height)
+	for y in 0 .. img.height {
+		for x in 0 .. img.width {
+			if img.pixels[(y * img.width + x) * 4 + 3] >= threshold {
+				m.set(x, y, true)
+			}
+		}
+	}
+	return m
+}
+
+// Build a mask of the pixels that aren't the color key, for sprites without
+// alpha. Alpha is ignored.
+pub fn collision_mask_from_color_key(img &Image, key Color) CollisionMask {
+	mut m := new_collision_mask(img.width, img.height)
+	for y in 0 .. img.height {
+		for x in 0 .. img.width {
+			i := (y * img.width + x) * 4
+			if img.pixels[i] != key.r || img.pixels[i + 1] != key.g || img.pixels[i + 2] != key.b {
+				m.set(x, y, true)
+			}
+		}
+	}
+	return m
+}
+
+// Build a mask for a region of a sprite sheet, e.g. one atlas frame.
+pub fn collision_mask_from_region(img &Image, x int, y int, w int, h int, threshold u8) CollisionMask {
+	return collision_mask_from_image(img.sub_image(x, y, w, h), threshold)
+}
+
+// Returns true if pixel (x, y) is solid. Pixels outside the mask aren't.
+pub fn (m &CollisionMask) get(x int, y int) bool {
+	if x < 0 || y < 0 || x >= m.width || y >= m.height {
+		return false
+	}
+	return (m.bits[y * m.stride + x / 64] >> u64(x % 64)) & 1 != 0
+}
+
+// Set whether pixel (x, y) is solid.
+pub fn (mut m CollisionMask) set(x int, y int, solid bool) {
+	if x < 0 || y < 0 || x >= m.width || y >= m.height {
+		return
+	}
+	i := y * m.stride + x / 64
+	bit := u64(1) << u64(x % 64)
+	if solid {
+		m.bits[i] |= bit
+	} else {
+		m.bits[i] &= ~bit
+	}
+}
+
+// Get the number of solid pixels.
+pub fn (m &CollisionMask) count() int {
+	mut n := 0
+	for w in m.bits {
+		n += popcount64(w)
+	}
+	return n
+}
+
+fn popcount64(x u64) int {
+	mut v := x - ((x >> 1) & 0x5555555555555555)
+	v = (v & 0x3333333333333333) + ((v >> 2) & 0x3333333333333333)
+	v = (v + (v >> 4)) & 0x0f0f0f0f0f0f0f0f
+	return int((v * 0x0101010101010101) >> 56)
+}
+
+// Get the 64 pixels of row y starting at column x, with zeros outside the
+// mask.
+fn (m &CollisionMask) row_bits(y int, x int) u64 {
+	if x >= m.width || x <= -64 {
+		return 0
+	}
+	q := floor_div(x, 64)
+	r := x - q * 64
+	row := y * m.stride
+	lo := if q >= 0 && q < m.stride { m.bits[row + q] } else { u64(0) }
+	if r == 0 {
+		return lo
+	}
+	hi := if q + 1 >= 0 && q + 1 < m.stride { m.bits[row + q + 1] } else { u64(0) }
+	return (lo >> u64(r)) | (hi << u64(64 - r))
+}
+
+// Count the solid pixels both masks share, 64 at a time, or return 1 at the
+// first if first_only.
+fn (a &CollisionMask) overlap(ax int, ay int, b &CollisionMask, bx int, by int, first_only bool) int {
+	dx := bx - ax
+	dy := by - ay
+	y0 := max_int(0, dy)
+	y1 := min_int(a.height, dy + b.height)
+	x0 := max_int(0, dx)
+	x1 := min_int(a.width, dx + b.width)
+	if y0 >= y1 || x0 >= x1 {
+		return 0
+	}
+	mut n := 0
+	for y in y0 .. y1 {
+		row := y * a.stride
+		for k in x0 / 64 .. (x1 - 1) / 64 + 1 {
+			both := a.bits[row + k] & b.row_bits(y - dy, k * 64 - dx)
+			if both != 0 {
+				if first_only {
+					return 1
+				}
+				n += popcount64(both)
+			}
+		}
+	}
+	return n
+}
+
+// Returns true if mask a at (ax, ay) and mask b at (bx, by) share any solid
+// pixel.
+pub fn (a &CollisionMask) overlaps(ax int, ay int, b &CollisionMask, bx int, by int) bool {
+	return a.overlap(ax, ay, b, bx, by, true) > 0
+}
+
+// Get how many solid pixels mask a at (ax, ay) and mask b at (bx, by)
+// share, e.g. to judge how deep a hit is.
+pub fn (a &CollisionMask) overlap_count(ax int, ay int, b &CollisionMask, bx int, by int) int {
+	return a.overlap(ax, ay, b, bx, by, false)
+}
+
+// Returns true if the mask at (x, y) has a solid pixel inside r.
+pub fn (m &CollisionMask) overlaps_rect(x int, y int, r Rect) bool {
+	x0 := max_int(0, r.x - x)
+	y0 := max_int(0, r.y - y)
+	x1 := min_int(m.width, r.x + r.w - x)
+	y1 := min_int(m.height, r.y + r.h - y)
+	if x0 >= x1 || y0 >= y1 {
+		return false
+	}
+	for row in y0 .. y1 {
+		for k in x0 / 64 .. (x1 - 1) / 64 + 1 {
+			// Keep only columns x0 .. x1 of this word.
+			lo := max_int(x0 - k * 64, 0)
+			hi := min_int(x1 - k * 64, 64)
+			span := if hi - lo == 64 { ~u64(0) } else { ((u64(1) << u64(hi - lo)) - 1) << u64(lo) }
+			if m.bits[row * m.stride + k] & span != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Get the smallest rectangle holding every solid pixel, in mask
+// coordinates. Empty if there are none.
+pub fn (m &CollisionMask) bounds() Rect {
+	mut x0 := m.width
+	mut y0 := m.height
+	mut x1 := -1
+	mut y1 := -1
+	for y in 0 .. m.height {
+		for x in 0 .. m.width {
+			if m.get(x, y) {
+				x0 = min_int(x0, x)
+				y0 = min_int(y0, y)
+				x1 = max_int(x1, x)
+				y1 = max_int(y1, y)
+			}
+		}
+	}
+	if x1 < 0 {
+		return Rect{}
+	}
+	return Rect{x0, y0, x1 - x0 + 1, y1 - y0 + 1}
+}
+
+// Get a copy mirrored left to right and/or top to bottom, to match a sprite
+// drawn flipped.
+pub fn (m &CollisionMask) flipped(horizontal bool, vertical bool) CollisionMask {
+	mut out := new_collision_mask(m.width, m.height)
+	for y in 0 .. m.height {
+		sy := if vertical { m.height - 1 - y } else { y }
+		for x in 0 .. m.width {
+			sx := if horizontal { m.width - 1 - x } else { x }
+			if m.get(sx, sy) {
+				out.set(x, y, true)
+			}
+		}
+	}
+	return out
+}
+
+// Get a copy rotated by angle radians (clockwise, as y points down) and
+// scaled by scale about its center, sampling the nearest pixel. The copy
+// is sized to hold the whole result and centered on the same point: draw
+// offsets change by (m.width - out.width) / 2 and likewise for height.
+pub fn (m &CollisionMask) transformed(angle f32, scale f32) CollisionMask {
+	if scale <= 0 {
+		return new_collision_mask(0, 0)
+	}
+	c := cosf(angle)
+	s := sinf(angle)
+	hw := f32(m.width) * scale / 2
+	hh := f32(m.height) * scale / 2
+	w := int(2 * (absf(c) * hw + absf(s) * hh) + 0.999)
+	h := int(2 * (absf(s) * hw + absf(c) * hh) + 0.999)
+	mut out := new_collision_mask(w, h)
+	// Map each output pixel center back into the source.
+	for y in 0 .. h {
+		py := f32(y) + 0.5 - f32(h) / 2
+		for x in 0 .. w {
+			px := f32(x) + 0.5 - f32(w) / 2
+			sx := (px * c + py * s) / scale + f32(m.width) / 2
+			sy := (-px * s + py * c) / scale + f32(m.height) / 2
+			if sx >= 0 && sy >= 0 && m.get(int(sx), int(sy)) {
+				out.set(x, y, true)
+			}
+		}
+	}
+	return out
+}
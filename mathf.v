@@ -0,0 +1,98 @@
+module wasm96
+
+// Small f32 math helpers, so the SDK doesn't pull in the math module.
+
+// Get the absolute value of x.
+pub fn absf(x f32) f32 {
+	return if x < 0 { -x } else { x }
+}
+
+// Clamp x to [lo, hi].
+pub fn clampf(x f32, lo f32, hi f32) f32 {
+	return if x < lo {
+		lo
+	} else if x > hi {
+		hi
+	} else {
+		x
+	}
+}
+
+// Get the smaller of a and b.
+pub fn minf(a f32, b f32) f32 {
+	return if a < b { a } else { b }
+}
+
+// Get the larger of a and b.
+pub fn maxf(a f32, b f32) f32 {
+	return if a > b { a } else { b }
+}
+
+// Linearly interpolate from a to b by t.
+pub fn lerpf(a f32, b f32, t f32) f32 {
+	return a + (b - a) * t
+}
+
+// Round x towards negative infinity.
+pub fn floorf(x f32) f32 {
+	i := f32(int(x))
+	return if i > x { i - 1 } else { i }
+}
+
+// Get the square root of x (0 for x <= 0).
+pub fn sqrtf(x f32) f32 {
+	if x <= 0 {
+		return 0
+	}
+	// Start from a bit-level estimate and refine with Newton's method.
+	bits := unsafe { *(&u32(&x)) }
+	guess := u32(0x1fbd1df5) + (bits >> 1)
+	mut y := unsafe { *(&f32(&guess)) }
+	for _ in 0 .. 3 {
+		y = 0.5 * (y + x / y)
+	}
+	return y
+}
+
+// Pi as an f32.
+pub const pi = f32(3.14159265)
+
+// Get the sine of x (radians).
+pub fn sinf(x f32) f32 {
+	// Reduce to [-pi, pi], then fold into [-pi/2, pi/2].
+	mut t := x - 2 * pi * floorf((x + pi) / (2 * pi))
+	if t > pi / 2 {
+		t = pi - t
+	} else if t < -pi / 2 {
+		t = -pi - t
+	}
+	t2 := t * t
+	// Taylor series to t^9; error below 4e-6 on [-pi/2, pi/2].
+	return t * (1 - t2 / 6 * (1 - t2 / 20 * (1 - t2 / 42 * (1 - t2 / 72))))
+}
+
+// Get the cosine of x (radians).
+pub fn cosf(x f32) f32 {
+	return sinf(x + pi / 2)
+}
+
+// Get the angle of (x, y) from the positive x axis, in radians from -pi to
+// pi.
+pub fn atan2f(y f32, x f32) f32 {
+	ax := absf(x)
+	ay := absf(y)
+	if ax == 0 && ay == 0 {
+		return 0
+	}
+	// Approximate atan on [0, 1]; error below 1e-5.
+	a := minf(ax, ay) / maxf(ax, ay)
+	s := a * a
+	mut r := ((-0.0464964749 * s + 0.15931422) * s - 0.327622764) * s * a + a
+	if ay > ax {
+		r = pi / 2 - r
+	}
+	if x < 0 {
+		r = pi - r
+	}
+	return if y < 0 { -r } else { r }
+}
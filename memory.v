@@ -0,0 +1,45 @@
+module wasm96
+
+// Guest memory offset helpers.
+
+fn check_ptr_align(p usize, align int) {
+	if p % usize(align) != 0 {
+		panic('wasm96: slice at ${p} is not aligned to ${align} bytes')
+	}
+}
+
+// Get the guest memory offset of the first byte of b, for passing to raw
+// host imports. Panics if b is empty.
+pub fn ptr_of(b []u8) u32 {
+	if b.len == 0 {
+		panic('wasm96: pointer to an empty slice')
+	}
+	return u32(usize(voidptr(&b[0])))
+}
+
+// Get the guest memory offset of the first element of s, for passing to raw
+// host imports. Panics if s is empty or its elements are misaligned.
+pub fn ptr_of_slice[T](s []T) u32 {
+	if s.len == 0 {
+		panic('wasm96: pointer to an empty slice')
+	}
+	p := usize(voidptr(&s[0]))
+	check_ptr_align(p, arena_align(sizeof(T)))
+	return u32(p)
+}
+
+// Get the size in bytes of the elements of s, for passing alongside
+// ptr_of_slice to imports that take a byte length.
+pub fn byte_len_of[T](s []T) u32 {
+	return u32(s.len) * u32(sizeof(T))
+}
+
+// View len bytes of guest memory starting at offset ptr as a slice.
+// The slice aliases the memory; it is not copied.
+@[unsafe]
+pub fn bytes_at(ptr u32, len int) []u8 {
+	if len == 0 {
+		return []u8{}
+	}
+	return unsafe { voidptr(usize(ptr)).vbytes(len) }
+}
@@ -0,0 +1,111 @@
+module wasm96
+
+// Heap and GC monitoring.
+
+const mem_max_marks = 16
+
+// Heap statistics sampled by debug_mem_frame.
+// Values are zero when the module is built without a garbage collector.
+pub struct MemStats {
+pub:
+	heap_bytes        u64
+	live_bytes        u64
+	total_alloc_bytes u64
+	frame_alloc_bytes u64
+	gc_count          u32
+	// Duration of the last frame in which a collection was observed.
+	// The GC does not report pause times, so this is an upper bound.
+	gc_last_frame_ms u32
+}
+
+struct MemMark {
+mut:
+	label string
+	bytes u64
+}
+
+struct MemMonitor {
+mut:
+	stats           MemStats
+	frame           u64
+	frame_start_ms  u64
+	last_total      u64
+	last_since_gc   u64
+	mark_total      u64
+	marks           [mem_max_marks]MemMark
+	mark_count      int
+	spike_threshold u64
+}
+
+__global mem_monitor MemMonitor
+
+// Get the heap statistics from the last call to debug_mem_frame.
+pub fn debug_mem_stats() MemStats {
+	return mem_monitor.stats
+}
+
+// Log frames that allocate more than bytes, with a breakdown by mark.
+// 0 disables the spike detector.
+pub fn debug_mem_set_spike_threshold(bytes u64) {
+	mem_monitor.spike_threshold = bytes
+}
+
+// Attribute everything allocated since the previous mark (or the start of
+// the frame) to label. Marks are only reported for allocation spikes.
+pub fn debug_mem_mark(label string) {
+	total := u64(gc_heap_usage().total_bytes)
+	if mem_monitor.mark_count < mem_max_marks {
+		mem_monitor.marks[mem_monitor.mark_count] = MemMark{
+			label: label
+			bytes: total - mem_monitor.mark_total
+		}
+		mem_monitor.mark_count++
+	}
+	mem_monitor.mark_total = total
+}
+
+// Sample the heap and run the spike detector. Call once per frame.
+pub fn debug_mem_frame() {
+	usage := gc_heap_usage()
+	now := C.wasm96_system_millis()
+	total := u64(usage.total_bytes)
+	since_gc := u64(usage.bytes_since_gc)
+	mut gc_count := mem_monitor.stats.gc_count
+	mut gc_last_frame_ms := mem_monitor.stats.gc_last_frame_ms
+	if mem_monitor.frame > 0 && since_gc < mem_monitor.last_since_gc {
+		gc_count++
+		gc_last_frame_ms = u32(now - mem_monitor.frame_start_ms)
+	}
+	frame_alloc := if mem_monitor.frame > 0 { total - mem_monitor.last_total } else { u64(0) }
+	mem_monitor.stats = MemStats{
+		heap_bytes: u64(usage.heap_size)
+		live_bytes: u64(usage.heap_size - usage.free_bytes)
+		total_alloc_bytes: total
+		frame_alloc_bytes: frame_alloc
+		gc_count: gc_count
+		gc_last_frame_ms: gc_last_frame_ms
+	}
+	if mem_monitor.spike_threshold > 0 && frame_alloc > mem_monitor.spike_threshold {
+		mem_report_spike(frame_alloc, total)
+	}
+	mem_monitor.frame++
+	mem_monitor.frame_start_ms = now
+	mem_monitor.last_total = total
+	mem_monitor.last_since_gc = since_gc
+	mem_monitor.mark_total = total
+	mem_monitor.mark_count = 0
+}
+
+fn mem_report_spike(frame_alloc u64, total u64) {
+	system_log('alloc spike in frame ${mem_monitor.frame}: ${frame_alloc} bytes'.bytes())
+	for i in 0 .. mem_monitor.mark_count {
+		mark := mem_monitor.marks[i]
+		if mark.bytes > 0 {
+			system_log('  ${mark.label}: ${mark.bytes} bytes'.bytes())
+		}
+	}
+	unmarked := total - mem_monitor.mark_total
+	if mem_monitor.mark_count > 0 && unmarked > 0 {
+		system_log('  (after last mark): ${unmarked} bytes'.bytes())
+	}
+}
@@ -0,0 +1,109 @@
+module wasm96
+
+// Generic guest/host message channel.
+//
+// Messages are arbitrary byte payloads tagged with a channel number, passed
+// whole in either direction: netplay packets, debugger commands, data for a
+// companion app. Hosts and guests agree on what each channel means, so new
+// uses need no new ABI entries.
+//
+// wasm96_msg_recv copies the next message and its channel out and returns
+// its length, or -1 when the queue is empty. A message larger than the
+// buffer is left queued and its length returned, so the buffer can grow and
+// the call be retried.
+
+// A message received from the host.
+pub struct Message {
+pub:
+	channel u32
+	data    []u8
+}
+
+// A function handling messages on one channel.
+pub type MessageFn = fn (data []u8)
+
+struct MessageRoute {
+	channel u32
+	handler MessageFn = unsafe { nil }
+}
+
+struct MessageState {
+mut:
+	buf    []u8 = []u8{len: 256}
+	routes []MessageRoute
+}
+
+__global messages MessageState
+
+// Send data to the host on channel. Returns false if the host has no
+// message channel or rejected the message.
+pub fn msg_send(channel u32, data []u8) bool {
+	if !compat_require(.messages) {
+		return false
+	}
+	ptr := if data.len > 0 { &data[0] } else { unsafe { nil } }
+	return record_status(C.wasm96_msg_send(channel, ptr, usize(data.len)))
+}
+
+// Take the next message from the host, or none if there are no more. The
+// message's data is its own copy.
+pub fn msg_recv() ?Message {
+	if !compat_require(.messages) {
+		return none
+	}
+	for {
+		mut channel := u32(0)
+		n := C.wasm96_msg_recv(&channel, &messages.buf[0], usize(messages.buf.len))
+		if n < 0 {
+			return none
+		}
+		if n > messages.buf.len {
+			messages.buf = []u8{len: n}
+			continue
+		}
+		return Message{
+			channel: channel
+			data: messages.buf[..n].clone()
+		}
+	}
+	return none
+}
+
+// Call handler for every message received on channel (see msg_dispatch).
+// A channel has at most one handler; registering again replaces it.
+pub fn msg_on(channel u32, handler MessageFn) {
+	for mut r in messages.routes {
+		if r.channel == channel {
+			r.handler = handler
+			return
+		}
+	}
+	messages.routes << MessageRoute{
+		channel: channel
+		handler: handler
+	}
+}
+
+// Stop handling messages on channel.
+pub fn msg_off(channel u32) {
+	for i, r in messages.routes {
+		if r.channel == channel {
+			messages.routes.delete(i)
+			return
+		}
+	}
+}
+
+// Drain the host's queue, passing each message to its channel's handler.
+// Messages on channels without one are dropped. Call once per frame.
+pub fn msg_dispatch() {
+	for {
+		m := msg_recv() or { return }
+		for r in messages.routes {
+			if r.channel == m.channel {
+				r.handler(m.data)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,176 @@
+module wasm96
+
+// MIDI input.
+//
+// Where the frontend has a MIDI-in device, wasm96_input_midi_read copies
+// out the raw MIDI bytes received since the last call and returns how many
+// it wrote. midi_poll parses them (running status included, system messages
+// skipped) into a per-frame event queue and tracks which notes are held and
+// the latest value of every controller.
+
+// Kinds of channel message.
+pub enum MidiEventKind {
+	note_off
+	note_on
+	poly_aftertouch
+	control_change
+	program_change
+	channel_aftertouch
+	pitch_bend
+}
+
+// A channel message received from a MIDI device.
+pub struct MidiEvent {
+pub:
+	kind    MidiEventKind
+	channel u8
+	// Note, controller or program number.
+	data1 u8
+	// Velocity, pressure or controller value.
+	data2 u8
+	// Pitch bend from -8192 to 8191, for pitch_bend.
+	bend int
+}
+
+struct MidiState {
+mut:
+	buf         []u8 = []u8{len: 256}
+	status      u8
+	data        [2]u8
+	have        int
+	in_sysex    bool
+	events      []MidiEvent
+	notes       [2048]bool
+	controllers [2048]u8
+}
+
+__global midi MidiState
+
+// Read and parse everything the MIDI device sent since the last poll. Call
+// once per frame before reading midi_events.
+pub fn midi_poll() {
+	midi.events.clear()
+	if !compat_require(.midi) {
+		return
+	}
+	for {
+		n := int(C.wasm96_input_midi_read(&midi.buf[0], usize(midi.buf.len)))
+		for i in 0 .. n {
+			midi_byte(midi.buf[i])
+		}
+		if n < midi.buf.len {
+			break
+		}
+	}
+}
+
+fn midi_byte(b u8) {
+	if b >= 0xf8 {
+		// Real-time messages (clock, start, stop, ...) may appear anywhere.
+		return
+	}
+	if b >= 0xf0 {
+		// System common messages cancel running status.
+		midi.in_sysex = b == 0xf0
+		midi.status = 0
+		return
+	}
+	if b >= 0x80 {
+		midi.in_sysex = false
+		midi.status = b
+		midi.have = 0
+		return
+	}
+	if midi.in_sysex || midi.status == 0 {
+		return
+	}
+	midi.data[midi.have] = b
+	midi.have++
+	kind := midi.status >> 4
+	need := if kind == 0xc || kind == 0xd { 1 } else { 2 }
+	if midi.have < need {
+		return
+	}
+	midi.have = 0
+	midi_message(midi.status, midi.data[0], if need == 2 { midi.data[1] } else { u8(0) })
+}
+
+fn midi_message(status u8, d1 u8, d2 u8) {
+	ch := status & 0x0f
+	mut kind := match status >> 4 {
+		0x8 { MidiEventKind.note_off }
+		0x9 { MidiEventKind.note_on }
+		0xa { MidiEventKind.poly_aftertouch }
+		0xb { MidiEventKind.control_change }
+		0xc { MidiEventKind.program_change }
+		0xd { MidiEventKind.channel_aftertouch }
+		else { MidiEventKind.pitch_bend }
+	}
+	// A note on with velocity 0 is a note off.
+	if kind == .note_on && d2 == 0 {
+		kind = .note_off
+	}
+	slot := int(ch) * 128 + int(d1)
+	match kind {
+		.note_on { midi.notes[slot] = true }
+		.note_off { midi.notes[slot] = false }
+		.control_change { midi.controllers[slot] = d2 }
+		else {}
+	}
+	midi.events << MidiEvent{
+		kind: kind
+		channel: ch
+		data1: d1
+		data2: d2
+		bend: if kind == .pitch_bend { (int(d2) << 7 | int(d1)) - 8192 } else { 0 }
+	}
+}
+
+// Get the MIDI events parsed by the last midi_poll.
+pub fn midi_events() []MidiEvent {
+	return midi.events
+}
+
+// Returns true if note (0 to 127) is held on channel (0 to 15), or on any
+// channel if channel is negative.
+pub fn midi_note_down(channel int, note int) bool {
+	if note < 0 || note > 127 || channel > 15 {
+		return false
+	}
+	if channel >= 0 {
+		return midi.notes[channel * 128 + note]
+	}
+	for ch in 0 .. 16 {
+		if midi.notes[ch * 128 + note] {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the latest value (0 to 127) of controller on channel.
+pub fn midi_controller(channel int, controller int) u8 {
+	if channel < 0 || channel > 15 || controller < 0 || controller > 127 {
+		return 0
+	}
+	return midi.controllers[channel * 128 + controller]
+}
+
+// Convert a MIDI note number to a frequency in Hz (69 is A4, 440 Hz).
+pub fn midi_note_hz(note int) f32 {
+	// 2^(1/12), applied octave by octave then semitone by semitone.
+	mut hz := f32(440)
+	mut n := note - 69
+	for n >= 12 {
+		hz *= 2
+		n -= 12
+	}
+	for n < 0 {
+		hz /= 2
+		n += 12
+	}
+	for _ in 0 .. n {
+		hz *= 1.0594631
+	}
+	return hz
+}
@@ -0,0 +1,219 @@
+module wasm96
+
+// Minimaps.
+//
+// A Minimap shrinks one tile layer into an offscreen surface, a block of
+// cell x cell tiles per pixel, hiding tiles the player hasn't explored yet
+// under fog. Rows are redrawn only when they change (a tile edit or newly
+// revealed fog) and at most rows_per_frame of them each update, so even a
+// large map never costs more than a few rows a frame. Entity markers are
+// drawn on top when presenting, since they move every frame.
+
+// An entity shown on the minimap.
+pub struct MinimapMarker {
+pub:
+	// Position in world pixels.
+	x     int
+	y     int
+	color Color
+	// Marker size in minimap pixels.
+	size int = 2
+}
+
+// A downsampled view of a tile layer.
+pub struct Minimap {
+pub mut:
+	layer int
+	// Tiles per minimap pixel, on each axis.
+	cell int = 1
+	// Rows redrawn per update at most.
+	rows_per_frame int = 8
+	// Colors of solid and empty cells, and of unexplored ones.
+	wall_color  Color = Color{200, 200, 210, 255}
+	floor_color Color = Color{40, 40, 60, 255}
+	fog_color   Color = Color{0, 0, 0, 255}
+	// Color for a non-empty tile; wall_color for all of them if nil.
+	tile_color fn (tile u32) Color = unsafe { nil }
+	// Hide unexplored tiles.
+	use_fog bool = true
+mut:
+	surf     Surface
+	explored []bool
+	dirty    []bool
+	pending  int
+	cursor   int
+	map_w    int
+	map_h    int
+	tile_w   int
+	tile_h   int
+}
+
+// Create a minimap of a layer of m, with cell x cell tiles per pixel.
+pub fn new_minimap(m &Tilemap, layer int, cell int) Minimap {
+	c := max_int(1, cell)
+	w := (m.width + c - 1) / c
+	h := (m.height + c - 1) / c
+	mut mm := Minimap{
+		layer: layer
+		cell: c
+		surf: new_surface(w, h)
+		explored: []bool{len: m.width * m.height}
+		dirty: []bool{len: h, init: true}
+		pending: h
+		map_w: m.width
+		map_h: m.height
+		tile_w: m.tile_width
+		tile_h: m.tile_height
+	}
+	mm.surf.clear(mm.fog_color)
+	return mm
+}
+
+// Get the minimap's size in pixels.
+pub fn (mm &Minimap) size() (int, int) {
+	return mm.surf.width, mm.surf.height
+}
+
+// Get the minimap image, as last refreshed.
+pub fn (mm &Minimap) surface() &Surface {
+	return &mm.surf
+}
+
+fn (mut mm Minimap) mark_row(row int) {
+	if row >= 0 && row < mm.dirty.len && !mm.dirty[row] {
+		mm.dirty[row] = true
+		mm.pending++
+	}
+}
+
+// Schedule the whole minimap for redrawing, e.g. after loading a level.
+pub fn (mut mm Minimap) invalidate() {
+	for row in 0 .. mm.dirty.len {
+		mm.mark_row(row)
+	}
+}
+
+// Schedule the pixel covering tile (tx, ty) for redrawing. Call after
+// changing a tile.
+pub fn (mut mm Minimap) invalidate_tile(tx int, ty int) {
+	mm.mark_row(ty / mm.cell)
+}
+
+// Mark the tiles within radius tiles of (tx, ty) explored.
+pub fn (mut mm Minimap) reveal(tx int, ty int, radius int) {
+	for y in max_int(0, ty - radius) .. min_int(mm.map_h, ty + radius + 1) {
+		mut changed := false
+		for x in max_int(0, tx - radius) .. min_int(mm.map_w, tx + radius + 1) {
+			dx := x - tx
+			dy := y - ty
+			i := y * mm.map_w + x
+			if dx * dx + dy * dy <= radius * radius && !mm.explored[i] {
+				mm.explored[i] = true
+				changed = true
+			}
+		}
+		if changed {
+			mm.mark_row(y / mm.cell)
+		}
+	}
+}
+
+// Mark every tile explored or unexplored.
+pub fn (mut mm Minimap) reveal_all(explored bool) {
+	for i in 0 .. mm.explored.len {
+		mm.explored[i] = explored
+	}
+	mm.invalidate()
+}
+
+// Returns true if tile (tx, ty) has been explored.
+pub fn (mm &Minimap) is_explored(tx int, ty int) bool {
+	if tx < 0 || ty < 0 || tx >= mm.map_w || ty >= mm.map_h {
+		return false
+	}
+	return mm.explored[ty * mm.map_w + tx]
+}
+
+// Redraw up to rows_per_frame changed rows from m. Call once per frame.
+// Returns true if anything was redrawn.
+pub fn (mut mm Minimap) update(m &Tilemap) bool {
+	if mm.pending == 0 || mm.layer < 0 || mm.layer >= m.layers.len {
+		return false
+	}
+	layer := &m.layers[mm.layer]
+	mut budget := max_int(1, mm.rows_per_frame)
+	mut scanned := 0
+	// Walk rows round-robin from where the last update stopped.
+	for budget > 0 && mm.pending > 0 && scanned < mm.dirty.len {
+		row := mm.cursor
+		mm.cursor = (mm.cursor + 1) % mm.dirty.len
+		scanned++
+		if !mm.dirty[row] {
+			continue
+		}
+		mm.dirty[row] = false
+		mm.pending--
+		budget--
+		for col in 0 .. mm.surf.width {
+			mm.surf.set(col, row, mm.cell_color(layer, col, row))
+		}
+	}
+	return true
+}
+
+// Get the color of the minimap pixel covering a cell x cell block. Any
+// explored non-empty tile wins, so thin walls stay visible.
+fn (mm &Minimap) cell_color(layer &TileLayer, col int, row int) Color {
+	mut seen := !mm.use_fog
+	for ty in row * mm.cell .. min_int((row + 1) * mm.cell, mm.map_h) {
+		for tx in col * mm.cell .. min_int((col + 1) * mm.cell, mm.map_w) {
+			if mm.use_fog && !mm.explored[ty * mm.map_w + tx] {
+				continue
+			}
+			seen = true
+			tile := layer.get(tx, ty)
+			if tile != 0 {
+				return if mm.tile_color != unsafe { nil } {
+					mm.tile_color(tile_id(tile))
+				} else {
+					mm.wall_color
+				}
+			}
+		}
+	}
+	return if seen { mm.floor_color } else { mm.fog_color }
+}
+
+// Convert a world position in pixels to minimap pixels.
+pub fn (mm &Minimap) to_minimap(wx int, wy int) (int, int) {
+	sx := max_int(1, mm.tile_w * mm.cell)
+	sy := max_int(1, mm.tile_h * mm.cell)
+	return floor_div(wx, sx), floor_div(wy, sy)
+}
+
+// Draw the minimap on screen at (x, y) with markers on top. Markers on
+// unexplored tiles are hidden.
+pub fn (mm &Minimap) draw(x int, y int, markers []MinimapMarker) {
+	mm.surf.present(x, y)
+	for mk in markers {
+		if mm.use_fog && !mm.is_explored(floor_div(mk.x, max_int(1, mm.tile_w)), floor_div(mk.y,
+			max_int(1, mm.tile_h))) {
+			continue
+		}
+		mx, my := mm.to_minimap(mk.x, mk.y)
+		if mx < 0 || my < 0 || mx >= mm.surf.width || my >= mm.surf.height {
+			continue
+		}
+		s := max_int(1, mk.size)
+		graphics_set_color_rgba(mk.color)
+		graphics_rect(x + mx - s / 2, y + my - s / 2, u32(s), u32(s))
+	}
+}
+
+// Outline the part of the world a camera sees, given in world pixels.
+pub fn (mm &Minimap) draw_view(x int, y int, view Rect, color Color) {
+	x0, y0 := mm.to_minimap(view.x, view.y)
+	x1, y1 := mm.to_minimap(view.x + view.w, view.y + view.h)
+	graphics_set_color_rgba(color)
+	graphics_rect_outline(x + x0, y + y0, u32(max_int(1, x1 - x0)), u32(max_int(1, y1 - y0)))
+}
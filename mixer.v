@@ -0,0 +1,474 @@
+module wasm96
+
+// Software audio mixer with buses and ducking.
+//
+// A Mixer plays any number of Sounds (PCM clips, e.g. from sound_from_wav)
+// at once, each at its own gain, pan and pitch, and pushes the mix to the
+// host with audio_push_samples, keeping a few frames queued ahead. Every
+// voice plays on a bus (music, sfx and voice to start with; add more) whose
+// volume scales everything on it. A bus can duck under another: while
+// anything plays on the trigger bus, the target fades to a lower level over
+// the attack time, and back over the release time, so narration and big
+// effects cut through the music.
+//
+// With every voice busy, a new sound takes over a playing one chosen by the
+// mixer's steal policy, but only one of its own priority or lower, so a
+// footstep never cuts off a line of dialogue.
+//
+//   wasm96.audio_init(44100)
+//   mut mix := wasm96.new_mixer(44100, 16)
+//   mix.duck(wasm96.bus_music, wasm96.bus_voice, 0.3, 50, 400)
+//   mix.play_loop(song, wasm96.bus_music, 0.8, 0)
+//   // each frame:
+//   mix.update()
+
+// A PCM clip.
+pub struct Sound {
+pub:
+	rate     int
+	channels int
+	// Interleaved when stereo.
+	samples []i16
+pub mut:
+	// Higher priority sounds may take over voices from lower ones.
+	priority int
+}
+
+// Get the clip's length in frames.
+pub fn (s &Sound) frames() int {
+	return if s.channels > 0 { s.samples.len / s.channels } else { 0 }
+}
+
+// Decode an uncompressed 8 or 16-bit PCM WAV file.
+pub fn sound_from_wav(data []u8) !Sound {
+	if data.len < 12 || data[0..4].bytestr() != 'RIFF' || data[8..12].bytestr() != 'WAVE' {
+		return error('wav: not a WAV file')
+	}
+	mut rate := 0
+	mut channels := 0
+	mut bits := 0
+	mut pos := 12
+	for pos + 8 <= data.len {
+		id := data[pos..pos + 4].bytestr()
+		size := int(le_u32(data, pos + 4))
+		body := pos + 8
+		if size < 0 || body + size > data.len {
+			return error('wav: truncated chunk')
+		}
+		if id == 'fmt ' {
+			if size < 16 {
+				return error('wav: bad format chunk')
+			}
+			if le_u16(data, body) != 1 {
+				return error('wav: only PCM is supported')
+			}
+			channels = int(le_u16(data, body + 2))
+			rate = int(le_u32(data, body + 4))
+			bits = int(le_u16(data, body + 14))
+		} else if id == 'data' {
+			if channels < 1 || channels > 2 || (bits != 8 && bits != 16) {
+				return error('wav: need 8 or 16-bit mono or stereo')
+			}
+			mut samples := []i16{cap: size * 8 / bits}
+			if bits == 8 {
+				for i in 0 .. size {
+					samples << i16((int(data[body + i]) - 128) << 8)
+				}
+			} else {
+				for i := 0; i + 1 < size; i += 2 {
+					samples << i16(le_u16(data, body + i))
+				}
+			}
+			return Sound{
+				rate: rate
+				channels: channels
+				samples: samples
+			}
+		}
+		// Chunks are padded to an even size.
+		pos = body + size + (size & 1)
+	}
+	return error('wav: no data chunk')
+}
+
+// Which voice a sound takes over when all are busy. Only voices playing a
+// sound of the same or lower priority are considered.
+pub enum VoiceSteal {
+	// Drop the new sound.
+	none
+	oldest
+	quietest
+	// The voice with the lowest priority, the oldest of those on a tie.
+	lowest_priority
+}
+
+// Buses every mixer starts with.
+pub const bus_music = 0
+pub const bus_sfx = 1
+pub const bus_voice = 2
+
+// A group of voices sharing a volume.
+pub struct MixerBus {
+pub mut:
+	name   string
+	volume f32 = 1
+	muted  bool
+mut:
+	// Current ducking gain, and whether anything played on it last block.
+	duck   f32 = 1
+	active bool
+}
+
+struct MixerDuck {
+	target  int
+	trigger int
+	depth   f32
+	attack  f32
+	release f32
+}
+
+struct MixerVoice {
+mut:
+	sound   Sound
+	gen     int
+	bus     int
+	gain    f32
+	pan     f32
+	looping bool
+	// When the voice started, in sounds played.
+	order u64
+	// Position and step in 16.16 source frames.
+	pos  i64
+	step i64
+}
+
+// Mixes sounds on buses and feeds the host.
+pub struct Mixer {
+pub:
+	rate int
+pub mut:
+	// Master volume.
+	volume f32 = 1
+	// Frames kept queued ahead of the host; more rides out slow frames,
+	// less makes sounds start sooner.
+	latency int
+	buses   []MixerBus
+	steal   VoiceSteal = .lowest_priority
+mut:
+	voices SlotPool[MixerVoice]
+	ducks  []MixerDuck
+	mix    []f32
+	env    []f32
+	out    []i16
+	played u64
+}
+
+// Create a mixer at the rate passed to audio_init, playing up to
+// max_voices sounds at once.
+pub fn new_mixer(rate int, max_voices int) Mixer {
+	return Mixer{
+		rate: rate
+		latency: rate / 30
+		buses: [MixerBus{
+			name: 'music'
+		}, MixerBus{
+			name: 'sfx'
+		}, MixerBus{
+			name: 'voice'
+		}]
+		voices: new_slot_pool[MixerVoice](clamp_int(max_voices, 1, 4096))
+	}
+}
+
+// Add a bus, returning its index.
+pub fn (mut m Mixer) add_bus(name string) int {
+	m.buses << MixerBus{
+		name: name
+	}
+	return m.buses.len - 1
+}
+
+// Find a bus by name. Returns -1 if there is none.
+pub fn (m &Mixer) find_bus(name string) int {
+	for i, b in m.buses {
+		if b.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Duck the target bus to depth (0 to 1) of its volume while anything plays
+// on the trigger bus, fading down over attack_ms and back over release_ms.
+// When several ducks hit a bus at once, the deepest wins.
+pub fn (mut m Mixer) duck(target int, trigger int, depth f32, attack_ms f32, release_ms f32) {
+	if target < 0 || target >= m.buses.len || trigger < 0 || trigger >= m.buses.len {
+		return
+	}
+	m.ducks << MixerDuck{target, trigger, clampf(depth, 0, 1), attack_ms, release_ms}
+}
+
+// Voice handles pack the slot with a generation, so a handle goes stale
+// once its voice is reused.
+fn (m &Mixer) slot(handle int) int {
+	i := handle & 0xfff
+	if handle < 0 || !m.voices.is_alive(i) || m.voices.items[i].gen != handle >> 12 {
+		return -1
+	}
+	return i
+}
+
+fn (mut m Mixer) start(s Sound, bus int, gain f32, pan f32, looping bool) int {
+	if s.frames() == 0 || s.rate <= 0 || m.rate <= 0 {
+		return -1
+	}
+	i := m.free_voice(s.priority)
+	if i < 0 {
+		return -1
+	}
+	m.played++
+	mut v := m.voices.get(i)
+	v.sound = s
+	v.gen = (v.gen + 1) & 0x7ffff
+	v.bus = clamp_int(bus, 0, m.buses.len - 1)
+	v.gain = gain
+	v.pan = clampf(pan, -1, 1)
+	v.looping = looping
+	v.order = m.played
+	v.pos = 0
+	v.step = (i64(s.rate) << 16) / m.rate
+	return v.gen << 12 | i
+}
+
+// Claim an idle voice, or pick a playing one to steal for a sound of the
+// given priority.
+fn (mut m Mixer) free_voice(priority int) int {
+	i := m.voices.claim()
+	if i >= 0 || m.steal == .none {
+		return i
+	}
+	mut best := -1
+	for j in 0 .. m.voices.end() {
+		v := m.voices.items[j]
+		if !m.voices.alive[j] || v.sound.priority > priority {
+			continue
+		}
+		if best < 0 || m.steal_before(v, m.voices.items[best]) {
+			best = j
+		}
+	}
+	return best
+}
+
+// Returns true if a is a better voice to steal than b.
+fn (m &Mixer) steal_before(a MixerVoice, b MixerVoice) bool {
+	match m.steal {
+		.quietest {
+			la := m.loudness(a)
+			lb := m.loudness(b)
+			if la != lb {
+				return la < lb
+			}
+		}
+		.lowest_priority {
+			if a.sound.priority != b.sound.priority {
+				return a.sound.priority < b.sound.priority
+			}
+		}
+		else {}
+	}
+	return a.order < b.order
+}
+
+// Get how loud a voice is heard, before panning.
+fn (m &Mixer) loudness(v MixerVoice) f32 {
+	b := m.buses[v.bus]
+	return if b.muted { 0 } else { absf(v.gain) * b.volume * b.duck }
+}
+
+// Play a sound once on a bus at gain, panned from -1 (left) to 1 (right).
+// Returns a handle for the voice, or -1 if every voice is busy and none can
+// be stolen.
+pub fn (mut m Mixer) play(s Sound, bus int, gain f32, pan f32) int {
+	return m.start(s, bus, gain, pan, false)
+}
+
+// Play a sound on a loop until stopped.
+pub fn (mut m Mixer) play_loop(s Sound, bus int, gain f32, pan f32) int {
+	return m.start(s, bus, gain, pan, true)
+}
+
+// Stop a voice.
+pub fn (mut m Mixer) stop(handle int) {
+	i := m.slot(handle)
+	if i >= 0 {
+		m.voices.release(i)
+	}
+}
+
+// Stop every voice on a bus.
+pub fn (mut m Mixer) stop_bus(bus int) {
+	for i in 0 .. m.voices.end() {
+		if m.voices.alive[i] && m.voices.items[i].bus == bus {
+			m.voices.release(i)
+		}
+	}
+}
+
+// Returns true while a voice is still playing.
+pub fn (m &Mixer) is_playing(handle int) bool {
+	return m.slot(handle) >= 0
+}
+
+// Set a voice's gain.
+pub fn (mut m Mixer) set_gain(handle int, gain f32) {
+	i := m.slot(handle)
+	if i >= 0 {
+		m.voices.items[i].gain = gain
+	}
+}
+
+// Set a voice's pan, from -1 (left) to 1 (right).
+pub fn (mut m Mixer) set_pan(handle int, pan f32) {
+	i := m.slot(handle)
+	if i >= 0 {
+		m.voices.items[i].pan = clampf(pan, -1, 1)
+	}
+}
+
+// Set a voice's playback rate; 2 is an octave up.
+pub fn (mut m Mixer) set_pitch(handle int, pitch f32) {
+	i := m.slot(handle)
+	if i >= 0 && pitch > 0 {
+		v := m.voices.items[i]
+		m.voices.items[i].step = i64(f32((i64(v.sound.rate) << 16) / m.rate) * pitch)
+	}
+}
+
+// Get the number of voices playing.
+pub fn (m &Mixer) active_voices() int {
+	return m.voices.len()
+}
+
+// Get a bus's current ducking gain, 1 when not ducked.
+pub fn (m &Mixer) bus_duck(bus int) f32 {
+	return m.buses[bus].duck
+}
+
+// Mix enough audio to keep latency frames queued and push it to the host.
+// Call once per frame.
+pub fn (mut m Mixer) update() {
+	queued := int(audio_queued_frames())
+	// Cover the time until the next frame on top of the latency.
+	per_frame := int(i64(m.rate) * i64(host_usec_per_frame()) / 1000000)
+	frames := m.latency + per_frame - queued
+	if frames <= 0 {
+		return
+	}
+	out := m.render(frames)
+	audio_push_samples(out)
+}
+
+// Mix frames of stereo audio and return it, advancing every voice. The
+// buffer is reused by the next call.
+pub fn (mut m Mixer) render(frames int) []i16 {
+	if m.mix.len < frames * 2 {
+		m.mix = []f32{len: frames * 2}
+		m.out = []i16{len: frames * 2}
+	}
+	for i in 0 .. frames * 2 {
+		m.mix[i] = 0
+	}
+	m.update_ducking(frames)
+	for i in 0 .. m.voices.end() {
+		if m.voices.alive[i] {
+			m.mix_voice(i, frames)
+		}
+	}
+	for i in 0 .. frames * 2 {
+		m.out[i] = i16(clampf(m.mix[i] * m.volume, -32768, 32767))
+	}
+	return m.out[..frames * 2]
+}
+
+// Work out each bus's ducking gain for every frame of the block, in env
+// (buses x frames).
+fn (mut m Mixer) update_ducking(frames int) {
+	for mut b in m.buses {
+		b.active = false
+	}
+	for i in 0 .. m.voices.end() {
+		if m.voices.alive[i] {
+			m.buses[m.voices.items[i].bus].active = true
+		}
+	}
+	if m.env.len < m.buses.len * frames {
+		m.env = []f32{len: m.buses.len * frames}
+	}
+	for bi in 0 .. m.buses.len {
+		mut goal := f32(1)
+		mut attack := f32(0)
+		mut release := f32(0)
+		for d in m.ducks {
+			if d.target == bi {
+				release = maxf(release, d.release)
+				if m.buses[d.trigger].active && d.depth < goal {
+					goal = d.depth
+					attack = d.attack
+				}
+			}
+		}
+		// Move a share of the way to the goal each frame, so the whole
+		// change takes about the given time.
+		ms := if goal < m.buses[bi].duck { attack } else { release }
+		k := 1 / maxf(1, ms * f32(m.rate) / 1000)
+		mut g := m.buses[bi].duck
+		for f in 0 .. frames {
+			g += (goal - g) * k
+			m.env[bi * frames + f] = g
+		}
+		m.buses[bi].duck = g
+	}
+}
+
+fn (mut m Mixer) mix_voice(i int, frames int) {
+	mut v := m.voices.get(i)
+	b := m.buses[v.bus]
+	n := v.sound.frames()
+	if b.muted {
+		// Keep time so the voice ends or loops as if it were heard.
+		v.pos += i64(frames) * v.step
+		if v.pos >> 16 >= i64(n) {
+			if v.looping {
+				v.pos %= i64(n) << 16
+			} else {
+				m.voices.release(i)
+			}
+		}
+		return
+	}
+	// Constant-power pan.
+	gain := v.gain * b.volume
+	left := gain * sqrtf((1 - v.pan) / 2)
+	right := gain * sqrtf((1 + v.pan) / 2)
+	s := v.sound.samples
+	stereo := v.sound.channels == 2
+	env := m.env[v.bus * frames..(v.bus + 1) * frames]
+	for f in 0 .. frames {
+		mut at := int(v.pos >> 16)
+		if at >= n {
+			if !v.looping {
+				m.voices.release(i)
+				return
+			}
+			// A step can exceed a short sound, so wrap by remainder.
+			v.pos %= i64(n) << 16
+			at = int(v.pos >> 16)
+		}
+		l := if stereo { f32(s[at * 2]) } else { f32(s[at]) }
+		r := if stereo { f32(s[at * 2 + 1]) } else { l }
+		m.mix[f * 2] += l * left * env[f]
+		m.mix[f * 2 + 1] += r * right * env[f]
+		v.pos += v.step
+	}
+}
@@ -0,0 +1,378 @@
+module wasm96
+
+// Value, Perlin and simplex noise in 1, 2 and 3 dimensions.
+//
+// Every function takes an integer seed and hashes lattice points with it, so
+// the same seed and coordinates give the same result on every host. Results
+// are roughly in [-1, 1]. The _fx variants work on 16.16 fixed-point
+// coordinates and results (65536 = 1.0) for code that avoids floats.
+
+// Kinds of noise for fbm2 and fbm3.
+pub enum NoiseKind {
+	value
+	perlin
+	simplex
+}
+
+// Hash a lattice point to 32 well-mixed bits.
+pub fn noise_hash(seed u32, x int, y int, z int) u32 {
+	mut h := seed ^ (u32(x) * u32(0x27d4eb2d)) ^ (u32(y) * u32(0x165667b1)) ^ (u32(z) * u32(0x9e3779b1))
+	h = (h ^ (h >> 15)) * u32(0x85ebca6b)
+	h = (h ^ (h >> 13)) * u32(0xc2b2ae35)
+	return h ^ (h >> 16)
+}
+
+// Map a hash to [-1, 1].
+fn hash_unit(h u32) f32 {
+	return f32(h & 0xffff) / 32767.5 - 1
+}
+
+// Quintic ease 6t^5 - 15t^4 + 10t^3.
+fn fade(t f32) f32 {
+	return t * t * t * (t * (t * 6 - 15) + 10)
+}
+
+// Unit-length 2D gradients, and the 12 cube-edge gradients for 3D.
+const grad2_x = [f32(1), -1, 0, 0, 0.70710678, -0.70710678, 0.70710678, -0.70710678]
+const grad2_y = [f32(0), 0, 1, -1, 0.70710678, 0.70710678, -0.70710678, -0.70710678]
+const grad3_x = [f32(1), -1, 1, -1, 1, -1, 1, -1, 0, 0, 0, 0]
+const grad3_y = [f32(1), 1, -1, -1, 0, 0, 0, 0, 1, -1, 1, -1]
+const grad3_z = [f32(0), 0, 0, 0, 1, 1, -1, -1, 1, 1, -1, -1]
+
+fn grad1(h u32, x f32) f32 {
+	return hash_unit(h) * x
+}
+
+fn grad2(h u32, x f32, y f32) f32 {
+	i := int(h & 7)
+	return grad2_x[i] * x + grad2_y[i] * y
+}
+
+fn grad3(h u32, x f32, y f32, z f32) f32 {
+	i := int(h % 12)
+	return grad3_x[i] * x + grad3_y[i] * y + grad3_z[i] * z
+}
+
+// Get 1D value noise at x.
+pub fn value_noise1(seed u32, x f32) f32 {
+	x0 := floorf(x)
+	ix := int(x0)
+	return lerpf(hash_unit(noise_hash(seed, ix, 0, 0)), hash_unit(noise_hash(seed, ix + 1, 0,
+		0)), fade(x - x0))
+}
+
+// Get 2D value noise at (x, y).
+pub fn value_noise2(seed u32, x f32, y f32) f32 {
+	x0 := floorf(x)
+	y0 := floorf(y)
+	ix := int(x0)
+	iy := int(y0)
+	u := fade(x - x0)
+	v := fade(y - y0)
+	a := lerpf(hash_unit(noise_hash(seed, ix, iy, 0)), hash_unit(noise_hash(seed, ix + 1, iy,
+		0)), u)
+	b := lerpf(hash_unit(noise_hash(seed, ix, iy + 1, 0)), hash_unit(noise_hash(seed, ix + 1,
+		iy + 1, 0)), u)
+	return lerpf(a, b, v)
+}
+
+// Get 3D value noise at (x, y, z).
+pub fn value_noise3(seed u32, x f32, y f32, z f32) f32 {
+	x0 := floorf(x)
+	y0 := floorf(y)
+	z0 := floorf(z)
+	ix := int(x0)
+	iy := int(y0)
+	iz := int(z0)
+	u := fade(x - x0)
+	v := fade(y - y0)
+	w := fade(z - z0)
+	mut planes := [f32(0), 0]
+	for k in 0 .. 2 {
+		a := lerpf(hash_unit(noise_hash(seed, ix, iy, iz + k)), hash_unit(noise_hash(seed,
+			ix + 1, iy, iz + k)), u)
+		b := lerpf(hash_unit(noise_hash(seed, ix, iy + 1, iz + k)), hash_unit(noise_hash(seed,
+			ix + 1, iy + 1, iz + k)), u)
+		planes[k] = lerpf(a, b, v)
+	}
+	return lerpf(planes[0], planes[1], w)
+}
+
+// Get 1D Perlin (gradient) noise at x.
+pub fn perlin1(seed u32, x f32) f32 {
+	x0 := floorf(x)
+	ix := int(x0)
+	fx := x - x0
+	// Gradients in [-1, 1] give at most 0.5 either way.
+	return 2 * lerpf(grad1(noise_hash(seed, ix, 0, 0), fx), grad1(noise_hash(seed, ix + 1, 0,
+		0), fx - 1), fade(fx))
+}
+
+// Get 2D Perlin noise at (x, y).
+pub fn perlin2(seed u32, x f32, y f32) f32 {
+	x0 := floorf(x)
+	y0 := floorf(y)
+	ix := int(x0)
+	iy := int(y0)
+	fx := x - x0
+	fy := y - y0
+	u := fade(fx)
+	a := lerpf(grad2(noise_hash(seed, ix, iy, 0), fx, fy), grad2(noise_hash(seed, ix + 1, iy,
+		0), fx - 1, fy), u)
+	b := lerpf(grad2(noise_hash(seed, ix, iy + 1, 0), fx, fy - 1), grad2(noise_hash(seed,
+		ix + 1, iy + 1, 0), fx - 1, fy - 1), u)
+	// Unit gradients peak at sqrt(2) / 2.
+	return 1.41421356 * lerpf(a, b, fade(fy))
+}
+
+// Get 3D Perlin noise at (x, y, z).
+pub fn perlin3(seed u32, x f32, y f32, z f32) f32 {
+	x0 := floorf(x)
+	y0 := floorf(y)
+	z0 := floorf(z)
+	ix := int(x0)
+	iy := int(y0)
+	iz := int(z0)
+	fx := x - x0
+	fy := y - y0
+	fz := z - z0
+	u := fade(fx)
+	v := fade(fy)
+	mut planes := [f32(0), 0]
+	for k in 0 .. 2 {
+		dz := fz - f32(k)
+		a := lerpf(grad3(noise_hash(seed, ix, iy, iz + k), fx, fy, dz), grad3(noise_hash(seed,
+			ix + 1, iy, iz + k), fx - 1, fy, dz), u)
+		b := lerpf(grad3(noise_hash(seed, ix, iy + 1, iz + k), fx, fy - 1, dz), grad3(noise_hash(seed,
+			ix + 1, iy + 1, iz + k), fx - 1, fy - 1, dz), u)
+		planes[k] = lerpf(a, b, v)
+	}
+	return lerpf(planes[0], planes[1], fade(fz))
+}
+
+// Get 1D simplex noise at x.
+pub fn simplex1(seed u32, x f32) f32 {
+	x0 := floorf(x)
+	ix := int(x0)
+	d0 := x - x0
+	d1 := d0 - 1
+	mut t0 := 1 - d0 * d0
+	t0 *= t0
+	mut t1 := 1 - d1 * d1
+	t1 *= t1
+	n := t0 * t0 * grad1(noise_hash(seed, ix, 0, 0), d0) + t1 * t1 * grad1(noise_hash(seed,
+		ix + 1, 0, 0), d1)
+	return 2.4 * n
+}
+
+// Skew factors for 2D and 3D simplex grids.
+const simplex_f2 = f32(0.36602540)
+const simplex_g2 = f32(0.21132487)
+const simplex_f3 = f32(1.0 / 3.0)
+const simplex_g3 = f32(1.0 / 6.0)
+
+// Get 2D simplex noise at (x, y).
+pub fn simplex2(seed u32, x f32, y f32) f32 {
+	s := (x + y) * simplex_f2
+	i := floorf(x + s)
+	j := floorf(y + s)
+	t := (i + j) * simplex_g2
+	x0 := x - (i - t)
+	y0 := y - (j - t)
+	// Which of the two triangles in the skewed cell holds the point.
+	i1 := if x0 > y0 { 1 } else { 0 }
+	j1 := 1 - i1
+	x1 := x0 - f32(i1) + simplex_g2
+	y1 := y0 - f32(j1) + simplex_g2
+	x2 := x0 - 1 + 2 * simplex_g2
+	y2 := y0 - 1 + 2 * simplex_g2
+	ii := int(i)
+	jj := int(j)
+	mut n := f32(0)
+	n += simplex_corner2(noise_hash(seed, ii, jj, 0), x0, y0)
+	n += simplex_corner2(noise_hash(seed, ii + i1, jj + j1, 0), x1, y1)
+	n += simplex_corner2(noise_hash(seed, ii + 1, jj + 1, 0), x2, y2)
+	return 70 * n
+}
+
+fn simplex_corner2(h u32, x f32, y f32) f32 {
+	mut t := 0.5 - x * x - y * y
+	if t <= 0 {
+		return 0
+	}
+	t *= t
+	return t * t * grad3(h, x, y, 0)
+}
+
+// Get 3D simplex noise at (x, y, z).
+pub fn simplex3(seed u32, x f32, y f32, z f32) f32 {
+	s := (x + y + z) * simplex_f3
+	i := floorf(x + s)
+	j := floorf(y + s)
+	k := floorf(z + s)
+	t := (i + j + k) * simplex_g3
+	x0 := x - (i - t)
+	y0 := y - (j - t)
+	z0 := z - (k - t)
+	// Pick the two middle corners of the tetrahedron holding the point.
+	mut i1, mut j1, mut k1 := 0, 0, 0
+	mut i2, mut j2, mut k2 := 0, 0, 0
+	if x0 >= y0 {
+		if y0 >= z0 {
+			i1, i2, j2 = 1, 1, 1
+		} else if x0 >= z0 {
+			i1, i2, k2 = 1, 1, 1
+		} else {
+			k1, i2, k2 = 1, 1, 1
+		}
+	} else {
+		if y0 < z0 {
+			k1, j2, k2 = 1, 1, 1
+		} else if x0 < z0 {
+			j1, j2, k2 = 1, 1, 1
+		} else {
+			j1, i2, j2 = 1, 1, 1
+		}
+	}
+	ii := int(i)
+	jj := int(j)
+	kk := int(k)
+	mut n := f32(0)
+	n += simplex_corner3(noise_hash(seed, ii, jj, kk), x0, y0, z0)
+	n += simplex_corner3(noise_hash(seed, ii + i1, jj + j1, kk + k1), x0 - f32(i1) + simplex_g3,
+		y0 - f32(j1) + simplex_g3, z0 - f32(k1) + simplex_g3)
+	n += simplex_corner3(noise_hash(seed, ii + i2, jj + j2, kk + k2), x0 - f32(i2) +
+		2 * simplex_g3, y0 - f32(j2) + 2 * simplex_g3, z0 - f32(k2) + 2 * simplex_g3)
+	n += simplex_corner3(noise_hash(seed, ii + 1, jj + 1, kk + 1), x0 - 1 + 3 * simplex_g3,
+		y0 - 1 + 3 * simplex_g3, z0 - 1 + 3 * simplex_g3)
+	return 32 * n
+}
+
+fn simplex_corner3(h u32, x f32, y f32, z f32) f32 {
+	mut t := 0.6 - x * x - y * y - z * z
+	if t <= 0 {
+		return 0
+	}
+	t *= t
+	return t * t * grad3(h, x, y, z)
+}
+
+// Get 2D noise of the given kind.
+pub fn noise2(kind NoiseKind, seed u32, x f32, y f32) f32 {
+	return match kind {
+		.value { value_noise2(seed, x, y) }
+		.perlin { perlin2(seed, x, y) }
+		.simplex { simplex2(seed, x, y) }
+	}
+}
+
+// Get 3D noise of the given kind.
+pub fn noise3(kind NoiseKind, seed u32, x f32, y f32, z f32) f32 {
+	return match kind {
+		.value { value_noise3(seed, x, y, z) }
+		.perlin { perlin3(seed, x, y, z) }
+		.simplex { simplex3(seed, x, y, z) }
+	}
+}
+
+// Sum octaves of 2D noise, each at double the frequency of the last and gain
+// times its amplitude, normalized back to roughly [-1, 1].
+pub fn fbm2(kind NoiseKind, seed u32, x f32, y f32, octaves int, gain f32) f32 {
+	mut sum := f32(0)
+	mut amp := f32(1)
+	mut total := f32(0)
+	mut freq := f32(1)
+	for o in 0 .. octaves {
+		sum += amp * noise2(kind, seed + u32(o), x * freq, y * freq)
+		total += amp
+		amp *= gain
+		freq *= 2
+	}
+	return if total > 0 { sum / total } else { 0 }
+}
+
+// Sum octaves of 3D noise like fbm2.
+pub fn fbm3(kind NoiseKind, seed u32, x f32, y f32, z f32, octaves int, gain f32) f32 {
+	mut sum := f32(0)
+	mut amp := f32(1)
+	mut total := f32(0)
+	mut freq := f32(1)
+	for o in 0 .. octaves {
+		sum += amp * noise3(kind, seed + u32(o), x * freq, y * freq, z * freq)
+		total += amp
+		amp *= gain
+		freq *= 2
+	}
+	return if total > 0 { sum / total } else { 0 }
+}
+
+// Fixed-point versions. Coordinates and results are 16.16.
+
+fn fade_fx(t i64) i64 {
+	// t^3 * (t * (6t - 15) + 10), all in 16.16.
+	inner := ((t * ((6 * t) - (15 << 16))) >> 16) + (10 << 16)
+	t3 := (((t * t) >> 16) * t) >> 16
+	return (t3 * inner) >> 16
+}
+
+fn lerp_fx(a i64, b i64, t i64) i64 {
+	return a + (((b - a) * t) >> 16)
+}
+
+fn hash_unit_fx(h u32) i64 {
+	return i64(h & 0x1ffff) - 65536
+}
+
+// Unit 2D gradients in 16.16.
+const grad2_fx_x = [i64(65536), -65536, 0, 0, 46341, -46341, 46341, -46341]
+const grad2_fx_y = [i64(0), 0, 65536, -65536, 46341, 46341, -46341, -46341]
+
+fn grad2_fx(h u32, x i64, y i64) i64 {
+	i := int(h & 7)
+	return (grad2_fx_x[i] * x + grad2_fx_y[i] * y) >> 16
+}
+
+// Get 1D value noise at fixed-point x.
+pub fn value_noise1_fx(seed u32, x int) int {
+	ix := x >> 16
+	t := fade_fx(i64(x & 0xffff))
+	return int(lerp_fx(hash_unit_fx(noise_hash(seed, ix, 0, 0)), hash_unit_fx(noise_hash(seed,
+		ix + 1, 0, 0)), t))
+}
+
+// Get 2D value noise at fixed-point (x, y).
+pub fn value_noise2_fx(seed u32, x int, y int) int {
+	ix := x >> 16
+	iy := y >> 16
+	u := fade_fx(i64(x & 0xffff))
+	v := fade_fx(i64(y & 0xffff))
+	a := lerp_fx(hash_unit_fx(noise_hash(seed, ix, iy, 0)), hash_unit_fx(noise_hash(seed, ix + 1,
+		iy, 0)), u)
+	b := lerp_fx(hash_unit_fx(noise_hash(seed, ix, iy + 1, 0)), hash_unit_fx(noise_hash(seed,
+		ix + 1, iy + 1, 0)), u)
+	return int(lerp_fx(a, b, v))
+}
+
+// Get 1D Perlin noise at fixed-point x.
+pub fn perlin1_fx(seed u32, x int) int {
+	ix := x >> 16
+	fx := i64(x & 0xffff)
+	a := (hash_unit_fx(noise_hash(seed, ix, 0, 0)) * fx) >> 16
+	b := (hash_unit_fx(noise_hash(seed, ix + 1, 0, 0)) * (fx - 65536)) >> 16
+	return int(2 * lerp_fx(a, b, fade_fx(fx)))
+}
+
+// Get 2D Perlin noise at fixed-point (x, y).
+pub fn perlin2_fx(seed u32, x int, y int) int {
+	ix := x >> 16
+	iy := y >> 16
+	fx := i64(x & 0xffff)
+	fy := i64(y & 0xffff)
+	u := fade_fx(fx)
+	a := lerp_fx(grad2_fx(noise_hash(seed, ix, iy, 0), fx, fy), grad2_fx(noise_hash(seed, ix + 1,
+		iy, 0), fx - 65536, fy), u)
+	b := lerp_fx(grad2_fx(noise_hash(seed, ix, iy + 1, 0), fx, fy - 65536), grad2_fx(noise_hash(seed,
+		ix + 1, iy + 1, 0), fx - 65536, fy - 65536), u)
+	// Scale by sqrt(2) as in perlin2.
+	return int((lerp_fx(a, b, fade_fx(fy)) * 92682) >> 16)
+}
@@ -0,0 +1,47 @@
+module wasm96
+
+// Classic palettes.
+//
+// Ready-made palettes for a consistent retro look: give one to
+// quantize_image to convert art, or to an IndexedImage to draw with.
+//
+//   sprite := wasm96.quantize_image(art, wasm96.palette_pico8, .ordered)
+
+// Build a palette from 0xRRGGBB values, fully opaque.
+pub fn palette_from_rgb(colors []u32) []Color {
+	mut pal := []Color{cap: colors.len}
+	for c in colors {
+		pal << Color{u8(c >> 16), u8(c >> 8), u8(c), 255}
+	}
+	return pal
+}
+
+// PICO-8's 16 colors.
+pub const palette_pico8 = palette_from_rgb([u32(0x000000), 0x1d2b53, 0x7e2553, 0x008751, 0xab5236,
+	0x5f574f, 0xc2c3c7, 0xfff1e8, 0xff004d, 0xffa300, 0xffec27, 0x00e436, 0x29adff, 0x83769c,
+	0xff77a8, 0xffccaa])
+
+// The NES's 64 colors, in hardware order (0x0d, 0x0e and 0x0f and the
+// last two of each row are black).
+pub const palette_nes = palette_from_rgb([u32(0x7c7c7c), 0x0000fc, 0x0000bc, 0x4428bc, 0x940084,
+	0xa80020, 0xa81000, 0x881400, 0x503000, 0x007800, 0x006800, 0x005800, 0x004058, 0x000000,
+	0x000000, 0x000000, 0xbcbcbc, 0x0078f8, 0x0058f8, 0x6844fc, 0xd800cc, 0xe40058, 0xf83800,
+	0xe45c10, 0xac7c00, 0x00b800, 0x00a800, 0x00a844, 0x008888, 0x000000, 0x000000, 0x000000,
+	0xf8f8f8, 0x3cbcfc, 0x6888fc, 0x9878f8, 0xf878f8, 0xf85898, 0xf87858, 0xfca044, 0xf8b800,
+	0xb8f818, 0x58d854, 0x58f898, 0x00e8d8, 0x787878, 0x000000, 0x000000, 0xfcfcfc, 0xa4e4fc,
+	0xb8b8f8, 0xd8b8f8, 0xf8b8f8, 0xf8a4c0, 0xf0d0b0, 0xfce0a8, 0xf8d878, 0xd8f878, 0xb8f8b8,
+	0xb8f8d8, 0x00fcfc, 0xf8d8f8, 0x000000, 0x000000])
+
+// The original Game Boy's 4 greens, darkest first.
+pub const palette_gameboy = palette_from_rgb([u32(0x0f380f), 0x306230, 0x8bac0f, 0x9bbc0f])
+
+// DawnBringer's 32 colors.
+pub const palette_db32 = palette_from_rgb([u32(0x000000), 0x222034, 0x45283c, 0x663931, 0x8f563b,
+	0xdf7126, 0xd9a066, 0xeec39a, 0xfbf236, 0x99e550, 0x6abe30, 0x37946e, 0x4b692f, 0x524b24,
+	0x323c39, 0x3f3f74, 0x306082, 0x5b6ee1, 0x639bff, 0x5fcde4, 0xcbdbfc, 0xffffff, 0x9badb7,
+	0x847e87, 0x696a6a, 0x595652, 0x76428a, 0xac3232, 0xd95763, 0xd77bba, 0x8f974a, 0x8a6f30])
+
+// GrafxKid's Sweetie 16.
+pub const palette_sweetie16 = palette_from_rgb([u32(0x1a1c2c), 0x5d275d, 0xb13e53, 0xef7d57,
+	0xffcd75, 0xa7f070, 0x38b764, 0x257179, 0x29366f, 0x3b5dc9, 0x41a6f6, 0x73eff7, 0xf4f4f4,
+	0x94b0c2, 0x566c86, 0x333c57])
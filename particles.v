@@ -0,0 +1,160 @@
+module wasm96
+
+// Particle systems.
+//
+// A ParticleSystem keeps up to a fixed number of particles in a SlotPool and
+// moves them under gravity, wind and drag each update, freeing the slots of
+// dead ones, so nothing allocates after it is created. Particles fade out
+// over their life.
+
+// How particles are drawn.
+pub enum ParticleShape {
+	pixel
+	square
+	// A line along the particle's velocity, for rain and sparks.
+	streak
+	circle
+}
+
+// One particle.
+pub struct Particle {
+pub mut:
+	x  f32
+	y  f32
+	vx f32
+	vy f32
+	// Frames left to live, and frames lived.
+	life int
+	age  int
+	// Size in pixels (streak length is scaled by speed instead).
+	size  int = 1
+	color Color = Color{255, 255, 255, 255}
+	// Free for effects, e.g. a phase for swaying.
+	phase f32
+}
+
+// A pool of particles sharing the same forces and look.
+pub struct ParticleSystem {
+pub mut:
+	shape ParticleShape
+	// Acceleration per frame, in pixels per frame.
+	gravity_x f32
+	gravity_y f32
+	// Fraction of velocity lost each frame.
+	drag f32
+	// Fade alpha out over the last fade_frames frames of life.
+	fade_frames int = 10
+mut:
+	slots SlotPool[Particle]
+}
+
+// Create a system with room for capacity particles.
+pub fn new_particle_system(capacity int) ParticleSystem {
+	return ParticleSystem{
+		slots: new_slot_pool[Particle](capacity)
+	}
+}
+
+// Add a particle. Returns false if the system is full.
+pub fn (mut ps ParticleSystem) emit(p Particle) bool {
+	if p.life <= 0 {
+		return false
+	}
+	return ps.slots.add(p) >= 0
+}
+
+// Get the number of live particles.
+pub fn (ps &ParticleSystem) len() int {
+	return ps.slots.len()
+}
+
+// Get the most particles the system holds.
+pub fn (ps &ParticleSystem) capacity() int {
+	return ps.slots.capacity()
+}
+
+// Get one past the highest slot holding a live particle; live particles are
+// the slots below it for which is_alive is true.
+pub fn (ps &ParticleSystem) end() int {
+	return ps.slots.end()
+}
+
+// Returns true if slot i holds a live particle.
+pub fn (ps &ParticleSystem) is_alive(i int) bool {
+	return ps.slots.is_alive(i)
+}
+
+// Get the particle in slot i, to adjust it before the next update.
+pub fn (mut ps ParticleSystem) get(i int) &Particle {
+	return ps.slots.get(i)
+}
+
+// Remove every particle.
+pub fn (mut ps ParticleSystem) clear() {
+	ps.slots.clear()
+}
+
+// Move every particle a frame and remove the dead ones.
+pub fn (mut ps ParticleSystem) update() {
+	keep := 1 - ps.drag
+	for i in 0 .. ps.slots.end() {
+		if !ps.slots.alive[i] {
+			continue
+		}
+		mut p := &ps.slots.items[i]
+		p.life--
+		if p.life <= 0 {
+			ps.slots.release(i)
+			continue
+		}
+		p.age++
+		p.vx = (p.vx + ps.gravity_x) * keep
+		p.vy = (p.vy + ps.gravity_y) * keep
+		p.x += p.vx
+		p.y += p.vy
+	}
+}
+
+// Remove particles outside r, e.g. the screen plus a margin.
+pub fn (mut ps ParticleSystem) cull(r Rect) {
+	for i in 0 .. ps.slots.end() {
+		if !ps.slots.alive[i] {
+			continue
+		}
+		p := ps.slots.items[i]
+		if !r.has_point(int(p.x), int(p.y)) {
+			ps.slots.release(i)
+		}
+	}
+}
+
+// Draw every particle offset by (-cam_x, -cam_y).
+pub fn (ps &ParticleSystem) draw(cam_x int, cam_y int) {
+	for i in 0 .. ps.slots.end() {
+		if !ps.slots.alive[i] {
+			continue
+		}
+		p := ps.slots.items[i]
+		mut c := p.color
+		if ps.fade_frames > 0 && p.life < ps.fade_frames {
+			c = Color{c.r, c.g, c.b, u8(int(c.a) * p.life / ps.fade_frames)}
+		}
+		graphics_set_color_rgba(c)
+		x := int(p.x) - cam_x
+		y := int(p.y) - cam_y
+		match ps.shape {
+			.pixel {
+				graphics_rect(x, y, 1, 1)
+			}
+			.square {
+				graphics_rect(x - p.size / 2, y - p.size / 2, u32(p.size), u32(p.size))
+			}
+			.streak {
+				graphics_line(x, y, x - int(p.vx * f32(p.size)), y - int(p.vy * f32(p.size)))
+			}
+			.circle {
+				graphics_circle(x, y, u32(p.size))
+			}
+		}
+	}
+}
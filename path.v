@@ -0,0 +1,274 @@
+module wasm96
+
+// A* pathfinding over tile grids.
+//
+// A Pathfinder keeps its per-cell bookkeeping between searches and marks
+// cells with a generation counter instead of clearing them, so once it has
+// seen a grid of a given size, repathing does not allocate. Keep one per
+// grid size and share it between agents.
+
+// Orthogonal and diagonal step costs (10 and roughly 10 * sqrt 2).
+const path_step = 10
+const path_diag = 14
+
+// Searches paths on tile grids.
+pub struct Pathfinder {
+pub mut:
+	// Allow diagonal steps.
+	diagonal bool
+	// Allow diagonal steps that squeeze past a solid corner.
+	cut_corners bool
+	// Give up after expanding this many cells; 0 means no limit.
+	max_nodes int
+mut:
+	width  int
+	g      []int
+	parent []int
+	seen   []u32
+	closed []u32
+	gen    u32
+	open   IntHeap
+}
+
+// Create a pathfinder for grids of the given size.
+pub fn new_pathfinder(width int, height int) Pathfinder {
+	mut p := Pathfinder{}
+	p.resize(width, height)
+	return p
+}
+
+fn (mut p Pathfinder) resize(width int, height int) {
+	n := width * height
+	p.width = width
+	if p.g.len == n {
+		return
+	}
+	p.g = []int{len: n}
+	p.parent = []int{len: n}
+	p.seen = []u32{len: n}
+	p.closed = []u32{len: n}
+	p.gen = 0
+}
+
+fn (mut p Pathfinder) next_gen() {
+	p.gen++
+	if p.gen == 0 {
+		// Wrapped: old marks could look current again.
+		for i in 0 .. p.seen.len {
+			p.seen[i] = 0
+			p.closed[i] = 0
+		}
+		p.gen = 1
+	}
+}
+
+// A binary min-heap of (key, value) pairs that keeps its storage between
+// uses. Stale entries are skipped by the callers instead of being removed.
+struct IntHeap {
+mut:
+	keys []int
+	vals []int
+}
+
+fn (mut h IntHeap) clear() {
+	h.keys.clear()
+	h.vals.clear()
+}
+
+fn (mut h IntHeap) push(key int, val int) {
+	h.keys << key
+	h.vals << val
+	mut i := h.keys.len - 1
+	for i > 0 {
+		up := (i - 1) / 2
+		if h.keys[up] <= h.keys[i] {
+			break
+		}
+		h.keys[up], h.keys[i] = h.keys[i], h.keys[up]
+		h.vals[up], h.vals[i] = h.vals[i], h.vals[up]
+		i = up
+	}
+}
+
+// Remove the entry with the smallest key, returning its key and value.
+fn (mut h IntHeap) pop() (int, int) {
+	key := h.keys[0]
+	val := h.vals[0]
+	last := h.keys.len - 1
+	h.keys[0] = h.keys[last]
+	h.vals[0] = h.vals[last]
+	h.keys.delete_last()
+	h.vals.delete_last()
+	mut i := 0
+	for {
+		l := i * 2 + 1
+		r := l + 1
+		mut m := i
+		if l < h.keys.len && h.keys[l] < h.keys[m] {
+			m = l
+		}
+		if r < h.keys.len && h.keys[r] < h.keys[m] {
+			m = r
+		}
+		if m == i {
+			break
+		}
+		h.keys[m], h.keys[i] = h.keys[i], h.keys[m]
+		h.vals[m], h.vals[i] = h.vals[i], h.vals[m]
+		i = m
+	}
+	return key, val
+}
+
+fn (p &Pathfinder) heuristic(x int, y int, gx int, gy int) int {
+	dx := iabs(x - gx)
+	dy := iabs(y - gy)
+	if !p.diagonal {
+		return (dx + dy) * path_step
+	}
+	return path_step * (dx + dy) + (path_diag - 2 * path_step) * min_int(dx, dy)
+}
+
+// Find a path from (sx, sy) to (gx, gy) on grid, writing the cells from start
+// to goal inclusive into out. weights gives the cost of entering each cell
+// (row-major, 0 counts as 1); pass an empty array for a uniform grid. Returns
+// false if the goal can't be reached.
+pub fn (mut p Pathfinder) find(grid &TileCollision, weights []u8, sx int, sy int, gx int, gy int, mut out []Point) bool {
+	out.clear()
+	if sx < 0 || sy < 0 || gx < 0 || gy < 0 || sx >= grid.width || sy >= grid.height
+		|| gx >= grid.width || gy >= grid.height || grid.is_solid(sx, sy) || grid.is_solid(gx, gy) {
+		return false
+	}
+	p.resize(grid.width, grid.height)
+	p.next_gen()
+	p.open.clear()
+	start := sy * p.width + sx
+	goal := gy * p.width + gx
+	p.g[start] = 0
+	p.parent[start] = -1
+	p.seen[start] = p.gen
+	p.open.push(p.heuristic(sx, sy, gx, gy), start)
+	mut expanded := 0
+	for p.open.keys.len > 0 {
+		_, node := p.open.pop()
+		if p.closed[node] == p.gen {
+			continue
+		}
+		if node == goal {
+			p.trace(goal, mut out)
+			return true
+		}
+		p.closed[node] = p.gen
+		expanded++
+		if p.max_nodes > 0 && expanded >= p.max_nodes {
+			return false
+		}
+		x := node % p.width
+		y := node / p.width
+		dirs := if p.diagonal { 8 } else { 4 }
+		for d in 0 .. dirs {
+			nx := x + path_dx[d]
+			ny := y + path_dy[d]
+			if nx < 0 || ny < 0 || nx >= grid.width || ny >= grid.height || grid.is_solid(nx, ny) {
+				continue
+			}
+			diag := d >= 4
+			if diag {
+				blocked_x := grid.is_solid(nx, y)
+				blocked_y := grid.is_solid(x, ny)
+				if (blocked_x && blocked_y) || (!p.cut_corners && (blocked_x || blocked_y)) {
+					continue
+				}
+			}
+			next := ny * p.width + nx
+			if p.closed[next] == p.gen {
+				continue
+			}
+			w := if weights.len > next && weights[next] > 0 { int(weights[next]) } else { 1 }
+			step := if diag { path_diag } else { path_step }
+			g := p.g[node] + w * step
+			if p.seen[next] == p.gen && g >= p.g[next] {
+				continue
+			}
+			p.seen[next] = p.gen
+			p.g[next] = g
+			p.parent[next] = node
+			p.open.push(g + p.heuristic(nx, ny, gx, gy), next)
+		}
+	}
+	return false
+}
+
+const path_dx = [1, -1, 0, 0, 1, 1, -1, -1]
+const path_dy = [0, 0, 1, -1, 1, -1, 1, -1]
+
+// Write the path ending at node into out, start first.
+fn (p &Pathfinder) trace(node int, mut out []Point) {
+	mut n := node
+	for n >= 0 {
+		out << Point{n % p.width, n / p.width}
+		n = p.parent[n]
+	}
+	for i in 0 .. out.len / 2 {
+		j := out.len - 1 - i
+		out[i], out[j] = out[j], out[i]
+	}
+}
+
+// Get the cost of the last path found, in units of 10 per orthogonal step.
+pub fn (p &Pathfinder) cost(goal Point) int {
+	return p.g[goal.y * p.width + goal.x]
+}
+
+// Returns true if a straight line between two cells crosses no solid cell.
+pub fn (c &TileCollision) line_of_sight(x0 int, y0 int, x1 int, y1 int) bool {
+	dx := iabs(x1 - x0)
+	dy := -iabs(y1 - y0)
+	step_x := if x0 < x1 { 1 } else { -1 }
+	step_y := if y0 < y1 { 1 } else { -1 }
+	mut err := dx + dy
+	mut x := x0
+	mut y := y0
+	for {
+		if c.is_solid(x, y) {
+			return false
+		}
+		if x == x1 && y == y1 {
+			return true
+		}
+		e2 := 2 * err
+		// Moving diagonally must not slip between two solid cells.
+		if e2 >= dy && e2 <= dx && c.is_solid(x + step_x, y) && c.is_solid(x, y + step_y) {
+			return false
+		}
+		if e2 >= dy {
+			err += dy
+			x += step_x
+		}
+		if e2 <= dx {
+			err += dx
+			y += step_y
+		}
+	}
+	return false
+}
+
+// Remove waypoints that can be skipped with a clear straight line, in place.
+// Best suited to uniform grids, since it ignores cell weights.
+pub fn (c &TileCollision) smooth_path(mut path []Point) {
+	if path.len < 3 {
+		return
+	}
+	mut keep := 1
+	mut anchor := path[0]
+	for i in 1 .. path.len - 1 {
+		next := path[i + 1]
+		if !c.line_of_sight(anchor.x, anchor.y, next.x, next.y) {
+			anchor = path[i]
+			path[keep] = anchor
+			keep++
+		}
+	}
+	path[keep] = path[path.len - 1]
+	path.trim(keep + 1)
+}
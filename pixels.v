@@ -0,0 +1,113 @@
+module wasm96
+
+// Pixel routines over RGBA buffers (4 bytes per pixel, the format taken by
+// graphics_image). Building with -d wasm96_simd switches to the simd128
+// implementations in pixels_simd128.h; results are identical either way.
+// The header is C, so this needs the C backend compiled to wasm32 with
+// clang (e.g. -cc clang with a wasm32 target); under -b wasm the simd
+// functions would be left as unresolved host imports and the module would
+// fail to load.
+
+$if wasm96_simd ? {
+	#flag -msimd128
+	#include "@VMODROOT/pixels_simd128.h"
+}
+
+fn C.wasm96_simd_fill(dst &u8, len usize, rgba u32)
+fn C.wasm96_simd_blend(dst &u8, src &u8, len usize)
+fn C.wasm96_simd_swap_rb(p &u8, len usize)
+fn C.wasm96_simd_rgba_to_rgb565(dst &u16, src &u8, pixels usize)
+
+// Fill every pixel of dst with one color.
+pub fn pixels_fill(mut dst []u8, r u8, g u8, b u8, a u8) {
+	if dst.len < 4 {
+		return
+	}
+	$if wasm96_simd ? {
+		rgba := u32(r) | u32(g) << 8 | u32(b) << 16 | u32(a) << 24
+		C.wasm96_simd_fill(&dst[0], usize(dst.len), rgba)
+	} $else {
+		for i := 0; i + 4 <= dst.len; i += 4 {
+			dst[i] = r
+			dst[i + 1] = g
+			dst[i + 2] = b
+			dst[i + 3] = a
+		}
+	}
+}
+
+// Alpha-blend src over dst in place ("source over").
+// Both buffers must hold the same number of pixels.
+pub fn pixels_blend(mut dst []u8, src []u8) {
+	if dst.len != src.len {
+		panic('wasm96: pixels_blend size mismatch (${dst.len} != ${src.len})')
+	}
+	if dst.len < 4 {
+		return
+	}
+	$if wasm96_simd ? {
+		C.wasm96_simd_blend(&dst[0], &src[0], usize(dst.len))
+	} $else {
+		for i := 0; i + 4 <= dst.len; i += 4 {
+			a := u32(src[i + 3])
+			for c in 0 .. 4 {
+				f := if c == 3 { u32(255) } else { a }
+				t := u32(src[i + c]) * f + u32(dst[i + c]) * (255 - a) + 128
+				dst[i + c] = u8((t + (t >> 8)) >> 8)
+			}
+		}
+	}
+}
+
+// Swap the red and blue channels in place (RGBA <-> BGRA).
+pub fn pixels_swap_rb(mut p []u8) {
+	if p.len < 4 {
+		return
+	}
+	$if wasm96_simd ? {
+		C.wasm96_simd_swap_rb(&p[0], usize(p.len))
+	} $else {
+		for i := 0; i + 4 <= p.len; i += 4 {
+			r := p[i]
+			p[i] = p[i + 2]
+			p[i + 2] = r
+		}
+	}
+}
+
+// Convert RGBA pixels to RGB565. dst must hold src.len / 4 values.
+pub fn pixels_rgba_to_rgb565(mut dst []u16, src []u8) {
+	pixels := src.len / 4
+	if dst.len < pixels {
+		panic('wasm96: pixels_rgba_to_rgb565 needs ${pixels} values, got ${dst.len}')
+	}
+	if pixels == 0 {
+		return
+	}
+	$if wasm96_simd ? {
+		C.wasm96_simd_rgba_to_rgb565(&dst[0], &src[0], usize(pixels))
+	} $else {
+		for i in 0 .. pixels {
+			r := u16(src[i * 4] >> 3)
+			g := u16(src[i * 4 + 1] >> 2)
+			b := u16(src[i * 4 + 2] >> 3)
+			dst[i] = r << 11 | g << 5 | b
+		}
+	}
+}
+
+// Convert RGB565 pixels to opaque RGBA. dst must hold src.len * 4 bytes.
+pub fn pixels_rgb565_to_rgba(mut dst []u8, src []u16) {
+	if dst.len < src.len * 4 {
+		panic('wasm96: pixels_rgb565_to_rgba needs ${src.len * 4} bytes, got ${dst.len}')
+	}
+	for i, p in src {
+		r := u8(p >> 11) & 0x1f
+		g := u8(p >> 5) & 0x3f
+		b := u8(p) & 0x1f
+		dst[i * 4] = r << 3 | r >> 2
+		dst[i * 4 + 1] = g << 2 | g >> 4
+		dst[i * 4 + 2] = b << 3 | b >> 2
+		dst[i * 4 + 3] = 255
+	}
+}
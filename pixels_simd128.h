@@ -0,0 +1,97 @@
+// Wasm96 V SDK
+// simd128 implementations of the pixel routines in pixels.v.
+// Only included when building with -d wasm96_simd.
+#ifndef WASM96_PIXELS_SIMD128_H
+#define WASM96_PIXELS_SIMD128_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <wasm_simd128.h>
+
+static inline void wasm96_simd_fill(uint8_t *dst, size_t len, uint32_t rgba) {
+	const v128_t v = wasm_i32x4_splat((int32_t)rgba);
+	size_t i = 0;
+	for (; i + 16 <= len; i += 16) {
+		wasm_v128_store(dst + i, v);
+	}
+	for (; i + 4 <= len; i += 4) {
+		dst[i] = (uint8_t)rgba;
+		dst[i + 1] = (uint8_t)(rgba >> 8);
+		dst[i + 2] = (uint8_t)(rgba >> 16);
+		dst[i + 3] = (uint8_t)(rgba >> 24);
+	}
+}
+
+// (x + 128) / 255, exact for x in [0, 65025].
+static inline v128_t wasm96_simd_div255(v128_t x) {
+	x = wasm_i16x8_add(x, wasm_i16x8_splat(128));
+	return wasm_u16x8_shr(wasm_i16x8_add(x, wasm_u16x8_shr(x, 8)), 8);
+}
+
+static inline v128_t wasm96_simd_blend_half(v128_t s, v128_t d, v128_t a, v128_t f) {
+	const v128_t inv = wasm_i16x8_sub(wasm_i16x8_splat(255), a);
+	return wasm96_simd_div255(wasm_i16x8_add(wasm_i16x8_mul(s, f), wasm_i16x8_mul(d, inv)));
+}
+
+static inline void wasm96_simd_blend(uint8_t *dst, const uint8_t *src, size_t len) {
+	const v128_t alpha_lanes = wasm_i32x4_splat((int32_t)0xff000000u);
+	size_t i = 0;
+	for (; i + 16 <= len; i += 16) {
+		const v128_t s = wasm_v128_load(src + i);
+		const v128_t d = wasm_v128_load(dst + i);
+		const v128_t a = wasm_i8x16_shuffle(s, s, 3, 3, 3, 3, 7, 7, 7, 7, 11, 11, 11, 11, 15, 15, 15, 15);
+		// Color channels are weighted by source alpha, the alpha channel by 255.
+		const v128_t f = wasm_v128_or(a, alpha_lanes);
+		const v128_t lo = wasm96_simd_blend_half(wasm_u16x8_extend_low_u8x16(s),
+			wasm_u16x8_extend_low_u8x16(d), wasm_u16x8_extend_low_u8x16(a),
+			wasm_u16x8_extend_low_u8x16(f));
+		const v128_t hi = wasm96_simd_blend_half(wasm_u16x8_extend_high_u8x16(s),
+			wasm_u16x8_extend_high_u8x16(d), wasm_u16x8_extend_high_u8x16(a),
+			wasm_u16x8_extend_high_u8x16(f));
+		wasm_v128_store(dst + i, wasm_u8x16_narrow_i16x8(lo, hi));
+	}
+	for (; i + 4 <= len; i += 4) {
+		const uint32_t a = src[i + 3];
+		for (int c = 0; c < 4; c++) {
+			const uint32_t f = c == 3 ? 255 : a;
+			const uint32_t t = src[i + c] * f + dst[i + c] * (255 - a) + 128;
+			dst[i + c] = (uint8_t)((t + (t >> 8)) >> 8);
+		}
+	}
+}
+
+static inline void wasm96_simd_swap_rb(uint8_t *p, size_t len) {
+	size_t i = 0;
+	for (; i + 16 <= len; i += 16) {
+		const v128_t v = wasm_v128_load(p + i);
+		wasm_v128_store(p + i, wasm_i8x16_shuffle(v, v, 2, 1, 0, 3, 6, 5, 4, 7, 10, 9, 8, 11, 14, 13, 12, 15));
+	}
+	for (; i + 4 <= len; i += 4) {
+		const uint8_t r = p[i];
+		p[i] = p[i + 2];
+		p[i + 2] = r;
+	}
+}
+
+static inline v128_t wasm96_simd_pack565(v128_t v) {
+	const v128_t mask = wasm_i32x4_splat(0xff);
+	const v128_t r = wasm_u32x4_shr(wasm_v128_and(v, mask), 3);
+	const v128_t g = wasm_u32x4_shr(wasm_v128_and(wasm_u32x4_shr(v, 8), mask), 2);
+	const v128_t b = wasm_u32x4_shr(wasm_v128_and(wasm_u32x4_shr(v, 16), mask), 3);
+	return wasm_v128_or(wasm_v128_or(wasm_i32x4_shl(r, 11), wasm_i32x4_shl(g, 5)), b);
+}
+
+static inline void wasm96_simd_rgba_to_rgb565(uint16_t *dst, const uint8_t *src, size_t pixels) {
+	size_t i = 0;
+	for (; i + 8 <= pixels; i += 8) {
+		const v128_t lo = wasm96_simd_pack565(wasm_v128_load(src + i * 4));
+		const v128_t hi = wasm96_simd_pack565(wasm_v128_load(src + i * 4 + 16));
+		wasm_v128_store(dst + i, wasm_u16x8_narrow_i32x4(lo, hi));
+	}
+	for (; i < pixels; i++) {
+		const uint8_t *s = src + i * 4;
+		dst[i] = (uint16_t)(((s[0] >> 3) << 11) | ((s[1] >> 2) << 5) | (s[2] >> 3));
+	}
+}
+
+#endif
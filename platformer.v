@@ -0,0 +1,250 @@
+module wasm96
+
+// A kinematic platformer character controller over tile collision.
+//
+// The body moves in whole pixels, one axis at a time, against a solid grid
+// and an optional grid of one-way platforms (solid only from above).
+// Velocities are in pixels per frame and timers in frames, so call update
+// once per fixed update. Stepped slopes are handled by climbing and
+// descending up to max_step pixels without leaving the ground, and so are
+// true slopes from tile attributes (see tileattr.v), along with ladders,
+// ice and spikes.
+
+// Tuning parameters for a PlatformerController.
+pub struct PlatformerTuning {
+pub mut:
+	run_speed f32 = 2.0
+	// Horizontal acceleration on the ground and in the air, and deceleration
+	// when no direction is held.
+	ground_accel f32 = 0.3
+	air_accel    f32 = 0.15
+	friction     f32 = 0.4
+	gravity      f32 = 0.35
+	max_fall     f32 = 6.0
+	jump_speed   f32 = 6.0
+	// Upward speed is multiplied by this when jump is released early.
+	jump_cut f32 = 0.45
+	// Frames after walking off a ledge during which a jump still works.
+	coyote_frames int = 6
+	// Frames a jump press is remembered before landing.
+	buffer_frames int = 6
+	// Highest step or slope rise climbed (and descent followed) per pixel moved.
+	max_step int = 4
+	// Acceleration and deceleration on ice.
+	ice_accel    f32 = 0.06
+	ice_friction f32 = 0.03
+	// Speed up and down ladders.
+	climb_speed f32 = 1.5
+}
+
+// Buttons driving a PlatformerController for one frame.
+pub struct PlatformerInput {
+pub mut:
+	left  bool
+	right bool
+	// Jump is held, and was pressed this frame.
+	jump         bool
+	jump_pressed bool
+	// Climb ladders; down also drops through one-way platforms when pressed
+	// with jump.
+	up   bool
+	down bool
+}
+
+// A controlled body. (x, y) is the top-left of its w x h box.
+pub struct PlatformerController {
+pub mut:
+	tuning    PlatformerTuning
+	x         f32
+	y         f32
+	w         int
+	h         int
+	vx        f32
+	vy        f32
+	on_ground bool
+	// Holding onto a ladder.
+	climbing bool
+	// Standing on ice, and touching spikes.
+	on_ice bool
+	hurt   bool
+mut:
+	coyote   int
+	buffer   int
+	jumping  bool
+	rem_x    f32
+	rem_y    f32
+	dropping int
+}
+
+// Create a controller with a w x h body at (x, y).
+pub fn new_platformer(x f32, y f32, w int, h int, tuning PlatformerTuning) PlatformerController {
+	return PlatformerController{
+		tuning: tuning
+		x: x
+		y: y
+		w: w
+		h: h
+	}
+}
+
+// Returns true if the body would collide at (x, y). moving_down lets
+// one-way platforms block when the feet land exactly on their top.
+fn (p &PlatformerController) blocked(solid &TileCollision, one_way &TileCollision, x int, y int, moving_down bool) bool {
+	if solid.overlaps(x, y, p.w, p.h) {
+		return true
+	}
+	if !moving_down || p.dropping > 0 || one_way.width == 0 || one_way.tile_height <= 0 {
+		return false
+	}
+	feet := y + p.h - 1
+	// Only the top pixel row of a one-way cell is solid, and only from above.
+	return feet % one_way.tile_height == 0 && one_way.overlaps(x, feet, p.w, 1)
+}
+
+// Advance one frame. one_way may be an empty TileCollision{}.
+pub fn (mut p PlatformerController) update(solid &TileCollision, one_way &TileCollision, input PlatformerInput) {
+	t := p.tuning
+	x0 := int(p.x)
+	y0 := int(p.y)
+	p.on_ice = p.on_ground && solid.stands_on(x0, y0, p.w, p.h, .ice)
+	// Horizontal velocity.
+	dir := (if input.right { 1 } else { 0 }) - (if input.left { 1 } else { 0 })
+	mut accel := if p.on_ground { t.ground_accel } else { t.air_accel }
+	mut friction := t.friction
+	if p.on_ice {
+		accel = t.ice_accel
+		friction = t.ice_friction
+	}
+	if dir != 0 {
+		p.vx = clampf(p.vx + f32(dir) * accel, -t.run_speed, t.run_speed)
+	} else if p.vx > 0 {
+		p.vx = if p.vx > friction { p.vx - friction } else { 0 }
+	} else if p.vx < 0 {
+		p.vx = if p.vx < -friction { p.vx + friction } else { 0 }
+	}
+	// Grab a ladder with up or down; let go on leaving it.
+	if !solid.touches_attr(x0, y0, p.w, p.h, .ladder) {
+		p.climbing = false
+	} else if input.up || (input.down && !p.on_ground) {
+		p.climbing = true
+	}
+	// Jump timers. A ladder counts as ground for jumping off.
+	if p.on_ground || p.climbing {
+		p.coyote = t.coyote_frames
+	} else if p.coyote > 0 {
+		p.coyote--
+	}
+	if input.jump_pressed {
+		p.buffer = t.buffer_frames
+	} else if p.buffer > 0 {
+		p.buffer--
+	}
+	if p.dropping > 0 {
+		p.dropping--
+	}
+	if p.buffer > 0 && input.down && p.on_ground && !solid.overlaps(int(p.x), int(p.y) + 1, p.w,
+		p.h) {
+		// Standing on a one-way platform: fall through instead of jumping.
+		p.dropping = 4
+		p.buffer = 0
+		p.on_ground = false
+	} else if p.buffer > 0 && p.coyote > 0 {
+		p.vy = -t.jump_speed
+		p.jumping = true
+		p.climbing = false
+		p.buffer = 0
+		p.coyote = 0
+		p.on_ground = false
+	}
+	if p.jumping && !input.jump && p.vy < 0 {
+		p.vy *= t.jump_cut
+		p.jumping = false
+	}
+	// Gravity, or climbing.
+	if p.climbing {
+		p.vy = f32((if input.down { 1 } else { 0 }) - (if input.up { 1 } else { 0 })) * t.climb_speed
+	} else {
+		p.vy = if p.vy + t.gravity > t.max_fall { t.max_fall } else { p.vy + t.gravity }
+	}
+	was_on_ground := p.on_ground
+	p.move_x(solid, one_way, was_on_ground)
+	p.move_y(solid, one_way)
+	// Follow the ground down slopes and steps instead of launching off them.
+	if was_on_ground && !p.on_ground && p.vy >= 0 {
+		ix := int(p.x)
+		iy := int(p.y)
+		for d in 1 .. t.max_step + 1 {
+			if p.blocked(solid, one_way, ix, iy + d, true) {
+				p.y = f32(iy + d - 1)
+				p.on_ground = true
+				p.vy = 0
+				break
+			}
+		}
+	}
+	if p.on_ground {
+		p.jumping = false
+	}
+	// Spikes hurt on touch, from any side.
+	p.hurt = solid.touches_attr(int(p.x) - 1, int(p.y) - 1, p.w + 2, p.h + 2, .spikes)
+}
+
+fn (mut p PlatformerController) move_x(solid &TileCollision, one_way &TileCollision, grounded bool) {
+	p.rem_x += p.vx
+	mut amount := int(p.rem_x)
+	p.rem_x -= f32(amount)
+	step := if amount > 0 { 1 } else { -1 }
+	for amount != 0 {
+		ix := int(p.x)
+		iy := int(p.y)
+		if !p.blocked(solid, one_way, ix + step, iy, false) {
+			p.x += f32(step)
+			amount -= step
+			continue
+		}
+		// Climb a step or slope if there is room above it.
+		mut climbed := false
+		if grounded {
+			for up in 1 .. p.tuning.max_step + 1 {
+				if !p.blocked(solid, one_way, ix + step, iy - up, false) {
+					p.x += f32(step)
+					p.y -= f32(up)
+					amount -= step
+					climbed = true
+					break
+				}
+			}
+		}
+		if !climbed {
+			p.vx = 0
+			p.rem_x = 0
+			break
+		}
+	}
+}
+
+fn (mut p PlatformerController) move_y(solid &TileCollision, one_way &TileCollision) {
+	p.rem_y += p.vy
+	mut amount := int(p.rem_y)
+	p.rem_y -= f32(amount)
+	step := if amount > 0 { 1 } else { -1 }
+	p.on_ground = false
+	for amount != 0 {
+		if p.blocked(solid, one_way, int(p.x), int(p.y) + step, step > 0) {
+			if step > 0 {
+				p.on_ground = true
+			}
+			p.vy = 0
+			p.rem_y = 0
+			return
+		}
+		p.y += f32(step)
+		amount -= step
+	}
+	// Resting on the ground with less than a pixel of fall this frame.
+	if !p.on_ground && p.vy >= 0 && p.blocked(solid, one_way, int(p.x), int(p.y) + 1, true) {
+		p.on_ground = true
+		p.vy = 0
+		p.rem_y = 0
+	}
+}
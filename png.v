@@ -0,0 +1,167 @@
+module wasm96
+
+// PNG and APNG encoding.
+//
+// Image data is written as stored (uncompressed) deflate blocks, which keeps
+// the encoder tiny and fast; use QOI when size matters.
+
+const png_signature = [u8(0x89), `P`, `N`, `G`, `\r`, `\n`, 0x1a, `\n`]
+
+__global crc32_table []u32
+
+fn crc32_init() {
+	if crc32_table.len != 0 {
+		return
+	}
+	crc32_table = []u32{len: 256}
+	for n in 0 .. 256 {
+		mut c := u32(n)
+		for _ in 0 .. 8 {
+			c = if c & 1 != 0 { 0xedb88320 ^ (c >> 1) } else { c >> 1 }
+		}
+		crc32_table[n] = c
+	}
+}
+
+// Compute the CRC-32 (as used by PNG, zip and gzip) of data.
+pub fn crc32(data []u8) u32 {
+	crc32_init()
+	mut c := u32(0xffffffff)
+	for b in data {
+		c = crc32_table[(c ^ u32(b)) & 0xff] ^ (c >> 8)
+	}
+	return c ^ 0xffffffff
+}
+
+// Compute the Adler-32 checksum (as used by zlib) of data.
+pub fn adler32(data []u8) u32 {
+	mut a := u32(1)
+	mut b := u32(0)
+	for i, v in data {
+		a += u32(v)
+		b += a
+		// Reduce before b can overflow.
+		if i % 5552 == 5551 {
+			a %= 65521
+			b %= 65521
+		}
+	}
+	return (b % 65521) << 16 | (a % 65521)
+}
+
+fn be_put_u32(mut out []u8, v u32) {
+	out << u8(v >> 24)
+	out << u8(v >> 16)
+	out << u8(v >> 8)
+	out << u8(v)
+}
+
+// Wrap data in a zlib stream of stored deflate blocks.
+fn zlib_store(data []u8) []u8 {
+	mut out := []u8{cap: data.len + data.len / 65535 * 5 + 11}
+	out << 0x78
+	out << 0x01
+	mut pos := 0
+	for {
+		n := min_int(data.len - pos, 65535)
+		last := pos + n == data.len
+		out << u8(if last { 1 } else { 0 })
+		out << u8(n)
+		out << u8(n >> 8)
+		out << u8(~n)
+		out << u8(~n >> 8)
+		out << data[pos..pos + n]
+		pos += n
+		if last {
+			break
+		}
+	}
+	be_put_u32(mut out, adler32(data))
+	return out
+}
+
+fn png_chunk(mut out []u8, kind string, data []u8) {
+	be_put_u32(mut out, u32(data.len))
+	start := out.len
+	out << kind.bytes()
+	out << data
+	be_put_u32(mut out, crc32(out[start..]))
+}
+
+// Encode an image as an RGBA PNG.
+pub fn png_encode(img &Image) []u8 {
+	mut out := []u8{cap: img.pixels.len + img.height + 128}
+	out << png_signature
+	mut ihdr := []u8{cap: 13}
+	be_put_u32(mut ihdr, u32(img.width))
+	be_put_u32(mut ihdr, u32(img.height))
+	// 8-bit RGBA, deflate, adaptive filtering, no interlace.
+	ihdr << [u8(8), 6, 0, 0, 0]
+	png_chunk(mut out, 'IHDR', ihdr)
+	stride := img.width * 4
+	mut raw := []u8{cap: (stride + 1) * img.height}
+	for y in 0 .. img.height {
+		raw << 0
+		raw << img.pixels[y * stride..(y + 1) * stride]
+	}
+	png_chunk(mut out, 'IDAT', zlib_store(raw))
+	png_chunk(mut out, 'IEND', [])
+	return out
+}
+
+// Encode indexed frames (one palette index per pixel) as a looping APNG.
+// palette may hold up to 256 colors.
+pub fn apng_encode(width int, height int, palette []Color, frames [][]u8, delay_ms int) []u8 {
+	mut out := []u8{}
+	out << png_signature
+	mut ihdr := []u8{cap: 13}
+	be_put_u32(mut ihdr, u32(width))
+	be_put_u32(mut ihdr, u32(height))
+	// 8-bit palette, deflate, adaptive filtering, no interlace.
+	ihdr << [u8(8), 3, 0, 0, 0]
+	png_chunk(mut out, 'IHDR', ihdr)
+	mut plte := []u8{cap: palette.len * 3}
+	mut trns := []u8{cap: palette.len}
+	for c in palette {
+		plte << [c.r, c.g, c.b]
+		trns << c.a
+	}
+	png_chunk(mut out, 'PLTE', plte)
+	if trns.any(it != 255) {
+		png_chunk(mut out, 'tRNS', trns)
+	}
+	mut actl := []u8{cap: 8}
+	be_put_u32(mut actl, u32(frames.len))
+	be_put_u32(mut actl, 0)
+	png_chunk(mut out, 'acTL', actl)
+	mut seq := u32(0)
+	for i, frame in frames {
+		mut fctl := []u8{cap: 26}
+		be_put_u32(mut fctl, seq)
+		seq++
+		be_put_u32(mut fctl, u32(width))
+		be_put_u32(mut fctl, u32(height))
+		be_put_u32(mut fctl, 0)
+		be_put_u32(mut fctl, 0)
+		// Delay as a fraction of a second: delay_ms / 1000.
+		fctl << [u8(delay_ms >> 8), u8(delay_ms), u8(1000 >> 8), u8(1000 & 0xff), 0, 0]
+		png_chunk(mut out, 'fcTL', fctl)
+		mut raw := []u8{cap: (width + 1) * height}
+		for y in 0 .. height {
+			raw << 0
+			raw << frame[y * width..(y + 1) * width]
+		}
+		data := zlib_store(raw)
+		if i == 0 {
+			png_chunk(mut out, 'IDAT', data)
+		} else {
+			mut fdat := []u8{cap: data.len + 4}
+			be_put_u32(mut fdat, seq)
+			seq++
+			fdat << data
+			png_chunk(mut out, 'fdAT', fdat)
+		}
+	}
+	png_chunk(mut out, 'IEND', [])
+	return out
+}
@@ -0,0 +1,144 @@
+module wasm96
+
+// Polygon rasterization.
+//
+// Polygons are filled with an active-edge scanline walk using the even-odd
+// rule, sampling at pixel centers, so convex, concave and self-intersecting
+// shapes all work and adjacent polygons sharing an edge don't overlap.
+
+// A point in pixels.
+pub struct Point {
+pub mut:
+	x int
+	y int
+}
+
+struct PolyEdge {
+	y_max f32
+mut:
+	x    f32
+	dxdy f32
+}
+
+struct PolyRaster {
+mut:
+	edges  []PolyEdge
+	starts []f32
+	active []PolyEdge
+	xs     []f32
+	// Output spans as y, x0, x1 triples (x1 exclusive).
+	spans []int
+}
+
+__global poly_raster PolyRaster
+
+// Compute the spans of a polygon clipped to [cx0, cx1) x [cy0, cy1).
+fn (mut r PolyRaster) rasterize(points []Point, cx0 int, cy0 int, cx1 int, cy1 int) {
+	r.spans.clear()
+	r.edges.clear()
+	r.starts.clear()
+	r.active.clear()
+	if points.len < 3 {
+		return
+	}
+	mut min_y := points[0].y
+	mut max_y := points[0].y
+	for i, a in points {
+		b := points[(i + 1) % points.len]
+		min_y = min_int(min_y, a.y)
+		max_y = max_int(max_y, a.y)
+		if a.y == b.y {
+			continue
+		}
+		top := if a.y < b.y { a } else { b }
+		bottom := if a.y < b.y { b } else { a }
+		r.edges << PolyEdge{
+			y_max: f32(bottom.y)
+			x: f32(top.x)
+			dxdy: f32(bottom.x - top.x) / f32(bottom.y - top.y)
+		}
+		r.starts << f32(top.y)
+	}
+	// Sort edges by their top so they can be activated in order.
+	for i in 1 .. r.edges.len {
+		mut j := i
+		for j > 0 && r.starts[j - 1] > r.starts[j] {
+			r.edges[j - 1], r.edges[j] = r.edges[j], r.edges[j - 1]
+			r.starts[j - 1], r.starts[j] = r.starts[j], r.starts[j - 1]
+			j--
+		}
+	}
+	mut next := 0
+	for y in max_int(min_y, cy0) .. min_int(max_y, cy1) {
+		yc := f32(y) + 0.5
+		for next < r.edges.len && r.starts[next] <= yc {
+			mut e := r.edges[next]
+			// Move the edge's x from its top down to this scanline.
+			e.x += (yc - r.starts[next]) * e.dxdy
+			if e.y_max > yc {
+				r.active << e
+			}
+			next++
+		}
+		r.xs.clear()
+		mut k := 0
+		for k < r.active.len {
+			if r.active[k].y_max <= yc {
+				r.active.delete(k)
+				continue
+			}
+			r.xs << r.active[k].x
+			k++
+		}
+		for i in 1 .. r.xs.len {
+			mut j := i
+			for j > 0 && r.xs[j - 1] > r.xs[j] {
+				r.xs[j - 1], r.xs[j] = r.xs[j], r.xs[j - 1]
+				j--
+			}
+		}
+		for i := 0; i + 1 < r.xs.len; i += 2 {
+			// Cover pixels whose centers lie inside [xs[i], xs[i + 1]).
+			x0 := max_int(int(floorf(r.xs[i] + 0.5)), cx0)
+			x1 := min_int(int(floorf(r.xs[i + 1] + 0.5)), cx1)
+			if x0 < x1 {
+				r.spans << y
+				r.spans << x0
+				r.spans << x1
+			}
+		}
+		for mut e in r.active {
+			e.x += e.dxdy
+		}
+	}
+}
+
+// Fill a polygon on screen with the current color.
+pub fn graphics_fill_polygon(points []Point) {
+	poly_raster.rasterize(points, 0, 0, int(screen_width), int(screen_height))
+	s := poly_raster.spans
+	for i := 0; i < s.len; i += 3 {
+		graphics_rect(s[i + 1], s[i], u32(s[i + 2] - s[i + 1]), 1)
+	}
+}
+
+// Fill a polygon on screen with color.
+pub fn graphics_fill_polygon_color(points []Point, color Color) {
+	graphics_set_color_rgba(color)
+	graphics_fill_polygon(points)
+}
+
+// Fill a polygon in the image, blending color over what's there.
+pub fn (mut img Image) fill_polygon(points []Point, color Color) {
+	poly_raster.rasterize(points, 0, 0, img.width, img.height)
+	s := poly_raster.spans
+	for i := 0; i < s.len; i += 3 {
+		if color.a == 255 {
+			img.fill_rect(s[i + 1], s[i], s[i + 2] - s[i + 1], 1, color)
+			continue
+		}
+		for x in s[i + 1] .. s[i + 2] {
+			img.blend(x, s[i], color)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+module wasm96
+
+// Generic object pools.
+//
+// A Pool hands out heap values by reference, for objects that live on their
+// own, like behavior tree agents. A SlotPool keeps its values in place in one
+// array and hands out slot indices, for systems that sweep many small values
+// every frame: particles, bullets and mixer voices are built on it. Slots
+// are reused from a free list and live slots stay below end, so a sweep
+// over 0 .. end skips the unused tail.
+
+// A free list of reusable values. Once the pool has grown to its working set,
+// get and put no longer allocate.
+pub struct Pool[T] {
+mut:
+	free []&T
+pub mut:
+	// Called on every value returned to the pool, before it can be reused.
+	on_put fn (mut item T) = unsafe { nil }
+	// Number of values the pool has allocated in total.
+	allocated int
+}
+
+// Create a pool with capacity values allocated up front.
+pub fn new_pool[T](capacity int) Pool[T] {
+	mut p := Pool[T]{
+		free: []&T{cap: capacity}
+	}
+	p.reserve(capacity)
+	return p
+}
+
+// Allocate values until at least n are free.
+pub fn (mut p Pool[T]) reserve(n int) {
+	for p.free.len < n {
+		p.free << &T{}
+		p.allocated++
+	}
+}
+
+// Take a value from the pool, allocating a new one if the pool is empty.
+pub fn (mut p Pool[T]) get() &T {
+	if p.free.len > 0 {
+		return p.free.pop()
+	}
+	p.allocated++
+	return &T{}
+}
+
+// Return a value to the pool.
+pub fn (mut p Pool[T]) put(mut item T) {
+	if p.on_put != unsafe { nil } {
+		p.on_put(mut item)
+	}
+	p.free << &item
+}
+
+// Get the number of values waiting in the pool.
+pub fn (p &Pool[T]) available() int {
+	return p.free.len
+}
+
+// A fixed number of values stored in place, each slot either live or free.
+pub struct SlotPool[T] {
+mut:
+	items []T
+	alive []bool
+	free  []int
+	top   int
+	count int
+}
+
+// Create a slot pool with capacity slots, all free.
+pub fn new_slot_pool[T](capacity int) SlotPool[T] {
+	n := max_int(1, capacity)
+	mut p := SlotPool[T]{
+		items: []T{len: n}
+		alive: []bool{len: n}
+		free: []int{cap: n}
+	}
+	p.clear()
+	return p
+}
+
+// Take a free slot, mark it live and return its index, or -1 if every slot
+// is live. The slot still holds its previous value.
+pub fn (mut p SlotPool[T]) claim() int {
+	if p.free.len == 0 {
+		return -1
+	}
+	i := p.free.pop()
+	p.alive[i] = true
+	p.count++
+	p.top = max_int(p.top, i + 1)
+	return i
+}
+
+// Store item in a free slot and return its index, or -1 if every slot is
+// live.
+pub fn (mut p SlotPool[T]) add(item T) int {
+	i := p.claim()
+	if i >= 0 {
+		p.items[i] = item
+	}
+	return i
+}
+
+// Free slot i. Freeing a free slot does nothing.
+pub fn (mut p SlotPool[T]) release(i int) {
+	if !p.is_alive(i) {
+		return
+	}
+	p.alive[i] = false
+	p.free << i
+	p.count--
+	for p.top > 0 && !p.alive[p.top - 1] {
+		p.top--
+	}
+}
+
+// Returns true if slot i is live.
+pub fn (p &SlotPool[T]) is_alive(i int) bool {
+	return i >= 0 && i < p.items.len && p.alive[i]
+}
+
+// Get the value in slot i. The reference stays valid while the pool lives.
+pub fn (mut p SlotPool[T]) get(i int) &T {
+	return unsafe { &p.items[i] }
+}
+
+// Get the number of live slots.
+pub fn (p &SlotPool[T]) len() int {
+	return p.count
+}
+
+// Get the number of slots.
+pub fn (p &SlotPool[T]) capacity() int {
+	return p.items.len
+}
+
+// Get one past the highest live slot.
+pub fn (p &SlotPool[T]) end() int {
+	return p.top
+}
+
+// Free every slot.
+pub fn (mut p SlotPool[T]) clear() {
+	p.free.clear()
+	// Hand out low slots first, keeping live values packed below end.
+	for i := p.items.len - 1; i >= 0; i-- {
+		p.alive[i] = false
+		p.free << i
+	}
+	p.top = 0
+	p.count = 0
+}
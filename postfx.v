@@ -0,0 +1,93 @@
+module wasm96
+
+// Blur and bloom post effects.
+//
+// Blurs are separable running-sum box filters on integer channels, so each
+// pass costs a handful of adds per pixel whatever the radius. Three box
+// passes approximate a gaussian.
+//
+// They work on images, so run them on the scene before presenting it, e.g.
+// on a VirtualScreen's surface:
+//
+//   vscreen.bloom(200, 6, 160)
+//   vscreen.present()
+
+__global postfx_tmp []u32
+
+// Blur one line of count pixels starting at byte offset start, stepping by
+// stride bytes, with a box of 2 * radius + 1 pixels. Edges are clamped.
+fn box_blur_line(mut px []u8, start int, stride int, count int, radius int) {
+	if postfx_tmp.len < count * 4 {
+		postfx_tmp = []u32{len: count * 4}
+	}
+	window := u32(2 * radius + 1)
+	// 16.16 fixed-point reciprocal of the window size. Products are rounded,
+	// so repeated passes don't darken flat areas.
+	inv := (u32(1) << 16) / window
+	for ch in 0 .. 4 {
+		mut sum := u32(0)
+		for k in -radius .. radius + 1 {
+			sum += u32(px[start + clamp_int(k, 0, count - 1) * stride + ch])
+		}
+		for i in 0 .. count {
+			postfx_tmp[i * 4 + ch] = (sum * inv + 0x8000) >> 16
+			add := clamp_int(i + radius + 1, 0, count - 1)
+			sub := clamp_int(i - radius, 0, count - 1)
+			sum += u32(px[start + add * stride + ch])
+			sum -= u32(px[start + sub * stride + ch])
+		}
+	}
+	for i in 0 .. count {
+		for ch in 0 .. 4 {
+			px[start + i * stride + ch] = u8(postfx_tmp[i * 4 + ch])
+		}
+	}
+}
+
+// Box-blur the image with the given radius in pixels.
+pub fn (mut img Image) box_blur(radius int) {
+	if radius <= 0 || img.width == 0 || img.height == 0 {
+		return
+	}
+	for y in 0 .. img.height {
+		box_blur_line(mut img.pixels, y * img.width * 4, 4, img.width, radius)
+	}
+	for x in 0 .. img.width {
+		box_blur_line(mut img.pixels, x * 4, img.width * 4, img.height, radius)
+	}
+}
+
+// Blur the image with three box passes, approximating a gaussian with the
+// given radius.
+pub fn (mut img Image) gaussian_blur(radius int) {
+	r := max_int(1, radius / 2)
+	for _ in 0 .. 3 {
+		img.box_blur(r)
+	}
+}
+
+__global bloom_buf Image
+
+// Add a glow around bright areas: pixels brighter than threshold are
+// extracted, blurred by radius and added back scaled by intensity / 256.
+pub fn (mut img Image) bloom(threshold u8, radius int, intensity int) {
+	if bloom_buf.width != img.width || bloom_buf.height != img.height {
+		bloom_buf = new_image(img.width, img.height)
+	}
+	t := u32(threshold)
+	for i := 0; i < img.pixels.len; i += 4 {
+		for ch in 0 .. 3 {
+			v := u32(img.pixels[i + ch])
+			bloom_buf.pixels[i + ch] = if v > t { u8(v - t) } else { 0 }
+		}
+		bloom_buf.pixels[i + 3] = 255
+	}
+	bloom_buf.gaussian_blur(radius)
+	k := u32(intensity)
+	for i := 0; i < img.pixels.len; i += 4 {
+		for ch in 0 .. 3 {
+			v := u32(img.pixels[i + ch]) + ((u32(bloom_buf.pixels[i + ch]) * k) >> 8)
+			img.pixels[i + ch] = if v > 255 { 255 } else { u8(v) }
+		}
+	}
+}
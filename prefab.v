@@ -0,0 +1,213 @@
+module wasm96
+
+// Entity prefabs.
+//
+// A Prefab names an archetype: the components an entity of that kind gets
+// and default values for their settings, optionally extending another
+// prefab. Each component is attached by a builder the game registers once,
+// which reads its settings and adds the component to the game's Store:
+//
+//   mut prefabs := wasm96.PrefabRegistry{}
+//   prefabs.component('health', fn (mut w wasm96.World, e wasm96.Entity, p &wasm96.PrefabProps) {
+//       healths.set(e, Health{ hp: p.get_int('hp', 1) })
+//   })
+//   prefabs.define(wasm96.Prefab{ name: 'goblin', components: ['health', 'body'],
+//       defaults: { 'hp': '5' } })
+//   prefabs.spawn_level(mut world, project.level('Level_0')?)
+//
+// Level objects (Tiled objects or LDtk entities) spawn the prefab named by
+// their type, with their custom properties overriding the defaults. Prefabs
+// can also be loaded from JSON, so archetypes live next to level data.
+
+// Attaches a component to a freshly spawned entity.
+pub type PrefabComponentFn = fn (mut w World, e Entity, props &PrefabProps)
+
+// An entity archetype.
+pub struct Prefab {
+pub mut:
+	name string
+	// Prefab this one extends; its components and defaults come first.
+	base       string
+	components []string
+	defaults   map[string]string
+}
+
+// Settings for one spawn: the prefab's defaults overlaid with per-instance
+// values, plus where to put the entity.
+pub struct PrefabProps {
+pub mut:
+	prefab string
+	values map[string]string
+	x      f32
+	y      f32
+	width  f32
+	height f32
+}
+
+// Get a setting as a string, or def if it isn't set.
+pub fn (p &PrefabProps) get_str(name string, def string) string {
+	return p.values[name] or { def }
+}
+
+// Get a setting as an int.
+pub fn (p &PrefabProps) get_int(name string, def int) int {
+	v := p.values[name] or { return def }
+	return v.int()
+}
+
+// Get a setting as an f32.
+pub fn (p &PrefabProps) get_f32(name string, def f32) f32 {
+	v := p.values[name] or { return def }
+	return v.f32()
+}
+
+// Get a setting as a bool (true, 1 or yes).
+pub fn (p &PrefabProps) get_bool(name string, def bool) bool {
+	v := p.values[name] or { return def }
+	return v in ['true', '1', 'yes']
+}
+
+// Prefabs and component builders by name.
+pub struct PrefabRegistry {
+mut:
+	prefabs  map[string]Prefab
+	builders map[string]PrefabComponentFn
+}
+
+// Register the builder for a component name.
+pub fn (mut r PrefabRegistry) component(name string, f PrefabComponentFn) {
+	r.builders[name] = f
+}
+
+// Define a prefab, replacing any with the same name.
+pub fn (mut r PrefabRegistry) define(p Prefab) {
+	r.prefabs[p.name] = p
+}
+
+// Returns true if a prefab is defined.
+pub fn (r &PrefabRegistry) has(name string) bool {
+	return name in r.prefabs
+}
+
+// Define prefabs from a JSON object of name to definition:
+//
+//   { "enemy": { "components": ["health", "body"], "hp": 3 },
+//     "goblin": { "base": "enemy", "components": ["ai"], "hp": 5 } }
+//
+// Every key other than base and components is a default value.
+pub fn (mut r PrefabRegistry) load_json(src string) ! {
+	root := json_parse(src)!
+	if root.kind != .object {
+		return error('prefab: expected an object of prefabs')
+	}
+	for name in root.keys {
+		def := root.fields[name] or { continue }
+		if def.kind != .object {
+			return error('prefab: ${name} is not an object')
+		}
+		mut p := Prefab{
+			name: name
+			base: def.get_str('base')
+			components: def.get_arr('components').map(it.to_text())
+		}
+		for key in def.keys {
+			if key == 'base' || key == 'components' {
+				continue
+			}
+			v := def.fields[key] or { continue }
+			p.defaults[key] = v.to_text()
+		}
+		r.define(p)
+	}
+}
+
+// Gather a prefab's components and defaults, bases first.
+fn (r &PrefabRegistry) resolve(name string, mut components []string, mut values map[string]string, depth int) ! {
+	p := r.prefabs[name] or { return error('prefab: no prefab ${name}') }
+	if p.base.len > 0 {
+		if depth > 16 {
+			return error('prefab: ${name} extends itself')
+		}
+		r.resolve(p.base, mut components, mut values, depth + 1)!
+	}
+	for c in p.components {
+		if c !in components {
+			components << c
+		}
+	}
+	for k, v in p.defaults {
+		values[k] = v
+	}
+}
+
+// Spawn a prefab with its defaults overridden by overrides.
+pub fn (r &PrefabRegistry) spawn(mut w World, name string, x f32, y f32, overrides map[string]string) !Entity {
+	mut components := []string{}
+	mut values := map[string]string{}
+	r.resolve(name, mut components, mut values, 0)!
+	for k, v in overrides {
+		values[k] = v
+	}
+	for c in components {
+		if c !in r.builders {
+			return error('prefab: ${name} uses unknown component ${c}')
+		}
+	}
+	width := values['width'] or { '0' }
+	height := values['height'] or { '0' }
+	props := PrefabProps{
+		prefab: name
+		values: values
+		x: x
+		y: y
+		width: width.f32()
+		height: height.f32()
+	}
+	e := w.spawn()
+	for c in components {
+		f := r.builders[c] or { continue }
+		f(mut w, e, &props)
+	}
+	return e
+}
+
+// Spawn the prefab named by a level object's type, at its position, with
+// its properties as overrides.
+pub fn (r &PrefabRegistry) spawn_object(mut w World, obj &MapObject) !Entity {
+	mut overrides := obj.properties.clone()
+	overrides['name'] = obj.name
+	overrides['width'] = obj.width.str()
+	overrides['height'] = obj.height.str()
+	return r.spawn(mut w, obj.kind, obj.x, obj.y, overrides)!
+}
+
+// Spawn every object in a layer whose type names a prefab. Returns how many
+// were spawned.
+pub fn (r &PrefabRegistry) spawn_layer(mut w World, layer &ObjectLayer) int {
+	mut count := 0
+	for i in 0 .. layer.objects.len {
+		obj := unsafe { &layer.objects[i] }
+		if obj.kind !in r.prefabs {
+			continue
+		}
+		r.spawn_object(mut w, obj) or { continue }
+		count++
+	}
+	return count
+}
+
+// Spawn prefabs for every object layer of a Tiled map. Returns how many were
+// spawned.
+pub fn (r &PrefabRegistry) spawn_map(mut w World, m &Tilemap) int {
+	mut count := 0
+	for i in 0 .. m.object_layers.len {
+		count += r.spawn_layer(mut w, &m.object_layers[i])
+	}
+	return count
+}
+
+// Spawn prefabs for every entity of an LDtk level. Returns how many were
+// spawned.
+pub fn (r &PrefabRegistry) spawn_level(mut w World, level &LdtkLevel) int {
+	return r.spawn_map(mut w, &level.tilemap)
+}
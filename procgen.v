@@ -0,0 +1,301 @@
+module wasm96
+
+// Procedural level generators: BSP dungeons, cellular-automata caves,
+// drunkard's walks and mazes.
+//
+// Each generator draws only from the Rng it is given, so a seed always
+// produces the same level. Results are ProcGrids of solid and open cells,
+// which convert to tile layers or collision grids.
+
+// A rectangle of open cells carved by a generator.
+pub struct Room {
+pub:
+	x int
+	y int
+	w int
+	h int
+}
+
+// Get the cell at the middle of the room.
+pub fn (r Room) center() Point {
+	return Point{r.x + r.w / 2, r.y + r.h / 2}
+}
+
+// A generated grid of solid (wall) and open (floor) cells.
+pub struct ProcGrid {
+pub mut:
+	width  int
+	height int
+	solid  []bool
+	// Rooms carved by bsp_dungeon.
+	rooms []Room
+}
+
+// Create a grid of the given size with every cell solid.
+pub fn new_proc_grid(width int, height int) ProcGrid {
+	return ProcGrid{
+		width: width
+		height: height
+		solid: []bool{len: width * height, init: true}
+	}
+}
+
+// Returns true if (x, y) is solid or outside the grid.
+pub fn (g &ProcGrid) is_solid(x int, y int) bool {
+	if x < 0 || y < 0 || x >= g.width || y >= g.height {
+		return true
+	}
+	return g.solid[y * g.width + x]
+}
+
+// Set whether (x, y) is solid. Does nothing outside the grid.
+pub fn (mut g ProcGrid) set(x int, y int, solid bool) {
+	if x < 0 || y < 0 || x >= g.width || y >= g.height {
+		return
+	}
+	g.solid[y * g.width + x] = solid
+}
+
+// Open every cell of a rectangle.
+pub fn (mut g ProcGrid) carve(r Room) {
+	for y in r.y .. r.y + r.h {
+		for x in r.x .. r.x + r.w {
+			g.set(x, y, false)
+		}
+	}
+}
+
+// Open an L-shaped corridor between two cells, turning at a random corner.
+pub fn (mut g ProcGrid) carve_corridor(a Point, b Point, mut rng Rng) {
+	corner := if rng.chance(0.5) { Point{b.x, a.y} } else { Point{a.x, b.y} }
+	g.carve_line(a, corner)
+	g.carve_line(corner, b)
+}
+
+// Open a horizontal or vertical run of cells.
+fn (mut g ProcGrid) carve_line(a Point, b Point) {
+	for x in min_int(a.x, b.x) .. max_int(a.x, b.x) + 1 {
+		for y in min_int(a.y, b.y) .. max_int(a.y, b.y) + 1 {
+			g.set(x, y, false)
+		}
+	}
+}
+
+// Count the open cells.
+pub fn (g &ProcGrid) open_count() int {
+	mut n := 0
+	for s in g.solid {
+		if !s {
+			n++
+		}
+	}
+	return n
+}
+
+// Build a tile layer with floor for open cells and wall for solid ones.
+pub fn (g &ProcGrid) to_layer(name string, floor u32, wall u32) TileLayer {
+	return TileLayer{
+		name: name
+		width: g.width
+		height: g.height
+		tiles: g.solid.map(if it { wall } else { floor })
+	}
+}
+
+// Build a collision grid from the solid cells.
+pub fn (g &ProcGrid) to_collision(tile_width int, tile_height int) TileCollision {
+	return TileCollision{
+		width: g.width
+		height: g.height
+		tile_width: tile_width
+		tile_height: tile_height
+		solid: g.solid.clone()
+		solid_outside: true
+	}
+}
+
+// Fill in every open area except the largest, so all floor is connected.
+pub fn (mut g ProcGrid) keep_largest_region() {
+	mut region := []int{len: g.solid.len, init: -1}
+	mut stack := []int{}
+	mut best := -1
+	mut best_size := 0
+	mut id := 0
+	for start in 0 .. g.solid.len {
+		if g.solid[start] || region[start] >= 0 {
+			continue
+		}
+		mut size := 0
+		region[start] = id
+		stack << start
+		for stack.len > 0 {
+			cell := stack.pop()
+			size++
+			x := cell % g.width
+			y := cell / g.width
+			for d in 0 .. 4 {
+				nx := x + path_dx[d]
+				ny := y + path_dy[d]
+				if g.is_solid(nx, ny) {
+					continue
+				}
+				n := ny * g.width + nx
+				if region[n] < 0 {
+					region[n] = id
+					stack << n
+				}
+			}
+		}
+		if size > best_size {
+			best = id
+			best_size = size
+		}
+		id++
+	}
+	for i, r in region {
+		if r >= 0 && r != best {
+			g.solid[i] = true
+		}
+	}
+}
+
+// Generate rooms by recursively splitting the map (binary space
+// partitioning), placing a room in each leaf at least min_leaf cells across
+// and joining sibling rooms with corridors.
+pub fn bsp_dungeon(width int, height int, min_leaf int, mut rng Rng) ProcGrid {
+	mut g := new_proc_grid(width, height)
+	// Keep a solid border around the map.
+	g.bsp_split(1, 1, width - 2, height - 2, max_int(min_leaf, 4), mut rng)
+	return g
+}
+
+// Split a region, returning a room inside it to connect to.
+fn (mut g ProcGrid) bsp_split(x int, y int, w int, h int, min_leaf int, mut rng Rng) Room {
+	can_x := w >= 2 * min_leaf
+	can_y := h >= 2 * min_leaf
+	if !can_x && !can_y {
+		// Leaf: a room with at least one cell of wall around it.
+		rw := rng.int_range(max_int(2, (w - 2) / 2), max_int(3, w - 1))
+		rh := rng.int_range(max_int(2, (h - 2) / 2), max_int(3, h - 1))
+		rw2 := min_int(rw, w - 2)
+		rh2 := min_int(rh, h - 2)
+		room := Room{
+			x: x + 1 + rng.intn(max_int(1, w - 1 - rw2))
+			y: y + 1 + rng.intn(max_int(1, h - 1 - rh2))
+			w: rw2
+			h: rh2
+		}
+		g.carve(room)
+		g.rooms << room
+		return room
+	}
+	// Prefer splitting across the longer side.
+	split_x := if can_x && can_y { w > h || (w == h && rng.chance(0.5)) } else { can_x }
+	mut a := Room{}
+	mut b := Room{}
+	if split_x {
+		cut := rng.int_range(min_leaf, w - min_leaf + 1)
+		a = g.bsp_split(x, y, cut, h, min_leaf, mut rng)
+		b = g.bsp_split(x + cut, y, w - cut, h, min_leaf, mut rng)
+	} else {
+		cut := rng.int_range(min_leaf, h - min_leaf + 1)
+		a = g.bsp_split(x, y, w, cut, min_leaf, mut rng)
+		b = g.bsp_split(x, y + cut, w, h - cut, min_leaf, mut rng)
+	}
+	g.carve_corridor(a.center(), b.center(), mut rng)
+	return if rng.chance(0.5) { a } else { b }
+}
+
+// Generate caves with a cellular automaton: fill fill_percent of cells at
+// random, then for each of steps passes make a cell solid if 5 or more of
+// its 9-cell neighborhood are solid. Smaller disconnected caves are removed.
+pub fn cave_grid(width int, height int, fill_percent int, steps int, mut rng Rng) ProcGrid {
+	mut g := new_proc_grid(width, height)
+	for y in 1 .. height - 1 {
+		for x in 1 .. width - 1 {
+			g.solid[y * width + x] = rng.intn(100) < fill_percent
+		}
+	}
+	mut next := g.solid.clone()
+	for _ in 0 .. steps {
+		for y in 1 .. height - 1 {
+			for x in 1 .. width - 1 {
+				mut walls := 0
+				for dy in -1 .. 2 {
+					for dx in -1 .. 2 {
+						if g.solid[(y + dy) * width + x + dx] {
+							walls++
+						}
+					}
+				}
+				next[y * width + x] = walls >= 5
+			}
+		}
+		g.solid, next = next, g.solid
+	}
+	g.keep_largest_region()
+	return g
+}
+
+// Carve caves by walking randomly from the center until floor_fraction of
+// the map is open.
+pub fn drunkard_walk(width int, height int, floor_fraction f32, mut rng Rng) ProcGrid {
+	mut g := new_proc_grid(width, height)
+	target := int(f32((width - 2) * (height - 2)) * clampf(floor_fraction, 0, 1))
+	mut x := width / 2
+	mut y := height / 2
+	mut open := 0
+	// Bound the walk so an unreachable target can't hang the game.
+	mut steps := width * height * 64
+	for open < target && steps > 0 {
+		if g.is_solid(x, y) {
+			g.set(x, y, false)
+			open++
+		}
+		d := rng.intn(4)
+		x = clamp_int(x + path_dx[d], 1, width - 2)
+		y = clamp_int(y + path_dy[d], 1, height - 2)
+		steps--
+	}
+	return g
+}
+
+// Generate a perfect maze (exactly one route between any two cells) with a
+// randomized depth-first search. The maze has cols x rows passages and is
+// returned as a (2 * cols + 1) x (2 * rows + 1) grid with walls between them.
+pub fn maze_grid(cols int, rows int, mut rng Rng) ProcGrid {
+	mut g := new_proc_grid(2 * cols + 1, 2 * rows + 1)
+	if cols <= 0 || rows <= 0 {
+		return g
+	}
+	mut visited := []bool{len: cols * rows}
+	mut stack := [0]
+	visited[0] = true
+	g.set(1, 1, false)
+	mut dirs := [0, 1, 2, 3]
+	for stack.len > 0 {
+		cell := stack.last()
+		cx := cell % cols
+		cy := cell / cols
+		rng.shuffle_ints(mut dirs)
+		mut moved := false
+		for d in dirs {
+			nx := cx + path_dx[d]
+			ny := cy + path_dy[d]
+			if nx < 0 || ny < 0 || nx >= cols || ny >= rows || visited[ny * cols + nx] {
+				continue
+			}
+			visited[ny * cols + nx] = true
+			// Open the wall between the cells and the new cell itself.
+			g.set(2 * cx + 1 + path_dx[d], 2 * cy + 1 + path_dy[d], false)
+			g.set(2 * nx + 1, 2 * ny + 1, false)
+			stack << ny * cols + nx
+			moved = true
+			break
+		}
+		if !moved {
+			stack.delete_last()
+		}
+	}
+	return g
+}
@@ -0,0 +1,149 @@
+module wasm96
+
+// Seeded world generation.
+//
+// A ProcWorld derives everything random about a generated world from one
+// master seed: each system (terrain, loot, enemies, ...) gets its own seed
+// from the master seed and the system's name, and each chunk of a system
+// its own seed from that and the chunk's coordinates. Adding a system, or
+// drawing more numbers in one, never shifts another, and nothing is kept
+// but the master seed, so a world comes out identical on every host and
+// after a save state is restored. Seeds are mixed with integer arithmetic
+// only; fixed-point noise (perlin2_fx) is available where float results
+// must match bit for bit.
+//
+//   w := wasm96.new_proc_world(1234)
+//   mut rng := w.chunk_rng('caves', cx, cy)
+//   grid := wasm96.cave_grid(32, 32, 45, 4, mut rng)
+//   height := w.noise('terrain', .simplex, x * 0.01, y * 0.01)
+
+// A world's master seed and the seeds derived from it.
+pub struct ProcWorld {
+pub mut:
+	seed u64
+}
+
+// Create a world from a master seed.
+pub fn new_proc_world(seed u64) ProcWorld {
+	return ProcWorld{
+		seed: seed
+	}
+}
+
+// Scramble 64 bits (SplitMix64's finalizer).
+fn seed_mix(x u64) u64 {
+	mut z := x + 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Get the seed for a system.
+pub fn (w &ProcWorld) sub_seed(system string) u64 {
+	return seed_mix(w.seed ^ seed_mix(hash_key(system.bytes())))
+}
+
+// Get the seed for chunk (cx, cy) of a system.
+pub fn (w &ProcWorld) chunk_seed(system string, cx int, cy int) u64 {
+	s := w.sub_seed(system)
+	return seed_mix(s ^ seed_mix(u64(u32(cx)) | u64(u32(cy)) << 32))
+}
+
+// Get a generator for a system, starting from the same point every time.
+pub fn (w &ProcWorld) rng(system string) Rng {
+	return new_rng(w.sub_seed(system))
+}
+
+// Get a generator for chunk (cx, cy) of a system.
+pub fn (w &ProcWorld) chunk_rng(system string, cx int, cy int) Rng {
+	return new_rng(w.chunk_seed(system, cx, cy))
+}
+
+// Get the 32-bit seed the noise functions take, for a system.
+pub fn (w &ProcWorld) noise_seed(system string) u32 {
+	s := w.sub_seed(system)
+	return u32(s ^ (s >> 32))
+}
+
+// Sample 2D noise for a system.
+pub fn (w &ProcWorld) noise(system string, kind NoiseKind, x f32, y f32) f32 {
+	return noise2(kind, w.noise_seed(system), x, y)
+}
+
+// Sample fractal 2D noise for a system.
+pub fn (w &ProcWorld) fbm(system string, kind NoiseKind, x f32, y f32, octaves int, gain f32) f32 {
+	return fbm2(kind, w.noise_seed(system), x, y, octaves, gain)
+}
+
+// Sample fixed-point 2D Perlin noise for a system (16.16 in and out).
+pub fn (w &ProcWorld) noise_fx(system string, x int, y int) int {
+	return perlin2_fx(w.noise_seed(system), x, y)
+}
+
+// Hash a point of a system to 32 random bits, without any generator state.
+pub fn (w &ProcWorld) hash(system string, x int, y int, z int) u32 {
+	return noise_hash(w.noise_seed(system), x, y, z)
+}
+
+// Save the master seed.
+pub fn (mut w ProcWorld) save_state(mut sw StateWriter) {
+	sw.write_u64(w.seed)
+}
+
+// Restore the master seed.
+pub fn (mut w ProcWorld) load_state(mut r StateReader) ! {
+	w.seed = r.read_u64()!
+}
+
+struct RandomTableEntry {
+	value  int
+	weight int
+}
+
+// A weighted table of values, e.g. loot or enemy kinds.
+pub struct RandomTable {
+mut:
+	entries []RandomTableEntry
+	total   int
+}
+
+// Add a value with a weight. Higher weights come up more often.
+pub fn (mut t RandomTable) add(value int, weight int) {
+	if weight <= 0 {
+		return
+	}
+	t.entries << RandomTableEntry{value, weight}
+	t.total += weight
+}
+
+// Get the number of entries.
+pub fn (t &RandomTable) len() int {
+	return t.entries.len
+}
+
+fn (t &RandomTable) at(roll int) int {
+	mut r := roll
+	for e in t.entries {
+		if r < e.weight {
+			return e.value
+		}
+		r -= e.weight
+	}
+	return t.entries.last().value
+}
+
+// Pick a value using rng. Returns none if the table is empty.
+pub fn (t &RandomTable) pick(mut rng Rng) ?int {
+	if t.total == 0 {
+		return none
+	}
+	return t.at(rng.intn(t.total))
+}
+
+// Pick a value for a point of a system, the same every time it's asked.
+pub fn (t &RandomTable) pick_at(w &ProcWorld, system string, x int, y int) ?int {
+	if t.total == 0 {
+		return none
+	}
+	return t.at(int(w.hash(system, x, y, 0) % u32(t.total)))
+}
@@ -0,0 +1,67 @@
+module wasm96
+
+// QOI ("Quite OK Image") encoding.
+
+fn qoi_hash(r u8, g u8, b u8, a u8) int {
+	return (int(r) * 3 + int(g) * 5 + int(b) * 7 + int(a) * 11) % 64
+}
+
+// Encode an image as QOI.
+pub fn qoi_encode(img &Image) []u8 {
+	mut out := []u8{cap: 14 + img.pixels.len / 2 + 8}
+	out << 'qoif'.bytes()
+	be_put_u32(mut out, u32(img.width))
+	be_put_u32(mut out, u32(img.height))
+	// RGBA, sRGB with linear alpha.
+	out << 4
+	out << 0
+	mut index := [64][4]u8{}
+	mut pr, mut pg, mut pb, mut pa := u8(0), u8(0), u8(0), u8(255)
+	mut run := 0
+	count := img.width * img.height
+	for i in 0 .. count {
+		r := img.pixels[i * 4]
+		g := img.pixels[i * 4 + 1]
+		b := img.pixels[i * 4 + 2]
+		a := img.pixels[i * 4 + 3]
+		if r == pr && g == pg && b == pb && a == pa {
+			run++
+			if run == 62 || i == count - 1 {
+				out << u8(0xc0 | (run - 1))
+				run = 0
+			}
+			continue
+		}
+		if run > 0 {
+			out << u8(0xc0 | (run - 1))
+			run = 0
+		}
+		h := qoi_hash(r, g, b, a)
+		if index[h][0] == r && index[h][1] == g && index[h][2] == b && index[h][3] == a {
+			out << u8(h)
+		} else {
+			index[h] = [r, g, b, a]!
+			if a == pa {
+				dr := i8(r - pr)
+				dg := i8(g - pg)
+				db := i8(b - pb)
+				dr_dg := dr - dg
+				db_dg := db - dg
+				if dr >= -2 && dr <= 1 && dg >= -2 && dg <= 1 && db >= -2 && db <= 1 {
+					out << u8(0x40 | u8(dr + 2) << 4 | u8(dg + 2) << 2 | u8(db + 2))
+				} else if dg >= -32 && dg <= 31 && dr_dg >= -8 && dr_dg <= 7 && db_dg >= -8
+					&& db_dg <= 7 {
+					out << u8(0x80 | u8(dg + 32))
+					out << u8(u8(dr_dg + 8) << 4 | u8(db_dg + 8))
+				} else {
+					out << [u8(0xfe), r, g, b]
+				}
+			} else {
+				out << [u8(0xff), r, g, b, a]
+			}
+		}
+		pr, pg, pb, pa = r, g, b, a
+	}
+	out << [u8(0), 0, 0, 0, 0, 0, 0, 1]
+	return out
+}
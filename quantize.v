@@ -0,0 +1,336 @@
+module wasm96
+
+// Indexed images and color quantization.
+//
+// An IndexedImage stores one palette index per pixel, so recoloring it is a
+// matter of changing the palette. quantize_palette picks up to 256 colors
+// that best cover an RGBA image by median cut: start with one box around
+// every color used, keep splitting the box with the widest spread at the
+// median of its longest side, then average each box. quantize_image then
+// maps every pixel to its nearest palette color, optionally dithering so
+// gradients don't band. Pixels under half alpha map to a transparent index.
+//
+//   pal := wasm96.quantize_palette(art, 16)
+//   indexed := wasm96.quantize_image(art, pal, .floyd_steinberg)
+
+// How quantize_image spreads the error of each pixel's nearest color.
+pub enum DitherMode {
+	none
+	// A fixed 4x4 pattern; stable between frames.
+	ordered
+	// Error diffusion; smoother, but changes ripple across the image.
+	floyd_steinberg
+}
+
+// An image of palette indices.
+pub struct IndexedImage {
+pub mut:
+	width   int
+	height  int
+	pixels  []u8
+	palette []Color
+	// Index drawn as transparent, or -1 for none.
+	transparent int = -1
+}
+
+// Create an image of index 0.
+pub fn new_indexed_image(width int, height int, palette []Color) IndexedImage {
+	return IndexedImage{
+		width: width
+		height: height
+		pixels: []u8{len: width * height}
+		palette: palette
+	}
+}
+
+// Get the index at (x, y), or 0 outside the image.
+pub fn (im &IndexedImage) get(x int, y int) u8 {
+	if x < 0 || y < 0 || x >= im.width || y >= im.height {
+		return 0
+	}
+	return im.pixels[y * im.width + x]
+}
+
+// Set the index at (x, y). Does nothing outside the image.
+pub fn (mut im IndexedImage) set(x int, y int, index u8) {
+	if x < 0 || y < 0 || x >= im.width || y >= im.height {
+		return
+	}
+	im.pixels[y * im.width + x] = index
+}
+
+// Expand to RGBA in img, which is resized if needed.
+pub fn (im &IndexedImage) to_image_into(mut img Image) {
+	if img.width != im.width || img.height != im.height {
+		img = new_image(im.width, im.height)
+	}
+	for i, p in im.pixels {
+		c := if int(p) == im.transparent || int(p) >= im.palette.len {
+			Color{
+				a: 0
+			}
+		} else {
+			im.palette[p]
+		}
+		img.pixels[i * 4] = c.r
+		img.pixels[i * 4 + 1] = c.g
+		img.pixels[i * 4 + 2] = c.b
+		img.pixels[i * 4 + 3] = c.a
+	}
+}
+
+// Expand to a new RGBA image.
+pub fn (im &IndexedImage) to_image() Image {
+	mut img := Image{}
+	im.to_image_into(mut img)
+	return img
+}
+
+__global indexed_scratch Image
+
+// Draw the image with its current palette.
+pub fn (im &IndexedImage) draw(x int, y int) {
+	im.to_image_into(mut indexed_scratch)
+	indexed_scratch.draw(x, y)
+}
+
+// Get the index of the palette color nearest c.
+pub fn nearest_color(palette []Color, c Color) int {
+	mut best := 0
+	mut best_d := max_i32
+	for i, p in palette {
+		dr := int(p.r) - int(c.r)
+		dg := int(p.g) - int(c.g)
+		db := int(p.b) - int(c.b)
+		// Weighted towards green, which the eye is most sensitive to.
+		d := 2 * dr * dr + 4 * dg * dg + 3 * db * db
+		if d < best_d {
+			best = i
+			best_d = d
+		}
+	}
+	return best
+}
+
+struct QuantBox {
+mut:
+	// Range of the box in colors, which are sorted by the box's last split.
+	start int
+	end   int
+	// Spread along each channel.
+	lo [3]int
+	hi [3]int
+}
+
+fn (mut b QuantBox) measure(colors []u32) {
+	b.lo = [255, 255, 255]!
+	b.hi = [0, 0, 0]!
+	for i in b.start .. b.end {
+		for ch in 0 .. 3 {
+			v := int((colors[i] >> u32(ch * 8)) & 0xff)
+			b.lo[ch] = min_int(b.lo[ch], v)
+			b.hi[ch] = max_int(b.hi[ch], v)
+		}
+	}
+}
+
+fn (b &QuantBox) widest() (int, int) {
+	mut axis := 0
+	mut spread := -1
+	for ch in 0 .. 3 {
+		if b.hi[ch] - b.lo[ch] > spread {
+			spread = b.hi[ch] - b.lo[ch]
+			axis = ch
+		}
+	}
+	return axis, spread
+}
+
+// Sort colors[start..end] by the channel at bit shift, counting each value.
+fn quant_sort(mut colors []u32, start int, end int, shift u32) {
+	mut pos := []int{len: 257}
+	for i in start .. end {
+		pos[int((colors[i] >> shift) & 0xff) + 1]++
+	}
+	for v in 1 .. 257 {
+		pos[v] += pos[v - 1]
+	}
+	sorted := colors[start..end].clone()
+	for c in sorted {
+		v := int((c >> shift) & 0xff)
+		colors[start + pos[v]] = c
+		pos[v]++
+	}
+}
+
+// Pick up to max_colors colors (at most 256, including a transparent entry
+// at index 0 if the image has transparent pixels) that best cover img.
+pub fn quantize_palette(img &Image, max_colors int) []Color {
+	// Count each opaque color at 5 bits per channel, which is plenty to
+	// choose a palette from and keeps the work bounded.
+	mut counts := map[u32]int{}
+	mut has_clear := false
+	for i := 0; i < img.pixels.len; i += 4 {
+		if img.pixels[i + 3] < 128 {
+			has_clear = true
+			continue
+		}
+		key := u32(img.pixels[i] >> 3) << 3 | u32(img.pixels[i + 1] >> 3) << 11 | u32(img.pixels[
+			i + 2] >> 3) << 19
+		counts[key]++
+	}
+	mut pal := []Color{}
+	if has_clear {
+		pal << Color{0, 0, 0, 0}
+	}
+	limit := clamp_int(max_colors, 1, 256) - pal.len
+	if counts.len == 0 || limit <= 0 {
+		return pal
+	}
+	mut colors := counts.keys()
+	mut boxes := [QuantBox{
+		start: 0
+		end: colors.len
+	}]
+	boxes[0].measure(colors)
+	for boxes.len < limit {
+		// Split the box with the widest spread that has more than one color.
+		mut pick := -1
+		mut pick_spread := 0
+		for i, b in boxes {
+			_, spread := b.widest()
+			if b.end - b.start > 1 && spread > pick_spread {
+				pick = i
+				pick_spread = spread
+			}
+		}
+		if pick < 0 {
+			break
+		}
+		mut b := boxes[pick]
+		axis, _ := b.widest()
+		quant_sort(mut colors, b.start, b.end, u32(axis * 8))
+		// Cut where half the pixels (not half the colors) fall either side.
+		mut total := 0
+		for i in b.start .. b.end {
+			total += counts[colors[i]]
+		}
+		mut run := 0
+		mut mid := b.start + 1
+		for i in b.start .. b.end - 1 {
+			run += counts[colors[i]]
+			mid = i + 1
+			if run * 2 >= total {
+				break
+			}
+		}
+		mut upper := QuantBox{
+			start: mid
+			end: b.end
+		}
+		b.end = mid
+		b.measure(colors)
+		upper.measure(colors)
+		boxes[pick] = b
+		boxes << upper
+	}
+	for b in boxes {
+		mut sum := [0, 0, 0]!
+		mut n := 0
+		for i in b.start .. b.end {
+			k := counts[colors[i]]
+			for ch in 0 .. 3 {
+				// Take the middle of each 5-bit step.
+				sum[ch] += int((colors[i] >> u32(ch * 8)) & 0xff | 4) * k
+			}
+			n += k
+		}
+		pal << Color{u8(sum[0] / n), u8(sum[1] / n), u8(sum[2] / n), 255}
+	}
+	return pal
+}
+
+// Map every pixel of img to the nearest palette color. Pixels under half
+// alpha map to the palette's first fully transparent entry if it has one.
+pub fn quantize_image(img &Image, palette []Color, dither DitherMode) IndexedImage {
+	mut out := new_indexed_image(img.width, img.height, palette)
+	mut clear := -1
+	mut opaque := []Color{}
+	mut opaque_index := []int{}
+	for i, c in palette {
+		if c.a == 0 {
+			if clear < 0 {
+				clear = i
+			}
+		} else {
+			opaque << c
+			opaque_index << i
+		}
+	}
+	out.transparent = clear
+	if opaque.len == 0 {
+		return out
+	}
+	// Nearest color per 5-bit color, found on first use.
+	mut cache := []i16{len: 32768, init: -1}
+	// Floyd-Steinberg error for this row and the next, 3 channels per pixel
+	// with a pixel of padding either side.
+	w := img.width
+	mut err := []int{len: (w + 2) * 3}
+	mut next := []int{len: (w + 2) * 3}
+	for y in 0 .. img.height {
+		for x in 0 .. w {
+			i := (y * w + x) * 4
+			if img.pixels[i + 3] < 128 && clear >= 0 {
+				out.pixels[y * w + x] = u8(clear)
+				continue
+			}
+			mut rgb := [int(img.pixels[i]), int(img.pixels[i + 1]), int(img.pixels[i + 2])]!
+			match dither {
+				.none {}
+				.ordered {
+					// Nudge by up to half a step of a 16-color ramp either way.
+					t := dither_bayer4[(y & 3) * 4 + (x & 3)] * 2 - 15
+					for ch in 0 .. 3 {
+						rgb[ch] = clamp_int(rgb[ch] + t, 0, 255)
+					}
+				}
+				.floyd_steinberg {
+					for ch in 0 .. 3 {
+						rgb[ch] = clamp_int(rgb[ch] + err[(x + 1) * 3 + ch] / 16, 0, 255)
+					}
+				}
+			}
+			key := (rgb[0] >> 3) | (rgb[1] >> 3) << 5 | (rgb[2] >> 3) << 10
+			mut k := int(cache[key])
+			if k < 0 {
+				k = nearest_color(opaque, Color{u8(rgb[0]), u8(rgb[1]), u8(rgb[2]), 255})
+				cache[key] = i16(k)
+			}
+			out.pixels[y * w + x] = u8(opaque_index[k])
+			if dither == .floyd_steinberg {
+				p := opaque[k]
+				chosen := [int(p.r), int(p.g), int(p.b)]!
+				for ch in 0 .. 3 {
+					e := rgb[ch] - chosen[ch]
+					err[(x + 2) * 3 + ch] += e * 7
+					next[x * 3 + ch] += e * 3
+					next[(x + 1) * 3 + ch] += e * 5
+					next[(x + 2) * 3 + ch] += e
+				}
+			}
+		}
+		if dither == .floyd_steinberg {
+			err, next = next, err
+			for j in 0 .. next.len {
+				next[j] = 0
+			}
+		}
+	}
+	return out
+}
+
+// Quantize img to at most max_colors colors in one step.
+pub fn image_to_indexed(img &Image, max_colors int, dither DitherMode) IndexedImage {
+	return quantize_image(img, quantize_palette(img, max_colors), dither)
+}
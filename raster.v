@@ -0,0 +1,157 @@
+module wasm96
+
+// Per-scanline raster effects.
+//
+// Old consoles let games change registers between scanlines, which gave
+// raster bars, wavy heat shimmer, split-screen scrolling and per-line
+// palette swaps. A ScanlineFn gets the same chance: it is called for every
+// line as an image is resolved and can shift the line sideways, show a
+// different source row, tint it, or (for indexed images) swap its palette.
+// Set VirtualScreen.scanline to run it as the logical screen is presented,
+// or use the functions below on any image.
+//
+//   fn wobble(y int, mut line wasm96.Scanline) {
+//       line.scroll_x = wasm96.wave_offset(y, 3, 32, f32(ticks) * 0.1)
+//   }
+//   vscreen.scanline = wobble
+
+// What a scanline callback can change about one line.
+pub struct Scanline {
+pub mut:
+	// Shift the line right by this many pixels, wrapping around.
+	scroll_x int
+	// Row of the source shown on this line; starts as the line itself.
+	source_y int
+	// Multiply the line's colors by this.
+	tint Color = Color{255, 255, 255, 255}
+	// Colors to use for this line of an indexed image; empty keeps the
+	// image's own palette.
+	palette []Color
+}
+
+// Called for line y before it is drawn.
+pub type ScanlineFn = fn (y int, mut line Scanline)
+
+// Get a sideways offset for line y that traces a sine wave of amplitude
+// pixels and wavelength lines, moved along by phase radians; animate phase
+// for heat haze and underwater wobble.
+pub fn wave_offset(y int, amplitude f32, wavelength f32, phase f32) int {
+	if wavelength == 0 {
+		return 0
+	}
+	return int(floorf(sinf(f32(y) * 2 * pi / wavelength + phase) * amplitude + 0.5))
+}
+
+fn (mut line Scanline) reset(y int) {
+	line.scroll_x = 0
+	line.source_y = y
+	line.tint = Color{255, 255, 255, 255}
+	line.palette.clear()
+}
+
+fn (line &Scanline) tinted() bool {
+	t := line.tint
+	return t.r != 255 || t.g != 255 || t.b != 255 || t.a != 255
+}
+
+// Run cb over every line of src, writing the result to dst, which is
+// resized to match.
+pub fn (src &Image) raster_into(mut dst Image, cb ScanlineFn) {
+	if dst.width != src.width || dst.height != src.height {
+		dst = new_image(src.width, src.height)
+	}
+	w := src.width
+	if w == 0 {
+		return
+	}
+	mut line := Scanline{}
+	for y in 0 .. src.height {
+		line.reset(y)
+		cb(y, mut line)
+		d := y * w * 4
+		if line.source_y < 0 || line.source_y >= src.height {
+			for i in 0 .. w * 4 {
+				dst.pixels[d + i] = 0
+			}
+			continue
+		}
+		s := line.source_y * w * 4
+		shift := line.scroll_x % w
+		for x in 0 .. w {
+			mut sx := x - shift
+			if sx < 0 {
+				sx += w
+			} else if sx >= w {
+				sx -= w
+			}
+			for ch in 0 .. 4 {
+				dst.pixels[d + x * 4 + ch] = src.pixels[s + sx * 4 + ch]
+			}
+		}
+		if line.tinted() {
+			tint_row(mut dst.pixels, d, w, line.tint)
+		}
+	}
+}
+
+// Run cb over every line of an indexed image while expanding it to RGBA in
+// dst, so lines can also swap palettes.
+pub fn (im &IndexedImage) raster_into(mut dst Image, cb ScanlineFn) {
+	if dst.width != im.width || dst.height != im.height {
+		dst = new_image(im.width, im.height)
+	}
+	w := im.width
+	if w == 0 {
+		return
+	}
+	mut line := Scanline{}
+	for y in 0 .. im.height {
+		line.reset(y)
+		cb(y, mut line)
+		d := y * w * 4
+		pal := if line.palette.len > 0 { line.palette } else { im.palette }
+		shift := line.scroll_x % w
+		for x in 0 .. w {
+			mut c := Color{
+				a: 0
+			}
+			if line.source_y >= 0 && line.source_y < im.height {
+				mut sx := x - shift
+				if sx < 0 {
+					sx += w
+				} else if sx >= w {
+					sx -= w
+				}
+				p := int(im.pixels[line.source_y * w + sx])
+				if p != im.transparent && p < pal.len {
+					c = pal[p]
+				}
+			}
+			dst.pixels[d + x * 4] = c.r
+			dst.pixels[d + x * 4 + 1] = c.g
+			dst.pixels[d + x * 4 + 2] = c.b
+			dst.pixels[d + x * 4 + 3] = c.a
+		}
+		if line.tinted() {
+			tint_row(mut dst.pixels, d, w, line.tint)
+		}
+	}
+}
+
+fn tint_row(mut px []u8, start int, count int, t Color) {
+	for x in 0 .. count {
+		i := start + x * 4
+		px[i] = u8(int(px[i]) * int(t.r) / 255)
+		px[i + 1] = u8(int(px[i + 1]) * int(t.g) / 255)
+		px[i + 2] = u8(int(px[i + 2]) * int(t.b) / 255)
+		px[i + 3] = u8(int(px[i + 3]) * int(t.a) / 255)
+	}
+}
+
+__global raster_out Image
+
+// Draw an indexed image through a scanline callback.
+pub fn (im &IndexedImage) draw_raster(x int, y int, cb ScanlineFn) {
+	im.raster_into(mut raster_out, cb)
+	raster_out.draw(x, y)
+}
@@ -0,0 +1,137 @@
+module wasm96
+
+// Rolling gameplay recorder.
+//
+// Keeps the last few seconds of downsampled frames in a ring, quantized to a
+// fixed 252-color palette (6 red x 7 green x 6 blue levels) with ordered
+// dithering, and encodes them to GIF or APNG on demand.
+
+// Get the fixed palette used by the recorder.
+pub fn recorder_palette() []Color {
+	mut pal := []Color{cap: 252}
+	for r in 0 .. 6 {
+		for g in 0 .. 7 {
+			for b in 0 .. 6 {
+				pal << Color{u8(r * 255 / 5), u8(g * 255 / 6), u8(b * 255 / 5), 255}
+			}
+		}
+	}
+	return pal
+}
+
+// Quantize one channel to levels steps with a dither threshold in 0..15.
+fn recorder_level(v u8, levels int, threshold int) int {
+	steps := levels - 1
+	scaled := int(v) * steps * 16 / 255 + threshold
+	return min_int(scaled / 16, steps)
+}
+
+// Records a rolling window of frames.
+pub struct Recorder {
+pub:
+	seconds int
+	fps     int
+	scale   int
+mut:
+	frames  [][]u8
+	head    int
+	count   int
+	tick    int
+	width   int
+	height  int
+	scratch Image
+}
+
+// Create a recorder keeping the last seconds of gameplay, captured fps times
+// per second and downsampled by scale in each direction.
+pub fn new_recorder(seconds int, fps int, scale int) Recorder {
+	return Recorder{
+		seconds: seconds
+		fps: if fps > 0 { fps } else { 15 }
+		scale: if scale > 0 { scale } else { 1 }
+	}
+}
+
+// Call once per frame after drawing. Captures the screen at the recorder's
+// rate; does nothing if the host can't read back frames.
+pub fn (mut r Recorder) update() {
+	// update runs once per drawn frame, so count in host frames.
+	interval := max_int(1, int(host_refresh_rate() / f32(r.fps) + 0.5))
+	r.tick++
+	if r.tick < interval {
+		return
+	}
+	r.tick = 0
+	w := int(screen_width)
+	h := int(screen_height)
+	if w == 0 || h == 0 {
+		return
+	}
+	if r.scratch.width != w || r.scratch.height != h {
+		r.scratch = new_image(w, h)
+	}
+	if graphics_capture(mut r.scratch.pixels) {
+		r.add(r.scratch)
+	}
+}
+
+// Add a frame from an image. Changing size discards older frames.
+pub fn (mut r Recorder) add(img &Image) {
+	w := img.width / r.scale
+	h := img.height / r.scale
+	if w != r.width || h != r.height {
+		r.clear()
+		r.width = w
+		r.height = h
+	}
+	capacity := max_int(1, r.seconds * r.fps)
+	if r.frames.len < capacity {
+		r.frames << []u8{len: w * h}
+	}
+	slot := if r.count < capacity { (r.head + r.count) % capacity } else { r.head }
+	for y in 0 .. h {
+		for x in 0 .. w {
+			i := ((y * r.scale) * img.width + x * r.scale) * 4
+			t := dither_bayer4[(y & 3) * 4 + (x & 3)]
+			cr := recorder_level(img.pixels[i], 6, t)
+			cg := recorder_level(img.pixels[i + 1], 7, t)
+			cb := recorder_level(img.pixels[i + 2], 6, t)
+			r.frames[slot][y * w + x] = u8(cr * 42 + cg * 6 + cb)
+		}
+	}
+	if r.count < capacity {
+		r.count++
+	} else {
+		r.head = (r.head + 1) % capacity
+	}
+}
+
+// Discard all recorded frames.
+pub fn (mut r Recorder) clear() {
+	r.frames.clear()
+	r.head = 0
+	r.count = 0
+}
+
+// Get the number of frames recorded.
+pub fn (r &Recorder) frame_count() int {
+	return r.count
+}
+
+fn (r &Recorder) ordered() [][]u8 {
+	mut out := [][]u8{cap: r.count}
+	for i in 0 .. r.count {
+		out << r.frames[(r.head + i) % r.frames.len]
+	}
+	return out
+}
+
+// Encode the recorded frames, oldest first, as a looping GIF.
+pub fn (r &Recorder) encode_gif() []u8 {
+	return gif_encode(r.width, r.height, recorder_palette(), r.ordered(), 1000 / r.fps)
+}
+
+// Encode the recorded frames, oldest first, as a looping APNG.
+pub fn (r &Recorder) encode_apng() []u8 {
+	return apng_encode(r.width, r.height, recorder_palette(), r.ordered(), 1000 / r.fps)
+}
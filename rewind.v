@@ -0,0 +1,182 @@
+module wasm96
+
+// In-game rewind.
+//
+// A Rewind keeps a ring of save states (see savestate.v) taken every
+// interval frames, and steps back through them while a button is held,
+// independent of any rewind the frontend offers. Only the newest state is
+// kept whole: every older one is stored as its XOR difference from the
+// state after it, run-length encoded, so a frame that changed little costs
+// a few bytes. XOR works both ways, which lets rewinding walk back one
+// difference at a time from the newest state.
+//
+//   mut rw := wasm96.new_rewind(600, 2)
+//   // in update:
+//   if rw.poll(0, .l2) { return }
+//   ... step the game ...
+
+struct RewindEntry {
+	// Length of the older state.
+	size int
+	// rle_encode of older XOR newer.
+	delta []u8
+}
+
+// A rewind buffer.
+pub struct Rewind {
+pub mut:
+	// Frames between saved states.
+	interval int = 2
+	// Most bytes the stored differences may take; 0 for no limit.
+	max_bytes int
+	// Saved states stepped back per frame while rewinding.
+	speed int = 1
+mut:
+	entries []RewindEntry
+	head    int
+	count   int
+	bytes   int
+	newest  []u8
+	ticks   int
+	active  bool
+}
+
+// Create a rewind buffer holding up to capacity states, one every interval
+// frames, so capacity * interval frames can be undone.
+pub fn new_rewind(capacity int, interval int) Rewind {
+	return Rewind{
+		interval: max_int(1, interval)
+		entries: []RewindEntry{len: max_int(1, capacity)}
+	}
+}
+
+// XOR a and b, padding the shorter with zeros to n bytes.
+fn rewind_xor(a []u8, b []u8, n int) []u8 {
+	mut out := []u8{len: n}
+	for i in 0 .. n {
+		x := if i < a.len { a[i] } else { u8(0) }
+		y := if i < b.len { b[i] } else { u8(0) }
+		out[i] = x ^ y
+	}
+	return out
+}
+
+// Save the current state. Called by update every interval frames.
+pub fn (mut rw Rewind) capture() {
+	state := savestate_save()
+	if rw.newest.len > 0 {
+		n := max_int(rw.newest.len, state.len)
+		rw.push(RewindEntry{
+			size: rw.newest.len
+			delta: rle_encode(rewind_xor(rw.newest, state, n))
+		})
+	}
+	rw.newest = state
+}
+
+fn (mut rw Rewind) push(e RewindEntry) {
+	if rw.count == rw.entries.len {
+		rw.drop_oldest()
+	}
+	rw.entries[rw.head] = e
+	rw.head = (rw.head + 1) % rw.entries.len
+	rw.count++
+	rw.bytes += e.delta.len
+	for rw.max_bytes > 0 && rw.bytes > rw.max_bytes && rw.count > 1 {
+		rw.drop_oldest()
+	}
+}
+
+fn (mut rw Rewind) drop_oldest() {
+	oldest := (rw.head - rw.count + rw.entries.len) % rw.entries.len
+	rw.bytes -= rw.entries[oldest].delta.len
+	rw.entries[oldest] = RewindEntry{}
+	rw.count--
+}
+
+// Step back to the previous saved state and load it. Returns false when
+// there is nothing older to go back to.
+pub fn (mut rw Rewind) step_back() bool {
+	if rw.count == 0 || rw.newest.len == 0 {
+		return false
+	}
+	i := (rw.head - 1 + rw.entries.len) % rw.entries.len
+	e := rw.entries[i]
+	n := max_int(e.size, rw.newest.len)
+	delta := rle_decode(e.delta, n) or {
+		rw.clear()
+		return false
+	}
+	older := rewind_xor(rw.newest, delta, n)[..e.size]
+	savestate_load(older) or {
+		rw.clear()
+		return false
+	}
+	rw.entries[i] = RewindEntry{}
+	rw.head = i
+	rw.count--
+	rw.bytes -= e.delta.len
+	rw.newest = older
+	return true
+}
+
+// Run the buffer for a frame: step back while rewinding is held, otherwise
+// save a state every interval frames. Returns true while rewinding, when the
+// game should skip its own update.
+pub fn (mut rw Rewind) update(rewinding bool) bool {
+	if rewinding {
+		if !rw.active {
+			// Go back to the last saved state first, dropping frames since.
+			rw.active = true
+			if rw.newest.len > 0 {
+				savestate_load(rw.newest) or {}
+			}
+		}
+		for _ in 0 .. max_int(1, rw.speed) {
+			if !rw.step_back() {
+				break
+			}
+		}
+		// The state stepped back to is already saved.
+		rw.ticks = 1
+		return true
+	}
+	rw.active = false
+	if rw.ticks % rw.interval == 0 {
+		rw.capture()
+	}
+	rw.ticks++
+	return false
+}
+
+// Update, rewinding while btn is held on port.
+pub fn (mut rw Rewind) poll(port u32, btn Button) bool {
+	return rw.update(input_is_button_down(port, btn))
+}
+
+// Returns true while stepping back.
+pub fn (rw &Rewind) rewinding() bool {
+	return rw.active
+}
+
+// Get the number of states that can be stepped back through.
+pub fn (rw &Rewind) len() int {
+	return rw.count
+}
+
+// Get the memory the buffer uses in bytes, including the newest state.
+pub fn (rw &Rewind) memory() int {
+	return rw.bytes + rw.newest.len
+}
+
+// Forget every saved state, e.g. after loading a level.
+pub fn (mut rw Rewind) clear() {
+	for i in 0 .. rw.entries.len {
+		rw.entries[i] = RewindEntry{}
+	}
+	rw.head = 0
+	rw.count = 0
+	rw.bytes = 0
+	rw.newest = []u8{}
+	rw.ticks = 0
+}
@@ -0,0 +1,299 @@
+module wasm96
+
+// Rich text markup.
+//
+// Tags in braces style the text that follows:
+//
+//   {color=red} ... {/color}     named color or #rrggbb
+//   {wave} ... {/wave}           characters bob on a sine wave
+//   {shake} ... {/shake}         characters jitter
+//   {icon=A}                     a button glyph (see glyph_named)
+//   {pause=30}                   wait 30 frames before revealing more
+//
+// Parsed text is drawn a character at a time so effects can move each one,
+// and can be revealed gradually by a Typewriter for RPG-style dialog.
+// Newlines break lines; unknown tags are drawn as written.
+
+// One character (or icon) of rich text with its style.
+pub struct RichChar {
+pub:
+	text  string
+	color Color
+	wave  bool
+	shake bool
+	icon  ?Glyph
+	// Frames to wait before this character is revealed.
+	pause int
+}
+
+// Parsed rich text.
+pub struct RichText {
+pub mut:
+	// Font for the text; the built-in debug font when empty.
+	font_key []u8
+	// Extra pixels between lines.
+	line_gap int = 2
+pub:
+	chars []RichChar
+mut:
+	widths []int
+	line_h int
+}
+
+// Get a color by name (red, green, blue, yellow, orange, purple, cyan,
+// magenta, white, gray, black) or as #rrggbb.
+pub fn color_named(name string) ?Color {
+	if name.starts_with('#') && name.len == 7 {
+		return hex_color(('0x' + name[1..]).u32())
+	}
+	return match name {
+		'red' { Color{230, 60, 60, 255} }
+		'green' { Color{80, 200, 90, 255} }
+		'blue' { Color{80, 130, 240, 255} }
+		'yellow' { Color{240, 220, 70, 255} }
+		'orange' { Color{240, 150, 50, 255} }
+		'purple' { Color{170, 90, 220, 255} }
+		'cyan' { Color{80, 220, 230, 255} }
+		'magenta' { Color{230, 80, 200, 255} }
+		'white' { Color{255, 255, 255, 255} }
+		'gray', 'grey' { Color{150, 150, 160, 255} }
+		'black' { Color{0, 0, 0, 255} }
+		else { none }
+	}
+}
+
+// Parse markup, with untagged text in color.
+pub fn rich_parse(markup string, color Color) RichText {
+	mut chars := []RichChar{}
+	mut colors := [color]
+	mut wave := 0
+	mut shake := 0
+	mut pause := 0
+	mut i := 0
+	for i < markup.len {
+		if markup[i] == `{` {
+			close := glyph_find(markup, `}`, i)
+			if close > i {
+				tag := markup[i + 1..close]
+				eq := glyph_find(tag, `=`, 0)
+				name := if eq < 0 { tag } else { tag[..eq] }
+				arg := if eq < 0 { '' } else { tag[eq + 1..] }
+				mut known := true
+				match name {
+					'color' {
+						colors << color_named(arg) or { colors.last() }
+					}
+					'/color' {
+						if colors.len > 1 {
+							colors.delete_last()
+						}
+					}
+					'wave' {
+						wave++
+					}
+					'/wave' {
+						wave = max_int(0, wave - 1)
+					}
+					'shake' {
+						shake++
+					}
+					'/shake' {
+						shake = max_int(0, shake - 1)
+					}
+					'pause' {
+						pause += arg.int()
+					}
+					'icon' {
+						if gl := glyph_named(arg) {
+							chars << RichChar{
+								color: colors.last()
+								wave: wave > 0
+								shake: shake > 0
+								icon: gl
+								pause: pause
+							}
+							pause = 0
+						} else {
+							known = false
+						}
+					}
+					else {
+						known = false
+					}
+				}
+				if known {
+					i = close + 1
+					continue
+				}
+			}
+		}
+		// Take one UTF-8 sequence as a character.
+		mut n := 1
+		for i + n < markup.len && markup[i + n] & 0xc0 == 0x80 {
+			n++
+		}
+		chars << RichChar{
+			text: markup[i..i + n]
+			color: colors.last()
+			wave: wave > 0
+			shake: shake > 0
+			pause: pause
+		}
+		pause = 0
+		i += n
+	}
+	return RichText{
+		chars: chars
+	}
+}
+
+fn (rt &RichText) font() []u8 {
+	return if rt.font_key.len > 0 { rt.font_key } else { debug_font_key }
+}
+
+// Measure every character once.
+fn (mut rt RichText) measure_chars() bool {
+	if rt.font_key.len == 0 && !debug_font_ready() {
+		return false
+	}
+	if rt.widths.len == rt.chars.len {
+		return true
+	}
+	font := rt.font()
+	glyphs := Glyphs{
+		font_key: rt.font_key
+	}
+	rt.widths = []int{len: rt.chars.len}
+	for i, c in rt.chars {
+		if gl := c.icon {
+			rt.widths[i] = glyphs.width(gl) + 2
+		} else if c.text != '\n' {
+			rt.widths[i] = int(graphics_text_measure_key(font, c.text.bytes()).width)
+		}
+	}
+	rt.line_h = int(graphics_text_measure_key(font, 'M'.bytes()).height) + rt.line_gap
+	return true
+}
+
+// Get the number of characters, icons included.
+pub fn (rt &RichText) len() int {
+	return rt.chars.len
+}
+
+// Get the size the whole text takes up.
+pub fn (mut rt RichText) size() (int, int) {
+	if !rt.measure_chars() {
+		return 0, 0
+	}
+	mut w := 0
+	mut line := 0
+	mut lines := 1
+	for i, c in rt.chars {
+		if c.text == '\n' {
+			line = 0
+			lines++
+			continue
+		}
+		line += rt.widths[i]
+		w = max_int(w, line)
+	}
+	return w, lines * rt.line_h
+}
+
+// Draw the first count characters (all of them if count is negative) with
+// the top-left at (x, y). Effects animate with the frame counter.
+pub fn (mut rt RichText) draw(x int, y int, count int) {
+	if !rt.measure_chars() {
+		return
+	}
+	n := if count < 0 { rt.chars.len } else { min_int(count, rt.chars.len) }
+	font := rt.font()
+	glyphs := Glyphs{
+		font_key: rt.font_key
+	}
+	t := f32(runner.frame)
+	mut pen_x := x
+	mut pen_y := y
+	for i in 0 .. n {
+		c := rt.chars[i]
+		if c.text == '\n' {
+			pen_x = x
+			pen_y += rt.line_h
+			continue
+		}
+		mut dx := 0
+		mut dy := 0
+		if c.wave {
+			dy += int(sinf(t * 0.2 + f32(i) * 0.6) * 2)
+		}
+		if c.shake {
+			h := noise_hash(0x5eed, i, int(runner.frame / 2), 0)
+			dx += int(h % 3) - 1
+			dy += int((h >> 8) % 3) - 1
+		}
+		if gl := c.icon {
+			glyphs.draw(pen_x + dx + 1, pen_y + dy, gl)
+		} else {
+			graphics_set_color_rgba(c.color)
+			graphics_text_key(pen_x + dx, pen_y + dy, font, c.text.bytes())
+		}
+		pen_x += rt.widths[i]
+	}
+}
+
+// Reveals rich text a character at a time, honoring pauses.
+pub struct Typewriter {
+pub mut:
+	text RichText
+	// Frames per character.
+	speed int = 2
+mut:
+	shown  int
+	wait   int
+	paused int = -1
+}
+
+// Start revealing text, a character every speed frames.
+pub fn new_typewriter(text RichText, speed int) Typewriter {
+	return Typewriter{
+		text: text
+		speed: speed
+	}
+}
+
+// Reveal more text. Returns true on frames a character appeared, e.g. to
+// play a blip. Call once per frame.
+pub fn (mut tw Typewriter) update() bool {
+	if tw.done() {
+		return false
+	}
+	if tw.wait > 0 {
+		tw.wait--
+		return false
+	}
+	c := tw.text.chars[tw.shown]
+	if c.pause > 0 && tw.paused != tw.shown {
+		tw.paused = tw.shown
+		tw.wait = c.pause - 1
+		return false
+	}
+	tw.shown++
+	tw.wait = max_int(0, tw.speed - 1)
+	return c.text != ' ' && c.text != '\n'
+}
+
+// Returns true once every character is shown.
+pub fn (tw &Typewriter) done() bool {
+	return tw.shown >= tw.text.chars.len
+}
+
+// Show everything at once.
+pub fn (mut tw Typewriter) skip() {
+	tw.shown = tw.text.chars.len
+	tw.wait = 0
+}
+
+// Draw the revealed part with the top-left at (x, y).
+pub fn (mut tw Typewriter) draw(x int, y int) {
+	tw.text.draw(x, y, tw.shown)
+}
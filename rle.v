@@ -0,0 +1,71 @@
+module wasm96
+
+// PackBits run-length encoding.
+//
+// Each run starts with a header byte h: 0 to 127 copies the next h + 1
+// bytes as they are, 129 to 255 repeats the next byte 257 - h times, and
+// 128 is skipped. Long runs of one value (cleared tiles, zeroed deltas)
+// shrink to two bytes per 128, and the worst case grows by one byte in 128.
+
+// Compress data.
+pub fn rle_encode(data []u8) []u8 {
+	mut out := []u8{cap: data.len / 8 + 16}
+	mut i := 0
+	for i < data.len {
+		// Length of the run of equal bytes starting here.
+		mut run := 1
+		for i + run < data.len && run < 128 && data[i + run] == data[i] {
+			run++
+		}
+		if run >= 3 {
+			out << u8(257 - run)
+			out << data[i]
+			i += run
+			continue
+		}
+		// Copy literally up to the next run of three or more.
+		start := i
+		for i < data.len && i - start < 128 {
+			if i + 2 < data.len && data[i] == data[i + 1] && data[i] == data[i + 2] {
+				break
+			}
+			i++
+		}
+		out << u8(i - start - 1)
+		out << data[start..i]
+	}
+	return out
+}
+
+// Decompress data written by rle_encode. size is the expected length.
+pub fn rle_decode(data []u8, size int) ![]u8 {
+	mut out := []u8{cap: size}
+	mut i := 0
+	for i < data.len {
+		h := int(data[i])
+		i++
+		if h < 128 {
+			n := h + 1
+			if i + n > data.len {
+				return error('rle: truncated literal')
+			}
+			out << data[i..i + n]
+			i += n
+		} else if h > 128 {
+			if i >= data.len {
+				return error('rle: truncated run')
+			}
+			for _ in 0 .. 257 - h {
+				out << data[i]
+			}
+			i++
+		}
+		if out.len > size {
+			return error('rle: too much data')
+		}
+	}
+	if out.len != size {
+		return error('rle: expected ${size} bytes, got ${out.len}')
+	}
+	return out
+}
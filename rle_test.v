@@ -0,0 +1,42 @@
+module wasm96
+
+fn rle_round_trip(data []u8) {
+	packed := rle_encode(data)
+	out := rle_decode(packed, data.len) or { panic(err) }
+	assert out == data
+}
+
+fn test_rle_round_trip() {
+	rle_round_trip([]u8{})
+	rle_round_trip([u8(5)])
+	rle_round_trip([u8(1), 2, 3, 4, 5])
+	rle_round_trip([]u8{len: 1000})
+	rle_round_trip([u8(9), 9, 1, 1, 1, 2, 3, 3, 3, 3, 4])
+	mut mixed := []u8{}
+	for i in 0 .. 600 {
+		mixed << if i % 200 < 100 { u8(i) } else { u8(7) }
+	}
+	rle_round_trip(mixed)
+}
+
+fn test_rle_encoding() {
+	// Runs take two bytes per 128, literals one header per 128.
+	assert rle_encode([]u8{len: 256, init: 3}) == [u8(129), 3, 129, 3]
+	assert rle_encode([u8(1), 2, 3]) == [u8(2), 1, 2, 3]
+	assert rle_encode([u8(1), 2, 2, 2, 2]) == [u8(0), 1, 253, 2]
+}
+
+fn test_rle_decode_errors() {
+	if _ := rle_decode([u8(4), 1, 2], 5) {
+		assert false
+	}
+	if _ := rle_decode([u8(250)], 7) {
+		assert false
+	}
+	if _ := rle_decode([u8(129), 1], 100) {
+		assert false
+	}
+	if _ := rle_decode([u8(129), 1], 200) {
+		assert false
+	}
+}
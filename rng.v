@@ -0,0 +1,94 @@
+module wasm96
+
+// A small seedable random number generator (PCG32).
+//
+// Sequences depend only on the seed, so generated content and replays come
+// out the same on every host.
+
+// A PCG32 random number generator.
+pub struct Rng {
+mut:
+	state u64
+	inc   u64 = 1442695040888963407
+}
+
+// Create a generator from a seed.
+pub fn new_rng(seed u64) Rng {
+	mut r := Rng{}
+	r.seed(seed)
+	return r
+}
+
+// Restart the sequence from seed.
+pub fn (mut r Rng) seed(seed u64) {
+	r.state = 0
+	r.next_u32()
+	r.state += seed
+	r.next_u32()
+}
+
+// Get the next 32 random bits.
+pub fn (mut r Rng) next_u32() u32 {
+	old := r.state
+	r.state = old * 6364136223846793005 + r.inc
+	xorshifted := u32(((old >> 18) ^ old) >> 27)
+	rot := u32(old >> 59)
+	return (xorshifted >> rot) | (xorshifted << ((32 - rot) & 31))
+}
+
+// Get a random int in [0, n). Returns 0 if n <= 0.
+pub fn (mut r Rng) intn(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	// Reject the few low values that would make some results more likely.
+	bound := u32(n)
+	threshold := (u32(0) - bound) % bound
+	for {
+		v := r.next_u32()
+		if v >= threshold {
+			return int(v % bound)
+		}
+	}
+	return 0
+}
+
+// Get a random int in [lo, hi).
+pub fn (mut r Rng) int_range(lo int, hi int) int {
+	return lo + r.intn(hi - lo)
+}
+
+// Get a random float in [0, 1).
+pub fn (mut r Rng) next_f32() f32 {
+	return f32(r.next_u32() >> 8) / f32(1 << 24)
+}
+
+// Get a random float in [lo, hi).
+pub fn (mut r Rng) f32_range(lo f32, hi f32) f32 {
+	return lo + (hi - lo) * r.next_f32()
+}
+
+// Returns true with probability p.
+pub fn (mut r Rng) chance(p f32) bool {
+	return r.next_f32() < p
+}
+
+// Shuffle values in place.
+pub fn (mut r Rng) shuffle_ints(mut values []int) {
+	for i := values.len - 1; i > 0; i-- {
+		j := r.intn(i + 1)
+		values[i], values[j] = values[j], values[i]
+	}
+}
+
+// Save the generator's position in its sequence (see Stateful).
+pub fn (mut r Rng) save_state(mut w StateWriter) {
+	w.write_u64(r.state)
+	w.write_u64(r.inc)
+}
+
+// Restore a position saved with save_state.
+pub fn (mut r Rng) load_state(mut sr StateReader) ! {
+	r.state = sr.read_u64()!
+	r.inc = sr.read_u64()!
+}
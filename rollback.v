@@ -0,0 +1,195 @@
+module wasm96
+
+// Rollback netcode support.
+//
+// Rollback runs the game every frame without waiting for remote players:
+// inputs that haven't arrived are predicted (each player is assumed to keep
+// holding what they last sent). A snapshot of the registered save state
+// (see savestate_register) is kept for each recent frame along with the
+// inputs it ran with. When a late input turns out to differ from the
+// prediction, the game is restored to that frame and resimulated up to the
+// present with the corrected inputs, all within one update.
+//
+// The SDK doesn't do networking: send local inputs to peers however the host
+// allows, and feed everything received to add_input. Frame numbers count
+// advance calls from 0 and must agree between peers.
+
+// A game simulated under rollback. Its whole simulation state must be
+// registered with savestate_register so it can be restored.
+pub interface RollbackGame {
+mut:
+	// Advance one fixed step given every player's input for the frame.
+	step(inputs []u64)
+}
+
+// Recent snapshots and inputs for rolling back and resimulating.
+pub struct Rollback {
+pub:
+	players int
+	// How many frames a prediction may run ahead of the inputs received.
+	window int
+mut:
+	now         u64
+	slots       int
+	states      [][]u8
+	state_frame []u64
+	in_frame    []u64
+	in_val      []u64
+	used_frame  []u64
+	used_val    []u64
+	latest      []u64
+	has_latest  []bool
+	last_input  []u64
+	inputs      []u64
+	pending     u64 = rollback_none
+	rollbacks   u64
+	resimulated u64
+}
+
+const rollback_none = u64(0xffffffffffffffff)
+
+// Create a rollback session for players players, able to predict up to
+// window frames ahead (8 is about 130ms at 60 fps).
+pub fn new_rollback(players int, window int) Rollback {
+	p := max_int(1, players)
+	w := max_int(1, window)
+	// Twice the window, so frames still open for rollback never share a slot
+	// with inputs received ahead of time.
+	slots := w * 2
+	n := slots * p
+	return Rollback{
+		players: p
+		window: w
+		slots: slots
+		states: [][]u8{len: slots}
+		state_frame: []u64{len: slots, init: rollback_none}
+		in_frame: []u64{len: n, init: rollback_none}
+		in_val: []u64{len: n}
+		used_frame: []u64{len: n, init: rollback_none}
+		used_val: []u64{len: n}
+		latest: []u64{len: p}
+		has_latest: []bool{len: p}
+		last_input: []u64{len: p}
+		inputs: []u64{len: p}
+	}
+}
+
+// Get the number of the next frame advance will simulate.
+pub fn (rb &Rollback) frame() u64 {
+	return rb.now
+}
+
+// Record player's input for frame, local or received from a peer. If that
+// frame already ran on a different prediction, the next advance rolls back
+// to it. Returns false if frame is outside the window kept, too old to
+// correct or too far ahead to store.
+pub fn (mut rb Rollback) add_input(player int, frame u64, input u64) bool {
+	if player < 0 || player >= rb.players {
+		return false
+	}
+	if frame + u64(rb.window) < rb.now || frame >= rb.now + u64(rb.window) {
+		return false
+	}
+	i := rb.index(frame, player)
+	rb.in_frame[i] = frame
+	rb.in_val[i] = input
+	if !rb.has_latest[player] || frame >= rb.latest[player] {
+		rb.latest[player] = frame
+		rb.has_latest[player] = true
+		rb.last_input[player] = input
+	}
+	if rb.used_frame[i] == frame && rb.used_val[i] != input && frame < rb.pending {
+		rb.pending = frame
+	}
+	return true
+}
+
+// Returns true if the predictions have run the full window ahead of some
+// player's inputs. Stop calling advance (stall) until more input arrives.
+pub fn (rb &Rollback) stalled() bool {
+	for p in 0 .. rb.players {
+		known := if rb.has_latest[p] { rb.latest[p] + 1 } else { u64(0) }
+		if rb.now >= known + u64(rb.window) {
+			return true
+		}
+	}
+	return false
+}
+
+// Roll back and resimulate if a late input calls for it, then simulate the
+// next frame. Returns false without simulating if stalled. Call once per
+// fixed update. Returns an error, without simulating, if the frame to roll
+// back to is no longer kept or can't be restored; the session has then
+// diverged from its peers and needs resyncing.
+pub fn (mut rb Rollback) advance(mut game RollbackGame) !bool {
+	if rb.stalled() {
+		return false
+	}
+	if rb.pending < rb.now {
+		from := rb.pending
+		rb.pending = rollback_none
+		slot := int(from % u64(rb.slots))
+		if rb.state_frame[slot] != from {
+			return error('rollback: no snapshot for frame ${from}')
+		}
+		savestate_load(rb.states[slot]) or {
+			return error('rollback: restoring frame ${from} failed: ${err}')
+		}
+		rb.rollbacks++
+		for f := from; f < rb.now; f++ {
+			if f != from {
+				rb.snapshot(f)
+			}
+			rb.simulate(mut game, f)
+			runner.frame++
+			rb.resimulated++
+		}
+	}
+	rb.pending = rollback_none
+	rb.snapshot(rb.now)
+	rb.simulate(mut game, rb.now)
+	rb.now++
+	return true
+}
+
+// Get the save state hash taken at the start of frame, if it is still kept.
+// Peers can exchange these for confirmed frames to detect desyncs.
+pub fn (rb &Rollback) checksum(frame u64) ?u64 {
+	slot := int(frame % u64(rb.slots))
+	if rb.state_frame[slot] != frame {
+		return none
+	}
+	return hash_key(rb.states[slot])
+}
+
+// Get how many times the session rolled back, and how many frames it
+// resimulated in total.
+pub fn (rb &Rollback) stats() (u64, u64) {
+	return rb.rollbacks, rb.resimulated
+}
+
+fn (rb &Rollback) index(frame u64, player int) int {
+	return int(frame % u64(rb.slots)) * rb.players + player
+}
+
+fn (mut rb Rollback) snapshot(frame u64) {
+	slot := int(frame % u64(rb.slots))
+	mut w := StateWriter{
+		data: rb.states[slot]
+	}
+	w.reset()
+	savestate_write(mut w)
+	rb.states[slot] = w.data
+	rb.state_frame[slot] = frame
+}
+
+fn (mut rb Rollback) simulate(mut game RollbackGame, frame u64) {
+	for p in 0 .. rb.players {
+		i := rb.index(frame, p)
+		v := if rb.in_frame[i] == frame { rb.in_val[i] } else { rb.last_input[p] }
+		rb.used_frame[i] = frame
+		rb.used_val[i] = v
+		rb.inputs[p] = v
+	}
+	game.step(rb.inputs)
+}
@@ -0,0 +1,114 @@
+module wasm96
+
+// Image rotation by three shears.
+//
+// Rotating by sampling (mapping each output pixel back into the source)
+// drops and doubles pixels unevenly, which breaks up thin lines in pixel
+// art. Rotating by three shears (Paeth's method) instead shifts whole rows,
+// then whole columns, then whole rows again, so every source pixel lands
+// exactly once and lines keep their thickness. Rotations past 45 degrees
+// take exact quarter turns first, so shears never exceed 45 degrees.
+// Rotation allocates, so cache results rather than rotating every frame.
+//
+//   spin := ship.rotated(angle)
+//   spin.draw(cx - spin.width / 2, cy - spin.height / 2)
+
+// Get a copy turned clockwise by turns quarter turns (negative turns
+// counterclockwise).
+pub fn (img &Image) rotated90(turns int) Image {
+	q := turns & 3
+	if q == 0 {
+		return img.sub_image(0, 0, img.width, img.height)
+	}
+	w := img.width
+	h := img.height
+	mut out := if q == 2 { new_image(w, h) } else { new_image(h, w) }
+	for y in 0 .. h {
+		for x in 0 .. w {
+			c := img.px(x, y)
+			match q {
+				1 { out.set_px(h - 1 - y, x, c) }
+				2 { out.set_px(w - 1 - x, h - 1 - y, c) }
+				else { out.set_px(y, w - 1 - x, c) }
+			}
+		}
+	}
+	return out
+}
+
+// Get a copy rotated clockwise by angle radians about its center, sized to
+// hold the whole result; the center stays the center.
+pub fn (img &Image) rotated(angle f32) Image {
+	// Take the nearest quarter turn exactly, leaving at most 45 degrees.
+	q := int(floorf(angle / (pi / 2) + 0.5))
+	r := angle - f32(q) * pi / 2
+	base := img.rotated90(q)
+	if absf(r) < 0.0005 || base.width == 0 || base.height == 0 {
+		return base
+	}
+	// Work on a square big enough for every stage, centered on the image.
+	size := int(sqrtf(f32(base.width * base.width + base.height * base.height))) + 3
+	mut a := new_image(size, size)
+	a.copy_from(base, 0, 0, base.width, base.height, (size - base.width) / 2, (size - base.height) / 2)
+	mut b := new_image(size, size)
+	// Paeth: shear x by -tan(r / 2), y by sin(r), then x by -tan(r / 2).
+	alpha := -sinf(r / 2) / cosf(r / 2)
+	beta := sinf(r)
+	shear_x(a, mut b, alpha)
+	shear_y(b, mut a, beta)
+	shear_x(a, mut b, alpha)
+	// Crop to the rotated bounds.
+	c := absf(cosf(r))
+	s := absf(sinf(r))
+	w := int(f32(base.width) * c + f32(base.height) * s + 0.999)
+	h := int(f32(base.width) * s + f32(base.height) * c + 0.999)
+	return b.sub_image((size - w) / 2, (size - h) / 2, w, h)
+}
+
+// Shift each row of src by k times its distance from the center into dst.
+fn shear_x(src &Image, mut dst Image, k f32) {
+	n := src.width
+	center := f32(src.height) / 2
+	for y in 0 .. src.height {
+		offset := int(floorf(k * (f32(y) + 0.5 - center) + 0.5))
+		row := y * n * 4
+		for x in 0 .. n {
+			sx := x - offset
+			i := row + x * 4
+			if sx < 0 || sx >= n {
+				for ch in 0 .. 4 {
+					dst.pixels[i + ch] = 0
+				}
+				continue
+			}
+			j := row + sx * 4
+			for ch in 0 .. 4 {
+				dst.pixels[i + ch] = src.pixels[j + ch]
+			}
+		}
+	}
+}
+
+// Shift each column of src by k times its distance from the center into
+// dst.
+fn shear_y(src &Image, mut dst Image, k f32) {
+	n := src.height
+	center := f32(src.width) / 2
+	for x in 0 .. src.width {
+		offset := int(floorf(k * (f32(x) + 0.5 - center) + 0.5))
+		for y in 0 .. n {
+			sy := y - offset
+			i := (y * src.width + x) * 4
+			if sy < 0 || sy >= n {
+				for ch in 0 .. 4 {
+					dst.pixels[i + ch] = 0
+				}
+				continue
+			}
+			j := (sy * src.width + x) * 4
+			for ch in 0 .. 4 {
+				dst.pixels[i + ch] = src.pixels[j + ch]
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+module wasm96
+
+// Game runner and frame counter.
+
+// A game driven by run_frame.
+pub interface Game {
+mut:
+	// Advance the simulation by dt seconds. dt is always the fixed step.
+	update(dt f32)
+	// Draw the current state. alpha (0 to 1) is how far real time has moved
+	// past the last update towards the next one, for interpolating positions.
+	draw(alpha f32)
+}
+
+struct Runner {
+mut:
+	frame       u64
+	step_ms     f64 = 1000.0 / 60.0
+	max_updates int = 5
+	accumulator f64
+	last_ms     u64
+	dropped     u64
+	// Frame skipping: most draws skipped in a row (0 disables), the current
+	// run of skips, and the total.
+	frame_skip int
+	skip_run   int
+	skipped    u64
+	// Game speed multiplier applied to elapsed time.
+	time_scale f64 = 1
+}
+
+__global runner Runner
+
+// Set how many fixed updates run per second (60 by default).
+pub fn runner_set_update_rate(hz f32) {
+	if hz > 0 {
+		runner.step_ms = 1000.0 / f64(hz)
+	}
+}
+
+// Run one fixed update per host frame, at whatever rate the host displays
+// (see host_refresh_rate), instead of 60 per second.
+pub fn runner_use_host_rate() {
+	runner_set_update_rate(host_refresh_rate())
+}
+
+// Get the fixed update step in seconds.
+pub fn runner_step() f32 {
+	return f32(runner.step_ms / 1000.0)
+}
+
+// Set the most updates run_frame may run to catch up before dropping the
+// backlog (5 by default). This keeps a slow frame from snowballing into
+// ever longer catch-up frames.
+pub fn runner_set_max_updates(n int) {
+	if n > 0 {
+		runner.max_updates = n
+	}
+}
+
+// Run the game at scale times normal speed (clamped to 0.1 to 4), for slow
+// motion, fast-forward while debugging, or retro-style slowdown when lots is
+// on screen. Updates keep their fixed step; only how many run per second
+// changes, so the simulation stays deterministic. With pitch set, host-played
+// audio is sped up or slowed down to match where the host supports it.
+pub fn runner_set_time_scale(scale f32, pitch bool) {
+	runner.time_scale = f64(clampf(scale, 0.1, 4))
+	if pitch {
+		audio_set_pitch(f32(runner.time_scale))
+	}
+}
+
+// Get the current game speed multiplier.
+pub fn runner_time_scale() f32 {
+	return f32(runner.time_scale)
+}
+
+// Get the number of updates dropped because run_frame fell too far behind.
+pub fn runner_dropped_updates() u64 {
+	return runner.dropped
+}
+
+// Let run_frame skip drawing for up to n frames in a row while it is behind
+// (it needed more than one update to catch up), so slow devices spend their
+// time on logic and game speed stays constant. Needs host support for
+// skipping frames; 0 (the default) always draws.
+pub fn runner_set_frame_skip(n int) {
+	runner.frame_skip = if n > 0 { n } else { 0 }
+}
+
+// Get the number of draws skipped to catch up.
+pub fn runner_skipped_frames() u64 {
+	return runner.skipped
+}
+
+// Run one frame of game: reset per-frame SDK state (frame arena, trace
+// spans), run as many fixed-step updates as the time since the last frame
+// calls for, then draw once (or skip the draw, see runner_set_frame_skip).
+// Call from the exported draw function.
+pub fn run_frame(mut game Game) {
+	now := C.wasm96_system_millis()
+	elapsed := if runner.last_ms == 0 { runner.step_ms } else { f64(now - runner.last_ms) }
+	runner.last_ms = now
+	runner.accumulator += elapsed * runner.time_scale
+	frame_arena_reset()
+	trace_frame()
+	mut updates := 0
+	for runner.accumulator >= runner.step_ms {
+		if updates >= runner.max_updates {
+			runner.dropped += u64(runner.accumulator / runner.step_ms)
+			runner.accumulator = 0
+			break
+		}
+		runner.frame++
+		game.update(f32(runner.step_ms / 1000.0))
+		runner.accumulator -= runner.step_ms
+		updates++
+	}
+	if updates > 1 && runner.skip_run < runner.frame_skip && graphics_skip_frame() {
+		runner.skip_run++
+		runner.skipped++
+		return
+	}
+	runner.skip_run = 0
+	game.draw(f32(runner.accumulator / runner.step_ms))
+}
+
+// Get the number of fixed updates run so far. The first update is frame 1.
+// Frame-based timers count updates, so they stay deterministic however
+// irregularly the host calls the guest.
+pub fn frame_count() u64 {
+	return runner.frame
+}
+
+// Get the number of frames since frame.
+pub fn frames_since(frame u64) u64 {
+	return runner.frame - frame
+}
+
+// Convert seconds to a number of fixed updates at the runner's rate (60 per
+// second unless changed with runner_set_update_rate).
+pub fn ticks60(seconds f32) u64 {
+	if seconds <= 0 {
+		return 0
+	}
+	return u64(f64(seconds) * 1000.0 / runner.step_ms + 0.5)
+}
+
+// Returns true once every n frames.
+pub fn every_frames(n u64) bool {
+	return n > 0 && runner.frame % n == 0
+}
+
+// Returns true for the first half of every period frames, for blink effects.
+pub fn blink(period u64) bool {
+	return period > 0 && runner.frame % period < period / 2
+}
+
+// A countdown measured in frames.
+pub struct FrameTimer {
+mut:
+	end u64
+}
+
+// Start a timer that finishes after frames frames.
+pub fn frame_timer(frames u64) FrameTimer {
+	return FrameTimer{
+		end: runner.frame + frames
+	}
+}
+
+// Restart the timer to finish after frames frames.
+pub fn (mut t FrameTimer) start(frames u64) {
+	t.end = runner.frame + frames
+}
+
+// Returns true once the timer has finished.
+pub fn (t FrameTimer) done() bool {
+	return runner.frame >= t.end
+}
+
+// Get the number of frames left before the timer finishes.
+pub fn (t FrameTimer) remaining() u64 {
+	if runner.frame >= t.end {
+		return 0
+	}
+	return t.end - runner.frame
+}
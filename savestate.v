@@ -0,0 +1,293 @@
+module wasm96
+
+// Save states and frame state hashing.
+//
+// Game objects that implement Stateful are registered by name. A save state
+// is every registered object's serialized state plus the frame counter, so
+// it can be kept in memory (rewind, rollback), written to storage, or hashed:
+// savestate_hash gives a stable 64-bit digest that peers in a netplay session
+// can compare each frame to catch desyncs, and that tests can compare across
+// runs to check a simulation is deterministic.
+//
+// Values are written little-endian with fixed sizes, so the same state gives
+// the same bytes on every host.
+
+const savestate_magic = u32(0x53363957) // 'W96S'
+
+const savestate_version = u32(1)
+
+// Something whose state can be saved and restored.
+pub interface Stateful {
+mut:
+	// Write the complete state.
+	save_state(mut w StateWriter)
+	// Read back what save_state wrote.
+	load_state(mut r StateReader) !
+}
+
+// Serializes values into a growing byte buffer.
+pub struct StateWriter {
+pub mut:
+	data []u8
+}
+
+// Append a byte.
+pub fn (mut w StateWriter) write_u8(v u8) {
+	w.data << v
+}
+
+// Append a bool as one byte.
+pub fn (mut w StateWriter) write_bool(v bool) {
+	w.data << if v { u8(1) } else { u8(0) }
+}
+
+// Append a 16-bit value.
+pub fn (mut w StateWriter) write_u16(v u16) {
+	w.data << u8(v)
+	w.data << u8(v >> 8)
+}
+
+// Append a 32-bit value.
+pub fn (mut w StateWriter) write_u32(v u32) {
+	for i in 0 .. 4 {
+		w.data << u8(v >> (i * 8))
+	}
+}
+
+// Append a 64-bit value.
+pub fn (mut w StateWriter) write_u64(v u64) {
+	for i in 0 .. 8 {
+		w.data << u8(v >> (i * 8))
+	}
+}
+
+// Append an int as 32 bits.
+pub fn (mut w StateWriter) write_i32(v int) {
+	w.write_u32(u32(v))
+}
+
+// Append an i64.
+pub fn (mut w StateWriter) write_i64(v i64) {
+	w.write_u64(u64(v))
+}
+
+// Append an f32 by its bits.
+pub fn (mut w StateWriter) write_f32(v f32) {
+	w.write_u32(unsafe { *(&u32(&v)) })
+}
+
+// Append a length-prefixed byte slice.
+pub fn (mut w StateWriter) write_bytes(b []u8) {
+	w.write_u32(u32(b.len))
+	w.data << b
+}
+
+// Append a length-prefixed string.
+pub fn (mut w StateWriter) write_string(s string) {
+	w.write_bytes(s.bytes())
+}
+
+// Get a 64-bit FNV-1a hash of everything written so far.
+pub fn (w &StateWriter) hash() u64 {
+	return hash_key(w.data)
+}
+
+// Empty the buffer, keeping its capacity.
+pub fn (mut w StateWriter) reset() {
+	w.data.clear()
+}
+
+// Reads values back from a buffer written by a StateWriter.
+pub struct StateReader {
+	data []u8
+mut:
+	pos int
+}
+
+// Create a reader over data.
+pub fn new_state_reader(data []u8) StateReader {
+	return StateReader{
+		data: data
+	}
+}
+
+fn (mut r StateReader) take(n int) ![]u8 {
+	if n < 0 || r.pos + n > r.data.len {
+		return error('savestate: truncated state')
+	}
+	b := r.data[r.pos..r.pos + n]
+	r.pos += n
+	return b
+}
+
+// Read a byte.
+pub fn (mut r StateReader) read_u8() !u8 {
+	b := r.take(1)!
+	return b[0]
+}
+
+// Read a bool.
+pub fn (mut r StateReader) read_bool() !bool {
+	return r.read_u8()! != 0
+}
+
+// Read a 16-bit value.
+pub fn (mut r StateReader) read_u16() !u16 {
+	b := r.take(2)!
+	return u16(b[0]) | u16(b[1]) << 8
+}
+
+// Read a 32-bit value.
+pub fn (mut r StateReader) read_u32() !u32 {
+	b := r.take(4)!
+	return u32(b[0]) | u32(b[1]) << 8 | u32(b[2]) << 16 | u32(b[3]) << 24
+}
+
+// Read a 64-bit value.
+pub fn (mut r StateReader) read_u64() !u64 {
+	lo := r.read_u32()!
+	hi := r.read_u32()!
+	return u64(lo) | u64(hi) << 32
+}
+
+// Read an int written with write_i32.
+pub fn (mut r StateReader) read_i32() !int {
+	return int(r.read_u32()!)
+}
+
+// Read an i64.
+pub fn (mut r StateReader) read_i64() !i64 {
+	return i64(r.read_u64()!)
+}
+
+// Read an f32.
+pub fn (mut r StateReader) read_f32() !f32 {
+	bits := r.read_u32()!
+	return unsafe { *(&f32(&bits)) }
+}
+
+// Read a length-prefixed byte slice. The result is a copy.
+pub fn (mut r StateReader) read_bytes() ![]u8 {
+	n := int(r.read_u32()!)
+	return r.take(n)!.clone()
+}
+
+// Read a length-prefixed string.
+pub fn (mut r StateReader) read_string() !string {
+	return r.read_bytes()!.bytestr()
+}
+
+// Get the number of bytes not yet read.
+pub fn (r &StateReader) remaining() int {
+	return r.data.len - r.pos
+}
+
+struct SaveStateEntry {
+	name string
+	key  u64
+mut:
+	obj Stateful
+}
+
+struct SaveStates {
+mut:
+	entries []SaveStateEntry
+	scratch StateWriter
+}
+
+__global savestates SaveStates
+
+// Register obj, under a name unique to it, to be included in save states.
+// Pass a reference (&thing) so later changes to the object are seen; it
+// must stay alive while registered. Registering a name again replaces it.
+pub fn savestate_register(name string, obj Stateful) {
+	key := hash_key(name.bytes())
+	for mut e in savestates.entries {
+		if e.key == key {
+			e.obj = obj
+			return
+		}
+	}
+	savestates.entries << SaveStateEntry{
+		name: name
+		key: key
+		obj: obj
+	}
+}
+
+// Remove the object registered under name.
+pub fn savestate_unregister(name string) {
+	key := hash_key(name.bytes())
+	for i, e in savestates.entries {
+		if e.key == key {
+			savestates.entries.delete(i)
+			return
+		}
+	}
+}
+
+// Write the frame counter and every registered object's state to w.
+pub fn savestate_write(mut w StateWriter) {
+	w.write_u32(savestate_magic)
+	w.write_u32(savestate_version)
+	w.write_u64(runner.frame)
+	w.write_u32(u32(savestates.entries.len))
+	for mut e in savestates.entries {
+		w.write_u64(e.key)
+		// Reserve the length and fill it in afterwards.
+		at := w.data.len
+		w.write_u32(0)
+		e.obj.save_state(mut w)
+		n := u32(w.data.len - at - 4)
+		for i in 0 .. 4 {
+			w.data[at + i] = u8(n >> (i * 8))
+		}
+	}
+}
+
+// Save the current state into a new buffer.
+pub fn savestate_save() []u8 {
+	mut w := StateWriter{}
+	savestate_write(mut w)
+	return w.data
+}
+
+// Restore a state saved with savestate_save, including the frame counter.
+// Objects are matched by name; saved objects no longer registered are
+// skipped. Fails if the data is not a save state or an object rejects its
+// part, in which case objects already restored keep their new state.
+pub fn savestate_load(data []u8) ! {
+	mut r := new_state_reader(data)
+	if r.read_u32()! != savestate_magic {
+		return error('savestate: not a save state')
+	}
+	if r.read_u32()! != savestate_version {
+		return error('savestate: unsupported version')
+	}
+	frame := r.read_u64()!
+	count := int(r.read_u32()!)
+	for _ in 0 .. count {
+		key := r.read_u64()!
+		n := int(r.read_u32()!)
+		part := r.take(n)!
+		for mut e in savestates.entries {
+			if e.key == key {
+				mut sub := new_state_reader(part)
+				e.obj.load_state(mut sub) or {
+					return error('${err.msg()} (${e.name})')
+				}
+				break
+			}
+		}
+	}
+	runner.frame = frame
+}
+
+// Get a 64-bit digest of the current state. Equal states always give equal
+// digests, so comparing digests from two machines (or two runs) each frame
+// detects the first frame they diverged.
+pub fn savestate_hash() u64 {
+	savestates.scratch.reset()
+	savestate_write(mut savestates.scratch)
+	return savestates.scratch.hash()
+}
@@ -0,0 +1,106 @@
+module wasm96
+
+struct TestCounter {
+mut:
+	n int
+}
+
+fn (c &TestCounter) save_state(mut w StateWriter) {
+	w.write_i32(c.n)
+}
+
+fn (mut c TestCounter) load_state(mut r StateReader) ! {
+	c.n = r.read_i32()!
+}
+
+fn test_state_writer_layout() {
+	mut w := StateWriter{}
+	w.write_u8(7)
+	w.write_bool(true)
+	w.write_u16(0x1234)
+	w.write_u32(0xdeadbeef)
+	w.write_i32(-2)
+	w.write_u64(0x0102030405060708)
+	w.write_f32(1.0)
+	w.write_string('hi')
+	assert w.data == [u8(7), 1, 0x34, 0x12, 0xef, 0xbe, 0xad, 0xde, 0xfe, 0xff, 0xff, 0xff, 8, 7,
+		6, 5, 4, 3, 2, 1, 0, 0, 0x80, 0x3f, 2, 0, 0, 0, `h`, `i`]
+}
+
+fn test_state_round_trip() ! {
+	mut w := StateWriter{}
+	w.write_u8(7)
+	w.write_bool(true)
+	w.write_u16(0x1234)
+	w.write_u32(0xdeadbeef)
+	w.write_u64(0x0123456789abcdef)
+	w.write_i32(-5)
+	w.write_i64(-6)
+	w.write_f32(1.5)
+	w.write_bytes([u8(1), 2, 3])
+	w.write_string('wasm96')
+	mut r := new_state_reader(w.data)
+	assert r.read_u8()! == 7
+	assert r.read_bool()!
+	assert r.read_u16()! == 0x1234
+	assert r.read_u32()! == 0xdeadbeef
+	assert r.read_u64()! == 0x0123456789abcdef
+	assert r.read_i32()! == -5
+	assert r.read_i64()! == -6
+	assert r.read_f32()! == 1.5
+	assert r.read_bytes()! == [u8(1), 2, 3]
+	assert r.read_string()! == 'wasm96'
+	assert r.remaining() == 0
+	if _ := r.read_u8() {
+		assert false
+	}
+}
+
+fn test_state_hash_is_fnv1a() {
+	// Published FNV-1a 64 test vectors.
+	mut w := StateWriter{}
+	assert w.hash() == 0xcbf29ce484222325
+	w.write_u8(`a`)
+	assert w.hash() == 0xaf63dc4c8601ec8c
+	w.write_string('bc')
+	assert w.hash() == hash_key(w.data)
+	w.reset()
+	w.data << 'foobar'.bytes()
+	assert w.hash() == 0x85944171f73967e8
+}
+
+fn test_savestate_save_load() ! {
+	mut c := &TestCounter{
+		n: 7
+	}
+	savestate_register('counter', c)
+	defer {
+		savestate_unregister('counter')
+	}
+	runner.frame = 42
+	// Header, frame, one entry: name hash, length and the counter.
+	mut want := StateWriter{}
+	want.write_u32(savestate_magic)
+	want.write_u32(savestate_version)
+	want.write_u64(42)
+	want.write_u32(1)
+	want.write_u64(hash_key('counter'.bytes()))
+	want.write_u32(4)
+	want.write_i32(7)
+	saved := savestate_save()
+	assert saved == want.data
+	assert savestate_hash() == want.hash()
+	c.n = 99
+	runner.frame = 100
+	assert savestate_hash() != want.hash()
+	savestate_load(saved)!
+	assert c.n == 7
+	assert runner.frame == 42
+	assert savestate_hash() == want.hash()
+	if _ := savestate_load(saved[..10]) {
+		assert false
+	}
+	if _ := savestate_load([]u8{len: 24}) {
+		assert false
+	}
+}
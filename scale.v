@@ -0,0 +1,178 @@
+module wasm96
+
+// Image scaling: nearest, bilinear, Scale2x and Scale3x.
+//
+// Nearest keeps pixels hard-edged and suits whole multiples; bilinear
+// smooths, for odd sizes where nearest would make uneven pixels. Scale2x
+// and Scale3x (also known as AdvMAME2x/3x) double or triple pixel art while
+// rounding off its diagonal stair steps, without adding any new colors.
+// Surfaces are images, so all of these work on them too.
+//
+//   big := sprite.scaled(.scale2x, sprite.width * 4, sprite.height * 4)
+
+// How an image is resampled to a new size.
+pub enum ScaleFilter {
+	nearest
+	bilinear
+	// Scale2x as many times as fits, then nearest to the exact size.
+	scale2x
+	// Scale3x as many times as fits, then nearest to the exact size.
+	scale3x
+}
+
+// Get pixel (x, y) as packed RGBA, clamping to the edges.
+fn (img &Image) px(x int, y int) u32 {
+	i := (clamp_int(y, 0, img.height - 1) * img.width + clamp_int(x, 0, img.width - 1)) * 4
+	return u32(img.pixels[i]) | u32(img.pixels[i + 1]) << 8 | u32(img.pixels[i + 2]) << 16 | u32(img.pixels[
+		i + 3]) << 24
+}
+
+fn (mut img Image) set_px(x int, y int, c u32) {
+	i := (y * img.width + x) * 4
+	img.pixels[i] = u8(c)
+	img.pixels[i + 1] = u8(c >> 8)
+	img.pixels[i + 2] = u8(c >> 16)
+	img.pixels[i + 3] = u8(c >> 24)
+}
+
+// Get a copy resized to w x h with filter.
+pub fn (img &Image) scaled(filter ScaleFilter, w int, h int) Image {
+	mut out := new_image(max_int(0, w), max_int(0, h))
+	img.scale_into(mut out, filter)
+	return out
+}
+
+// Resize the image into dst, filling all of dst. Reusing dst each frame
+// avoids allocating for the nearest and bilinear filters.
+pub fn (img &Image) scale_into(mut dst Image, filter ScaleFilter) {
+	if img.width == 0 || img.height == 0 || dst.width == 0 || dst.height == 0 {
+		return
+	}
+	match filter {
+		.nearest {
+			img.nearest_into(mut dst)
+		}
+		.bilinear {
+			img.bilinear_into(mut dst)
+		}
+		.scale2x, .scale3x {
+			k := if filter == .scale2x { 2 } else { 3 }
+			mut cur := *img
+			for cur.width * k <= dst.width && cur.height * k <= dst.height {
+				cur = if k == 2 { cur.scale2x() } else { cur.scale3x() }
+			}
+			cur.nearest_into(mut dst)
+		}
+	}
+}
+
+fn (img &Image) nearest_into(mut dst Image) {
+	if img.width == dst.width && img.height == dst.height {
+		for i in 0 .. dst.pixels.len {
+			dst.pixels[i] = img.pixels[i]
+		}
+		return
+	}
+	for y in 0 .. dst.height {
+		sy := y * img.height / dst.height
+		for x in 0 .. dst.width {
+			j := (sy * img.width + x * img.width / dst.width) * 4
+			k := (y * dst.width + x) * 4
+			dst.pixels[k] = img.pixels[j]
+			dst.pixels[k + 1] = img.pixels[j + 1]
+			dst.pixels[k + 2] = img.pixels[j + 2]
+			dst.pixels[k + 3] = img.pixels[j + 3]
+		}
+	}
+}
+
+fn (img &Image) bilinear_into(mut dst Image) {
+	// 16.16 source position of each destination pixel center, less half a
+	// pixel so weights fall between the neighbouring source centers.
+	step_x := (i64(img.width) << 16) / dst.width
+	step_y := (i64(img.height) << 16) / dst.height
+	for y in 0 .. dst.height {
+		fy := max_int(0, int(step_y * y + step_y / 2 - 32768))
+		y0 := fy >> 16
+		y1 := min_int(y0 + 1, img.height - 1)
+		wy := (fy >> 8) & 0xff
+		for x in 0 .. dst.width {
+			fx := max_int(0, int(step_x * x + step_x / 2 - 32768))
+			x0 := fx >> 16
+			x1 := min_int(x0 + 1, img.width - 1)
+			wx := (fx >> 8) & 0xff
+			a := (y0 * img.width + x0) * 4
+			b := (y0 * img.width + x1) * 4
+			c := (y1 * img.width + x0) * 4
+			d := (y1 * img.width + x1) * 4
+			k := (y * dst.width + x) * 4
+			for ch in 0 .. 4 {
+				top := int(img.pixels[a + ch]) * (256 - wx) + int(img.pixels[b + ch]) * wx
+				bottom := int(img.pixels[c + ch]) * (256 - wx) + int(img.pixels[d + ch]) * wx
+				dst.pixels[k + ch] = u8((top * (256 - wy) + bottom * wy) >> 16)
+			}
+		}
+	}
+}
+
+// Get a copy at twice the size with Scale2x.
+pub fn (img &Image) scale2x() Image {
+	mut out := new_image(img.width * 2, img.height * 2)
+	for y in 0 .. img.height {
+		for x in 0 .. img.width {
+			//   a
+			// c p b
+			//   d
+			p := img.px(x, y)
+			a := img.px(x, y - 1)
+			b := img.px(x + 1, y)
+			c := img.px(x - 1, y)
+			d := img.px(x, y + 1)
+			ox := x * 2
+			oy := y * 2
+			out.set_px(ox, oy, if c == a && c != d && a != b { a } else { p })
+			out.set_px(ox + 1, oy, if a == b && a != c && b != d { b } else { p })
+			out.set_px(ox, oy + 1, if d == c && d != b && c != a { c } else { p })
+			out.set_px(ox + 1, oy + 1, if b == d && b != a && d != c { d } else { p })
+		}
+	}
+	return out
+}
+
+// Get a copy at three times the size with Scale3x.
+pub fn (img &Image) scale3x() Image {
+	mut out := new_image(img.width * 3, img.height * 3)
+	for y in 0 .. img.height {
+		for x in 0 .. img.width {
+			// a b c
+			// d e f
+			// g h i
+			a := img.px(x - 1, y - 1)
+			b := img.px(x, y - 1)
+			c := img.px(x + 1, y - 1)
+			d := img.px(x - 1, y)
+			e := img.px(x, y)
+			f := img.px(x + 1, y)
+			g := img.px(x - 1, y + 1)
+			h := img.px(x, y + 1)
+			i := img.px(x + 1, y + 1)
+			ox := x * 3
+			oy := y * 3
+			// Which edges meet at a corner.
+			db := d == b && b != f && d != h
+			bf := b == f && b != d && f != h
+			dh := d == h && d != b && h != f
+			hf := h == f && d != h && b != f
+			out.set_px(ox, oy, if db { d } else { e })
+			out.set_px(ox + 1, oy, if (db && e != c) || (bf && e != a) { b } else { e })
+			out.set_px(ox + 2, oy, if bf { f } else { e })
+			out.set_px(ox, oy + 1, if (db && e != g) || (dh && e != a) { d } else { e })
+			out.set_px(ox + 1, oy + 1, e)
+			out.set_px(ox + 2, oy + 1, if (bf && e != i) || (hf && e != c) { f } else { e })
+			out.set_px(ox, oy + 2, if dh { d } else { e })
+			out.set_px(ox + 1, oy + 2, if (dh && e != i) || (hf && e != g) { h } else { e })
+			out.set_px(ox + 2, oy + 2, if hf { f } else { e })
+		}
+	}
+	return out
+}
@@ -0,0 +1,57 @@
+module wasm96
+
+// Accelerometer and gyroscope input, over libretro's sensor interface.
+//
+// Sensors are off until enabled, since polling them costs battery on
+// handhelds. Readings are per port: axis 0 to 2 of wasm96_input_sensor_get
+// are the accelerometer's x, y and z, 3 to 5 the gyroscope's.
+
+// Motion sensors a device may have.
+pub enum Sensor as u32 {
+	accelerometer
+	gyroscope
+}
+
+// Turn a sensor on for port, sampling at about rate_hz (0 lets the host
+// choose). Returns false if the host or device has no such sensor.
+pub fn sensor_enable(port u32, sensor Sensor, rate_hz u32) bool {
+	if !compat_require(.sensors) {
+		return false
+	}
+	return record_status(C.wasm96_input_sensor_set(port, u32(sensor), 1, rate_hz))
+}
+
+// Turn a sensor off.
+pub fn sensor_disable(port u32, sensor Sensor) {
+	if !compat_require(.sensors) {
+		return
+	}
+	C.wasm96_input_sensor_set(port, u32(sensor), 0, 0)
+}
+
+fn sensor_axes(port u32, first u32) (f32, f32, f32) {
+	if !compat_require(.sensors) {
+		return 0, 0, 0
+	}
+	return C.wasm96_input_sensor_get(port, first), C.wasm96_input_sensor_get(port, first + 1), C.wasm96_input_sensor_get(port,
+		first + 2)
+}
+
+// Get the acceleration on port's device along x, y and z in g (1 g is
+// gravity, so a device lying flat reads about (0, 0, 1)). Zero if disabled.
+pub fn sensor_accel(port u32) (f32, f32, f32) {
+	return sensor_axes(port, 0)
+}
+
+// Get the rotation rate of port's device around x, y and z in radians per
+// second. Zero if disabled.
+pub fn sensor_gyro(port u32) (f32, f32, f32) {
+	return sensor_axes(port, 3)
+}
+
+// Get the device's tilt from the accelerometer as (x, y) in -1 to 1, for
+// steering by tilting: x is left/right and y is towards/away from the player.
+pub fn sensor_tilt(port u32) (f32, f32) {
+	x, y, _ := sensor_accel(port)
+	return clampf(x, -1, 1), clampf(y, -1, 1)
+}
@@ -0,0 +1,420 @@
+module wasm96
+
+// Game settings.
+//
+// Settings declares typed options (on/off toggles, number ranges, lists of
+// choices and joypad button bindings) with defaults, keeps their values,
+// and saves them to storage. Every option records the settings version its
+// default was last changed in (0 unless marked with changed_in), so when a
+// newer build loads an older save, options whose defaults have changed since
+// take the new default while the rest keep the player's choice.
+// SettingsMenu shows and edits them.
+//
+//   mut opts := wasm96.new_settings('options', 2)
+//   opts.add_range('volume', 'Volume', 0, 10, 1, 8)
+//   opts.add_toggle('crt', 'CRT filter', false)
+//   opts.changed_in('crt', 2) // default was true in version 1
+//   opts.add_binding('jump', 'Jump', .a)
+//   opts.load()
+
+// What kind of value an option holds.
+pub enum SettingKind {
+	toggle
+	range
+	choice
+	binding
+}
+
+// An option and its default.
+pub struct Setting {
+pub:
+	name  string
+	label string
+	kind  SettingKind
+	// Range bounds and step.
+	min  int
+	max  int
+	step int = 1
+	// Labels for choice options.
+	choices []string
+	default int
+	// Settings version the default was last changed in.
+	since u32
+}
+
+const settings_magic = u32(0x4f363957) // 'W96O'
+
+// A set of options and their values.
+pub struct Settings {
+pub:
+	// Storage key the settings are saved under.
+	key     string
+	version u32
+mut:
+	defs   []Setting
+	values []int
+	index  map[string]int
+	dirty  bool
+}
+
+// Create an empty set of settings saved under key, at version.
+pub fn new_settings(key string, version u32) Settings {
+	return Settings{
+		key: key
+		version: version
+	}
+}
+
+// Declare an option. Redeclaring a name replaces it.
+pub fn (mut s Settings) add(def Setting) {
+	if i := s.index[def.name] {
+		s.defs[i] = def
+		s.values[i] = def.default
+		return
+	}
+	s.index[def.name] = s.defs.len
+	s.defs << def
+	s.values << def.default
+}
+
+// Declare an on/off option.
+pub fn (mut s Settings) add_toggle(name string, label string, default bool) {
+	s.add(Setting{
+		name: name
+		label: label
+		kind: .toggle
+		max: 1
+		default: if default { 1 } else { 0 }
+	})
+}
+
+// Declare a number from min to max in steps of step.
+pub fn (mut s Settings) add_range(name string, label string, min int, max int, step int, default int) {
+	s.add(Setting{
+		name: name
+		label: label
+		kind: .range
+		min: min
+		max: max
+		step: max_int(1, step)
+		default: default
+	})
+}
+
+// Declare a choice from a list, holding the chosen index.
+pub fn (mut s Settings) add_choice(name string, label string, choices []string, default int) {
+	s.add(Setting{
+		name: name
+		label: label
+		kind: .choice
+		max: choices.len - 1
+		choices: choices
+		default: default
+	})
+}
+
+// Declare a joypad button binding for an action.
+pub fn (mut s Settings) add_binding(name string, label string, default Button) {
+	s.add(Setting{
+		name: name
+		label: label
+		kind: .binding
+		max: glyph_button_names.len - 1
+		default: int(default)
+	})
+}
+
+// Record that an option's default changed in version, so saves from before
+// it reset the option instead of keeping the old value.
+pub fn (mut s Settings) changed_in(name string, version u32) {
+	if i := s.index[name] {
+		s.defs[i] = Setting{
+			...s.defs[i]
+			since: version
+		}
+	}
+}
+
+// Get the number of options.
+pub fn (s &Settings) len() int {
+	return s.defs.len
+}
+
+// Get the i-th option's declaration.
+pub fn (s &Settings) def(i int) Setting {
+	return s.defs[i]
+}
+
+// Get an option's value, or 0 if there is no such option.
+pub fn (s &Settings) get(name string) int {
+	i := s.index[name] or { return 0 }
+	return s.values[i]
+}
+
+// Get a toggle's value.
+pub fn (s &Settings) get_bool(name string) bool {
+	return s.get(name) != 0
+}
+
+// Get the button bound to an action.
+pub fn (s &Settings) get_button(name string) Button {
+	return unsafe { Button(s.get(name)) }
+}
+
+// Returns true if the button bound to an action is down on port.
+pub fn (s &Settings) action_down(port u32, name string) bool {
+	return input_is_button_down(port, s.get_button(name))
+}
+
+fn (s &Settings) clamp(i int, v int) int {
+	d := s.defs[i]
+	return match d.kind {
+		.toggle { if v != 0 { 1 } else { 0 } }
+		else { clamp_int(v, d.min, d.max) }
+	}
+}
+
+// Set an option's value, clamped to its range.
+pub fn (mut s Settings) set(name string, value int) {
+	i := s.index[name] or { return }
+	s.set_at(i, value)
+}
+
+fn (mut s Settings) set_at(i int, value int) {
+	v := s.clamp(i, value)
+	if s.values[i] != v {
+		s.values[i] = v
+		s.dirty = true
+	}
+}
+
+// Put every option back to its default.
+pub fn (mut s Settings) reset() {
+	for i, d in s.defs {
+		s.set_at(i, d.default)
+	}
+}
+
+// Returns true if values changed since the last save or load.
+pub fn (s &Settings) changed() bool {
+	return s.dirty
+}
+
+// Get the text shown for the i-th option's value.
+pub fn (s &Settings) value_text(i int) string {
+	d := s.defs[i]
+	v := s.values[i]
+	return match d.kind {
+		.toggle { if v != 0 { 'On' } else { 'Off' } }
+		.range { v.str() }
+		.choice { if v >= 0 && v < d.choices.len { d.choices[v] } else { '' } }
+		.binding { glyph_button_names[v] }
+	}
+}
+
+// Save the values to storage.
+pub fn (mut s Settings) save() bool {
+	mut w := StateWriter{}
+	w.write_u32(settings_magic)
+	w.write_u32(s.version)
+	w.write_u32(u32(s.defs.len))
+	for i, d in s.defs {
+		w.write_string(d.name)
+		w.write_i32(s.values[i])
+	}
+	if !storage_save(s.key.bytes(), w.data) {
+		return false
+	}
+	s.dirty = false
+	return true
+}
+
+// Load saved values. Options missing from the save, or whose default changed
+// after the version it was written by, keep their defaults. Returns false if
+// nothing usable was saved.
+pub fn (mut s Settings) load() bool {
+	data := storage_load(s.key.bytes()) or { return false }
+	s.load_from(data) or { return false }
+	s.dirty = false
+	return true
+}
+
+fn (mut s Settings) load_from(data []u8) ! {
+	mut r := new_state_reader(data)
+	if r.read_u32()! != settings_magic {
+		return error('settings: bad data')
+	}
+	saved := r.read_u32()!
+	n := int(r.read_u32()!)
+	for _ in 0 .. n {
+		name := r.read_string()!
+		value := r.read_i32()!
+		i := s.index[name] or { continue }
+		if s.defs[i].since > saved {
+			continue
+		}
+		s.values[i] = s.clamp(i, value)
+	}
+}
+
+// A menu listing settings: up and down pick an option, left and right change
+// it, A toggles or starts rebinding (the next button pressed becomes the
+// binding) and B closes the menu.
+pub struct SettingsMenu {
+pub mut:
+	x     int
+	y     int
+	width int = 200
+	port  u32
+	// Glyphs draw the text and binding icons.
+	glyphs     Glyphs
+	sel_color  Color = Color{230, 200, 80, 255}
+	back_color Color = Color{20, 20, 40, 220}
+	// Save whenever a value changes.
+	autosave bool = true
+mut:
+	cursor    int
+	rebinding bool
+	prev      u32
+	held      int
+}
+
+// Create a menu at (x, y), width pixels wide.
+pub fn new_settings_menu(x int, y int, width int) SettingsMenu {
+	return SettingsMenu{
+		x: x
+		y: y
+		width: width
+	}
+}
+
+fn settings_buttons(port u32) u32 {
+	mut now := u32(0)
+	for i in 0 .. glyph_button_names.len {
+		if input_is_button_down(port, unsafe { Button(i) }) {
+			now |= u32(1) << u32(i)
+		}
+	}
+	return now
+}
+
+// Handle input for a frame. Returns false once the player closes the menu.
+pub fn (mut m SettingsMenu) update(mut s Settings) bool {
+	now := settings_buttons(m.port)
+	pressed := now & ~m.prev
+	m.prev = now
+	if s.len() == 0 {
+		return pressed & vk_bit(.b) == 0
+	}
+	m.cursor = clamp_int(m.cursor, 0, s.len() - 1)
+	if m.rebinding {
+		for i in 0 .. glyph_button_names.len {
+			if pressed & (u32(1) << u32(i)) != 0 {
+				s.set_at(m.cursor, i)
+				m.rebinding = false
+				m.commit(mut s)
+				break
+			}
+		}
+		return true
+	}
+	if pressed & vk_bit(.b) != 0 {
+		return false
+	}
+	if pressed & vk_bit(.up) != 0 {
+		m.cursor = (m.cursor + s.len() - 1) % s.len()
+	}
+	if pressed & vk_bit(.down) != 0 {
+		m.cursor = (m.cursor + 1) % s.len()
+	}
+	// Left and right repeat while held.
+	lr := now & (vk_bit(.left) | vk_bit(.right))
+	mut step := pressed & lr
+	if lr != 0 {
+		m.held++
+		if m.held > 15 && m.held % 4 == 0 {
+			step = lr
+		}
+	} else {
+		m.held = 0
+	}
+	d := s.defs[m.cursor]
+	mut dir := 0
+	if step & vk_bit(.left) != 0 {
+		dir--
+	}
+	if step & vk_bit(.right) != 0 {
+		dir++
+	}
+	if pressed & vk_bit(.a) != 0 {
+		match d.kind {
+			.toggle { dir = 1 }
+			.binding { m.rebinding = true }
+			else {}
+		}
+	}
+	if dir != 0 {
+		v := s.values[m.cursor]
+		match d.kind {
+			.toggle { s.set_at(m.cursor, 1 - v) }
+			.range { s.set_at(m.cursor, v + dir * d.step) }
+			.choice { s.set_at(m.cursor, (v + dir + d.choices.len) % max_int(1, d.choices.len)) }
+			.binding {}
+		}
+		m.commit(mut s)
+	}
+	return true
+}
+
+fn (mut m SettingsMenu) commit(mut s Settings) {
+	if m.autosave && s.changed() {
+		s.save()
+	}
+}
+
+// Get the menu's height in pixels for s.
+pub fn (m &SettingsMenu) height(s &Settings) int {
+	return s.len() * (m.glyphs.size() + 4) + 4
+}
+
+// Draw the menu.
+pub fn (m &SettingsMenu) draw(s &Settings) {
+	row_h := m.glyphs.size() + 4
+	graphics_set_color_rgba(m.back_color)
+	graphics_rect(m.x, m.y, u32(m.width), u32(m.height(s)))
+	for i in 0 .. s.len() {
+		d := s.defs[i]
+		y := m.y + 4 + i * row_h
+		selected := i == m.cursor
+		if selected {
+			graphics_set_color_rgba(m.sel_color)
+			graphics_rect_outline(m.x + 1, y - 2, u32(m.width - 2), u32(row_h))
+		}
+		m.glyphs.text(m.x + 6, y, d.label, if selected { m.sel_color } else { m.glyphs.text_color })
+		vx := m.x + m.width / 2 + 10
+		if d.kind == .binding {
+			if selected && m.rebinding {
+				if blink(20) {
+					m.glyphs.text(vx, y, '...', m.sel_color)
+				}
+			} else {
+				m.glyphs.draw_button(vx, y, s.get_button(d.name))
+			}
+			continue
+		}
+		text := s.value_text(i)
+		if d.kind == .range {
+			// A bar along with the number.
+			bw := m.width / 2 - 40
+			span := max_int(1, d.max - d.min)
+			graphics_set_color_rgba(m.glyphs.icon_color)
+			graphics_rect(vx, y + 2, u32(bw), u32(row_h - 8))
+			graphics_set_color_rgba(m.sel_color)
+			graphics_rect(vx, y + 2, u32(bw * (s.values[i] - d.min) / span), u32(row_h - 8))
+			m.glyphs.text(vx + bw + 4, y, text, m.glyphs.text_color)
+			continue
+		}
+		arrows := if selected && d.kind == .choice { '< ${text} >' } else { text }
+		m.glyphs.text(vx, y, arrows, m.glyphs.text_color)
+	}
+}
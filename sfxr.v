@@ -0,0 +1,383 @@
+module wasm96
+
+// Procedural sound effects in the style of sfxr.
+//
+// An Sfxr holds the classic sfxr parameter set: a waveform with a pitch
+// that can slide, vibrate and jump, shaped by an attack/sustain/decay
+// envelope, a phaser, low and high-pass filters and a retrigger. Start from
+// a preset, nudge it with mutate until it sounds right, then generate a
+// Sound for the mixer, so a game can carry its effects as a few numbers
+// instead of WAV files. Parameters run from 0 to 1, or -1 to 1 for ramps,
+// as in the original tool.
+//
+//   mut rng := wasm96.new_rng(7)
+//   coin := wasm96.sfxr_pickup(mut rng).generate()
+//   mix.play(coin, wasm96.bus_sfx, 1, 0)
+
+// Oscillator shapes.
+pub enum SfxrWave {
+	square
+	sawtooth
+	sine
+	noise
+}
+
+// Rate of sounds from Sfxr.generate, as in the original tool.
+pub const sfxr_rate = 44100
+
+// An sfxr sound description.
+pub struct Sfxr {
+pub mut:
+	wave SfxrWave
+	// Pitch.
+	base_freq  f32 = 0.3
+	freq_limit f32
+	freq_ramp  f32
+	freq_dramp f32
+	// Square wave duty cycle.
+	duty      f32
+	duty_ramp f32
+	// Vibrato.
+	vib_strength f32
+	vib_speed    f32
+	// Envelope.
+	env_attack  f32
+	env_sustain f32 = 0.3
+	env_punch   f32
+	env_decay   f32 = 0.4
+	// Filters.
+	lpf_freq      f32 = 1
+	lpf_ramp      f32
+	lpf_resonance f32
+	hpf_freq      f32
+	hpf_ramp      f32
+	// Phaser.
+	pha_offset f32
+	pha_ramp   f32
+	// Restart the pitch sweep this often.
+	repeat_speed f32
+	// Jump in pitch by arp_mod after arp_speed.
+	arp_speed f32
+	arp_mod   f32
+	volume    f32 = 0.5
+}
+
+// A coin or item pickup.
+pub fn sfxr_pickup(mut rng Rng) Sfxr {
+	mut p := Sfxr{}
+	p.base_freq = 0.4 + rng.f32_range(0, 0.5)
+	p.env_sustain = rng.f32_range(0, 0.1)
+	p.env_decay = 0.1 + rng.f32_range(0, 0.4)
+	p.env_punch = 0.3 + rng.f32_range(0, 0.3)
+	if rng.chance(0.5) {
+		p.arp_speed = 0.5 + rng.f32_range(0, 0.2)
+		p.arp_mod = 0.2 + rng.f32_range(0, 0.4)
+	}
+	return p
+}
+
+// A laser or shot.
+pub fn sfxr_laser(mut rng Rng) Sfxr {
+	mut p := Sfxr{}
+	p.wave = unsafe { SfxrWave(rng.intn(3)) }
+	if p.wave == .sine && rng.chance(0.5) {
+		p.wave = unsafe { SfxrWave(rng.intn(2)) }
+	}
+	p.base_freq = 0.5 + rng.f32_range(0, 0.5)
+	p.freq_limit = maxf(0.2, p.base_freq - 0.2 - rng.f32_range(0, 0.6))
+	p.freq_ramp = -0.15 - rng.f32_range(0, 0.2)
+	if rng.intn(3) == 0 {
+		p.base_freq = 0.3 + rng.f32_range(0, 0.6)
+		p.freq_limit = rng.f32_range(0, 0.1)
+		p.freq_ramp = -0.35 - rng.f32_range(0, 0.3)
+	}
+	if rng.chance(0.5) {
+		p.duty = rng.f32_range(0, 0.5)
+		p.duty_ramp = rng.f32_range(0, 0.2)
+	} else {
+		p.duty = 0.4 + rng.f32_range(0, 0.5)
+		p.duty_ramp = -rng.f32_range(0, 0.7)
+	}
+	p.env_sustain = 0.1 + rng.f32_range(0, 0.2)
+	p.env_decay = rng.f32_range(0, 0.4)
+	if rng.chance(0.5) {
+		p.env_punch = rng.f32_range(0, 0.3)
+	}
+	if rng.intn(3) == 0 {
+		p.pha_offset = rng.f32_range(0, 0.2)
+		p.pha_ramp = -rng.f32_range(0, 0.2)
+	}
+	if rng.chance(0.5) {
+		p.hpf_freq = rng.f32_range(0, 0.3)
+	}
+	return p
+}
+
+// An explosion.
+pub fn sfxr_explosion(mut rng Rng) Sfxr {
+	mut p := Sfxr{}
+	p.wave = .noise
+	if rng.chance(0.5) {
+		p.base_freq = 0.1 + rng.f32_range(0, 0.4)
+		p.freq_ramp = -0.1 + rng.f32_range(0, 0.4)
+	} else {
+		p.base_freq = 0.2 + rng.f32_range(0, 0.7)
+		p.freq_ramp = -0.2 - rng.f32_range(0, 0.2)
+	}
+	p.base_freq *= p.base_freq
+	if rng.intn(5) == 0 {
+		p.freq_ramp = 0
+	}
+	if rng.intn(3) == 0 {
+		p.repeat_speed = 0.3 + rng.f32_range(0, 0.5)
+	}
+	p.env_sustain = 0.1 + rng.f32_range(0, 0.3)
+	p.env_decay = rng.f32_range(0, 0.5)
+	if rng.chance(0.5) {
+		p.pha_offset = -0.3 + rng.f32_range(0, 0.9)
+		p.pha_ramp = -rng.f32_range(0, 0.3)
+	}
+	p.env_punch = 0.2 + rng.f32_range(0, 0.6)
+	if rng.chance(0.5) {
+		p.vib_strength = rng.f32_range(0, 0.7)
+		p.vib_speed = rng.f32_range(0, 0.6)
+	}
+	if rng.intn(3) == 0 {
+		p.arp_speed = 0.6 + rng.f32_range(0, 0.3)
+		p.arp_mod = 0.8 - rng.f32_range(0, 1.6)
+	}
+	return p
+}
+
+// A jump.
+pub fn sfxr_jump(mut rng Rng) Sfxr {
+	mut p := Sfxr{}
+	p.duty = rng.f32_range(0, 0.6)
+	p.base_freq = 0.3 + rng.f32_range(0, 0.3)
+	p.freq_ramp = 0.1 + rng.f32_range(0, 0.2)
+	p.env_sustain = 0.1 + rng.f32_range(0, 0.3)
+	p.env_decay = 0.1 + rng.f32_range(0, 0.2)
+	if rng.chance(0.5) {
+		p.hpf_freq = rng.f32_range(0, 0.3)
+	}
+	if rng.chance(0.5) {
+		p.lpf_freq = 1 - rng.f32_range(0, 0.6)
+	}
+	return p
+}
+
+fn sfxr_nudge(mut rng Rng, v f32, amount f32, lo f32) f32 {
+	if !rng.chance(0.5) {
+		return v
+	}
+	return clampf(v + rng.f32_range(-amount, amount), lo, 1)
+}
+
+// Randomly nudge about half the parameters by up to amount (0.05 is
+// sfxr's "mutate" button), keeping the waveform.
+pub fn (mut p Sfxr) mutate(mut rng Rng, amount f32) {
+	p.base_freq = sfxr_nudge(mut rng, p.base_freq, amount, 0)
+	p.freq_ramp = sfxr_nudge(mut rng, p.freq_ramp, amount, -1)
+	p.freq_dramp = sfxr_nudge(mut rng, p.freq_dramp, amount, -1)
+	p.duty = sfxr_nudge(mut rng, p.duty, amount, 0)
+	p.duty_ramp = sfxr_nudge(mut rng, p.duty_ramp, amount, -1)
+	p.vib_strength = sfxr_nudge(mut rng, p.vib_strength, amount, 0)
+	p.vib_speed = sfxr_nudge(mut rng, p.vib_speed, amount, 0)
+	p.env_attack = sfxr_nudge(mut rng, p.env_attack, amount, 0)
+	p.env_sustain = sfxr_nudge(mut rng, p.env_sustain, amount, 0)
+	p.env_punch = sfxr_nudge(mut rng, p.env_punch, amount, 0)
+	p.env_decay = sfxr_nudge(mut rng, p.env_decay, amount, 0)
+	p.lpf_freq = sfxr_nudge(mut rng, p.lpf_freq, amount, 0)
+	p.lpf_ramp = sfxr_nudge(mut rng, p.lpf_ramp, amount, -1)
+	p.lpf_resonance = sfxr_nudge(mut rng, p.lpf_resonance, amount, 0)
+	p.hpf_freq = sfxr_nudge(mut rng, p.hpf_freq, amount, 0)
+	p.hpf_ramp = sfxr_nudge(mut rng, p.hpf_ramp, amount, -1)
+	p.pha_offset = sfxr_nudge(mut rng, p.pha_offset, amount, -1)
+	p.pha_ramp = sfxr_nudge(mut rng, p.pha_ramp, amount, -1)
+	p.repeat_speed = sfxr_nudge(mut rng, p.repeat_speed, amount, 0)
+	p.arp_speed = sfxr_nudge(mut rng, p.arp_speed, amount, 0)
+	p.arp_mod = sfxr_nudge(mut rng, p.arp_mod, amount, -1)
+}
+
+// Oscillator and sweep state, reset each time the sound repeats.
+struct SfxrSweep {
+mut:
+	period     f32
+	max_period f32
+	slide      f32
+	dslide     f32
+	duty       f32
+	duty_slide f32
+	arp_mod    f32
+	arp_time   int
+	arp_limit  int
+}
+
+fn (p &Sfxr) sweep() SfxrSweep {
+	mut s := SfxrSweep{
+		period: 100 / (p.base_freq * p.base_freq + 0.001)
+		max_period: 100 / (p.freq_limit * p.freq_limit + 0.001)
+		slide: 1 - p.freq_ramp * p.freq_ramp * p.freq_ramp * 0.01
+		dslide: -p.freq_dramp * p.freq_dramp * p.freq_dramp * 0.000001
+		duty: 0.5 - p.duty * 0.5
+		duty_slide: -p.duty_ramp * 0.00005
+	}
+	s.arp_mod = if p.arp_mod >= 0 {
+		1 - p.arp_mod * p.arp_mod * 0.9
+	} else {
+		1 + p.arp_mod * p.arp_mod * 10
+	}
+	if p.arp_speed < 1 {
+		s.arp_limit = int((1 - p.arp_speed) * (1 - p.arp_speed) * 20000 + 32)
+	}
+	return s
+}
+
+fn sfxr_signed_square(v f32) f32 {
+	return if v < 0 { -v * v } else { v * v }
+}
+
+// Render the sound as a mono Sound at sfxr_rate. Noise is seeded, so the
+// same parameters always give the same samples.
+pub fn (p &Sfxr) generate() Sound {
+	mut rng := new_rng(1)
+	mut sw := p.sweep()
+	// Envelope stage lengths, in samples.
+	env_len := [int(p.env_attack * p.env_attack * 100000), int(p.env_sustain * p.env_sustain * 100000),
+		int(p.env_decay * p.env_decay * 100000)]!
+	total := env_len[0] + env_len[1] + env_len[2]
+	mut samples := []i16{cap: total}
+	// Filters.
+	mut lp := f32(0)
+	mut lp_d := f32(0)
+	mut hp := f32(0)
+	mut lp_w := p.lpf_freq * p.lpf_freq * p.lpf_freq * 0.1
+	lp_w_d := 1 + p.lpf_ramp * 0.0001
+	mut lp_damp := 5 / (1 + p.lpf_resonance * p.lpf_resonance * 20) * (0.01 + lp_w)
+	if lp_damp > 0.8 {
+		lp_damp = 0.8
+	}
+	mut hp_w := p.hpf_freq * p.hpf_freq * 0.1
+	hp_w_d := 1 + p.hpf_ramp * 0.0003
+	// Phaser.
+	mut phaser := []f32{len: 1024}
+	mut pha := sfxr_signed_square(p.pha_offset) * 1020
+	pha_d := sfxr_signed_square(p.pha_ramp)
+	mut pha_pos := 0
+	mut pha_i := 0
+	// Vibrato.
+	vib_speed := p.vib_speed * p.vib_speed * 0.01
+	vib_amp := p.vib_strength * 0.5
+	mut vib_phase := f32(0)
+	repeat_limit := if p.repeat_speed > 0 {
+		int((1 - p.repeat_speed) * (1 - p.repeat_speed) * 20000 + 32)
+	} else {
+		0
+	}
+	mut repeat_time := 0
+	mut noise := []f32{len: 32}
+	for i in 0 .. noise.len {
+		noise[i] = rng.f32_range(-1, 1)
+	}
+	mut phase := 0
+	mut stage := 0
+	mut stage_time := 0
+	for _ in 0 .. total {
+		if repeat_limit > 0 {
+			repeat_time++
+			if repeat_time >= repeat_limit {
+				repeat_time = 0
+				sw = p.sweep()
+			}
+		}
+		// Pitch.
+		sw.arp_time++
+		if sw.arp_limit > 0 && sw.arp_time >= sw.arp_limit {
+			sw.arp_limit = 0
+			sw.period *= sw.arp_mod
+		}
+		sw.slide += sw.dslide
+		sw.period *= sw.slide
+		if sw.period > sw.max_period {
+			sw.period = sw.max_period
+			if p.freq_limit > 0 {
+				// Slid below the lowest pitch: the sound ends.
+				break
+			}
+		}
+		mut period := sw.period
+		if vib_amp > 0 {
+			vib_phase += vib_speed
+			period *= 1 + sinf(vib_phase) * vib_amp
+		}
+		iperiod := max_int(8, int(period))
+		sw.duty = clampf(sw.duty + sw.duty_slide, 0, 0.5)
+		// Envelope.
+		stage_time++
+		for stage < 3 && stage_time > env_len[stage] {
+			stage_time = 0
+			stage++
+		}
+		if stage >= 3 {
+			break
+		}
+		t := f32(stage_time) / f32(max_int(1, env_len[stage]))
+		env := match stage {
+			0 { t }
+			1 { 1 + (1 - t) * 2 * p.env_punch }
+			else { 1 - t }
+		}
+		// Phaser and filter sweeps.
+		pha += pha_d
+		pha_pos = clamp_int(int(absf(pha)), 0, 1023)
+		if hp_w_d != 1 {
+			hp_w = clampf(hp_w * hp_w_d, 0.00001, 0.1)
+		}
+		// Eight sub-samples per output sample smooth out the waveform.
+		mut sum := f32(0)
+		for _ in 0 .. 8 {
+			phase++
+			if phase >= iperiod {
+				phase %= iperiod
+				if p.wave == .noise {
+					for j in 0 .. noise.len {
+						noise[j] = rng.f32_range(-1, 1)
+					}
+				}
+			}
+			fp := f32(phase) / f32(iperiod)
+			mut v := match p.wave {
+				.square { if fp < sw.duty { f32(0.5) } else { f32(-0.5) } }
+				.sawtooth { 1 - fp * 2 }
+				.sine { sinf(fp * 2 * pi) }
+				.noise { noise[phase * 32 / iperiod] }
+			}
+			// Low-pass with resonance, then high-pass.
+			prev := lp
+			lp_w = clampf(lp_w * lp_w_d, 0, 0.1)
+			if p.lpf_freq != 1 {
+				lp_d += (v - lp) * lp_w
+				lp_d -= lp_d * lp_damp
+			} else {
+				lp = v
+				lp_d = 0
+			}
+			lp += lp_d
+			hp += lp - prev
+			hp -= hp * hp_w
+			v = hp
+			// Phaser.
+			phaser[pha_i & 1023] = v
+			v += phaser[(pha_i - pha_pos + 1024) & 1023]
+			pha_i++
+			sum += v * env
+		}
+		out := clampf(sum / 8 * 0.05 * 2 * p.volume, -1, 1)
+		samples << i16(out * 32767)
+	}
+	return Sound{
+		rate: sfxr_rate
+		channels: 1
+		samples: samples
+	}
+}
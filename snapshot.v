@@ -0,0 +1,200 @@
+module wasm96
+
+// Whole-frame input snapshots.
+//
+// input_poll reads everything in one go: buttons and analog axes of every
+// port, the mouse, and a list of keys the game cares about. Hosts with the
+// input_snapshot feature fill it with a single call, laid out as
+//
+//   per port (4):  u16 buttons (bit n = Button n), i16 lx, ly, rx, ry
+//   mouse:         i32 x, i32 y, u32 buttons
+//   keys:          one bit per watched key, in watch order
+//
+// all little-endian; elsewhere it is gathered with the individual calls.
+
+// Number of controller ports in a snapshot.
+pub const snapshot_ports = 4
+
+const snapshot_port_bytes = 10
+
+const snapshot_fixed_bytes = snapshot_ports * snapshot_port_bytes + 12
+
+// One controller port's state.
+pub struct PortState {
+pub:
+	port    u32
+	buttons u16
+	// Raw left x, left y, right x, right y.
+	analog [4]i16
+}
+
+// Returns true if btn is held.
+pub fn (p &PortState) down(btn Button) bool {
+	return p.buttons & (u16(1) << u32(btn)) != 0
+}
+
+// Get an analog axis shaped by the port's AnalogConfig (see input_get_analog).
+pub fn (p &PortState) axis(stick AnalogStick, axis AnalogAxis) f32 {
+	raw := p.analog[int(stick) * 2 + int(axis)]
+	i := analog_config_index(p.port, stick, axis)
+	cfg := if i >= 0 { analog_configs[i] } else { AnalogConfig{} }
+	return cfg.apply(f32(raw) / 32767)
+}
+
+// The mouse's state.
+pub struct MouseState {
+pub:
+	x       int
+	y       int
+	buttons u32
+}
+
+// Returns true if mouse button btn (0 left, 1 right, 2 middle) is held.
+pub fn (m &MouseState) down(btn u32) bool {
+	return btn < 32 && m.buttons & (u32(1) << btn) != 0
+}
+
+// All input for one frame.
+pub struct InputSnapshot {
+pub:
+	frame u64
+	ports [snapshot_ports]PortState
+	mouse MouseState
+	keys  []u32
+	held  []bool
+}
+
+// Returns true if btn is held on port.
+pub fn (s &InputSnapshot) button(port u32, btn Button) bool {
+	return port < snapshot_ports && s.ports[port].down(btn)
+}
+
+// Returns true if btn went down on port between prev and this snapshot.
+pub fn (s &InputSnapshot) pressed(prev &InputSnapshot, port u32, btn Button) bool {
+	return s.button(port, btn) && !prev.button(port, btn)
+}
+
+// Returns true if key is held. Only watched keys are ever held.
+pub fn (s &InputSnapshot) key(key u32) bool {
+	for i, k in s.keys {
+		if k == key {
+			return s.held[i]
+		}
+	}
+	return false
+}
+
+struct SnapshotState {
+mut:
+	keys []u32
+	buf  []u8
+	prev InputSnapshot
+	cur  InputSnapshot
+}
+
+__global input_snap SnapshotState
+
+// Set the keys every snapshot records.
+pub fn input_watch_keys(keys []u32) {
+	input_snap.keys = keys.clone()
+}
+
+// Read the whole input state for this frame. Call once per frame.
+pub fn input_poll() InputSnapshot {
+	input_snap.prev = input_snap.cur
+	input_snap.cur = if compat_require(.input_snapshot) {
+		snapshot_read()
+	} else {
+		snapshot_gather()
+	}
+	return input_snap.cur
+}
+
+// Get the snapshot before the latest input_poll, for edge detection.
+pub fn input_previous() InputSnapshot {
+	return input_snap.prev
+}
+
+fn snapshot_read() InputSnapshot {
+	keys := input_snap.keys
+	n := snapshot_fixed_bytes + (keys.len + 7) / 8
+	if input_snap.buf.len != n {
+		input_snap.buf = []u8{len: n}
+	}
+	kp := if keys.len > 0 { &keys[0] } else { unsafe { nil } }
+	C.wasm96_input_snapshot(kp, usize(keys.len), &input_snap.buf[0], usize(n))
+	b := input_snap.buf
+	mut ports := [snapshot_ports]PortState{}
+	for p in 0 .. snapshot_ports {
+		o := p * snapshot_port_bytes
+		mut analog := [4]i16{}
+		for a in 0 .. 4 {
+			analog[a] = i16(le_u16(b, o + 2 + a * 2))
+		}
+		ports[p] = PortState{
+			port: u32(p)
+			buttons: u16(le_u16(b, o))
+			analog: analog
+		}
+	}
+	m := snapshot_ports * snapshot_port_bytes
+	mut held := []bool{len: keys.len}
+	for i in 0 .. keys.len {
+		held[i] = b[snapshot_fixed_bytes + i / 8] & (u8(1) << (i % 8)) != 0
+	}
+	return InputSnapshot{
+		frame: runner.frame
+		ports: ports
+		mouse: MouseState{
+			x: int(le_u32(b, m))
+			y: int(le_u32(b, m + 4))
+			buttons: le_u32(b, m + 8)
+		}
+		keys: keys
+		held: held
+	}
+}
+
+fn snapshot_gather() InputSnapshot {
+	keys := input_snap.keys
+	mut ports := [snapshot_ports]PortState{}
+	for p in 0 .. snapshot_ports {
+		mut buttons := u16(0)
+		for btn in 0 .. 16 {
+			if C.wasm96_input_is_button_down(u32(p), u32(btn)) != 0 {
+				buttons |= u16(1) << u32(btn)
+			}
+		}
+		mut analog := [4]i16{}
+		for a in 0 .. 4 {
+			analog[a] = i16(input_get_analog_raw(u32(p), unsafe { AnalogStick(a / 2) },
+				unsafe { AnalogAxis(a % 2) }))
+		}
+		ports[p] = PortState{
+			port: u32(p)
+			buttons: buttons
+			analog: analog
+		}
+	}
+	mut mouse_buttons := u32(0)
+	for btn in 0 .. 3 {
+		if input_is_mouse_down(u32(btn)) {
+			mouse_buttons |= u32(1) << u32(btn)
+		}
+	}
+	mut held := []bool{len: keys.len}
+	for i, k in keys {
+		held[i] = input_is_key_down(k)
+	}
+	return InputSnapshot{
+		frame: runner.frame
+		ports: ports
+		mouse: MouseState{
+			x: input_get_mouse_x()
+			y: input_get_mouse_y()
+			buttons: mouse_buttons
+		}
+		keys: keys
+		held: held
+	}
+}
@@ -0,0 +1,163 @@
+module wasm96
+
+// Positional audio.
+//
+// A SpatialAudio places sounds in the world around a listener, usually the
+// camera. Sounds to the listener's left or right pan that way, and fade
+// with distance along a falloff curve: full volume within min_dist, silent
+// beyond max_dist. Sounds played through it are tracked, so moving the
+// listener or an emitter and calling update keeps every voice's pan and gain
+// in step.
+//
+//   mut space := wasm96.new_spatial_audio(32, 400, .inverse)
+//   h := space.play(mut mix, engine, wasm96.bus_sfx, 1, car.x, car.y)
+//   // each frame:
+//   space.set_listener(cam_x, cam_y)
+//   space.move(h, car.x, car.y)
+//   space.update(mut mix)
+
+// How a sound fades between min_dist and max_dist.
+pub enum FalloffCurve {
+	// Straight down to silence at max_dist.
+	linear
+	// Halves as distance past min_dist doubles, like sound in open air,
+	// easing to silence at max_dist.
+	inverse
+	// Drops off faster, for sounds that should stay local.
+	inverse_square
+}
+
+struct SpatialEmitter {
+mut:
+	handle int
+	x      f32
+	y      f32
+	gain   f32
+}
+
+// Pans and attenuates sounds relative to a listener.
+pub struct SpatialAudio {
+pub mut:
+	listener_x f32
+	listener_y f32
+	min_dist   f32 = 32
+	max_dist   f32 = 400
+	falloff    FalloffCurve = .inverse
+	// How steeply the inverse curves fall; 1 is natural.
+	rolloff f32 = 1
+	// Sideways distance at which a sound is fully in one speaker.
+	pan_width f32 = 256
+mut:
+	emitters []SpatialEmitter
+}
+
+// Create a listener at the origin.
+pub fn new_spatial_audio(min_dist f32, max_dist f32, falloff FalloffCurve) SpatialAudio {
+	return SpatialAudio{
+		min_dist: min_dist
+		max_dist: max_dist
+		falloff: falloff
+	}
+}
+
+// Move the listener.
+pub fn (mut sa SpatialAudio) set_listener(x f32, y f32) {
+	sa.listener_x = x
+	sa.listener_y = y
+}
+
+// Get the volume, from 0 to 1, of a sound at (x, y).
+pub fn (sa &SpatialAudio) attenuation(x f32, y f32) f32 {
+	dx := x - sa.listener_x
+	dy := y - sa.listener_y
+	d := sqrtf(dx * dx + dy * dy)
+	if d <= sa.min_dist {
+		return 1
+	}
+	if d >= sa.max_dist {
+		return 0
+	}
+	// Stretch the inverse curves to reach 0 at max_dist instead of cutting
+	// off there, which would pop as a sound crosses it.
+	edge := sa.inverse_gain(sa.max_dist)
+	if sa.falloff == .linear || edge >= 1 {
+		return 1 - (d - sa.min_dist) / (sa.max_dist - sa.min_dist)
+	}
+	return (sa.inverse_gain(d) - edge) / (1 - edge)
+}
+
+fn (sa &SpatialAudio) inverse_gain(d f32) f32 {
+	r := sa.min_dist / (sa.min_dist + sa.rolloff * (d - sa.min_dist))
+	return if sa.falloff == .inverse_square { r * r } else { r }
+}
+
+// Get the pan, from -1 (left) to 1 (right), of a sound at (x, y).
+pub fn (sa &SpatialAudio) pan(x f32, y f32) f32 {
+	if sa.pan_width <= 0 {
+		return 0
+	}
+	return clampf((x - sa.listener_x) / sa.pan_width, -1, 1)
+}
+
+// Play a sound once at (x, y) and track it. Returns the mixer's handle for
+// the voice, or -1 if it couldn't play.
+pub fn (mut sa SpatialAudio) play(mut m Mixer, s Sound, bus int, gain f32, x f32, y f32) int {
+	return sa.track(m.play(s, bus, gain * sa.attenuation(x, y), sa.pan(x, y)), gain,
+		x, y)
+}
+
+// Play a sound on a loop at (x, y) and track it.
+pub fn (mut sa SpatialAudio) play_loop(mut m Mixer, s Sound, bus int, gain f32, x f32, y f32) int {
+	return sa.track(m.play_loop(s, bus, gain * sa.attenuation(x, y), sa.pan(x, y)),
+		gain, x, y)
+}
+
+fn (mut sa SpatialAudio) track(handle int, gain f32, x f32, y f32) int {
+	if handle >= 0 {
+		sa.emitters << SpatialEmitter{handle, x, y, gain}
+	}
+	return handle
+}
+
+// Move a tracked sound.
+pub fn (mut sa SpatialAudio) move(handle int, x f32, y f32) {
+	for mut e in sa.emitters {
+		if e.handle == handle {
+			e.x = x
+			e.y = y
+			return
+		}
+	}
+}
+
+// Change a tracked sound's gain before attenuation.
+pub fn (mut sa SpatialAudio) set_gain(handle int, gain f32) {
+	for mut e in sa.emitters {
+		if e.handle == handle {
+			e.gain = gain
+			return
+		}
+	}
+}
+
+// Get the number of sounds being tracked.
+pub fn (sa &SpatialAudio) len() int {
+	return sa.emitters.len
+}
+
+// Update the pan and gain of every tracked sound on the mixer and forget
+// those that have stopped. Call once per frame after moving things.
+pub fn (mut sa SpatialAudio) update(mut m Mixer) {
+	mut i := 0
+	for i < sa.emitters.len {
+		e := sa.emitters[i]
+		if !m.is_playing(e.handle) {
+			sa.emitters[i] = sa.emitters[sa.emitters.len - 1]
+			sa.emitters.delete_last()
+			continue
+		}
+		m.set_gain(e.handle, e.gain * sa.attenuation(e.x, e.y))
+		m.set_pan(e.handle, sa.pan(e.x, e.y))
+		i++
+	}
+}
@@ -0,0 +1,230 @@
+module wasm96
+
+// Sprite-limit emulation.
+//
+// Old consoles could only show so many sprites on one scanline (8 on the
+// NES and Master System) and so many in all (64); extra sprites simply
+// vanished on the lines where the limit was hit. Games cycled which sprites
+// got priority each frame, so instead of vanishing, crowded sprites
+// flickered. A SpriteLimiter reproduces this for games that want it: submit
+// sprites during the frame, then flush. Lines over the limit are cut out of
+// the sprites that lost out, and with flicker on, priority rotates every
+// frame. Sprites still draw in the order submitted.
+//
+// Images are kept by reference until the flush, so they must stay alive
+// and unchanged until then.
+//
+//   mut sprites := wasm96.new_sprite_limiter(8, 64)
+//   for e in enemies { sprites.image(e.img, e.x, e.y) }
+//   sprites.flush()
+
+struct LimitedSprite {
+	img    &Image     = unsafe { nil }
+	custom DrawListFn = unsafe { nil }
+	id     int
+	x      int
+	y      int
+	sx     int
+	sy     int
+	w      int
+	h      int
+}
+
+// Rows of a sprite that made it onto the screen.
+struct SpriteBand {
+	sprite int
+	row    int
+	rows   int
+}
+
+// Queues sprites and draws them under per-scanline limits.
+pub struct SpriteLimiter {
+pub mut:
+	// With enabled off every sprite draws, as on modern hardware.
+	enabled bool = true
+	// Most sprites drawn on one scanline, and in all; 0 for no limit.
+	per_line    int = 8
+	max_sprites int = 64
+	// Rotate priority each frame so crowded sprites flicker instead of
+	// vanishing.
+	flicker bool = true
+mut:
+	sprites []LimitedSprite
+	bands   []SpriteBand
+	counts  []int
+	frame   int
+	lost    int
+}
+
+// Create a limiter allowing per_line sprites on a line and max_sprites in
+// all.
+pub fn new_sprite_limiter(per_line int, max_sprites int) SpriteLimiter {
+	return SpriteLimiter{
+		per_line: per_line
+		max_sprites: max_sprites
+	}
+}
+
+// Queue an image at (x, y).
+pub fn (mut sl SpriteLimiter) image(img &Image, x int, y int) {
+	sl.sprites << LimitedSprite{
+		img: img
+		x: x
+		y: y
+		w: img.width
+		h: img.height
+	}
+}
+
+// Queue a w x h region at (sx, sy) of an image, e.g. an atlas frame, drawn
+// at (x, y).
+pub fn (mut sl SpriteLimiter) image_region(img &Image, x int, y int, sx int, sy int, w int, h int) {
+	sl.sprites << LimitedSprite{
+		img: img
+		x: x
+		y: y
+		sx: sx
+		sy: sy
+		w: w
+		h: h
+	}
+}
+
+// Queue custom drawing covering the w x h box at (x, y). It can't be cut
+// line by line, so it is shown only if all its lines have room.
+pub fn (mut sl SpriteLimiter) custom(f DrawListFn, id int, x int, y int, w int, h int) {
+	sl.sprites << LimitedSprite{
+		custom: f
+		id: id
+		x: x
+		y: y
+		w: w
+		h: h
+	}
+}
+
+// Get the number of sprites queued this frame.
+pub fn (sl &SpriteLimiter) len() int {
+	return sl.sprites.len
+}
+
+// Get how many sprites lost some or all of their lines in the last flush.
+pub fn (sl &SpriteLimiter) hidden() int {
+	return sl.lost
+}
+
+// Draw the queued sprites under the limits and start the next frame.
+pub fn (mut sl SpriteLimiter) flush() {
+	n := sl.sprites.len
+	sl.lost = 0
+	if !sl.enabled {
+		for i in 0 .. n {
+			sl.draw_rows(i, 0, sl.sprites[i].h)
+		}
+		sl.sprites.clear()
+		sl.frame++
+		return
+	}
+	lines := int(screen_height)
+	if sl.counts.len != lines {
+		sl.counts = []int{len: lines}
+	} else {
+		for i in 0 .. lines {
+			sl.counts[i] = 0
+		}
+	}
+	sl.bands.clear()
+	// Decide in priority order, starting from a different sprite each frame.
+	start := if sl.flicker && n > 0 { sl.frame % n } else { 0 }
+	mut shown := 0
+	mut split := 0
+	for k in 0 .. n {
+		i := (start + k) % n
+		if i == 0 {
+			split = sl.bands.len
+		}
+		if sl.max_sprites > 0 && shown >= sl.max_sprites {
+			sl.lost++
+			continue
+		}
+		if sl.place(i) {
+			shown++
+		}
+	}
+	// Bands were found in rotated order; sprites before start come first.
+	for b in sl.bands[split..] {
+		sl.draw_rows(b.sprite, b.row, b.rows)
+	}
+	for b in sl.bands[..split] {
+		sl.draw_rows(b.sprite, b.row, b.rows)
+	}
+	sl.sprites.clear()
+	sl.frame++
+}
+
+// Claim lines for sprite i, recording the runs of rows that fit. Returns
+// true if any row is shown.
+fn (mut sl SpriteLimiter) place(i int) bool {
+	s := sl.sprites[i]
+	limit := if sl.per_line > 0 { sl.per_line } else { max_int(1, sl.sprites.len) }
+	lines := sl.counts.len
+	if s.custom != unsafe { nil } {
+		for r in 0 .. s.h {
+			y := s.y + r
+			if y >= 0 && y < lines && sl.counts[y] >= limit {
+				sl.lost++
+				return false
+			}
+		}
+		for r in 0 .. s.h {
+			y := s.y + r
+			if y >= 0 && y < lines {
+				sl.counts[y]++
+			}
+		}
+		sl.bands << SpriteBand{i, 0, s.h}
+		return true
+	}
+	mut run := -1
+	mut cut := false
+	mut placed := false
+	for r in 0 .. s.h + 1 {
+		y := s.y + r
+		// Lines off screen take no slot, as on hardware they aren't fetched.
+		fits := r < s.h && (y < 0 || y >= lines || sl.counts[y] < limit)
+		if fits {
+			if y >= 0 && y < lines {
+				sl.counts[y]++
+			}
+			if run < 0 {
+				run = r
+			}
+			continue
+		}
+		if r < s.h {
+			cut = true
+		}
+		if run >= 0 {
+			sl.bands << SpriteBand{i, run, r - run}
+			placed = true
+			run = -1
+		}
+	}
+	if cut {
+		sl.lost++
+	}
+	return placed
+}
+
+fn (sl &SpriteLimiter) draw_rows(i int, row int, rows int) {
+	s := sl.sprites[i]
+	if s.custom != unsafe { nil } {
+		s.custom(s.id)
+		return
+	}
+	if rows == s.h && s.sx == 0 && s.sy == 0 && s.w == s.img.width && s.h == s.img.height {
+		s.img.draw(s.x, s.y)
+		return
+	}
+	s.img.draw_region(s.x, s.y + row, s.sx, s.sy + row, s.w, rows)
+}
@@ -0,0 +1,41 @@
+module wasm96
+
+// Typed status codes for host call results.
+
+// Result of a host call that registers a resource or configures the host.
+// Hosts that only report success or failure return 1 or 0, which decode to
+// ok and host_error.
+pub enum Status as u32 {
+	host_error = 0
+	ok = 1
+	invalid_arg = 2
+	too_large = 3
+	not_configured = 4
+}
+
+__global last_status Status
+
+// Decode a raw status value returned by the host.
+// Unknown values decode to host_error.
+pub fn status_from_raw(raw u32) Status {
+	if raw > u32(Status.not_configured) {
+		return .host_error
+	}
+	return unsafe { Status(raw) }
+}
+
+// Returns true if the status is ok.
+pub fn (s Status) is_ok() bool {
+	return s == .ok
+}
+
+// Get the status of the last host call that returned one
+// (registrations and audio_init).
+pub fn system_last_status() Status {
+	return last_status
+}
+
+fn record_status(raw u32) bool {
+	last_status = status_from_raw(raw)
+	return last_status == .ok
+}
@@ -0,0 +1,145 @@
+module wasm96
+
+// Thick strokes along lines, Bezier curves and Catmull-Rom splines.
+//
+// Curves are flattened into polylines with a chosen number of segments per
+// curve (or per spline span), then drawn as quads with round joins. A
+// thickness of 1 or less falls back to plain host lines.
+
+// Draw a line of the given thickness with the current color.
+pub fn graphics_thick_line(x1 int, y1 int, x2 int, y2 int, thickness f32) {
+	if thickness <= 1 {
+		graphics_line(x1, y1, x2, y2)
+		return
+	}
+	dx := f32(x2 - x1)
+	dy := f32(y2 - y1)
+	len := sqrtf(dx * dx + dy * dy)
+	if len == 0 {
+		graphics_circle(x1, y1, u32(thickness / 2))
+		return
+	}
+	// Offset both ends by half the thickness along the normal.
+	nx := -dy / len * thickness / 2
+	ny := dx / len * thickness / 2
+	ax := int(floorf(f32(x1) + nx + 0.5))
+	ay := int(floorf(f32(y1) + ny + 0.5))
+	bx := int(floorf(f32(x2) + nx + 0.5))
+	by := int(floorf(f32(y2) + ny + 0.5))
+	cx := int(floorf(f32(x2) - nx + 0.5))
+	cy := int(floorf(f32(y2) - ny + 0.5))
+	ex := int(floorf(f32(x1) - nx + 0.5))
+	ey := int(floorf(f32(y1) - ny + 0.5))
+	graphics_triangle(ax, ay, bx, by, cx, cy)
+	graphics_triangle(ax, ay, cx, cy, ex, ey)
+}
+
+// Draw connected line segments through points with round joins.
+pub fn graphics_polyline(points []Point, thickness f32) {
+	for i in 1 .. points.len {
+		a := points[i - 1]
+		b := points[i]
+		graphics_thick_line(a.x, a.y, b.x, b.y, thickness)
+	}
+	if thickness > 2 {
+		r := u32(thickness / 2)
+		for i in 1 .. points.len - 1 {
+			graphics_circle(points[i].x, points[i].y, r)
+		}
+		// Closed paths also need a join where they meet.
+		if points.len > 2 && points[0] == points[points.len - 1] {
+			graphics_circle(points[0].x, points[0].y, r)
+		}
+	}
+}
+
+fn round_point(x f32, y f32) Point {
+	return Point{int(floorf(x + 0.5)), int(floorf(y + 0.5))}
+}
+
+// Flatten a quadratic Bezier curve into segments + 1 points.
+pub fn bezier_quadratic_points(p0 Point, p1 Point, p2 Point, segments int) []Point {
+	n := max_int(segments, 1)
+	mut out := []Point{cap: n + 1}
+	for i in 0 .. n + 1 {
+		t := f32(i) / f32(n)
+		u := 1 - t
+		x := u * u * f32(p0.x) + 2 * u * t * f32(p1.x) + t * t * f32(p2.x)
+		y := u * u * f32(p0.y) + 2 * u * t * f32(p1.y) + t * t * f32(p2.y)
+		out << round_point(x, y)
+	}
+	return out
+}
+
+// Flatten a cubic Bezier curve into segments + 1 points.
+pub fn bezier_cubic_points(p0 Point, p1 Point, p2 Point, p3 Point, segments int) []Point {
+	n := max_int(segments, 1)
+	mut out := []Point{cap: n + 1}
+	for i in 0 .. n + 1 {
+		t := f32(i) / f32(n)
+		u := 1 - t
+		a := u * u * u
+		b := 3 * u * u * t
+		c := 3 * u * t * t
+		d := t * t * t
+		x := a * f32(p0.x) + b * f32(p1.x) + c * f32(p2.x) + d * f32(p3.x)
+		y := a * f32(p0.y) + b * f32(p1.y) + c * f32(p2.y) + d * f32(p3.y)
+		out << round_point(x, y)
+	}
+	return out
+}
+
+// Flatten a Catmull-Rom spline passing through every point, with segments
+// per span. A closed spline also joins the last point back to the first.
+pub fn catmull_rom_points(points []Point, segments int, closed bool) []Point {
+	count := points.len
+	if count < 2 {
+		return points.clone()
+	}
+	n := max_int(segments, 1)
+	spans := if closed { count } else { count - 1 }
+	mut out := []Point{cap: spans * n + 1}
+	for s in 0 .. spans {
+		p0 := catmull_rom_at(points, s - 1, closed)
+		p1 := points[s]
+		p2 := catmull_rom_at(points, s + 1, closed)
+		p3 := catmull_rom_at(points, s + 2, closed)
+		for i in 0 .. n {
+			t := f32(i) / f32(n)
+			t2 := t * t
+			t3 := t2 * t
+			x := 0.5 * (2 * f32(p1.x) + (f32(p2.x) - f32(p0.x)) * t +
+				(2 * f32(p0.x) - 5 * f32(p1.x) + 4 * f32(p2.x) - f32(p3.x)) * t2 +
+				(3 * f32(p1.x) - f32(p0.x) - 3 * f32(p2.x) + f32(p3.x)) * t3)
+			y := 0.5 * (2 * f32(p1.y) + (f32(p2.y) - f32(p0.y)) * t +
+				(2 * f32(p0.y) - 5 * f32(p1.y) + 4 * f32(p2.y) - f32(p3.y)) * t2 +
+				(3 * f32(p1.y) - f32(p0.y) - 3 * f32(p2.y) + f32(p3.y)) * t3)
+			out << round_point(x, y)
+		}
+	}
+	out << if closed { points[0] } else { points[count - 1] }
+	return out
+}
+
+// Get a spline control point, wrapping when closed and clamping otherwise.
+fn catmull_rom_at(points []Point, i int, closed bool) Point {
+	if closed {
+		return points[floor_mod(i, points.len)]
+	}
+	return points[clamp_int(i, 0, points.len - 1)]
+}
+
+// Stroke a quadratic Bezier curve with the current color.
+pub fn graphics_stroke_quadratic(p0 Point, p1 Point, p2 Point, segments int, thickness f32) {
+	graphics_polyline(bezier_quadratic_points(p0, p1, p2, segments), thickness)
+}
+
+// Stroke a cubic Bezier curve with the current color.
+pub fn graphics_stroke_cubic(p0 Point, p1 Point, p2 Point, p3 Point, segments int, thickness f32) {
+	graphics_polyline(bezier_cubic_points(p0, p1, p2, p3, segments), thickness)
+}
+
+// Stroke a Catmull-Rom spline through points with the current color.
+pub fn graphics_stroke_catmull_rom(points []Point, segments int, thickness f32, closed bool) {
+	graphics_polyline(catmull_rom_points(points, segments, closed), thickness)
+}
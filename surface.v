@@ -0,0 +1,204 @@
+module wasm96
+
+// Offscreen render targets.
+//
+// A Surface is an Image with drawing state: a current color and a clip
+// rectangle that every primitive respects, mirroring the screen-drawing
+// API. Draw into one for minimaps, mirrors, cached UI panels or effects
+// input, then present it on screen or compose it into another surface.
+
+// An image to draw into, with a current color and clip rectangle.
+pub struct Surface {
+	Image
+pub mut:
+	color Color
+	clip  Rect
+}
+
+// Create a transparent surface with the clip covering all of it.
+pub fn new_surface(width int, height int) Surface {
+	return Surface{
+		Image: new_image(width, height)
+		clip: Rect{0, 0, width, height}
+	}
+}
+
+// Restrict drawing to r (intersected with the surface).
+pub fn (mut s Surface) set_clip(r Rect) {
+	x0 := max_int(r.x, 0)
+	y0 := max_int(r.y, 0)
+	x1 := min_int(r.x + r.w, s.width)
+	y1 := min_int(r.y + r.h, s.height)
+	s.clip = Rect{x0, y0, max_int(0, x1 - x0), max_int(0, y1 - y0)}
+}
+
+// Allow drawing anywhere on the surface.
+pub fn (mut s Surface) reset_clip() {
+	s.clip = Rect{0, 0, s.width, s.height}
+}
+
+// Set the current drawing color.
+pub fn (mut s Surface) set_color(c Color) {
+	s.color = c
+}
+
+// Fill the clip rectangle with c, ignoring blending.
+pub fn (mut s Surface) clear(c Color) {
+	s.fill_rect(s.clip.x, s.clip.y, s.clip.w, s.clip.h, c)
+}
+
+fn (s &Surface) clipped(x int, y int) bool {
+	return x < s.clip.x || y < s.clip.y || x >= s.clip.x + s.clip.w || y >= s.clip.y + s.clip.h
+}
+
+// Plot a pixel with the current color.
+pub fn (mut s Surface) point(x int, y int) {
+	if !s.clipped(x, y) {
+		s.blend(x, y, s.color)
+	}
+}
+
+// Fill a horizontal run of pixels from x0 to x1 (exclusive) on row y.
+fn (mut s Surface) span(y int, x0 int, x1 int) {
+	if y < s.clip.y || y >= s.clip.y + s.clip.h {
+		return
+	}
+	a := max_int(x0, s.clip.x)
+	b := min_int(x1, s.clip.x + s.clip.w)
+	if a >= b {
+		return
+	}
+	if s.color.a == 255 {
+		s.fill_rect(a, y, b - a, 1, s.color)
+		return
+	}
+	for x in a .. b {
+		s.blend(x, y, s.color)
+	}
+}
+
+// Fill a rectangle with the current color.
+pub fn (mut s Surface) rect(x int, y int, w int, h int) {
+	for row in max_int(y, s.clip.y) .. min_int(y + h, s.clip.y + s.clip.h) {
+		s.span(row, x, x + w)
+	}
+}
+
+// Outline a rectangle with the current color.
+pub fn (mut s Surface) rect_outline(x int, y int, w int, h int) {
+	if w <= 0 || h <= 0 {
+		return
+	}
+	s.span(y, x, x + w)
+	if h > 1 {
+		s.span(y + h - 1, x, x + w)
+	}
+	for row in y + 1 .. y + h - 1 {
+		s.point(x, row)
+		if w > 1 {
+			s.point(x + w - 1, row)
+		}
+	}
+}
+
+// Draw a line with the current color.
+pub fn (mut s Surface) line(x1 int, y1 int, x2 int, y2 int) {
+	dx := iabs(x2 - x1)
+	dy := -iabs(y2 - y1)
+	sx := if x1 < x2 { 1 } else { -1 }
+	sy := if y1 < y2 { 1 } else { -1 }
+	mut err := dx + dy
+	mut x := x1
+	mut y := y1
+	for {
+		s.point(x, y)
+		if x == x2 && y == y2 {
+			break
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y += sy
+		}
+	}
+}
+
+// Fill a circle with the current color.
+pub fn (mut s Surface) circle(cx int, cy int, r int) {
+	for dy in -r .. r + 1 {
+		dx := int(sqrtf(f32(r * r - dy * dy)) + 0.5)
+		s.span(cy + dy, cx - dx, cx + dx + 1)
+	}
+}
+
+// Outline a circle with the current color.
+pub fn (mut s Surface) circle_outline(cx int, cy int, r int) {
+	mut x := r
+	mut y := 0
+	mut err := 1 - r
+	for x >= y {
+		for p in [Point{x, y}, Point{y, x}, Point{-y, x}, Point{-x, y}, Point{-x, -y},
+			Point{-y, -x}, Point{y, -x}, Point{x, -y}] {
+			s.point(cx + p.x, cy + p.y)
+		}
+		y++
+		if err < 0 {
+			err += 2 * y + 1
+		} else {
+			x--
+			err += 2 * (y - x) + 1
+		}
+	}
+}
+
+// Fill a polygon with the current color.
+pub fn (mut s Surface) polygon(points []Point) {
+	poly_raster.rasterize(points, s.clip.x, s.clip.y, s.clip.x + s.clip.w, s.clip.y + s.clip.h)
+	sp := poly_raster.spans
+	for i := 0; i < sp.len; i += 3 {
+		s.span(sp[i], sp[i + 1], sp[i + 2])
+	}
+}
+
+// Fill a triangle with the current color.
+pub fn (mut s Surface) triangle(x1 int, y1 int, x2 int, y2 int, x3 int, y3 int) {
+	s.polygon([Point{x1, y1}, Point{x2, y2}, Point{x3, y3}])
+}
+
+// Alpha-blend an image onto the surface at (x, y), within the clip.
+pub fn (mut s Surface) draw_image(img &Image, x int, y int) {
+	s.draw_image_region(img, 0, 0, img.width, img.height, x, y)
+}
+
+// Alpha-blend a w x h region at (sx, sy) of img onto the surface at (x, y),
+// within the clip.
+pub fn (mut s Surface) draw_image_region(img &Image, sx int, sy int, w int, h int, x int, y int) {
+	// Trim the region to the clip, then blit what's left.
+	x0 := max_int(x, s.clip.x)
+	y0 := max_int(y, s.clip.y)
+	x1 := min_int(x + w, s.clip.x + s.clip.w)
+	y1 := min_int(y + h, s.clip.y + s.clip.h)
+	if x0 >= x1 || y0 >= y1 {
+		return
+	}
+	s.blit_region(img, sx + x0 - x, sy + y0 - y, x1 - x0, y1 - y0, x0, y0)
+}
+
+// Compose another surface onto this one at (x, y), within the clip.
+pub fn (mut s Surface) draw_surface(src &Surface, x int, y int) {
+	s.draw_image(&src.Image, x, y)
+}
+
+// Draw the surface on screen at (x, y).
+pub fn (s &Surface) present(x int, y int) {
+	s.draw(x, y)
+}
+
+// Draw a w x h region at (sx, sy) of the surface on screen at (x, y).
+pub fn (s &Surface) present_region(x int, y int, sx int, sy int, w int, h int) {
+	s.draw_region(x, y, sx, sy, w, h)
+}
@@ -0,0 +1,128 @@
+module wasm96
+
+// Multi-buffered guest framebuffers.
+//
+// A SwapChain owns two or three full-screen Surfaces. Each frame the game
+// acquires a free one, draws into it and submits it. On hosts with the
+// async_present feature the host reads a submitted buffer after the call
+// returns, so the next frame can be drawn into another buffer in the
+// meantime; elsewhere submit presents synchronously and the buffer is free
+// again at once. The last submitted frame stays readable, which effects
+// such as motion blur or frame interpolation can blend from.
+
+enum SwapState {
+	free
+	acquired
+	in_flight
+}
+
+// A set of framebuffers presented in turn.
+pub struct SwapChain {
+mut:
+	buffers []Surface
+	states  []SwapState
+	tickets []u32
+	current int = -1
+	last    int = -1
+	// Buffers replaced by resize while the host was still reading them,
+	// kept alive until their present finishes.
+	retired         []Surface
+	retired_tickets []u32
+}
+
+// Create a swap chain of count (2 or 3) width x height buffers.
+pub fn new_swap_chain(width int, height int, count int) SwapChain {
+	n := clamp_int(count, 2, 3)
+	mut sc := SwapChain{}
+	for _ in 0 .. n {
+		sc.buffers << new_surface(width, height)
+		sc.states << .free
+		sc.tickets << 0
+	}
+	return sc
+}
+
+// Mark buffers whose asynchronous present has finished as free.
+pub fn (mut sc SwapChain) poll() {
+	for i, st in sc.states {
+		if st == .in_flight && graphics_present_done(sc.tickets[i]) {
+			sc.states[i] = .free
+			sc.tickets[i] = 0
+		}
+	}
+	for i := sc.retired.len - 1; i >= 0; i-- {
+		if graphics_present_done(sc.retired_tickets[i]) {
+			sc.retired.delete(i)
+			sc.retired_tickets.delete(i)
+		}
+	}
+}
+
+// Get a free buffer to draw the next frame into, or none if every buffer is
+// still being presented (skip drawing this frame). The buffer still holds
+// whatever frame was last drawn into it.
+pub fn (mut sc SwapChain) acquire() ?&Surface {
+	if sc.current >= 0 {
+		return &sc.buffers[sc.current]
+	}
+	sc.poll()
+	// Never hand out the previous frame, so it stays readable.
+	for i, st in sc.states {
+		if st == .free && i != sc.last {
+			sc.states[i] = .acquired
+			sc.current = i
+			return &sc.buffers[i]
+		}
+	}
+	return none
+}
+
+// Present the acquired buffer at (x, y) on screen.
+pub fn (mut sc SwapChain) submit(x int, y int) {
+	i := sc.current
+	if i < 0 {
+		return
+	}
+	b := &sc.buffers[i]
+	ticket := graphics_present_async(x, y, u32(b.width), u32(b.height), b.pixels)
+	if ticket == 0 {
+		b.draw(x, y)
+		sc.states[i] = .free
+	} else {
+		sc.states[i] = .in_flight
+		sc.tickets[i] = ticket
+	}
+	sc.last = i
+	sc.current = -1
+}
+
+// Get the last submitted frame, or none before the first submit. Its pixels
+// may be read while it is in flight but must not be changed.
+pub fn (sc &SwapChain) previous() ?&Surface {
+	if sc.last < 0 {
+		return none
+	}
+	return &sc.buffers[sc.last]
+}
+
+// Reallocate every buffer at a new size, e.g. after video_set_mode. Call
+// between frames; the previous frame is forgotten. Buffers still being
+// presented are kept until the host is done with them.
+pub fn (mut sc SwapChain) resize(width int, height int) {
+	for i in 0 .. sc.buffers.len {
+		if sc.states[i] == .in_flight {
+			sc.retired << sc.buffers[i]
+			sc.retired_tickets << sc.tickets[i]
+		}
+		sc.buffers[i] = new_surface(width, height)
+		sc.states[i] = .free
+		sc.tickets[i] = 0
+	}
+	sc.current = -1
+	sc.last = -1
+}
+
+// Get the number of buffers.
+pub fn (sc &SwapChain) len() int {
+	return sc.buffers.len
+}
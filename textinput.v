@@ -0,0 +1,113 @@
+module wasm96
+
+// A single-line editable text buffer driven by key events.
+pub struct TextInput {
+pub mut:
+	text    []u8
+	cursor  int
+	max_len int = 256
+}
+
+// Set the buffer contents and move the cursor to the end.
+pub fn (mut t TextInput) set(text string) {
+	t.text = text.bytes()
+	if t.text.len > t.max_len {
+		t.text = t.text[..t.max_len].clone()
+	}
+	t.cursor = t.text.len
+}
+
+// Clear the buffer.
+pub fn (mut t TextInput) clear() {
+	t.text.clear()
+	t.cursor = 0
+}
+
+// Get the buffer contents as a string.
+pub fn (t &TextInput) str() string {
+	return t.text.bytestr()
+}
+
+// Insert a character at the cursor.
+pub fn (mut t TextInput) insert(ch u8) {
+	if t.text.len >= t.max_len {
+		return
+	}
+	t.text.insert(t.cursor, ch)
+	t.cursor++
+}
+
+// Insert text at the cursor, dropping what doesn't fit and any control
+// characters.
+pub fn (mut t TextInput) insert_text(text string) {
+	for ch in text {
+		if ch >= 32 && ch != 127 {
+			t.insert(ch)
+		}
+	}
+}
+
+// Insert the system clipboard's text at the cursor.
+pub fn (mut t TextInput) paste() {
+	text := clipboard_get() or { return }
+	t.insert_text(text)
+}
+
+// Copy the buffer to the system clipboard.
+pub fn (t &TextInput) copy() {
+	clipboard_set(t.str())
+}
+
+// Apply a key event. Returns true if the event was enter (submit). Ctrl+C
+// and Ctrl+V copy and paste through the system clipboard.
+pub fn (mut t TextInput) handle(ev KeyEvent) bool {
+	if !ev.pressed {
+		return false
+	}
+	if ev.mods.has(.ctrl) {
+		if ev.key == u32(`v`) {
+			t.paste()
+		} else if ev.key == u32(`c`) {
+			t.copy()
+		}
+		return false
+	}
+	match ev.key {
+		u32(Key.enter) {
+			return true
+		}
+		u32(Key.backspace) {
+			if t.cursor > 0 {
+				t.cursor--
+				t.text.delete(t.cursor)
+			}
+		}
+		u32(Key.delete) {
+			if t.cursor < t.text.len {
+				t.text.delete(t.cursor)
+			}
+		}
+		u32(Key.left) {
+			if t.cursor > 0 {
+				t.cursor--
+			}
+		}
+		u32(Key.right) {
+			if t.cursor < t.text.len {
+				t.cursor++
+			}
+		}
+		u32(Key.home) {
+			t.cursor = 0
+		}
+		u32(Key.end) {
+			t.cursor = t.text.len
+		}
+		else {
+			if ev.ch != 0 {
+				t.insert(ev.ch)
+			}
+		}
+	}
+	return false
+}
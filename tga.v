@@ -0,0 +1,150 @@
+module wasm96
+
+// TGA decoder: color-mapped, true-color and grayscale images, raw or RLE.
+
+// Decode a TGA file.
+pub fn tga_decode(data []u8) !Image {
+	if data.len < 18 {
+		return error('tga: bad header')
+	}
+	id_len := int(data[0])
+	map_type := data[1]
+	kind := data[2]
+	map_first := int(le_u16(data, 3))
+	map_len := int(le_u16(data, 5))
+	map_bits := int(data[7])
+	width := int(le_u16(data, 12))
+	height := int(le_u16(data, 14))
+	bpp := int(data[16])
+	desc := data[17]
+	if kind !in [u8(1), 2, 3, 9, 10, 11] {
+		return error('tga: unsupported image type ${kind}')
+	}
+	if width == 0 || height == 0 {
+		return error('tga: bad size ${width}x${height}')
+	}
+	mut pos := 18 + id_len
+	mut palette := []Color{}
+	if map_type == 1 {
+		if map_bits !in [15, 16, 24, 32] {
+			return error('tga: bad pixel format')
+		}
+		entry := (map_bits + 7) / 8
+		if pos + map_len * entry > data.len {
+			return error('tga: color map out of range')
+		}
+		palette = []Color{len: map_first + map_len}
+		for i in 0 .. map_len {
+			palette[map_first + i] = tga_color(data, pos, map_bits, desc & 0x0f != 0)
+			pos += entry
+		}
+	}
+	mapped := kind == 1 || kind == 9
+	gray := kind == 3 || kind == 11
+	depths := if mapped || gray { [8, 16] } else { [15, 16, 24, 32] }
+	if bpp !in depths || (mapped && palette.len == 0) {
+		return error('tga: bad pixel format')
+	}
+	size := (bpp + 7) / 8
+	has_alpha := desc & 0x0f != 0 || bpp == 32
+	// Decode into a flat list of pixels in file order.
+	count := width * height
+	mut pixels := []Color{cap: count}
+	format := TgaFormat{
+		mapped: mapped
+		gray: gray
+		bpp: bpp
+		has_alpha: has_alpha
+	}
+	if kind >= 9 {
+		for pixels.len < count {
+			if pos >= data.len {
+				return error('tga: pixel data too short')
+			}
+			header := data[pos]
+			pos++
+			n := int(header & 0x7f) + 1
+			if header & 0x80 != 0 {
+				if pos + size > data.len {
+					return error('tga: pixel data too short')
+				}
+				c := format.read(data, pos, palette)
+				pos += size
+				for _ in 0 .. n {
+					pixels << c
+				}
+			} else {
+				if pos + n * size > data.len {
+					return error('tga: pixel data too short')
+				}
+				for _ in 0 .. n {
+					pixels << format.read(data, pos, palette)
+					pos += size
+				}
+			}
+		}
+	} else {
+		if pos + count * size > data.len {
+			return error('tga: pixel data too short')
+		}
+		for _ in 0 .. count {
+			pixels << format.read(data, pos, palette)
+			pos += size
+		}
+	}
+	right_to_left := desc & 0x10 != 0
+	top_down := desc & 0x20 != 0
+	mut img := new_image(width, height)
+	for i in 0 .. count {
+		fx := i % width
+		fy := i / width
+		x := if right_to_left { width - 1 - fx } else { fx }
+		y := if top_down { fy } else { height - 1 - fy }
+		img.set(x, y, pixels[i])
+	}
+	return img
+}
+
+struct TgaFormat {
+	mapped    bool
+	gray      bool
+	bpp       int
+	has_alpha bool
+}
+
+fn (f &TgaFormat) read(data []u8, pos int, palette []Color) Color {
+	size := (f.bpp + 7) / 8
+	if f.mapped {
+		index := if size == 2 { int(le_u16(data, pos)) } else { int(data[pos]) }
+		return if index < palette.len { palette[index] } else { Color{} }
+	}
+	if f.gray {
+		v := data[pos]
+		return Color{v, v, v, if size == 2 { data[pos + 1] } else { 255 }}
+	}
+	return tga_color(data, pos, f.bpp, f.has_alpha)
+}
+
+// Read a 15/16, 24 or 32-bit BGR(A) pixel.
+fn tga_color(data []u8, pos int, bits int, has_alpha bool) Color {
+	match bits {
+		15, 16 {
+			v := le_u16(data, pos)
+			r := u8((v >> 10) & 0x1f)
+			g := u8((v >> 5) & 0x1f)
+			b := u8(v & 0x1f)
+			a := if bits == 16 && has_alpha && v & 0x8000 == 0 { u8(0) } else { u8(255) }
+			return Color{r << 3 | r >> 2, g << 3 | g >> 2, b << 3 | b >> 2, a}
+		}
+		24 {
+			return Color{data[pos + 2], data[pos + 1], data[pos], 255}
+		}
+		else {
+			return Color{data[pos + 2], data[pos + 1], data[pos], if has_alpha {
+				data[pos + 3]
+			} else {
+				255
+			}}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+module wasm96
+
+fn tga_test_header(kind u8, width int, height int, bpp int, desc u8) []u8 {
+	mut b := []u8{len: 18}
+	b[2] = kind
+	b[12] = u8(width)
+	b[13] = u8(width >> 8)
+	b[14] = u8(height)
+	b[15] = u8(height >> 8)
+	b[16] = u8(bpp)
+	b[17] = desc
+	return b
+}
+
+fn test_tga_decode_raw() ! {
+	// Bottom-up BGR rows.
+	mut data := tga_test_header(2, 2, 2, 24, 0)
+	data << [u8(0), 0, 255, 0, 255, 0]
+	data << [u8(255), 0, 0, 30, 20, 10]
+	img := tga_decode(data)!
+	assert img.width == 2
+	assert img.height == 2
+	assert img.get(0, 1) == Color{255, 0, 0, 255}
+	assert img.get(1, 1) == Color{0, 255, 0, 255}
+	assert img.get(0, 0) == Color{0, 0, 255, 255}
+	assert img.get(1, 0) == Color{10, 20, 30, 255}
+}
+
+fn test_tga_decode_rle() ! {
+	// Top-down BGRA: a run of three then one literal.
+	mut data := tga_test_header(10, 2, 2, 32, 0x28)
+	data << [u8(0x82), 1, 2, 3, 128]
+	data << [u8(0x00), 40, 50, 60, 255]
+	img := tga_decode(data)!
+	assert img.get(0, 0) == Color{3, 2, 1, 128}
+	assert img.get(1, 0) == Color{3, 2, 1, 128}
+	assert img.get(0, 1) == Color{3, 2, 1, 128}
+	assert img.get(1, 1) == Color{60, 50, 40, 255}
+}
+
+fn test_tga_decode_errors() {
+	if _ := tga_decode([]u8{len: 10}) {
+		assert false
+	}
+	if _ := tga_decode(tga_test_header(4, 2, 2, 24, 0)) {
+		assert false
+	}
+	mut short := tga_test_header(2, 2, 2, 24, 0)
+	short << [u8(1), 2, 3]
+	if _ := tga_decode(short) {
+		assert false
+	}
+	mut rle := tga_test_header(10, 2, 2, 24, 0)
+	rle << [u8(0x81), 1, 2, 3]
+	if _ := tga_decode(rle) {
+		assert false
+	}
+}
+
+fn test_tga_rejects_bad_depths() {
+	// 8-bit true color would read past each pixel.
+	mut data := tga_test_header(2, 2, 2, 8, 0)
+	data << [u8(1), 2, 3, 4]
+	if _ := tga_decode(data) {
+		assert false
+	}
+	mut gray := tga_test_header(3, 1, 1, 24, 0)
+	gray << [u8(1), 2, 3]
+	if _ := tga_decode(gray) {
+		assert false
+	}
+}
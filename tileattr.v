@@ -0,0 +1,173 @@
+module wasm96
+
+// Tile attributes: slopes, ladders, spikes and ice.
+//
+// A TileCollision can carry an attribute per cell alongside its solid
+// flags. Slopes are solid below a diagonal surface, and overlaps and
+// solid_at test against that surface pixel by pixel, so anything that
+// steps up and snaps down against tile collision, like the platformer
+// controller, walks slopes with no changes. Spikes and ice are solid;
+// ladders are not. The attribute queries below say what a body is touching
+// or standing on.
+//
+// Slopes rise 45 degrees over one tile, or 22.5 degrees over a pair of
+// tiles (the low half then the high half). Name them in a tileset with a
+// property, e.g. "collision" = "slope_right", and build the grid with
+// collision_from_attributes.
+
+// What a cell of tile collision is.
+pub enum TileAttr as u8 {
+	empty
+	solid
+	// 45 degree slopes, named by the side the ground is high on.
+	slope_right
+	slope_left
+	// 22.5 degree slopes over two tiles.
+	slope_right_low
+	slope_right_high
+	slope_left_high
+	slope_left_low
+	ladder
+	spikes
+	ice
+}
+
+// Parse an attribute name as used in tileset properties.
+pub fn tile_attr_from_name(name string) ?TileAttr {
+	return match name {
+		'empty' { .empty }
+		'solid' { .solid }
+		'slope_right' { .slope_right }
+		'slope_left' { .slope_left }
+		'slope_right_low' { .slope_right_low }
+		'slope_right_high' { .slope_right_high }
+		'slope_left_high' { .slope_left_high }
+		'slope_left_low' { .slope_left_low }
+		'ladder' { .ladder }
+		'spikes' { .spikes }
+		'ice' { .ice }
+		else { none }
+	}
+}
+
+// Returns true for attributes that fill the whole cell.
+pub fn (a TileAttr) is_solid() bool {
+	return a == .solid || a == .spikes || a == .ice
+}
+
+// Returns true for slopes.
+pub fn (a TileAttr) is_slope() bool {
+	return a in [.slope_right, .slope_left, .slope_right_low, .slope_right_high, .slope_left_high,
+		.slope_left_low]
+}
+
+// Build a collision grid from every tile layer, where each tile's attribute
+// is named by its tileset property. Tiles without the property are empty;
+// on later layers they leave earlier attributes as they are.
+pub fn (m &Tilemap) collision_from_attributes(property string) TileCollision {
+	mut c := m.empty_collision()
+	c.attrs = []TileAttr{len: m.width * m.height}
+	for l in m.layers {
+		for i, tile in l.tiles {
+			if tile == 0 {
+				continue
+			}
+			name := m.tile_property(tile, property) or { continue }
+			a := tile_attr_from_name(name) or { continue }
+			c.attrs[i] = a
+			c.solid[i] = a.is_solid()
+		}
+	}
+	return c
+}
+
+// Get the attribute of cell (tx, ty). Cells outside the grid are solid or
+// empty following solid_outside.
+pub fn (c &TileCollision) attr(tx int, ty int) TileAttr {
+	if tx < 0 || ty < 0 || tx >= c.width || ty >= c.height {
+		return if c.solid_outside { .solid } else { .empty }
+	}
+	i := ty * c.width + tx
+	if c.attrs.len == 0 {
+		return if c.solid[i] { .solid } else { .empty }
+	}
+	return c.attrs[i]
+}
+
+// Set the attribute of cell (tx, ty), updating its solid flag to match.
+pub fn (mut c TileCollision) set_attr(tx int, ty int, a TileAttr) {
+	if tx < 0 || ty < 0 || tx >= c.width || ty >= c.height {
+		return
+	}
+	if c.attrs.len == 0 {
+		c.attrs = []TileAttr{len: c.width * c.height}
+		for i, s in c.solid {
+			if s {
+				c.attrs[i] = .solid
+			}
+		}
+	}
+	i := ty * c.width + tx
+	c.attrs[i] = a
+	c.solid[i] = a.is_solid()
+}
+
+// Get the height of a slope's ground in column lx of a tw x th tile, from
+// 0 (none) to th (full).
+fn slope_height(a TileAttr, lx int, tw int, th int) int {
+	right := lx + 1
+	left := tw - lx
+	return match a {
+		.slope_right { right * th / tw }
+		.slope_left { left * th / tw }
+		.slope_right_low { right * th / (2 * tw) }
+		.slope_right_high { th / 2 + right * th / (2 * tw) }
+		.slope_left_high { th / 2 + left * th / (2 * tw) }
+		.slope_left_low { left * th / (2 * tw) }
+		else { 0 }
+	}
+}
+
+// Returns true if the w x h box at (x, y) reaches below the surface of a
+// slope in cell (tx, ty).
+fn (c &TileCollision) slope_overlaps(tx int, ty int, x int, y int, w int, h int) bool {
+	a := c.attr(tx, ty)
+	if !a.is_slope() {
+		return false
+	}
+	x0 := tx * c.tile_width
+	y0 := ty * c.tile_height
+	// Only the box's lowest row inside the cell can reach the ground.
+	bottom := min_int(y + h - 1, y0 + c.tile_height - 1)
+	if bottom < y0 {
+		return false
+	}
+	for px in max_int(x, x0) .. min_int(x + w, x0 + c.tile_width) {
+		ground := y0 + c.tile_height - slope_height(a, px - x0, c.tile_width, c.tile_height)
+		if bottom >= ground {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the w x h box at (x, y) overlaps a cell with attribute a.
+pub fn (c &TileCollision) touches_attr(x int, y int, w int, h int, a TileAttr) bool {
+	if w <= 0 || h <= 0 || c.attrs.len == 0 {
+		return false
+	}
+	for ty in floor_div(y, c.tile_height) .. floor_div(y + h - 1, c.tile_height) + 1 {
+		for tx in floor_div(x, c.tile_width) .. floor_div(x + w - 1, c.tile_width) + 1 {
+			if c.attr(tx, ty) == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns true if the w x h box at (x, y) stands on a cell with attribute
+// a, i.e. the row just below its feet touches one.
+pub fn (c &TileCollision) stands_on(x int, y int, w int, h int, a TileAttr) bool {
+	return c.touches_attr(x, y + h, w, 1, a)
+}
@@ -0,0 +1,210 @@
+module wasm96
+
+// Tiled (TMX/TSX) map loader.
+//
+// Supports orthogonal, isometric and hexagonal maps with CSV, XML and base64
+// layer data (uncompressed, zlib or gzip), embedded and external tilesets,
+// group layers (flattened), object layers and custom properties. Infinite
+// maps are not supported; export them with a fixed size.
+
+// Resolves the source path of an external tileset to its TSX contents.
+pub type TiledResolveFn = fn (source string) !string
+
+// Load a TMX map. External tilesets are an error; use tiled_load_tmx_with
+// to resolve them.
+pub fn tiled_load_tmx(data string) !Tilemap {
+	return tiled_load_tmx_with(data, fn (source string) !string {
+		return error('tiled: external tileset ${source} needs a resolver')
+	})
+}
+
+// Load a TMX map, calling resolve to read external tilesets.
+pub fn tiled_load_tmx_with(data string, resolve TiledResolveFn) !Tilemap {
+	root := xml_parse(data)!
+	if root.name != 'map' {
+		return error('tiled: root element is <${root.name}>, expected <map>')
+	}
+	if root.attr('infinite') == '1' {
+		return error('tiled: infinite maps are not supported')
+	}
+	mut m := Tilemap{
+		orientation: match root.attr('orientation') {
+			'orthogonal' { MapOrientation.orthogonal }
+			'isometric' { MapOrientation.isometric }
+			'hexagonal' { MapOrientation.hexagonal }
+			else { return error('tiled: unsupported orientation ${root.attr('orientation')}') }
+		}
+		width: root.attr_int('width', 0)
+		height: root.attr_int('height', 0)
+		tile_width: root.attr_int('tilewidth', 0)
+		tile_height: root.attr_int('tileheight', 0)
+		properties: tiled_properties(root)
+		hex_side: root.attr_int('hexsidelength', 0)
+		stagger_x: root.attr('staggeraxis') == 'x'
+		stagger_odd: root.attr('staggerindex') != 'even'
+	}
+	for node in root.children_named('tileset') {
+		first_gid := u32(node.attr_int('firstgid', 1))
+		source := node.attr('source')
+		if source.len > 0 {
+			tsx := resolve(source)!
+			m.tilesets << tiled_load_tsx(tsx, first_gid)!
+		} else {
+			m.tilesets << tiled_tileset(node, first_gid)!
+		}
+	}
+	tiled_layers(root, mut m)!
+	return m
+}
+
+// Load a standalone TSX tileset whose first tile has global id first_gid.
+pub fn tiled_load_tsx(data string, first_gid u32) !Tileset {
+	root := xml_parse(data)!
+	if root.name != 'tileset' {
+		return error('tiled: root element is <${root.name}>, expected <tileset>')
+	}
+	return tiled_tileset(root, first_gid)
+}
+
+fn tiled_properties(node XmlNode) map[string]string {
+	mut props := map[string]string{}
+	list := node.child('properties') or { return props }
+	for p in list.children_named('property') {
+		props[p.attr('name')] = p.attrs['value'] or { p.text }
+	}
+	return props
+}
+
+fn tiled_tileset(node XmlNode, first_gid u32) !Tileset {
+	mut ts := Tileset{
+		name: node.attr('name')
+		first_gid: first_gid
+		tile_width: node.attr_int('tilewidth', 0)
+		tile_height: node.attr_int('tileheight', 0)
+		tile_count: node.attr_int('tilecount', 0)
+		columns: node.attr_int('columns', 0)
+		spacing: node.attr_int('spacing', 0)
+		margin: node.attr_int('margin', 0)
+	}
+	if image := node.child('image') {
+		ts.image = image.attr('source')
+	}
+	for tile in node.children_named('tile') {
+		props := tiled_properties(tile)
+		if props.len > 0 {
+			ts.tile_properties[tile.attr_int('id', 0)] = props.clone()
+		}
+	}
+	return ts
+}
+
+fn tiled_layers(parent XmlNode, mut m Tilemap) ! {
+	for node in parent.children {
+		match node.name {
+			'layer' { m.layers << tiled_tile_layer(node, m)! }
+			'objectgroup' { m.object_layers << tiled_object_layer(node) }
+			'group' { tiled_layers(node, mut m)! }
+			else {}
+		}
+	}
+}
+
+fn tiled_tile_layer(node XmlNode, m &Tilemap) !TileLayer {
+	mut l := TileLayer{
+		name: node.attr('name')
+		width: node.attr_int('width', m.width)
+		height: node.attr_int('height', m.height)
+		visible: node.attr('visible') != '0'
+		properties: tiled_properties(node)
+	}
+	// Collision and drawing index layers by map cell.
+	if l.width != m.width || l.height != m.height {
+		return error('tiled: layer ${l.name} is ${l.width}x${l.height}, map is ${m.width}x${m.height}')
+	}
+	count := l.width * l.height
+	data := node.child('data') or { return error('tiled: layer ${l.name} has no data') }
+	match data.attr('encoding') {
+		'csv' {
+			for field in data.text.split(',') {
+				f := field.trim_space()
+				if f.len > 0 {
+					l.tiles << u32(f.u64())
+				}
+			}
+		}
+		'base64' {
+			raw := base64_decode(data.text.trim_space())!
+			bytes := match data.attr('compression') {
+				'' { raw }
+				'zlib' { zlib_decompress(raw)! }
+				'gzip' { gzip_decompress(raw)! }
+				else { return error('tiled: unsupported compression ${data.attr('compression')}') }
+			}
+			for i := 0; i + 4 <= bytes.len; i += 4 {
+				l.tiles << u32(bytes[i]) | u32(bytes[i + 1]) << 8 | u32(bytes[i + 2]) << 16 |
+					u32(bytes[i + 3]) << 24
+			}
+		}
+		'' {
+			for tile in data.children_named('tile') {
+				l.tiles << u32(tile.attr('gid').u64())
+			}
+		}
+		else {
+			return error('tiled: unsupported encoding ${data.attr('encoding')}')
+		}
+	}
+	if l.tiles.len != count {
+		return error('tiled: layer ${l.name} has ${l.tiles.len} tiles, expected ${count}')
+	}
+	return l
+}
+
+fn tiled_object_layer(node XmlNode) ObjectLayer {
+	mut layer := ObjectLayer{
+		name: node.attr('name')
+		visible: node.attr('visible') != '0'
+		properties: tiled_properties(node)
+	}
+	for o in node.children_named('object') {
+		mut obj := MapObject{
+			id: o.attr_int('id', 0)
+			name: o.attr('name')
+			kind: o.attrs['type'] or { o.attr('class') }
+			x: o.attr_f32('x', 0)
+			y: o.attr_f32('y', 0)
+			width: o.attr_f32('width', 0)
+			height: o.attr_f32('height', 0)
+			rotation: o.attr_f32('rotation', 0)
+			gid: u32(o.attr('gid').u64())
+			visible: o.attr('visible') != '0'
+			properties: tiled_properties(o)
+		}
+		if obj.gid != 0 {
+			obj.shape = .tile
+		}
+		for c in o.children {
+			match c.name {
+				'ellipse' {
+					obj.shape = .ellipse
+				}
+				'point' {
+					obj.shape = .point
+				}
+				'polygon', 'polyline' {
+					obj.shape = if c.name == 'polygon' { .polygon } else { .polyline }
+					for pair in c.attr('points').fields() {
+						xy := pair.split(',')
+						if xy.len == 2 {
+							obj.points << xy[0].f32()
+							obj.points << xy[1].f32()
+						}
+					}
+				}
+				else {}
+			}
+		}
+		layer.objects << obj
+	}
+	return layer
+}
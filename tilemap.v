@@ -0,0 +1,314 @@
+module wasm96
+
+// Tilemaps and tile collision.
+
+// Flip flags stored in the high bits of tile ids, as written by Tiled.
+pub const tile_flip_h = u32(0x80000000)
+pub const tile_flip_v = u32(0x40000000)
+pub const tile_flip_d = u32(0x20000000)
+pub const tile_flip_mask = u32(0xe0000000)
+
+// Get the tile id of a tile with its flip flags removed.
+pub fn tile_id(tile u32) u32 {
+	return tile & ~tile_flip_mask
+}
+
+// Map projection.
+pub enum MapOrientation {
+	orthogonal
+	isometric
+	hexagonal
+}
+
+// A grid of tile ids. 0 is an empty cell; other ids are global ids into the
+// map's tilesets and may carry flip flags.
+pub struct TileLayer {
+pub mut:
+	name       string
+	width      int
+	height     int
+	tiles      []u32
+	visible    bool = true
+	properties map[string]string
+}
+
+// Get the tile at (x, y), or 0 outside the layer.
+pub fn (l &TileLayer) get(x int, y int) u32 {
+	if x < 0 || y < 0 || x >= l.width || y >= l.height {
+		return 0
+	}
+	return l.tiles[y * l.width + x]
+}
+
+// Set the tile at (x, y). Does nothing outside the layer.
+pub fn (mut l TileLayer) set(x int, y int, tile u32) {
+	if x < 0 || y < 0 || x >= l.width || y >= l.height {
+		return
+	}
+	l.tiles[y * l.width + x] = tile
+}
+
+// A tileset image cut into equally sized tiles.
+pub struct Tileset {
+pub mut:
+	name        string
+	first_gid   u32
+	tile_width  int
+	tile_height int
+	tile_count  int
+	columns     int
+	spacing     int
+	margin      int
+	image       string
+	// Custom properties per local tile id.
+	tile_properties map[int]map[string]string
+}
+
+// Returns true if the global id gid belongs to this tileset.
+pub fn (t &Tileset) contains(gid u32) bool {
+	id := tile_id(gid)
+	return id >= t.first_gid && id < t.first_gid + u32(t.tile_count)
+}
+
+// Get the pixel position of a global tile id in the tileset image.
+pub fn (t &Tileset) source_rect(gid u32) (int, int) {
+	local := int(tile_id(gid) - t.first_gid)
+	columns := if t.columns > 0 { t.columns } else { 1 }
+	x := t.margin + (local % columns) * (t.tile_width + t.spacing)
+	y := t.margin + (local / columns) * (t.tile_height + t.spacing)
+	return x, y
+}
+
+// Get a custom property of a global tile id.
+pub fn (t &Tileset) tile_property(gid u32, name string) ?string {
+	props := t.tile_properties[int(tile_id(gid) - t.first_gid)] or { return none }
+	return props[name] or { return none }
+}
+
+// Shape of a map object.
+pub enum MapObjectShape {
+	rect
+	ellipse
+	point
+	polygon
+	polyline
+	tile
+}
+
+// An object placed on an object layer (spawn points, triggers, regions).
+pub struct MapObject {
+pub mut:
+	id         int
+	name       string
+	kind       string
+	shape      MapObjectShape
+	x          f32
+	y          f32
+	width      f32
+	height     f32
+	rotation   f32
+	gid        u32
+	visible    bool = true
+	// Polygon and polyline vertices as x, y pairs relative to (x, y).
+	points     []f32
+	properties map[string]string
+}
+
+// A named group of objects.
+pub struct ObjectLayer {
+pub mut:
+	name       string
+	objects    []MapObject
+	visible    bool = true
+	properties map[string]string
+}
+
+// A tile map with any number of tile and object layers.
+pub struct Tilemap {
+pub mut:
+	orientation   MapOrientation
+	width         int
+	height        int
+	tile_width    int
+	tile_height   int
+	layers        []TileLayer
+	object_layers []ObjectLayer
+	tilesets      []Tileset
+	properties    map[string]string
+	// Hexagonal maps: side length of the flat edge, whether columns (rather
+	// than rows) are staggered, and whether odd (rather than even) ones are.
+	hex_side    int
+	stagger_x   bool
+	stagger_odd bool = true
+}
+
+// Get the index of the tile layer named name.
+pub fn (m &Tilemap) layer_index(name string) ?int {
+	for i, l in m.layers {
+		if l.name == name {
+			return i
+		}
+	}
+	return none
+}
+
+// Get the object layer named name.
+pub fn (m &Tilemap) object_layer(name string) ?ObjectLayer {
+	for l in m.object_layers {
+		if l.name == name {
+			return l
+		}
+	}
+	return none
+}
+
+// Get the tileset a global tile id belongs to.
+pub fn (m &Tilemap) tileset_for(gid u32) ?&Tileset {
+	for i in 0 .. m.tilesets.len {
+		if m.tilesets[i].contains(gid) {
+			return unsafe { &m.tilesets[i] }
+		}
+	}
+	return none
+}
+
+// Get a custom property of a global tile id from its tileset.
+pub fn (m &Tilemap) tile_property(gid u32, name string) ?string {
+	ts := m.tileset_for(gid)?
+	return ts.tile_property(gid, name)
+}
+
+// A function that draws one tile at a screen position.
+pub type TileDrawFn = fn (tile u32, x int, y int)
+
+// Draw the visible part of a tile layer with the camera at (cam_x, cam_y),
+// calling draw for every non-empty tile on screen. Isometric layers are drawn
+// back to front (see draw_iso_layer) and hexagonal ones with draw_hex_layer.
+pub fn (m &Tilemap) draw_layer(index int, cam_x int, cam_y int, draw TileDrawFn) {
+	match m.orientation {
+		.isometric {
+			m.draw_iso_layer(index, cam_x, cam_y, draw, [], fn (id int, x int, y int) {})
+			return
+		}
+		.hexagonal {
+			m.draw_hex_layer(index, cam_x, cam_y, draw)
+			return
+		}
+		.orthogonal {}
+	}
+	l := m.layers[index]
+	if !l.visible || m.tile_width <= 0 || m.tile_height <= 0 {
+		return
+	}
+	x0 := floor_div(cam_x, m.tile_width)
+	y0 := floor_div(cam_y, m.tile_height)
+	x1 := floor_div(cam_x + int(screen_width) - 1, m.tile_width)
+	y1 := floor_div(cam_y + int(screen_height) - 1, m.tile_height)
+	for ty in y0 .. y1 + 1 {
+		for tx in x0 .. x1 + 1 {
+			tile := l.get(tx, ty)
+			if tile != 0 {
+				draw(tile, tx * m.tile_width - cam_x, ty * m.tile_height - cam_y)
+			}
+		}
+	}
+}
+
+fn floor_div(a int, b int) int {
+	q := a / b
+	return if (a % b != 0) && ((a < 0) != (b < 0)) { q - 1 } else { q }
+}
+
+// A grid of solid cells for collision against tiles.
+pub struct TileCollision {
+pub mut:
+	width       int
+	height      int
+	tile_width  int
+	tile_height int
+	solid       []bool
+	// Whether cells outside the grid count as solid.
+	solid_outside bool
+	// Per-cell attributes such as slopes and ladders (see tileattr.v); empty
+	// when only solid is used.
+	attrs []TileAttr
+}
+
+// Build a collision grid where every non-empty tile of a layer is solid. A
+// layer on a different grid from the map (possible in LDtk) gives an empty
+// grid.
+pub fn (m &Tilemap) collision_from_layer(index int) TileCollision {
+	l := m.layers[index]
+	mut c := m.empty_collision()
+	if l.tiles.len != c.solid.len {
+		return c
+	}
+	for i, tile in l.tiles {
+		c.solid[i] = tile != 0
+	}
+	return c
+}
+
+// Build a collision grid from every tile layer, where a tile is solid if its
+// tileset gives it the property name with the value "true".
+pub fn (m &Tilemap) collision_from_property(name string) TileCollision {
+	mut c := m.empty_collision()
+	for l in m.layers {
+		if l.tiles.len != c.solid.len {
+			continue
+		}
+		for i, tile in l.tiles {
+			if tile != 0 && (m.tile_property(tile, name) or { '' }) == 'true' {
+				c.solid[i] = true
+			}
+		}
+	}
+	return c
+}
+
+fn (m &Tilemap) empty_collision() TileCollision {
+	return TileCollision{
+		width: m.width
+		height: m.height
+		tile_width: m.tile_width
+		tile_height: m.tile_height
+		solid: []bool{len: m.width * m.height}
+	}
+}
+
+// Returns true if the cell (tx, ty) is solid.
+pub fn (c &TileCollision) is_solid(tx int, ty int) bool {
+	if tx < 0 || ty < 0 || tx >= c.width || ty >= c.height {
+		return c.solid_outside
+	}
+	return c.solid[ty * c.width + tx]
+}
+
+// Returns true if the pixel (x, y) is inside a solid cell, or under the
+// surface of a slope.
+pub fn (c &TileCollision) solid_at(x int, y int) bool {
+	tx := floor_div(x, c.tile_width)
+	ty := floor_div(y, c.tile_height)
+	if c.is_solid(tx, ty) {
+		return true
+	}
+	return c.attrs.len > 0 && c.slope_overlaps(tx, ty, x, y, 1, 1)
+}
+
+// Returns true if the rectangle overlaps any solid cell.
+pub fn (c &TileCollision) overlaps(x int, y int, w int, h int) bool {
+	if w <= 0 || h <= 0 {
+		return false
+	}
+	for ty in floor_div(y, c.tile_height) .. floor_div(y + h - 1, c.tile_height) + 1 {
+		for tx in floor_div(x, c.tile_width) .. floor_div(x + w - 1, c.tile_width) + 1 {
+			if c.is_solid(tx, ty) {
+				return true
+			}
+			if c.attrs.len > 0 && c.slope_overlaps(tx, ty, x, y, w, h) {
+				return true
+			}
+		}
+	}
+	return false
+}
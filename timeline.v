@@ -0,0 +1,360 @@
+module wasm96
+
+// Cutscene timelines.
+//
+// A Timeline plays cues (move an actor, play a sound, show a line of dialog,
+// wait, fade the screen, raise an event) laid out on tracks. Cues on a track
+// run one after another; tracks run side by side against one frame clock, so
+// a cutscene plays out identically every time. A dialog cue with no duration
+// holds the clock until the player confirms it.
+//
+//   mut cs := wasm96.new_timeline()
+//   cam := cs.track()
+//   talk := cs.track()
+//   cs.set_actor(hero, 0, 100)
+//   cs.move(cam, hero, 120, 100, 60, .out_quad)
+//   cs.wait(talk, 40)
+//   cs.dialog(talk, '{color=yellow}Hero:{/color} At last.', 0)
+//   cs.fade(talk, 255, 30)
+//
+// Drive it from a coroutine stage with `if cs.update() { co.next() }`, draw
+// actors at cs.actor(id) and call cs.draw last. skip jumps to the end with
+// every cue's final effect applied.
+
+// What a cue does.
+pub enum CueKind {
+	move
+	sound
+	dialog
+	wait
+	fade
+	event
+}
+
+// One step on a track.
+pub struct Cue {
+pub:
+	kind CueKind
+	// Frame the cue starts on, and how many frames it runs.
+	start  u64
+	frames u64
+	// Actor and destination, for move.
+	actor  int
+	x      int
+	y      int
+	easing Easing
+	// WAV data, for sound.
+	sound []u8
+	// Rich text markup, for dialog.
+	text string
+	// Final fade level, 0 (clear) to 255 (solid), for fade.
+	level u8
+	// Id raised, for event.
+	event int
+}
+
+struct TimelineTrack {
+mut:
+	cues  []Cue
+	end   u64
+	next  int
+	begun bool
+	from  Point
+	fade  u8
+}
+
+// A cutscene: tracks of cues against a frame clock.
+pub struct Timeline {
+pub mut:
+	fade_color Color = Color{0, 0, 0, 255}
+	// Box dialog cues are shown in.
+	box DialogBox
+mut:
+	tracks   []TimelineTrack
+	actors   []Point
+	now      u64
+	level    u8
+	blocking bool
+	skipping bool
+	events   []int
+}
+
+// Create an empty timeline.
+pub fn new_timeline() Timeline {
+	return Timeline{}
+}
+
+// Add a track. Returns its index.
+pub fn (mut tl Timeline) track() int {
+	tl.tracks << TimelineTrack{}
+	return tl.tracks.len - 1
+}
+
+// Set where the next cue on track starts. Frames already taken by earlier
+// cues on the track can't be reused.
+pub fn (mut tl Timeline) at(track int, frame u64) {
+	if frame > tl.tracks[track].end {
+		tl.tracks[track].end = frame
+	}
+}
+
+// Add a cue at the end of track. Its start is filled in.
+pub fn (mut tl Timeline) add(track int, cue Cue) {
+	mut tr := &tl.tracks[track]
+	tr.cues << Cue{
+		...cue
+		start: tr.end
+	}
+	tr.end += cue.frames
+}
+
+// Move actor to (x, y) over frames frames.
+pub fn (mut tl Timeline) move(track int, actor int, x int, y int, frames u64, easing Easing) {
+	tl.add(track, Cue{
+		kind: .move
+		frames: frames
+		actor: actor
+		x: x
+		y: y
+		easing: easing
+	})
+}
+
+// Play a WAV sound.
+pub fn (mut tl Timeline) sound(track int, data []u8) {
+	tl.add(track, Cue{
+		kind: .sound
+		sound: data
+	})
+}
+
+// Show a line of rich text for frames frames, or until the player presses
+// A if frames is 0. Waiting for the player holds the whole timeline.
+pub fn (mut tl Timeline) dialog(track int, text string, frames u64) {
+	tl.add(track, Cue{
+		kind: .dialog
+		text: text
+		frames: frames
+	})
+}
+
+// Do nothing on track for frames frames.
+pub fn (mut tl Timeline) wait(track int, frames u64) {
+	tl.add(track, Cue{
+		kind: .wait
+		frames: frames
+	})
+}
+
+// Fade the screen to level (0 clear, 255 solid) over frames frames.
+pub fn (mut tl Timeline) fade(track int, level u8, frames u64) {
+	tl.add(track, Cue{
+		kind: .fade
+		frames: frames
+		level: level
+	})
+}
+
+// Raise event id, for the game to pick up with poll_event.
+pub fn (mut tl Timeline) event(track int, id int) {
+	tl.add(track, Cue{
+		kind: .event
+		event: id
+	})
+}
+
+// Place an actor without a cue, e.g. before playing.
+pub fn (mut tl Timeline) set_actor(actor int, x int, y int) {
+	for tl.actors.len <= actor {
+		tl.actors << Point{}
+	}
+	tl.actors[actor] = Point{x, y}
+}
+
+// Get an actor's position.
+pub fn (tl &Timeline) actor(actor int) Point {
+	if actor < 0 || actor >= tl.actors.len {
+		return Point{}
+	}
+	return tl.actors[actor]
+}
+
+// Get the current fade level.
+pub fn (tl &Timeline) fade_level() u8 {
+	return tl.level
+}
+
+// Get the frame the clock is on.
+pub fn (tl &Timeline) clock() u64 {
+	return tl.now
+}
+
+// Get the number of frames the timeline runs, not counting time spent
+// waiting on dialog.
+pub fn (tl &Timeline) length() u64 {
+	mut n := u64(0)
+	for tr in tl.tracks {
+		if tr.end > n {
+			n = tr.end
+		}
+	}
+	return n
+}
+
+// Take the next raised event, oldest first.
+pub fn (mut tl Timeline) poll_event() ?int {
+	if tl.events.len == 0 {
+		return none
+	}
+	id := tl.events[0]
+	tl.events.delete(0)
+	return id
+}
+
+// Returns true once every cue has finished.
+pub fn (tl &Timeline) done() bool {
+	if tl.blocking {
+		return false
+	}
+	for tr in tl.tracks {
+		if tr.next < tr.cues.len {
+			return false
+		}
+	}
+	return true
+}
+
+// Advance one frame. Returns true once the timeline has finished.
+pub fn (mut tl Timeline) update() bool {
+	if tl.done() {
+		return true
+	}
+	tl.update_dialog()
+	if tl.blocking {
+		return false
+	}
+	for i in 0 .. tl.tracks.len {
+		tl.run_track(i)
+	}
+	if tl.blocking {
+		return false
+	}
+	if tl.done() {
+		return true
+	}
+	tl.now++
+	return false
+}
+
+// Jump to the end: moves and fades land on their final values, events are
+// raised, and sounds and dialog are dropped.
+pub fn (mut tl Timeline) skip() {
+	tl.skipping = true
+	tl.blocking = false
+	tl.box.close()
+	for i in 0 .. tl.tracks.len {
+		for tl.tracks[i].next < tl.tracks[i].cues.len {
+			c := tl.tracks[i].cues[tl.tracks[i].next]
+			if !tl.tracks[i].begun {
+				tl.begin(i, c)
+			}
+			tl.finish(i, c)
+		}
+	}
+	tl.skipping = false
+	tl.now = tl.length()
+}
+
+// Reveal dialog, and dismiss a line that is holding the clock.
+fn (mut tl Timeline) update_dialog() {
+	if tl.box.update() && tl.blocking {
+		tl.blocking = false
+		tl.box.close()
+	}
+}
+
+// Run the cues due on track i at the current frame.
+fn (mut tl Timeline) run_track(i int) {
+	for tl.tracks[i].next < tl.tracks[i].cues.len {
+		c := tl.tracks[i].cues[tl.tracks[i].next]
+		if tl.now < c.start {
+			return
+		}
+		if !tl.tracks[i].begun {
+			if tl.blocking {
+				// Another track is waiting on the player.
+				return
+			}
+			tl.begin(i, c)
+			if tl.blocking {
+				return
+			}
+		}
+		if tl.now + 1 < c.start + c.frames {
+			tl.apply(i, c, f32(tl.now - c.start + 1) / f32(c.frames))
+			return
+		}
+		tl.finish(i, c)
+	}
+}
+
+fn (mut tl Timeline) begin(i int, c Cue) {
+	tl.tracks[i].begun = true
+	match c.kind {
+		.move {
+			tl.tracks[i].from = tl.actor(c.actor)
+		}
+		.fade {
+			tl.tracks[i].fade = tl.level
+		}
+		.sound {
+			if !tl.skipping && c.sound.len > 0 {
+				audio_play_wav(c.sound)
+			}
+		}
+		.dialog {
+			if tl.skipping {
+				return
+			}
+			tl.box.say('', c.text)
+			tl.blocking = c.frames == 0
+		}
+		.event {
+			tl.events << c.event
+		}
+		.wait {}
+	}
+}
+
+fn (mut tl Timeline) apply(i int, c Cue, t f32) {
+	match c.kind {
+		.move {
+			from := tl.tracks[i].from
+			e := ease(c.easing, t)
+			tl.set_actor(c.actor, int(lerpf(f32(from.x), f32(c.x), e)), int(lerpf(f32(from.y),
+				f32(c.y), e)))
+		}
+		.fade {
+			tl.level = u8(lerpf(f32(tl.tracks[i].fade), f32(c.level), t))
+		}
+		else {}
+	}
+}
+
+fn (mut tl Timeline) finish(i int, c Cue) {
+	tl.apply(i, c, 1)
+	if c.kind == .dialog && c.frames > 0 {
+		tl.box.close()
+	}
+	tl.tracks[i].begun = false
+	tl.tracks[i].next++
+}
+
+// Draw the fade and any open dialog box. Call last in draw.
+pub fn (mut tl Timeline) draw() {
+	if tl.level > 0 {
+		graphics_set_color_rgba(Color{tl.fade_color.r, tl.fade_color.g, tl.fade_color.b, tl.level})
+		graphics_rect(0, 0, screen_width, screen_height)
+	}
+	tl.box.draw()
+}
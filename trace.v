@@ -0,0 +1,81 @@
+module wasm96
+
+// Tracing spans.
+//
+// Spans are kept for the current frame so guests can inspect them, and when
+// forwarding is enabled they are also sent to the host as begin/end events,
+// which the host timestamps with its own clock so guest spans line up with
+// the core's profiler.
+
+const trace_max_depth = 32
+
+// A completed span from the current frame.
+pub struct TraceSpan {
+pub:
+	name     string
+	depth    int
+	start_ms u64
+	end_ms   u64
+}
+
+struct Tracer {
+mut:
+	forward bool
+	names   [trace_max_depth]string
+	starts  [trace_max_depth]u64
+	// Whether each open span's begin went to the host, so only those get
+	// an end.
+	sent    [trace_max_depth]bool
+	depth   int
+	spans   []TraceSpan
+}
+
+__global tracer Tracer
+
+// Enable or disable forwarding spans to the host.
+// Hosts without the trace feature ignore forwarded spans.
+pub fn trace_set_forwarding(enabled bool) {
+	tracer.forward = enabled && compat_require(.trace)
+}
+
+// Open a span. Spans nest and must be closed with trace_end.
+pub fn trace_begin(name string) {
+	if tracer.depth >= trace_max_depth {
+		panic('wasm96: trace spans nested deeper than ${trace_max_depth}')
+	}
+	tracer.names[tracer.depth] = name
+	tracer.starts[tracer.depth] = C.wasm96_system_millis()
+	sent := tracer.forward && name.len > 0
+	tracer.sent[tracer.depth] = sent
+	tracer.depth++
+	if sent {
+		C.wasm96_system_trace_begin(name.str, usize(name.len))
+	}
+}
+
+// Close the innermost open span.
+pub fn trace_end() {
+	if tracer.depth == 0 {
+		panic('wasm96: trace_end without trace_begin')
+	}
+	tracer.depth--
+	if tracer.sent[tracer.depth] {
+		C.wasm96_system_trace_end()
+	}
+	tracer.spans << TraceSpan{
+		name: tracer.names[tracer.depth]
+		depth: tracer.depth
+		start_ms: tracer.starts[tracer.depth]
+		end_ms: C.wasm96_system_millis()
+	}
+}
+
+// Get the spans completed since the last trace_frame, in completion order.
+pub fn trace_spans() []TraceSpan {
+	return tracer.spans
+}
+
+// Clear the completed spans. Call once per frame.
+pub fn trace_frame() {
+	tracer.spans.clear()
+}
@@ -0,0 +1,72 @@
+module wasm96
+
+// Turbo (auto-fire).
+//
+// A Turbo turns a held button into a train of presses: each cycle of rate
+// frames starts pressed and stays pressed for duty percent of the cycle, so
+// holding fire shoots at a steady rate and every first press still counts
+// on its first frame.
+
+// Auto-fire for one button.
+pub struct Turbo {
+pub mut:
+	port   u32
+	button Button
+	// Frames per press-and-release cycle.
+	rate int = 6
+	// Percent of each cycle spent pressed.
+	duty int = 50
+mut:
+	held_frames int
+	out         bool
+	prev        bool
+}
+
+// Create auto-fire for button on port, pressing once every rate frames.
+pub fn new_turbo(port u32, button Button, rate int) Turbo {
+	return Turbo{
+		port: port
+		button: button
+		rate: rate
+	}
+}
+
+// Get whether the pulsed button is down on a frame the real button has been
+// held for held_frames frames (0 is the first).
+pub fn turbo_pulse(held_frames int, rate int, duty int) bool {
+	if rate <= 1 {
+		return held_frames >= 0
+	}
+	on := clamp_int((rate * duty + 50) / 100, 1, rate - 1)
+	return held_frames % rate < on
+}
+
+// Feed whether the real button is held this frame. Returns whether the
+// pulsed button is down. Call once per frame.
+pub fn (mut t Turbo) update(held bool) bool {
+	t.prev = t.out
+	if !held {
+		t.held_frames = 0
+		t.out = false
+		return false
+	}
+	t.out = turbo_pulse(t.held_frames, t.rate, t.duty)
+	t.held_frames++
+	return t.out
+}
+
+// Read the button from input and update. Returns whether the pulsed button
+// is down.
+pub fn (mut t Turbo) poll() bool {
+	return t.update(input_is_button_down(t.port, t.button))
+}
+
+// Returns true if the pulsed button is down.
+pub fn (t &Turbo) down() bool {
+	return t.out
+}
+
+// Returns true if the pulsed button went down this frame, once per shot.
+pub fn (t &Turbo) pressed() bool {
+	return t.out && !t.prev
+}
@@ -0,0 +1,157 @@
+module wasm96
+
+// Easing curves and frame-counted tweens.
+//
+// A Tween moves a value from one number to another over a whole number of
+// frames, shaped by an Easing curve. Tweens advance with update, once per
+// frame, so they stay in step with the fixed-rate runner and replay the same
+// way every time.
+//
+//   mut t := wasm96.new_tween(0, 120, 30, .out_quad)
+//   ...
+//   x := int(t.update())
+
+// Easing curves. in_ curves start slow, out_ curves end slow and in_out_
+// curves do both.
+pub enum Easing {
+	linear
+	in_quad
+	out_quad
+	in_out_quad
+	in_cubic
+	out_cubic
+	in_out_cubic
+	in_sine
+	out_sine
+	in_out_sine
+	out_back
+	out_bounce
+	step
+}
+
+// Map t in [0, 1] through an easing curve.
+pub fn ease(e Easing, t f32) f32 {
+	x := clampf(t, 0, 1)
+	return match e {
+		.linear {
+			x
+		}
+		.in_quad {
+			x * x
+		}
+		.out_quad {
+			1 - (1 - x) * (1 - x)
+		}
+		.in_out_quad {
+			if x < 0.5 { 2 * x * x } else { 1 - 2 * (1 - x) * (1 - x) }
+		}
+		.in_cubic {
+			x * x * x
+		}
+		.out_cubic {
+			1 - (1 - x) * (1 - x) * (1 - x)
+		}
+		.in_out_cubic {
+			if x < 0.5 { 4 * x * x * x } else { 1 - 4 * (1 - x) * (1 - x) * (1 - x) }
+		}
+		.in_sine {
+			1 - cosf(x * pi / 2)
+		}
+		.out_sine {
+			sinf(x * pi / 2)
+		}
+		.in_out_sine {
+			(1 - cosf(x * pi)) / 2
+		}
+		.out_back {
+			// Overshoots by about 10% before settling.
+			c := f32(1.70158)
+			y := x - 1
+			1 + (c + 1) * y * y * y + c * y * y
+		}
+		.out_bounce {
+			ease_bounce(x)
+		}
+		.step {
+			if x < 1 { f32(0) } else { f32(1) }
+		}
+	}
+}
+
+fn ease_bounce(x f32) f32 {
+	n := f32(7.5625)
+	d := f32(2.75)
+	if x < 1 / d {
+		return n * x * x
+	}
+	if x < 2 / d {
+		y := x - 1.5 / d
+		return n * y * y + 0.75
+	}
+	if x < 2.5 / d {
+		y := x - 2.25 / d
+		return n * y * y + 0.9375
+	}
+	y := x - 2.625 / d
+	return n * y * y + 0.984375
+}
+
+// A value moving between two numbers over a number of frames.
+pub struct Tween {
+pub mut:
+	from   f32
+	to     f32
+	frames int
+	easing Easing
+mut:
+	elapsed int
+}
+
+// Create a tween from one value to another over frames frames.
+pub fn new_tween(from f32, to f32, frames int, easing Easing) Tween {
+	return Tween{
+		from: from
+		to: to
+		frames: frames
+		easing: easing
+	}
+}
+
+// Advance one frame. Returns the new value.
+pub fn (mut t Tween) update() f32 {
+	if t.elapsed < t.frames {
+		t.elapsed++
+	}
+	return t.value()
+}
+
+// Get the current value.
+pub fn (t &Tween) value() f32 {
+	if t.frames <= 0 {
+		return t.to
+	}
+	return lerpf(t.from, t.to, ease(t.easing, f32(t.elapsed) / f32(t.frames)))
+}
+
+// Get progress through the tween, 0 to 1, before easing.
+pub fn (t &Tween) progress() f32 {
+	if t.frames <= 0 {
+		return 1
+	}
+	return f32(t.elapsed) / f32(t.frames)
+}
+
+// Returns true once the tween has reached its end value.
+pub fn (t &Tween) done() bool {
+	return t.elapsed >= t.frames
+}
+
+// Jump to the end value.
+pub fn (mut t Tween) finish() {
+	t.elapsed = max_int(t.frames, 0)
+}
+
+// Start over from the beginning.
+pub fn (mut t Tween) restart() {
+	t.elapsed = 0
+}
@@ -0,0 +1,281 @@
+module wasm96
+
+// Verlet physics for ropes, chains, limbs and cloth.
+//
+// A VerletBody is a set of points joined by sticks. Each point keeps its
+// current and previous position, so its velocity is implicit and moving a
+// point anywhere (to grab it, or push it out of a wall) just works. Each
+// update moves the points under gravity, then nudges the ends of every
+// stick back towards its length a number of times; more iterations make
+// stiffer ropes and cloth at more cost.
+//
+//   mut rope := wasm96.new_rope(160, 20, 160, 120, 16)
+//   // each frame:
+//   rope.set_pin(0, hand_x, hand_y)
+//   rope.update()
+//   rope.draw(wasm96.Color{200, 160, 90, 255}, 2, 0, 0)
+
+// A point of a body.
+pub struct VerletPoint {
+pub mut:
+	x  f32
+	y  f32
+	px f32
+	py f32
+	// Pinned points stay where they are put.
+	pinned bool
+}
+
+// A constraint holding two points length apart.
+pub struct VerletStick {
+pub mut:
+	a      int
+	b      int
+	length f32
+	// How much of the error to correct each iteration, 0 to 1.
+	stiffness f32 = 1
+	// Only pull the points together, never push them apart, like rope.
+	slack bool
+}
+
+// Points and sticks simulated together.
+pub struct VerletBody {
+pub mut:
+	points []VerletPoint
+	sticks []VerletStick
+	// Acceleration per frame.
+	gravity_x f32
+	gravity_y f32 = 0.3
+	// Fraction of velocity kept each frame.
+	damping f32 = 0.99
+	// Constraint passes per update.
+	iterations int = 8
+	// Points are kept inside this area; empty for no limit.
+	bounds Rect
+	// Fraction of velocity kept along a wall when a point hits it.
+	friction f32 = 0.8
+	// Grid size for cloth, used by draw_cloth.
+	cols int
+	rows int
+}
+
+// Add a point, returning its index.
+pub fn (mut vb VerletBody) add_point(x f32, y f32, pinned bool) int {
+	vb.points << VerletPoint{x, y, x, y, pinned}
+	return vb.points.len - 1
+}
+
+// Join points a and b with a stick as long as they are apart now. Returns
+// the stick's index.
+pub fn (mut vb VerletBody) add_stick(a int, b int, stiffness f32) int {
+	dx := vb.points[b].x - vb.points[a].x
+	dy := vb.points[b].y - vb.points[a].y
+	vb.sticks << VerletStick{
+		a: a
+		b: b
+		length: sqrtf(dx * dx + dy * dy)
+		stiffness: stiffness
+	}
+	return vb.sticks.len - 1
+}
+
+// Add a line of segments + 1 points from (x0, y0) to (x1, y1), each joined
+// to the next, optionally pinning the first. Returns the first point's index,
+// so limbs can be built up in one body and joined with add_stick.
+pub fn (mut vb VerletBody) add_chain(x0 f32, y0 f32, x1 f32, y1 f32, segments int, pin_first bool, slack bool) int {
+	n := max_int(1, segments)
+	first := vb.points.len
+	for i in 0 .. n + 1 {
+		t := f32(i) / f32(n)
+		vb.add_point(lerpf(x0, x1, t), lerpf(y0, y1, t), pin_first && i == 0)
+		if i > 0 {
+			s := vb.add_stick(first + i - 1, first + i, 1)
+			vb.sticks[s].slack = slack
+		}
+	}
+	return first
+}
+
+// Create a rope hanging from (x0, y0), pinned there, reaching towards
+// (x1, y1).
+pub fn new_rope(x0 f32, y0 f32, x1 f32, y1 f32, segments int) VerletBody {
+	mut vb := VerletBody{}
+	vb.add_chain(x0, y0, x1, y1, segments, true, true)
+	return vb
+}
+
+// Create a cloth of cols x rows points spacing pixels apart with its top
+// left corner at (x, y), pinned along the top edge.
+pub fn new_cloth(x f32, y f32, cols int, rows int, spacing f32) VerletBody {
+	mut vb := VerletBody{
+		cols: max_int(1, cols)
+		rows: max_int(1, rows)
+	}
+	for r in 0 .. vb.rows {
+		for c in 0 .. vb.cols {
+			i := vb.add_point(x + f32(c) * spacing, y + f32(r) * spacing, r == 0)
+			if c > 0 {
+				vb.add_stick(i - 1, i, 1)
+			}
+			if r > 0 {
+				vb.add_stick(i - vb.cols, i, 1)
+			}
+		}
+	}
+	return vb
+}
+
+// Pin point i at (x, y), e.g. to drag a rope's end around.
+pub fn (mut vb VerletBody) set_pin(i int, x f32, y f32) {
+	mut p := &vb.points[i]
+	p.x = x
+	p.y = y
+	p.px = x
+	p.py = y
+	p.pinned = true
+}
+
+// Let point i move freely.
+pub fn (mut vb VerletBody) unpin(i int) {
+	vb.points[i].pinned = false
+}
+
+// Find the point nearest (x, y) within radius pixels, e.g. to grab it with
+// the mouse. Returns -1 if none.
+pub fn (vb &VerletBody) nearest(x f32, y f32, radius f32) int {
+	mut best := -1
+	mut best_d := radius * radius
+	for i, p in vb.points {
+		d := (p.x - x) * (p.x - x) + (p.y - y) * (p.y - y)
+		if d <= best_d {
+			best = i
+			best_d = d
+		}
+	}
+	return best
+}
+
+// Push every free point within radius of (x, y) by (dx, dy), e.g. for wind
+// gusts or a character brushing past.
+pub fn (mut vb VerletBody) push(x f32, y f32, radius f32, dx f32, dy f32) {
+	for mut p in vb.points {
+		if p.pinned {
+			continue
+		}
+		if (p.x - x) * (p.x - x) + (p.y - y) * (p.y - y) <= radius * radius {
+			// Moving the previous position changes the velocity.
+			p.px -= dx
+			p.py -= dy
+		}
+	}
+}
+
+// Advance the body a frame.
+pub fn (mut vb VerletBody) update() {
+	for mut p in vb.points {
+		if p.pinned {
+			continue
+		}
+		vx := (p.x - p.px) * vb.damping
+		vy := (p.y - p.py) * vb.damping
+		p.px = p.x
+		p.py = p.y
+		p.x += vx + vb.gravity_x
+		p.y += vy + vb.gravity_y
+	}
+	for _ in 0 .. max_int(1, vb.iterations) {
+		for s in vb.sticks {
+			vb.solve(s)
+		}
+		vb.keep_in_bounds()
+	}
+}
+
+fn (mut vb VerletBody) solve(s VerletStick) {
+	mut a := &vb.points[s.a]
+	mut b := &vb.points[s.b]
+	if a.pinned && b.pinned {
+		return
+	}
+	dx := b.x - a.x
+	dy := b.y - a.y
+	d := sqrtf(dx * dx + dy * dy)
+	if d == 0 || (s.slack && d <= s.length) {
+		return
+	}
+	// Move each free end part of the way, splitting the fix between them.
+	diff := (d - s.length) / d * s.stiffness
+	share := if a.pinned || b.pinned { f32(1) } else { f32(0.5) }
+	if !a.pinned {
+		a.x += dx * diff * share
+		a.y += dy * diff * share
+	}
+	if !b.pinned {
+		b.x -= dx * diff * share
+		b.y -= dy * diff * share
+	}
+}
+
+fn (mut vb VerletBody) keep_in_bounds() {
+	r := vb.bounds
+	if r.w <= 0 || r.h <= 0 {
+		return
+	}
+	x0 := f32(r.x)
+	y0 := f32(r.y)
+	x1 := f32(r.x + r.w - 1)
+	y1 := f32(r.y + r.h - 1)
+	for mut p in vb.points {
+		if p.pinned {
+			continue
+		}
+		if p.x < x0 || p.x > x1 {
+			p.x = clampf(p.x, x0, x1)
+			p.py = p.y - (p.y - p.py) * vb.friction
+		}
+		if p.y < y0 || p.y > y1 {
+			p.y = clampf(p.y, y0, y1)
+			p.px = p.x - (p.x - p.px) * vb.friction
+		}
+	}
+}
+
+// Draw every stick as a line of thickness pixels, offset by (-cam_x,
+// -cam_y).
+pub fn (vb &VerletBody) draw(color Color, thickness f32, cam_x int, cam_y int) {
+	graphics_set_color_rgba(color)
+	for s in vb.sticks {
+		a := vb.points[s.a]
+		b := vb.points[s.b]
+		graphics_thick_line(int(a.x) - cam_x, int(a.y) - cam_y, int(b.x) - cam_x, int(b.y) - cam_y,
+			thickness)
+	}
+}
+
+// Draw every point as a circle of radius pixels, e.g. the links of a chain.
+pub fn (vb &VerletBody) draw_points(color Color, radius int, cam_x int, cam_y int) {
+	graphics_set_color_rgba(color)
+	for p in vb.points {
+		graphics_circle(int(p.x) - cam_x, int(p.y) - cam_y, u32(radius))
+	}
+}
+
+// Fill the cells of a cloth made by new_cloth. Alternate rows are drawn in
+// shade, which suggests folds as the cloth moves.
+pub fn (vb &VerletBody) draw_cloth(color Color, shade Color, cam_x int, cam_y int) {
+	if vb.cols < 2 || vb.rows < 2 || vb.points.len < vb.cols * vb.rows {
+		return
+	}
+	mut quad := []Point{len: 4}
+	for r in 0 .. vb.rows - 1 {
+		graphics_set_color_rgba(if r % 2 == 0 { color } else { shade })
+		for c in 0 .. vb.cols - 1 {
+			i := r * vb.cols + c
+			corners := [i, i + 1, i + vb.cols + 1, i + vb.cols]
+			for k, j in corners {
+				quad[k] = Point{int(vb.points[j].x) - cam_x, int(vb.points[j].y) - cam_y}
+			}
+			graphics_fill_polygon(quad)
+		}
+	}
+}
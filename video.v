@@ -0,0 +1,133 @@
+module wasm96
+
+// Changing the video mode mid-session, and how the picture is shown.
+//
+// graphics_set_size is meant for setup. video_set_mode can be called at any
+// time: it reconfigures the host, drops the SDK's screen-sized scratch
+// buffers so they are reallocated at the new size, and notifies every
+// registered listener (camera, UI scaler, swap chain owner, ...) so nothing
+// keeps drawing for the old resolution. The aspect ratio, rotation and
+// safe-area calls mirror libretro's geometry settings.
+
+// Pixel formats the host can present in.
+pub enum PixelFormat as u32 {
+	xrgb8888
+	rgb565
+}
+
+// A function told about a new video mode.
+pub type VideoModeFn = fn (width int, height int, format PixelFormat)
+
+// Counter-clockwise screen rotations, in quarter turns as in libretro.
+pub enum Rotation as u32 {
+	none
+	ccw90
+	ccw180
+	ccw270
+}
+
+struct VideoState {
+mut:
+	format    PixelFormat
+	listeners []VideoModeFn
+	aspect_w  int
+	aspect_h  int
+	rotation  Rotation
+	safe      [4]int
+}
+
+__global video VideoState
+
+// Register f to be called after every video_set_mode.
+pub fn video_on_mode_change(f VideoModeFn) {
+	video.listeners << f
+}
+
+// Get the pixel format last set with video_set_mode.
+pub fn video_format() PixelFormat {
+	return video.format
+}
+
+// Switch to a width x height screen in format. Hosts without mode switching
+// only get the new size and keep their format. Returns false if the size is
+// invalid or the host rejected the mode, in which case nothing changes.
+pub fn video_set_mode(width int, height int, format PixelFormat) bool {
+	if width <= 0 || height <= 0 {
+		return false
+	}
+	batch_flush()
+	if compat_require(.video_mode) {
+		if !record_status(C.wasm96_graphics_set_mode(u32(width), u32(height), u32(format))) {
+			return false
+		}
+		screen_width = u32(width)
+		screen_height = u32(height)
+		video.format = format
+	} else {
+		graphics_set_size(u32(width), u32(height))
+	}
+	// Screen-sized scratch buffers are reallocated on next use.
+	bloom_buf = Image{}
+	light_screen = Image{}
+	for f in video.listeners {
+		f(width, height, video.format)
+	}
+	return true
+}
+
+// Declare the aspect ratio the screen should be shown at, such as 4:3 or
+// 8:7, independent of its size in pixels (so pixels need not be square).
+// Returns false if the host can't change the displayed aspect ratio.
+pub fn video_set_aspect(num int, den int) bool {
+	if num <= 0 || den <= 0 {
+		return false
+	}
+	video.aspect_w = num
+	video.aspect_h = den
+	if !compat_require(.geometry) {
+		return false
+	}
+	return record_status(C.wasm96_graphics_set_aspect(u32(num), u32(den)))
+}
+
+// Get the declared aspect ratio; with none declared, the screen's size.
+pub fn video_aspect() (int, int) {
+	if video.aspect_w > 0 {
+		return video.aspect_w, video.aspect_h
+	}
+	return int(screen_width), int(screen_height)
+}
+
+// Ask the host to rotate the picture, e.g. for portrait shooters drawn on
+// their side. Returns false if the host can't rotate.
+pub fn video_set_rotation(rotation Rotation) bool {
+	video.rotation = rotation
+	if !compat_require(.geometry) {
+		return false
+	}
+	return record_status(C.wasm96_graphics_set_rotation(u32(rotation)))
+}
+
+// Get the rotation last requested.
+pub fn video_rotation() Rotation {
+	return video.rotation
+}
+
+// Declare how many pixels on each edge may be hidden by overscan or cropped,
+// so the host can crop them and the game can keep HUDs inside. Returns false
+// if the host doesn't take safe areas; video_safe_rect still honors them.
+pub fn video_set_safe_area(left int, top int, right int, bottom int) bool {
+	video.safe = [max_int(left, 0), max_int(top, 0), max_int(right, 0), max_int(bottom, 0)]!
+	if !compat_require(.geometry) {
+		return false
+	}
+	return record_status(C.wasm96_graphics_set_safe_area(u32(video.safe[0]), u32(video.safe[1]),
+		u32(video.safe[2]), u32(video.safe[3])))
+}
+
+// Get the part of the screen inside the declared safe area.
+pub fn video_safe_rect() Rect {
+	s := video.safe
+	return Rect{s[0], s[1], max_int(0, int(screen_width) - s[0] - s[2]), max_int(0,
+		int(screen_height) - s[1] - s[3])}
+}
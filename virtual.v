@@ -0,0 +1,167 @@
+module wasm96
+
+// Fixed logical resolution with letterboxing.
+//
+// A VirtualScreen is a Surface at the game's logical size (say 240x136).
+// Draw the frame into it, then present: it is scaled up to the largest whole
+// multiple that fits the real screen and centered, with the leftover border
+// filled, so pixels stay square and sharp at any framebuffer size. Turn off
+// integer_scale to fill as much of the screen as possible instead, with a
+// smoother filter than nearest if uneven pixels bother you. Pointer
+// positions are mapped back into logical coordinates. A color grade and the
+// accessibility filter, if one is selected, are applied on the way out.
+
+// A logical-resolution render target presented scaled to the screen.
+pub struct VirtualScreen {
+	Surface
+pub mut:
+	// Only scale by whole multiples.
+	integer_scale bool = true
+	// Color of the letterbox bars.
+	border Color = Color{0, 0, 0, 255}
+	// How the logical screen is scaled up (see scale.v).
+	filter ScaleFilter
+	// Called for each logical line as the screen is presented (see raster.v).
+	scanline ScanlineFn = unsafe { nil }
+	// Grade applied as the screen is presented (see grade.v).
+	grade ColorGrade
+mut:
+	out   Image
+	cols  []int
+	lines Image
+}
+
+// Create a virtual screen of the given logical size.
+pub fn new_virtual_screen(width int, height int) VirtualScreen {
+	return VirtualScreen{
+		Surface: new_surface(width, height)
+	}
+}
+
+// Get where the logical screen lands on the real screen.
+pub fn (vs &VirtualScreen) viewport() Rect {
+	sw := int(screen_width)
+	sh := int(screen_height)
+	if vs.width <= 0 || vs.height <= 0 || sw <= 0 || sh <= 0 {
+		return Rect{0, 0, vs.width, vs.height}
+	}
+	mut w := 0
+	mut h := 0
+	if vs.integer_scale {
+		// A screen smaller than the logical size is shown unscaled and cropped.
+		k := max_int(1, min_int(sw / vs.width, sh / vs.height))
+		w = vs.width * k
+		h = vs.height * k
+	} else if i64(sw) * vs.height <= i64(sh) * vs.width {
+		w = sw
+		h = int(i64(sw) * vs.height / vs.width)
+	} else {
+		w = int(i64(sh) * vs.width / vs.height)
+		h = sh
+	}
+	return Rect{(sw - w) / 2, (sh - h) / 2, w, h}
+}
+
+// Map a screen position to logical coordinates. Positions in the letterbox
+// map outside the logical screen.
+pub fn (vs &VirtualScreen) to_virtual(x int, y int) (int, int) {
+	v := vs.viewport()
+	if v.w <= 0 || v.h <= 0 {
+		return x, y
+	}
+	return floor_div((x - v.x) * vs.width, v.w), floor_div((y - v.y) * vs.height, v.h)
+}
+
+// Map a logical position to the screen pixel at its top-left.
+pub fn (vs &VirtualScreen) to_screen(x int, y int) (int, int) {
+	v := vs.viewport()
+	if vs.width <= 0 || vs.height <= 0 {
+		return x, y
+	}
+	return v.x + floor_div(x * v.w, vs.width), v.y + floor_div(y * v.h, vs.height)
+}
+
+// Get the mouse position in logical coordinates.
+pub fn (vs &VirtualScreen) mouse() (int, int) {
+	return vs.to_virtual(input_get_mouse_x(), input_get_mouse_y())
+}
+
+// Returns true if the mouse is over the logical screen rather than the
+// letterbox.
+pub fn (vs &VirtualScreen) mouse_inside() bool {
+	x, y := vs.mouse()
+	return vs.contains(x, y)
+}
+
+// Scale the logical screen onto the real one and fill the letterbox.
+pub fn (mut vs VirtualScreen) present() {
+	v := vs.viewport()
+	sw := int(screen_width)
+	sh := int(screen_height)
+	graphics_set_color_rgba(vs.border)
+	if v.y > 0 {
+		graphics_rect(0, 0, u32(sw), u32(v.y))
+		graphics_rect(0, v.y + v.h, u32(sw), u32(max_int(0, sh - v.y - v.h)))
+	}
+	if v.x > 0 {
+		graphics_rect(0, v.y, u32(v.x), u32(v.h))
+		graphics_rect(v.x + v.w, v.y, u32(max_int(0, sw - v.x - v.w)), u32(v.h))
+	}
+	mut src := &vs.Surface.Image
+	if vs.scanline != unsafe { nil } {
+		vs.Surface.Image.raster_into(mut vs.lines, vs.scanline)
+		src = &vs.lines
+	}
+	if !vs.grade.identity() || accessibility_active() {
+		// Color a copy, so the game's surface keeps its true colors.
+		if vs.scanline == unsafe { nil } {
+			if vs.lines.width != vs.width || vs.lines.height != vs.height {
+				vs.lines = new_image(vs.width, vs.height)
+			}
+			vs.lines.copy_from(vs.Surface.Image, 0, 0, vs.width, vs.height, 0, 0)
+			src = &vs.lines
+		}
+		vs.grade.apply_image(mut vs.lines)
+		accessibility_apply(mut vs.lines)
+	}
+	if v.w == vs.width && v.h == vs.height {
+		src.draw(v.x, v.y)
+		return
+	}
+	if vs.out.width != v.w || vs.out.height != v.h {
+		vs.out = new_image(v.w, v.h)
+		vs.cols = []int{len: v.w}
+		for x in 0 .. v.w {
+			vs.cols[x] = x * vs.width / v.w * 4
+		}
+	}
+	if vs.filter != .nearest {
+		src.scale_into(mut vs.out, vs.filter)
+		vs.out.draw(v.x, v.y)
+		return
+	}
+	row_bytes := v.w * 4
+	mut prev_sy := -1
+	for y in 0 .. v.h {
+		sy := y * vs.height / v.h
+		d := y * row_bytes
+		if sy == prev_sy {
+			// Repeated source rows are copied from the row just written.
+			for i in 0 .. row_bytes {
+				vs.out.pixels[d + i] = vs.out.pixels[d - row_bytes + i]
+			}
+			continue
+		}
+		prev_sy = sy
+		s := sy * vs.width * 4
+		for x in 0 .. v.w {
+			j := s + vs.cols[x]
+			k := d + x * 4
+			vs.out.pixels[k] = src.pixels[j]
+			vs.out.pixels[k + 1] = src.pixels[j + 1]
+			vs.out.pixels[k + 2] = src.pixels[j + 2]
+			vs.out.pixels[k + 3] = src.pixels[j + 3]
+		}
+	}
+	vs.out.draw(v.x, v.y)
+}
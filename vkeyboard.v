@@ -0,0 +1,267 @@
+module wasm96
+
+// On-screen keyboard for controller-only setups.
+//
+// The d-pad moves the selection (holding it repeats), A types the selected
+// key, B deletes, X types a space, Y toggles shift and Start accepts.
+// Clicking a key with the mouse types it too. Typed text goes into a
+// TextInput, so name entry and seed screens work the same with either a
+// real keyboard or this one.
+
+enum VkAction {
+	ch
+	shift
+	space
+	backspace
+	done
+}
+
+struct VkKey {
+	label  string
+	ch     u8
+	action VkAction
+	// Position and width in key units.
+	col  int
+	span int = 1
+}
+
+const vk_rows = ['1234567890', 'qwertyuiop', "asdfghjkl'", 'zxcvbnm,.-']
+
+// An on-screen keyboard.
+pub struct VirtualKeyboard {
+pub mut:
+	x    int
+	y    int
+	port u32
+	// Size of one key and the gap between keys, in pixels.
+	key_w int = 14
+	key_h int = 14
+	gap   int = 2
+	// Font for the labels; the built-in debug font when empty.
+	font_key   []u8
+	background Color = Color{20, 20, 32, 230}
+	key_color  Color = Color{60, 60, 84, 255}
+	sel_color  Color = Color{220, 180, 60, 255}
+	text_color Color = Color{255, 255, 255, 255}
+mut:
+	rows      [][]VkKey
+	row       int
+	col       int
+	shift     bool
+	prev      u32
+	held      int
+	mouse_was bool
+}
+
+// Create a keyboard with its top-left at (x, y), read from port's joypad.
+pub fn new_virtual_keyboard(x int, y int, port u32) VirtualKeyboard {
+	mut vk := VirtualKeyboard{
+		x: x
+		y: y
+		port: port
+	}
+	for line in vk_rows {
+		mut keys := []VkKey{}
+		for i, c in line {
+			keys << VkKey{
+				label: c.ascii_str()
+				ch: c
+				col: i
+			}
+		}
+		vk.rows << keys
+	}
+	vk.rows << [
+		VkKey{
+			label: 'SHIFT'
+			action: .shift
+			col: 0
+			span: 2
+		},
+		VkKey{
+			label: 'SPACE'
+			action: .space
+			col: 2
+			span: 4
+		},
+		VkKey{
+			label: 'DEL'
+			action: .backspace
+			col: 6
+			span: 2
+		},
+		VkKey{
+			label: 'OK'
+			action: .done
+			col: 8
+			span: 2
+		},
+	]
+	return vk
+}
+
+// Get the keyboard's size in pixels.
+pub fn (vk &VirtualKeyboard) size() (int, int) {
+	cols := 10
+	return cols * (vk.key_w + vk.gap) + vk.gap, vk.rows.len * (vk.key_h + vk.gap) + vk.gap
+}
+
+fn (vk &VirtualKeyboard) key_rect(row int, k VkKey) Rect {
+	return Rect{vk.x + vk.gap + k.col * (vk.key_w + vk.gap), vk.y + vk.gap + row * (vk.key_h +
+		vk.gap), k.span * (vk.key_w + vk.gap) - vk.gap, vk.key_h}
+}
+
+// Pick the key on row whose center is nearest the given key unit position.
+fn (vk &VirtualKeyboard) nearest(row int, center int) int {
+	mut best := 0
+	mut best_d := 1 << 30
+	for i, k in vk.rows[row] {
+		d := iabs(k.col * 2 + k.span - center)
+		if d < best_d {
+			best = i
+			best_d = d
+		}
+	}
+	return best
+}
+
+fn (mut vk VirtualKeyboard) move(dx int, dy int) {
+	if dy != 0 {
+		k := vk.rows[vk.row][vk.col]
+		vk.row = (vk.row + dy + vk.rows.len) % vk.rows.len
+		vk.col = vk.nearest(vk.row, k.col * 2 + k.span)
+		return
+	}
+	n := vk.rows[vk.row].len
+	vk.col = (vk.col + dx + n) % n
+}
+
+fn vk_bit(btn Button) u32 {
+	return u32(1) << u32(btn)
+}
+
+// Apply one key to input. Returns true for OK.
+fn (mut vk VirtualKeyboard) activate(k VkKey, mut input TextInput) bool {
+	match k.action {
+		.ch {
+			mut c := k.ch
+			if vk.shift {
+				c = keyboard_char(u32(c), KeyMod.shift)
+				vk.shift = false
+			}
+			input.insert(c)
+		}
+		.shift {
+			vk.shift = !vk.shift
+		}
+		.space {
+			input.insert(` `)
+		}
+		.backspace {
+			if input.cursor > 0 {
+				input.cursor--
+				input.text.delete(input.cursor)
+			}
+		}
+		.done {
+			return true
+		}
+	}
+	return false
+}
+
+// Read the joypad and mouse and type into input. Returns true when OK or
+// Start is pressed. Call once per frame while the keyboard is shown.
+pub fn (mut vk VirtualKeyboard) update(mut input TextInput) bool {
+	mut now := u32(0)
+	for btn in [Button.up, .down, .left, .right, .a, .b, .x, .y, .start] {
+		if input_is_button_down(vk.port, btn) {
+			now |= vk_bit(btn)
+		}
+	}
+	pressed := now & ~vk.prev
+	vk.prev = now
+	dirs := now & (vk_bit(.up) | vk_bit(.down) | vk_bit(.left) | vk_bit(.right))
+	// Held directions repeat after a short delay.
+	mut step := pressed
+	if dirs != 0 {
+		vk.held++
+		if vk.held > 15 && vk.held % 4 == 0 {
+			step |= dirs
+		}
+	} else {
+		vk.held = 0
+	}
+	if step & vk_bit(.up) != 0 {
+		vk.move(0, -1)
+	}
+	if step & vk_bit(.down) != 0 {
+		vk.move(0, 1)
+	}
+	if step & vk_bit(.left) != 0 {
+		vk.move(-1, 0)
+	}
+	if step & vk_bit(.right) != 0 {
+		vk.move(1, 0)
+	}
+	mut done := false
+	if pressed & vk_bit(.a) != 0 {
+		done = vk.activate(vk.rows[vk.row][vk.col], mut input) || done
+	}
+	if pressed & vk_bit(.b) != 0 {
+		vk.activate(VkKey{ action: .backspace }, mut input)
+	}
+	if pressed & vk_bit(.x) != 0 {
+		vk.activate(VkKey{ action: .space }, mut input)
+	}
+	if pressed & vk_bit(.y) != 0 {
+		vk.shift = !vk.shift
+	}
+	if pressed & vk_bit(.start) != 0 {
+		done = true
+	}
+	mouse := input_is_mouse_down(0)
+	if mouse && !vk.mouse_was {
+		mx := input_get_mouse_x()
+		my := input_get_mouse_y()
+		for r, keys in vk.rows {
+			for c, k in keys {
+				if vk.key_rect(r, k).has_point(mx, my) {
+					vk.row = r
+					vk.col = c
+					done = vk.activate(k, mut input) || done
+				}
+			}
+		}
+	}
+	vk.mouse_was = mouse
+	return done
+}
+
+// Draw the keyboard.
+pub fn (vk &VirtualKeyboard) draw() {
+	w, h := vk.size()
+	graphics_set_color_rgba(vk.background)
+	graphics_rect(vk.x, vk.y, u32(w), u32(h))
+	font := if vk.font_key.len > 0 { vk.font_key } else { debug_font_key }
+	has_font := vk.font_key.len > 0 || debug_font_ready()
+	for r, keys in vk.rows {
+		for c, k in keys {
+			kr := vk.key_rect(r, k)
+			selected := r == vk.row && c == vk.col
+			graphics_set_color_rgba(if selected { vk.sel_color } else { vk.key_color })
+			graphics_rect(kr.x, kr.y, u32(kr.w), u32(kr.h))
+			if !has_font {
+				continue
+			}
+			mut label := k.label
+			if vk.shift && k.action == .ch {
+				label = keyboard_char(u32(k.ch), KeyMod.shift).ascii_str()
+			}
+			size := graphics_text_measure_key(font, label.bytes())
+			graphics_set_color_rgba(vk.text_color)
+			graphics_text_key(kr.x + (kr.w - int(size.width)) / 2, kr.y + (kr.h - int(size.height)) / 2,
+				font, label.bytes())
+		}
+	}
+}
@@ -31,6 +31,10 @@ pub struct TextSize {
 
 // Graphics
 fn C.wasm96_graphics_set_size(width u32, height u32)
+fn C.wasm96_graphics_set_mode(width u32, height u32, format u32) u32
+fn C.wasm96_graphics_set_aspect(num u32, den u32) u32
+fn C.wasm96_graphics_set_rotation(quarter_turns u32) u32
+fn C.wasm96_graphics_set_safe_area(left u32, top u32, right u32, bottom u32) u32
 fn C.wasm96_graphics_set_color(r u32, g u32, b u32, a u32)
 fn C.wasm96_graphics_background(r u32, g u32, b u32)
 fn C.wasm96_graphics_point(x int, y int)
@@ -64,6 +68,10 @@ fn C.wasm96_graphics_font_register_spleen(key u64, size u32) u32
 fn C.wasm96_graphics_font_unregister(key u64)
 fn C.wasm96_graphics_text_key(x int, y int, font_key u64, text_ptr &u8, text_len usize)
 fn C.wasm96_graphics_text_measure_key(font_key u64, text_ptr &u8, text_len usize) u64
+fn C.wasm96_graphics_capture(ptr &u8, len usize) u32
+fn C.wasm96_graphics_present_async(x int, y int, w u32, h u32, ptr &u8, len usize) u32
+fn C.wasm96_graphics_present_done(ticket u32) u32
+fn C.wasm96_graphics_skip_frame() u32
 
 fn C.wasm96_graphics_set_3d(enable u32)
 fn C.wasm96_graphics_camera_look_at(eye_x f32, eye_y f32, eye_z f32, target_x f32, target_y f32, target_z f32, up_x f32, up_y f32, up_z f32)
@@ -76,9 +84,26 @@ fn C.wasm96_graphics_mesh_draw(key u64, pos_x f32, pos_y f32, pos_z f32, rot_x f
 // Input
 fn C.wasm96_input_is_button_down(port u32, btn u32) u32
 fn C.wasm96_input_is_key_down(key u32) u32
+fn C.wasm96_input_key_modifiers() u32
 fn C.wasm96_input_get_mouse_x() int
 fn C.wasm96_input_get_mouse_y() int
 fn C.wasm96_input_is_mouse_down(btn u32) u32
+fn C.wasm96_input_get_port_mouse_x(port u32) int
+fn C.wasm96_input_get_port_mouse_y(port u32) int
+fn C.wasm96_input_is_port_mouse_down(port u32, btn u32) u32
+fn C.wasm96_input_get_analog(port u32, stick u32, axis u32) int
+fn C.wasm96_input_port_connected(port u32) u32
+fn C.wasm96_input_snapshot(keys_ptr &u32, keys_len usize, out_ptr &u8, out_len usize) u32
+fn C.wasm96_input_lightgun_x(port u32) int
+fn C.wasm96_input_lightgun_y(port u32) int
+fn C.wasm96_input_lightgun_state(port u32) u32
+fn C.wasm96_input_midi_read(ptr &u8, cap usize) u32
+fn C.wasm96_input_camera_start(width u32, height u32) u32
+fn C.wasm96_input_camera_size() u64
+fn C.wasm96_input_camera_read(ptr &u8, len usize) u32
+fn C.wasm96_input_camera_stop()
+fn C.wasm96_input_sensor_set(port u32, sensor u32, enable u32, rate u32) u32
+fn C.wasm96_input_sensor_get(port u32, axis u32) f32
 
 // Audio
 fn C.wasm96_audio_init(sample_rate u32) u32
@@ -86,10 +111,45 @@ fn C.wasm96_audio_push_samples(ptr &i16, len usize)
 fn C.wasm96_audio_play_wav(ptr &u8, len usize)
 fn C.wasm96_audio_play_qoa(ptr &u8, len usize)
 fn C.wasm96_audio_play_xm(ptr &u8, len usize)
+fn C.wasm96_audio_set_pitch(milli u32) u32
+
+// Storage
+fn C.wasm96_storage_save(key u64, ptr &u8, len usize) u32
+fn C.wasm96_storage_size(key u64) u32
+fn C.wasm96_storage_load(key u64, ptr &u8, len usize) u32
+fn C.wasm96_storage_delete(key u64)
+
+// Messages
+fn C.wasm96_msg_send(channel u32, ptr &u8, len usize) u32
+fn C.wasm96_msg_recv(channel &u32, ptr &u8, cap usize) int
+
+// Batch
+fn C.wasm96_batch_submit(ptr &u32, len usize)
 
 // System
 fn C.wasm96_system_log(ptr &u8, len usize)
 fn C.wasm96_system_millis() u64
+fn C.wasm96_system_abi_version() u32
+fn C.wasm96_system_features() u64
+fn C.wasm96_system_trace_begin(name_ptr &u8, name_len usize)
+fn C.wasm96_system_trace_end()
+fn C.wasm96_system_screenshot(ptr &u8, len usize) u32
+fn C.wasm96_system_refresh_rate_millihz() u32
+fn C.wasm96_system_usec_per_frame() u32
+fn C.wasm96_system_clipboard_set(ptr &u8, len usize) u32
+fn C.wasm96_system_clipboard_get(ptr &u8, cap usize) int
+fn C.wasm96_system_led_count() u32
+fn C.wasm96_system_led_set(index u32, on u32) u32
+
+// SDK-side state mirrored from calls into the host.
+__global (
+	screen_width        u32
+	screen_height       u32
+	current_color       [4]u8
+	audio_sample_rate   u32
+	audio_started_ms    u64
+	audio_frames_pushed u64
+)
 
 // Graphics API.
 
@@ -104,97 +164,166 @@ fn hash_key(key []u8) u64 {
 
 // Set the screen dimensions.
 pub fn graphics_set_size(width u32, height u32) {
+	screen_width = width
+	screen_height = height
 	C.wasm96_graphics_set_size(width, height)
 }
 
+// Get the screen dimensions last passed to graphics_set_size.
+pub fn graphics_size() (u32, u32) {
+	return screen_width, screen_height
+}
+
 // Set the current drawing color (RGBA).
 pub fn graphics_set_color(r u8, g u8, b u8, a u8) {
+	current_color = [r, g, b, a]!
+	if batch.active {
+		batch.push4(.set_color, u32(r), u32(g), u32(b), u32(a))
+		return
+	}
 	C.wasm96_graphics_set_color(u32(r), u32(g), u32(b), u32(a))
 }
 
 // Clear the screen with a specific color (RGB).
 pub fn graphics_background(r u8, g u8, b u8) {
+	if batch.active {
+		batch.push3(.background, u32(r), u32(g), u32(b))
+		return
+	}
 	C.wasm96_graphics_background(u32(r), u32(g), u32(b))
 }
 
 // Draw a single pixel at (x, y).
 pub fn graphics_point(x int, y int) {
+	if batch.active {
+		batch.push2(.point, u32(x), u32(y))
+		return
+	}
 	C.wasm96_graphics_point(x, y)
 }
 
 // Draw a line from (x1, y1) to (x2, y2).
 pub fn graphics_line(x1 int, y1 int, x2 int, y2 int) {
+	if batch.active {
+		batch.push4(.line, u32(x1), u32(y1), u32(x2), u32(y2))
+		return
+	}
 	C.wasm96_graphics_line(x1, y1, x2, y2)
 }
 
 // Draw a filled rectangle.
 pub fn graphics_rect(x int, y int, w u32, h u32) {
+	if batch.active {
+		batch.push4(.rect, u32(x), u32(y), w, h)
+		return
+	}
 	C.wasm96_graphics_rect(x, y, w, h)
 }
 
 // Draw a rectangle outline.
 pub fn graphics_rect_outline(x int, y int, w u32, h u32) {
+	if batch.active {
+		batch.push4(.rect_outline, u32(x), u32(y), w, h)
+		return
+	}
 	C.wasm96_graphics_rect_outline(x, y, w, h)
 }
 
 // Draw a filled circle.
 pub fn graphics_circle(x int, y int, r u32) {
+	if batch.active {
+		batch.push3(.circle, u32(x), u32(y), r)
+		return
+	}
 	C.wasm96_graphics_circle(x, y, r)
 }
 
 // Draw a circle outline.
 pub fn graphics_circle_outline(x int, y int, r u32) {
+	if batch.active {
+		batch.push3(.circle_outline, u32(x), u32(y), r)
+		return
+	}
 	C.wasm96_graphics_circle_outline(x, y, r)
 }
 
 // Draw an image/sprite.
 // data is a slice of RGBA bytes (4 bytes per pixel).
 pub fn graphics_image(x int, y int, w u32, h u32, data []u8) {
+	batch_flush()
 	C.wasm96_graphics_image(x, y, w, h, &data[0], usize(data.len))
 }
 
 // Draw an image from raw PNG bytes.
 pub fn graphics_image_png(x int, y int, data []u8) {
+	batch_flush()
 	C.wasm96_graphics_image_png(x, y, &data[0], usize(data.len))
 }
 
 // Draw a filled triangle.
 pub fn graphics_triangle(x1 int, y1 int, x2 int, y2 int, x3 int, y3 int) {
+	if batch.active {
+		batch.push6(.triangle, u32(x1), u32(y1), u32(x2), u32(y2), u32(x3), u32(y3))
+		return
+	}
 	C.wasm96_graphics_triangle(x1, y1, x2, y2, x3, y3)
 }
 
 // Draw a triangle outline.
 pub fn graphics_triangle_outline(x1 int, y1 int, x2 int, y2 int, x3 int, y3 int) {
+	if batch.active {
+		batch.push6(.triangle_outline, u32(x1), u32(y1), u32(x2), u32(y2), u32(x3), u32(y3))
+		return
+	}
 	C.wasm96_graphics_triangle_outline(x1, y1, x2, y2, x3, y3)
 }
 
 // Draw a quadratic Bezier curve.
 pub fn graphics_bezier_quadratic(x1 int, y1 int, cx int, cy int, x2 int, y2 int, segments u32) {
+	if batch.active {
+		batch.push7(.bezier_quadratic, u32(x1), u32(y1), u32(cx), u32(cy), u32(x2), u32(y2),
+			segments)
+		return
+	}
 	C.wasm96_graphics_bezier_quadratic(x1, y1, cx, cy, x2, y2, segments)
 }
 
 // Draw a cubic Bezier curve.
 pub fn graphics_bezier_cubic(x1 int, y1 int, cx1 int, cy1 int, cx2 int, cy2 int, x2 int, y2 int, segments u32) {
+	if batch.active {
+		batch.push9(.bezier_cubic, u32(x1), u32(y1), u32(cx1), u32(cy1), u32(cx2), u32(cy2),
+			u32(x2), u32(y2), segments)
+		return
+	}
 	C.wasm96_graphics_bezier_cubic(x1, y1, cx1, cy1, cx2, cy2, x2, y2, segments)
 }
 
 // Draw a filled pill.
 pub fn graphics_pill(x int, y int, w u32, h u32) {
+	if batch.active {
+		batch.push4(.pill, u32(x), u32(y), w, h)
+		return
+	}
 	C.wasm96_graphics_pill(x, y, w, h)
 }
 
 // Draw a pill outline.
 pub fn graphics_pill_outline(x int, y int, w u32, h u32) {
+	if batch.active {
+		batch.push4(.pill_outline, u32(x), u32(y), w, h)
+		return
+	}
 	C.wasm96_graphics_pill_outline(x, y, w, h)
 }
 
 // Register an SVG resource under a string key.
 pub fn graphics_svg_register(key []u8, data []u8) bool {
-	return C.wasm96_graphics_svg_register(hash_key(key), &data[0], usize(data.len)) != 0
+	return record_status(C.wasm96_graphics_svg_register(hash_key(key), &data[0], usize(data.len)))
 }
 
 // Draw a registered SVG by key.
 pub fn graphics_svg_draw_key(key []u8, x int, y int, w u32, h u32) {
+	batch_flush()
 	C.wasm96_graphics_svg_draw_key(hash_key(key), x, y, w, h)
 }
 
@@ -205,16 +334,18 @@ pub fn graphics_svg_unregister(key []u8) {
 
 // Register a GIF resource under a string key.
 pub fn graphics_gif_register(key []u8, data []u8) bool {
-	return C.wasm96_graphics_gif_register(hash_key(key), &data[0], usize(data.len)) != 0
+	return record_status(C.wasm96_graphics_gif_register(hash_key(key), &data[0], usize(data.len)))
 }
 
 // Draw a registered GIF by key at natural size.
 pub fn graphics_gif_draw_key(key []u8, x int, y int) {
+	batch_flush()
 	C.wasm96_graphics_gif_draw_key(hash_key(key), x, y)
 }
 
 // Draw a registered GIF by key scaled.
 pub fn graphics_gif_draw_key_scaled(key []u8, x int, y int, w u32, h u32) {
+	batch_flush()
 	C.wasm96_graphics_gif_draw_key_scaled(hash_key(key), x, y, w, h)
 }
 
@@ -225,16 +356,18 @@ pub fn graphics_gif_unregister(key []u8) {
 
 // Register a PNG resource under a string key.
 pub fn graphics_png_register(key []u8, data []u8) bool {
-	return C.wasm96_graphics_png_register(hash_key(key), &data[0], usize(data.len)) != 0
+	return record_status(C.wasm96_graphics_png_register(hash_key(key), &data[0], usize(data.len)))
 }
 
 // Draw a registered PNG by key at natural size.
 pub fn graphics_png_draw_key(key []u8, x int, y int) {
+	batch_flush()
 	C.wasm96_graphics_png_draw_key(hash_key(key), x, y)
 }
 
 // Draw a registered PNG by key scaled.
 pub fn graphics_png_draw_key_scaled(key []u8, x int, y int, w u32, h u32) {
+	batch_flush()
 	C.wasm96_graphics_png_draw_key_scaled(hash_key(key), x, y, w, h)
 }
 
@@ -245,17 +378,17 @@ pub fn graphics_png_unregister(key []u8) {
 
 // Register a TTF font under a string key.
 pub fn graphics_font_register_ttf(key []u8, data []u8) bool {
-	return C.wasm96_graphics_font_register_ttf(hash_key(key), &data[0], usize(data.len)) != 0
+	return record_status(C.wasm96_graphics_font_register_ttf(hash_key(key), &data[0], usize(data.len)))
 }
 
 // Register a BDF font under a string key.
 pub fn graphics_font_register_bdf(key []u8, data []u8) bool {
-	return C.wasm96_graphics_font_register_bdf(hash_key(key), &data[0], usize(data.len)) != 0
+	return record_status(C.wasm96_graphics_font_register_bdf(hash_key(key), &data[0], usize(data.len)))
 }
 
 // Register a built-in Spleen font under a string key.
 pub fn graphics_font_register_spleen(key []u8, size u32) bool {
-	return C.wasm96_graphics_font_register_spleen(hash_key(key), size) != 0
+	return record_status(C.wasm96_graphics_font_register_spleen(hash_key(key), size))
 }
 
 // Unregister a font by key.
@@ -265,6 +398,7 @@ pub fn graphics_font_unregister(key []u8) {
 
 // Draw text using a font referenced by key.
 pub fn graphics_text_key(x int, y int, font_key []u8, str []u8) {
+	batch_flush()
 	C.wasm96_graphics_text_key(x, y, hash_key(font_key), &str[0], usize(str.len))
 }
 
@@ -277,20 +411,65 @@ pub fn graphics_text_measure_key(font_key []u8, str []u8) TextSize {
 	}
 }
 
+// Copy the last presented frame into pixels as RGBA, the same layout
+// graphics_image takes. pixels must hold width * height * 4 bytes.
+// Returns false if the host can't read back frames.
+pub fn graphics_capture(mut pixels []u8) bool {
+	if pixels.len == 0 || !compat_require(.capture) {
+		return false
+	}
+	batch_flush()
+	return record_status(C.wasm96_graphics_capture(&pixels[0], usize(pixels.len)))
+}
+
+// Draw an RGBA image like graphics_image, but let the host read the pixels
+// after the call returns. data must not change until graphics_present_done
+// reports the returned ticket finished. Returns 0 if the host can't present
+// asynchronously; draw with graphics_image instead.
+pub fn graphics_present_async(x int, y int, w u32, h u32, data []u8) u32 {
+	if data.len == 0 || !compat_require(.async_present) {
+		return 0
+	}
+	batch_flush()
+	return C.wasm96_graphics_present_async(x, y, w, h, &data[0], usize(data.len))
+}
+
+// Returns true once the host has finished reading the pixels of an
+// asynchronous present. Ticket 0 is always finished.
+pub fn graphics_present_done(ticket u32) bool {
+	if ticket == 0 {
+		return true
+	}
+	return C.wasm96_graphics_present_done(ticket) != 0
+}
+
+// Tell the host this frame won't be drawn, so it keeps showing the previous
+// one. Returns false if the host can't skip frames; draw as usual then.
+pub fn graphics_skip_frame() bool {
+	if !compat_require(.frame_skip) {
+		return false
+	}
+	batch_flush()
+	return record_status(C.wasm96_graphics_skip_frame())
+}
+
 // 3D Graphics API.
 
 // Enable or disable 3D rendering mode.
 pub fn graphics_set_3d(enable bool) {
+	batch_flush()
 	C.wasm96_graphics_set_3d(if enable { 1 } else { 0 })
 }
 
 // Set the camera position and target.
 pub fn graphics_camera_look_at(eye_x f32, eye_y f32, eye_z f32, target_x f32, target_y f32, target_z f32, up_x f32, up_y f32, up_z f32) {
+	batch_flush()
 	C.wasm96_graphics_camera_look_at(eye_x, eye_y, eye_z, target_x, target_y, target_z, up_x, up_y, up_z)
 }
 
 // Set the camera perspective projection.
 pub fn graphics_camera_perspective(fovy f32, aspect f32, near f32, far f32) {
+	batch_flush()
 	C.wasm96_graphics_camera_perspective(fovy, aspect, near, far)
 }
 
@@ -312,6 +491,7 @@ pub fn graphics_mesh_create_stl(key []u8, data []u8) {
 
 // Draw a mesh with transformation.
 pub fn graphics_mesh_draw(key []u8, pos_x f32, pos_y f32, pos_z f32, rot_x f32, rot_y f32, rot_z f32, scale_x f32, scale_y f32, scale_z f32) {
+	batch_flush()
 	C.wasm96_graphics_mesh_draw(hash_key(key), pos_x, pos_y, pos_z, rot_x, rot_y, rot_z, scale_x, scale_y, scale_z)
 }
 
@@ -343,19 +523,74 @@ pub fn input_is_mouse_down(btn u32) bool {
 	return C.wasm96_input_is_mouse_down(btn) != 0
 }
 
+// Get the X position of the mouse (or trackball, light pen) on port.
+// The zero-argument mouse calls read port 0. Hosts with a single mouse
+// report it on port 0 and 0 elsewhere.
+pub fn input_get_port_mouse_x(port u32) int {
+	if !compat_require(.multi_mouse) {
+		return if port == 0 { input_get_mouse_x() } else { 0 }
+	}
+	return C.wasm96_input_get_port_mouse_x(port)
+}
+
+// Get the Y position of the mouse on port.
+pub fn input_get_port_mouse_y(port u32) int {
+	if !compat_require(.multi_mouse) {
+		return if port == 0 { input_get_mouse_y() } else { 0 }
+	}
+	return C.wasm96_input_get_port_mouse_y(port)
+}
+
+// Returns true if the specified button of the mouse on port is held down.
+pub fn input_is_port_mouse_down(port u32, btn u32) bool {
+	if !compat_require(.multi_mouse) {
+		return port == 0 && input_is_mouse_down(btn)
+	}
+	return C.wasm96_input_is_port_mouse_down(port, btn) != 0
+}
+
 // Audio API.
 
 // Initialize audio system.
 pub fn audio_init(sample_rate u32) u32 {
-	return C.wasm96_audio_init(sample_rate)
+	audio_sample_rate = sample_rate
+	audio_started_ms = C.wasm96_system_millis()
+	audio_frames_pushed = 0
+	raw := C.wasm96_audio_init(sample_rate)
+	record_status(raw)
+	return raw
 }
 
 // Push a chunk of audio samples.
 // Samples are interleaved stereo (L, R, L, R...) signed 16-bit integers.
 pub fn audio_push_samples(samples []i16) {
+	audio_frames_pushed += u64(samples.len / 2)
 	C.wasm96_audio_push_samples(&samples[0], usize(samples.len))
 }
 
+// Estimate how many stereo frames pushed with audio_push_samples are still
+// waiting to be played, based on the sample rate and wall-clock time.
+pub fn audio_queued_frames() u32 {
+	if audio_sample_rate == 0 {
+		return 0
+	}
+	elapsed := C.wasm96_system_millis() - audio_started_ms
+	played := elapsed * u64(audio_sample_rate) / 1000
+	if played >= audio_frames_pushed {
+		return 0
+	}
+	return u32(audio_frames_pushed - played)
+}
+
+// Play host-decoded audio (WAV, QOA, XM) at rate times normal speed, which
+// also shifts its pitch. Returns false if the host can't.
+pub fn audio_set_pitch(rate f32) bool {
+	if rate <= 0 || !compat_require(.audio_pitch) {
+		return false
+	}
+	return record_status(C.wasm96_audio_set_pitch(u32(rate * 1000 + 0.5)))
+}
+
 // Play a WAV file.
 // The WAV data is decoded and played as a one-shot audio channel.
 pub fn audio_play_wav(data []u8) {
@@ -374,14 +609,84 @@ pub fn audio_play_xm(data []u8) {
 	C.wasm96_audio_play_xm(&data[0], usize(data.len))
 }
 
+// Storage API.
+
+// Save data persistently under a string key, replacing any previous value.
+// Returns false if the host has no storage.
+pub fn storage_save(key []u8, data []u8) bool {
+	if !compat_require(.storage) {
+		return false
+	}
+	ptr := if data.len > 0 { &data[0] } else { unsafe { nil } }
+	return record_status(C.wasm96_storage_save(hash_key(key), ptr, usize(data.len)))
+}
+
+// Load data saved under a string key.
+// Returns none if nothing is saved under the key or the host has no storage.
+pub fn storage_load(key []u8) ?[]u8 {
+	if !compat_require(.storage) {
+		return none
+	}
+	k := hash_key(key)
+	size := C.wasm96_storage_size(k)
+	if size == 0 {
+		return none
+	}
+	mut data := []u8{len: int(size)}
+	n := C.wasm96_storage_load(k, &data[0], usize(data.len))
+	return data[..int(n)]
+}
+
+// Delete data saved under a string key.
+pub fn storage_delete(key []u8) {
+	if !compat_require(.storage) {
+		return
+	}
+	C.wasm96_storage_delete(hash_key(key))
+}
+
 // System API.
 
 // Log a message to the host console.
+// The message is also echoed to the debug console scrollback.
 pub fn system_log(message []u8) {
+	console_echo(message.bytestr())
 	C.wasm96_system_log(&message[0], usize(message.len))
 }
 
+// Hand an encoded screenshot (PNG or QOI) to the host to save or share.
+// Returns false if the host has no screenshot support.
+pub fn system_screenshot(data []u8) bool {
+	if data.len == 0 || !compat_require(.capture) {
+		return false
+	}
+	return record_status(C.wasm96_system_screenshot(&data[0], usize(data.len)))
+}
+
 // Get the number of milliseconds since the app started.
 pub fn system_millis() u64 {
 	return C.wasm96_system_millis()
 }
+
+// Get the host display's refresh rate in Hz, such as 50, 59.94 or 120.
+// Hosts that can't tell report 60.
+pub fn host_refresh_rate() f32 {
+	if compat_require(.timing) {
+		mhz := C.wasm96_system_refresh_rate_millihz()
+		if mhz > 0 {
+			return f32(mhz) / 1000
+		}
+	}
+	return 60
+}
+
+// Get the time between host frames in microseconds (16667 at 60 Hz).
+pub fn host_usec_per_frame() u32 {
+	if compat_require(.timing) {
+		us := C.wasm96_system_usec_per_frame()
+		if us > 0 {
+			return us
+		}
+	}
+	return u32(1000000.0 / f64(host_refresh_rate()) + 0.5)
+}
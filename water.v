@@ -0,0 +1,120 @@
+module wasm96
+
+// Ripple water: a height-field simulation with refraction.
+//
+// The surface is two height buffers; each update spreads every cell's
+// height to its neighbors and damps it, so disturbances ring outwards and
+// fade. Drawing displaces the background by the surface's slope, which
+// bends whatever lies beneath like looking through moving water, and
+// lightens or darkens by slope to suggest highlights.
+
+// A rectangular patch of rippling water on screen.
+pub struct Water {
+pub mut:
+	// Screen rectangle covered by the effect.
+	x int
+	y int
+	w int
+	h int
+	// Each update keeps 1 - 1 / 2^damping of the motion; higher rings longer.
+	damping int = 5
+	// Slope is divided by 2^refraction to get the pixel offset.
+	refraction int = 3
+	// Color tint blended over the refracted image.
+	tint Color = Color{40, 90, 160, 60}
+mut:
+	cur  []int
+	prev []int
+	out  Image
+}
+
+// Create a water region covering w x h pixels at (x, y).
+pub fn new_water(x int, y int, w int, h int) Water {
+	return Water{
+		x: x
+		y: y
+		w: w
+		h: h
+		cur: []int{len: w * h}
+		prev: []int{len: w * h}
+		out: new_image(w, h)
+	}
+}
+
+// Push the surface down around (px, py) (screen coordinates) by strength
+// over a disc of radius pixels.
+pub fn (mut wt Water) disturb(px int, py int, radius int, strength int) {
+	cx := px - wt.x
+	cy := py - wt.y
+	for y in max_int(1, cy - radius) .. min_int(wt.h - 1, cy + radius + 1) {
+		for x in max_int(1, cx - radius) .. min_int(wt.w - 1, cx + radius + 1) {
+			if (x - cx) * (x - cx) + (y - cy) * (y - cy) <= radius * radius {
+				wt.cur[y * wt.w + x] += strength
+			}
+		}
+	}
+}
+
+// Advance the simulation one step.
+pub fn (mut wt Water) update() {
+	w := wt.w
+	for y in 1 .. wt.h - 1 {
+		for x in 1 .. w - 1 {
+			i := y * w + x
+			// Average of the neighbors, minus where this cell was last step,
+			// gives the wave its momentum.
+			mut v := ((wt.cur[i - 1] + wt.cur[i + 1] + wt.cur[i - w] + wt.cur[i + w]) >> 1) - wt.prev[i]
+			v -= v >> wt.damping
+			wt.prev[i] = v
+		}
+	}
+	wt.cur, wt.prev = wt.prev, wt.cur
+}
+
+// Clear all ripples.
+pub fn (mut wt Water) calm() {
+	for i in 0 .. wt.cur.len {
+		wt.cur[i] = 0
+		wt.prev[i] = 0
+	}
+}
+
+// Render the water over background, whose pixel (bx, by) lies under the
+// region's top-left, into the region's image.
+pub fn (mut wt Water) render(background &Image, bx int, by int) {
+	w := wt.w
+	for y in 0 .. wt.h {
+		for x in 0 .. w {
+			i := y * w + x
+			sx := if x > 0 && x < w - 1 { wt.cur[i - 1] - wt.cur[i + 1] } else { 0 }
+			sy := if y > 0 && y < wt.h - 1 { wt.cur[i - w] - wt.cur[i + w] } else { 0 }
+			ox := sx >> wt.refraction
+			oy := sy >> wt.refraction
+			mut c := background.get(clamp_int(bx + x + ox, 0, background.width - 1), clamp_int(by +
+				y + oy, 0, background.height - 1))
+			// Slopes facing up-left catch the light.
+			shade := clamp_int((sx + sy) >> (wt.refraction + 1), -48, 48)
+			c.r = u8(clamp_int(int(c.r) + shade, 0, 255))
+			c.g = u8(clamp_int(int(c.g) + shade, 0, 255))
+			c.b = u8(clamp_int(int(c.b) + shade, 0, 255))
+			c.a = 255
+			wt.out.set(x, y, c)
+			wt.out.blend(x, y, wt.tint)
+		}
+	}
+}
+
+// Render over background (see render) and draw the result.
+pub fn (mut wt Water) draw(background &Image, bx int, by int) {
+	wt.render(background, bx, by)
+	wt.out.draw(wt.x, wt.y)
+}
+
+// Render over the region of scene it covers and write the result back, for
+// games that draw into an offscreen image such as a VirtualScreen's
+// surface. The screen itself can't be used: reading it back gives the
+// previous frame.
+pub fn (mut wt Water) draw_into(mut scene Image) {
+	wt.render(scene, wt.x, wt.y)
+	scene.copy_from(wt.out, 0, 0, wt.w, wt.h, wt.x, wt.y)
+}
@@ -0,0 +1,186 @@
+module wasm96
+
+// Weather effects.
+//
+// A Weather draws rain, snow, fog or heat haze over the screen with a
+// density (0 to 1) and a wind (pixels per frame, positive blowing right).
+// Rain and snow are particles and fog is scrolling noise drawn in coarse
+// blocks. Heat haze ripples the rows of the scene, so it works on an image
+// the world was drawn into, such as a VirtualScreen's surface, with apply_to.
+//
+//   mut sky := wasm96.new_weather(.rain, 0.6, 1.5)
+//   // each frame, after drawing the world:
+//   sky.update()
+//   sky.draw()
+//   sky.apply_to(mut vscreen.Surface.Image)
+//   vscreen.present()
+
+// Kinds of weather.
+pub enum WeatherKind {
+	clear
+	rain
+	snow
+	fog
+	heat_haze
+}
+
+// A weather effect over the screen.
+pub struct Weather {
+pub mut:
+	kind    WeatherKind
+	density f32 = 0.5
+	wind    f32
+	// Rain and snow color, and fog color (alpha is the thickest fog).
+	color     Color = Color{170, 190, 230, 160}
+	fog_color Color = Color{200, 205, 215, 150}
+	// Fog block size in pixels; smaller is smoother and slower.
+	fog_cell int = 8
+mut:
+	particles ParticleSystem
+	rng       Rng
+	ticks     int
+	row       []u8
+}
+
+// Create a weather effect.
+pub fn new_weather(kind WeatherKind, density f32, wind f32) Weather {
+	mut w := Weather{
+		density: density
+		wind: wind
+		particles: new_particle_system(1024)
+		rng: new_rng(0x5eed)
+	}
+	w.set_kind(kind)
+	return w
+}
+
+// Change the weather. Falling particles already on screen are dropped.
+pub fn (mut w Weather) set_kind(kind WeatherKind) {
+	w.kind = kind
+	w.particles.clear()
+	match kind {
+		.rain {
+			w.particles.shape = .streak
+			w.particles.fade_frames = 0
+			w.color = Color{170, 190, 230, 160}
+		}
+		.snow {
+			w.particles.shape = .square
+			w.particles.fade_frames = 20
+			w.color = Color{245, 245, 255, 220}
+		}
+		else {}
+	}
+}
+
+// Advance the effect a frame.
+pub fn (mut w Weather) update() {
+	w.ticks++
+	sw := f32(screen_width)
+	sh := f32(screen_height)
+	d := clampf(w.density, 0, 1)
+	match w.kind {
+		.rain {
+			// Spawn upwind by as far as a drop drifts while falling, so slanted
+			// rain still fills the screen.
+			drift := w.wind * sh / 7
+			for _ in 0 .. int(d * 12 + 0.5) {
+				vy := w.rng.f32_range(6, 8)
+				w.particles.emit(Particle{
+					x: w.rng.f32_range(0, sw) - drift
+					y: -8
+					vx: w.wind
+					vy: vy
+					life: int(sh / vy) + 2
+					size: 1
+					color: w.color
+				})
+			}
+		}
+		.snow {
+			for _ in 0 .. int(d * 3 + w.rng.next_f32()) {
+				vy := w.rng.f32_range(0.4, 1.1)
+				w.particles.emit(Particle{
+					x: w.rng.f32_range(-sw / 4, sw * 5 / 4)
+					y: -4
+					vy: vy
+					life: int(sh / vy) + 4
+					size: if w.rng.chance(0.3) { 2 } else { 1 }
+					color: w.color
+					phase: w.rng.f32_range(0, 2 * pi)
+				})
+			}
+			// Flakes drift with the wind and sway side to side.
+			for i in 0 .. w.particles.end() {
+				if !w.particles.is_alive(i) {
+					continue
+				}
+				mut p := w.particles.get(i)
+				p.vx = w.wind * 0.5 + sinf(f32(p.age) * 0.05 + p.phase) * 0.4
+			}
+		}
+		else {}
+	}
+	w.particles.update()
+}
+
+// Draw rain, snow or fog. Call after drawing the world. Heat haze isn't
+// drawn; see apply_to.
+pub fn (mut w Weather) draw() {
+	match w.kind {
+		.rain, .snow { w.particles.draw(0, 0) }
+		.fog { w.draw_fog() }
+		.heat_haze, .clear {}
+	}
+}
+
+fn (w &Weather) draw_fog() {
+	cell := max_int(2, w.fog_cell)
+	t := f32(w.ticks)
+	d := clampf(w.density, 0, 1)
+	seed := u32(0xf06)
+	for cy := 0; cy < int(screen_height); cy += cell {
+		for cx := 0; cx < int(screen_width); cx += cell {
+			// Two octaves drifting with the wind at different speeds.
+			n := fbm2(.value, seed, (f32(cx) - t * w.wind) * 0.01, f32(cy) * 0.015 + t * 0.001,
+				2, 0.5)
+			a := clampf((n * 0.5 + 0.5) * d * 1.5 - 0.2, 0, 1)
+			if a <= 0 {
+				continue
+			}
+			graphics_set_color_rgba(Color{w.fog_color.r, w.fog_color.g, w.fog_color.b, u8(f32(w.fog_color.a) * a)})
+			graphics_rect(cx, cy, u32(cell), u32(cell))
+		}
+	}
+}
+
+// Ripple the rows of scene for heat haze, in place. Does nothing for other
+// kinds of weather.
+pub fn (mut w Weather) apply_to(mut scene Image) {
+	if w.kind != .heat_haze || scene.width == 0 {
+		return
+	}
+	width := scene.width
+	stride := width * 4
+	if w.row.len != stride {
+		w.row = []u8{len: stride}
+	}
+	amp := clampf(w.density, 0, 1) * 3
+	t := f32(w.ticks) * 0.1
+	for y in 0 .. scene.height {
+		shift := int(sinf(f32(y) * 0.15 + t) * amp)
+		if shift == 0 {
+			continue
+		}
+		base := y * stride
+		for x in 0 .. width {
+			src := clamp_int(x - shift, 0, width - 1) * 4
+			for ch in 0 .. 4 {
+				w.row[x * 4 + ch] = scene.pixels[base + src + ch]
+			}
+		}
+		for i in 0 .. stride {
+			scene.pixels[base + i] = w.row[i]
+		}
+	}
+}
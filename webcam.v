@@ -0,0 +1,73 @@
+module wasm96
+
+// Camera (video capture) input, over libretro's camera interface.
+//
+// webcam_start asks for a resolution; the host opens the device at the
+// nearest size it supports and reports that back (packed as width << 32 |
+// height, like text measurement). Each wasm96_input_camera_read copies the
+// newest captured frame into the guest's buffer as RGBA and returns its
+// sequence number, so a frame is only processed when it is new.
+
+struct WebcamState {
+mut:
+	running bool
+	frame   Image
+	seq     u32
+}
+
+__global webcam WebcamState
+
+// Start capturing at about width x height. Returns false if the host has no
+// camera or couldn't open it.
+pub fn webcam_start(width int, height int) bool {
+	if !compat_require(.camera) {
+		return false
+	}
+	if !record_status(C.wasm96_input_camera_start(u32(width), u32(height))) {
+		return false
+	}
+	size := C.wasm96_input_camera_size()
+	webcam.frame = new_image(int(size >> 32), int(size & 0xFFFFFFFF))
+	webcam.seq = 0
+	webcam.running = true
+	return true
+}
+
+// Stop capturing and release the device.
+pub fn webcam_stop() {
+	if !webcam.running {
+		return
+	}
+	C.wasm96_input_camera_stop()
+	webcam.running = false
+}
+
+// Returns true while the camera is capturing.
+pub fn webcam_running() bool {
+	return webcam.running
+}
+
+// Get the resolution the host settled on.
+pub fn webcam_size() (int, int) {
+	return webcam.frame.width, webcam.frame.height
+}
+
+// Fetch the newest frame. Returns it if it arrived since the last call, or
+// none if there is nothing new (or the camera isn't running). The image is
+// reused for every frame; copy it to keep one.
+pub fn webcam_frame() ?&Image {
+	if !webcam.running || webcam.frame.pixels.len == 0 {
+		return none
+	}
+	seq := C.wasm96_input_camera_read(&webcam.frame.pixels[0], usize(webcam.frame.pixels.len))
+	if seq == 0 || seq == webcam.seq {
+		return none
+	}
+	webcam.seq = seq
+	return &webcam.frame
+}
+
+// Get the last frame fetched, new or not.
+pub fn webcam_last_frame() &Image {
+	return &webcam.frame
+}
@@ -0,0 +1,178 @@
+module wasm96
+
+// Minimal XML reader for asset formats (elements, attributes and text).
+
+struct XmlNode {
+	name string
+mut:
+	attrs    map[string]string
+	children []XmlNode
+	text     string
+}
+
+fn (n &XmlNode) attr(name string) string {
+	return n.attrs[name] or { '' }
+}
+
+fn (n &XmlNode) attr_int(name string, default int) int {
+	v := n.attrs[name] or { return default }
+	return v.int()
+}
+
+fn (n &XmlNode) attr_f32(name string, default f32) f32 {
+	v := n.attrs[name] or { return default }
+	return v.f32()
+}
+
+fn (n &XmlNode) child(name string) ?XmlNode {
+	for c in n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return none
+}
+
+fn (n &XmlNode) children_named(name string) []XmlNode {
+	return n.children.filter(it.name == name)
+}
+
+struct XmlParser {
+	src string
+mut:
+	pos int
+}
+
+fn xml_parse(src string) !XmlNode {
+	mut p := XmlParser{
+		src: src
+	}
+	for {
+		p.skip_space()
+		if p.pos >= p.src.len {
+			return error('xml: no root element')
+		}
+		if p.starts('<?') {
+			p.skip_past('?>')!
+		} else if p.starts('<!--') {
+			p.skip_past('-->')!
+		} else if p.starts('<!') {
+			p.skip_past('>')!
+		} else {
+			return p.element()
+		}
+	}
+	return error('xml: no root element')
+}
+
+fn xml_unescape(s string) string {
+	if !s.contains('&') {
+		return s
+	}
+	return s.replace_each(['&lt;', '<', '&gt;', '>', '&quot;', '"', '&apos;', "'", '&#10;', '\n',
+		'&amp;', '&'])
+}
+
+fn (p &XmlParser) starts(s string) bool {
+	if p.pos + s.len > p.src.len {
+		return false
+	}
+	for i in 0 .. s.len {
+		if p.src[p.pos + i] != s[i] {
+			return false
+		}
+	}
+	return true
+}
+
+fn (mut p XmlParser) skip_space() {
+	for p.pos < p.src.len && p.src[p.pos] in [` `, `\t`, `\n`, `\r`] {
+		p.pos++
+	}
+}
+
+fn (mut p XmlParser) skip_past(end string) ! {
+	i := p.src[p.pos..].index(end) or { return error('xml: missing ${end}') }
+	p.pos += i + end.len
+}
+
+fn (mut p XmlParser) name() string {
+	start := p.pos
+	for p.pos < p.src.len && p.src[p.pos] !in [` `, `\t`, `\n`, `\r`, `/`, `>`, `=`] {
+		p.pos++
+	}
+	return p.src[start..p.pos]
+}
+
+fn (mut p XmlParser) element() !XmlNode {
+	if !p.starts('<') {
+		return error('xml: expected element at ${p.pos}')
+	}
+	p.pos++
+	mut node := XmlNode{
+		name: p.name()
+	}
+	for {
+		p.skip_space()
+		if p.pos >= p.src.len {
+			return error('xml: unterminated <${node.name}>')
+		}
+		if p.starts('/>') {
+			p.pos += 2
+			return node
+		}
+		if p.starts('>') {
+			p.pos++
+			break
+		}
+		key := p.name()
+		p.skip_space()
+		if !p.starts('=') {
+			return error('xml: expected = after ${key}')
+		}
+		p.pos++
+		p.skip_space()
+		if p.pos >= p.src.len {
+			return error('xml: unterminated attribute ${key}')
+		}
+		quote := p.src[p.pos]
+		if quote != `"` && quote != `'` {
+			return error('xml: unquoted attribute ${key}')
+		}
+		len := p.src[p.pos + 1..].index(quote.ascii_str()) or {
+			return error('xml: unterminated attribute ${key}')
+		}
+		node.attrs[key] = xml_unescape(p.src[p.pos + 1..p.pos + 1 + len])
+		p.pos += len + 2
+	}
+	for {
+		if p.pos >= p.src.len {
+			return error('xml: unterminated <${node.name}>')
+		}
+		if p.starts('</') {
+			p.pos += 2
+			closing := p.name()
+			if closing != node.name {
+				return error('xml: </${closing}> closes <${node.name}>')
+			}
+			p.skip_past('>')!
+			return node
+		}
+		if p.starts('<!--') {
+			p.skip_past('-->')!
+		} else if p.starts('<![CDATA[') {
+			start := p.pos + 9
+			p.skip_past(']]>')!
+			node.text += p.src[start..p.pos - 3]
+		} else if p.starts('<') {
+			node.children << p.element()!
+		} else {
+			start := p.pos
+			for p.pos < p.src.len && p.src[p.pos] != `<` {
+				p.pos++
+			}
+			node.text += xml_unescape(p.src[start..p.pos])
+		}
+	}
+	return node
+}